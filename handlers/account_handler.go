@@ -1,6 +1,7 @@
 package handlers
 
 import (
+	"errors"
 	"net/http"
 
 	"asset-dairy/models"
@@ -32,10 +33,12 @@ func (h *AccountHandler) ListAccounts(c *gin.Context) {
 	responses := make([]models.AccountResponse, len(accounts))
 	for i, acc := range accounts {
 		responses[i] = models.AccountResponse{
-			ID:       acc.ID,
-			Name:     acc.Name,
-			Currency: acc.Currency,
-			Balance:  acc.Balance,
+			ID:              acc.ID,
+			Name:            acc.Name,
+			Currency:        acc.Currency,
+			Balance:         acc.Balance,
+			CostBasisMethod: acc.CostBasisMethod,
+			AllowShort:      acc.AllowShort,
 		}
 	}
 	c.JSON(http.StatusOK, responses)
@@ -59,10 +62,12 @@ func (h *AccountHandler) CreateAccount(c *gin.Context) {
 		return
 	}
 	response := models.AccountResponse{
-		ID:       acc.ID,
-		Name:     acc.Name,
-		Currency: acc.Currency,
-		Balance:  acc.Balance,
+		ID:              acc.ID,
+		Name:            acc.Name,
+		Currency:        acc.Currency,
+		Balance:         acc.Balance,
+		CostBasisMethod: acc.CostBasisMethod,
+		AllowShort:      acc.AllowShort,
 	}
 	c.JSON(http.StatusCreated, response)
 }
@@ -82,14 +87,20 @@ func (h *AccountHandler) UpdateAccount(c *gin.Context) {
 	}
 	acc, err := h.AccountService.UpdateAccount(userID.(string), accID, req)
 	if err != nil {
+		if errors.Is(err, services.ErrAccountCurrencyLocked) || errors.Is(err, services.ErrAccountShortLocked) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update account"})
 		return
 	}
 	response := models.AccountResponse{
-		ID:       acc.ID,
-		Name:     acc.Name,
-		Currency: acc.Currency,
-		Balance:  acc.Balance,
+		ID:              acc.ID,
+		Name:            acc.Name,
+		Currency:        acc.Currency,
+		Balance:         acc.Balance,
+		CostBasisMethod: acc.CostBasisMethod,
+		AllowShort:      acc.AllowShort,
 	}
 	c.JSON(http.StatusOK, response)
 }
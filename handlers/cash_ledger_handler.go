@@ -0,0 +1,119 @@
+package handlers
+
+import (
+	"asset-dairy/models"
+	"asset-dairy/services"
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+type CashLedgerHandler struct {
+	cashLedgerService services.CashLedgerServiceInterface
+}
+
+func NewCashLedgerHandler(cashLedgerService services.CashLedgerServiceInterface) *CashLedgerHandler {
+	return &CashLedgerHandler{
+		cashLedgerService: cashLedgerService,
+	}
+}
+
+// ListEntries handles GET /accounts/:id/ledger
+func (h *CashLedgerHandler) ListEntries(c *gin.Context) {
+	userID, ok := c.Get("user_id")
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+		return
+	}
+
+	entries, err := h.cashLedgerService.ListEntries(userID.(string), c.Param("id"))
+	if err != nil {
+		respondCashLedgerError(c, err, "Failed to fetch cash ledger")
+		return
+	}
+	c.JSON(http.StatusOK, entries)
+}
+
+// CreateEntry handles POST /accounts/:id/ledger for fees and interest
+func (h *CashLedgerHandler) CreateEntry(c *gin.Context) {
+	userID, ok := c.Get("user_id")
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+		return
+	}
+	var req models.CashLedgerEntryCreateRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	entry, err := h.cashLedgerService.CreateEntry(userID.(string), c.Param("id"), req)
+	if err != nil {
+		respondCashLedgerError(c, err, "Failed to create cash entry")
+		return
+	}
+	c.JSON(http.StatusCreated, entry)
+}
+
+// Deposit handles POST /accounts/:id/deposits
+func (h *CashLedgerHandler) Deposit(c *gin.Context) {
+	h.recordMovement(c, h.cashLedgerService.Deposit)
+}
+
+// Withdraw handles POST /accounts/:id/withdrawals
+func (h *CashLedgerHandler) Withdraw(c *gin.Context) {
+	h.recordMovement(c, h.cashLedgerService.Withdraw)
+}
+
+func (h *CashLedgerHandler) recordMovement(c *gin.Context, record func(userID, accountID string, req models.CashMovementRequest) (*models.CashLedgerEntry, error)) {
+	userID, ok := c.Get("user_id")
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+		return
+	}
+	var req models.CashMovementRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	entry, err := record(userID.(string), c.Param("id"), req)
+	if err != nil {
+		respondCashLedgerError(c, err, "Failed to record cash movement")
+		return
+	}
+	c.JSON(http.StatusCreated, entry)
+}
+
+// Transfer handles POST /transfers between two of the user's accounts
+func (h *CashLedgerHandler) Transfer(c *gin.Context) {
+	userID, ok := c.Get("user_id")
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+		return
+	}
+	var req models.CashTransferRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	transfer, err := h.cashLedgerService.Transfer(userID.(string), req)
+	if err != nil {
+		respondCashLedgerError(c, err, "Failed to record transfer")
+		return
+	}
+	c.JSON(http.StatusCreated, transfer)
+}
+
+func respondCashLedgerError(c *gin.Context, err error, message string) {
+	switch {
+	case errors.Is(err, services.ErrAccountNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": "Account not found"})
+	case errors.Is(err, services.ErrInvalidCashEntry), errors.Is(err, services.ErrInvalidTransfer):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": message})
+	}
+}
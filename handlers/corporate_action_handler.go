@@ -0,0 +1,88 @@
+package handlers
+
+import (
+	"asset-dairy/models"
+	"asset-dairy/services"
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+type CorporateActionHandler struct {
+	actionService services.CorporateActionServiceInterface
+}
+
+func NewCorporateActionHandler(actionService services.CorporateActionServiceInterface) *CorporateActionHandler {
+	return &CorporateActionHandler{
+		actionService: actionService,
+	}
+}
+
+// ListActions handles GET /corporate-actions, optionally filtered by ?ticker=
+func (h *CorporateActionHandler) ListActions(c *gin.Context) {
+	actions, err := h.actionService.ListActions(c.Query("ticker"))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch corporate actions"})
+		return
+	}
+	c.JSON(http.StatusOK, actions)
+}
+
+// CreateAction handles POST /admin/corporate-actions
+func (h *CorporateActionHandler) CreateAction(c *gin.Context) {
+	var req models.CorporateActionCreateRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	action, err := h.actionService.CreateAction(req)
+	if err != nil {
+		respondCorporateActionError(c, err, "Failed to create corporate action")
+		return
+	}
+	c.JSON(http.StatusCreated, action)
+}
+
+// UpdateAction handles PUT /admin/corporate-actions/:id, replacing the whole action
+func (h *CorporateActionHandler) UpdateAction(c *gin.Context) {
+	var req models.CorporateActionCreateRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	action, err := h.actionService.UpdateAction(c.Param("id"), req)
+	if err != nil {
+		respondCorporateActionError(c, err, "Failed to update corporate action")
+		return
+	}
+	c.JSON(http.StatusOK, action)
+}
+
+// DeleteAction handles DELETE /admin/corporate-actions/:id
+func (h *CorporateActionHandler) DeleteAction(c *gin.Context) {
+	id := c.Param("id")
+	deleted, err := h.actionService.DeleteAction(id)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete corporate action"})
+		return
+	}
+	if !deleted {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Corporate action not found"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"id": id, "deleted": true})
+}
+
+func respondCorporateActionError(c *gin.Context, err error, message string) {
+	switch {
+	case errors.Is(err, services.ErrCorporateActionNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": "Corporate action not found"})
+	case errors.Is(err, services.ErrInvalidCorporateAction):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": message})
+	}
+}
@@ -0,0 +1,33 @@
+package handlers
+
+import (
+	"asset-dairy/services"
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+type FxHandler struct {
+	fxService services.FxServiceInterface
+}
+
+func NewFxHandler(fxService services.FxServiceInterface) *FxHandler {
+	return &FxHandler{
+		fxService: fxService,
+	}
+}
+
+// UploadRates handles POST /admin/fx-rates with a text/csv body of date,base,quote,rate rows
+func (h *FxHandler) UploadRates(c *gin.Context) {
+	count, err := h.fxService.ImportCSV(c.Request.Body)
+	if err != nil {
+		if errors.Is(err, services.ErrInvalidFxUpload) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to store fx rates"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"imported": count})
+}
@@ -1,8 +1,12 @@
 package handlers
 
 import (
+	"asset-dairy/models"
 	"asset-dairy/services"
+	"errors"
 	"net/http"
+	"strconv"
+	"time"
 
 	"github.com/gin-gonic/gin"
 )
@@ -17,19 +21,170 @@ func NewHoldingHandler(holdingService services.HoldingServiceInterface) *Holding
 	}
 }
 
-// ListHoldings handles GET /holdings
+// ListHoldings handles GET /holdings. With ?groupBy=account it returns the positions of each
+// account, matched within the account and with their open lots. ?asOf= replays the trades up
+// to that date, valued at its closes with ?valuation=close.
 func (h *HoldingHandler) ListHoldings(c *gin.Context) {
 	userID, ok := c.Get("user_id")
 	if !ok {
 		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
 		return
 	}
+	query, ok := bindHoldingsQuery(c)
+	if !ok {
+		return
+	}
+
+	if groupBy := c.Query("groupBy"); groupBy != "" {
+		if groupBy != "account" {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid groupBy, use account"})
+			return
+		}
+		grouped, err := h.holdingService.ListHoldingsByAccount(userID.(string), query)
+		if err != nil {
+			respondHoldingsError(c, err)
+			return
+		}
+		c.JSON(http.StatusOK, grouped)
+		return
+	}
 
-	holdings, err := h.holdingService.ListHoldings(userID.(string))
+	holdings, err := h.holdingService.ListHoldingsAsOf(userID.(string), query)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		respondHoldingsError(c, err)
 		return
 	}
 
 	c.JSON(http.StatusOK, holdings)
 }
+
+// ListAccountHoldings handles GET /accounts/:id/holdings, taking the same ?asOf= and
+// ?valuation= parameters as GET /holdings
+func (h *HoldingHandler) ListAccountHoldings(c *gin.Context) {
+	userID, ok := c.Get("user_id")
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+		return
+	}
+	query, ok := bindHoldingsQuery(c)
+	if !ok {
+		return
+	}
+
+	holdings, err := h.holdingService.GetAccountHoldings(userID.(string), c.Param("id"), query)
+	if err != nil {
+		if errors.Is(err, services.ErrAccountNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Account not found"})
+			return
+		}
+		respondHoldingsError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, holdings)
+}
+
+// DiffHoldings handles GET /holdings/diff?from=&to=, comparing the positions held at the end
+// of the two dates
+func (h *HoldingHandler) DiffHoldings(c *gin.Context) {
+	userID, ok := c.Get("user_id")
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+		return
+	}
+
+	var from, to time.Time
+	for param, target := range map[string]*time.Time{"from": &from, "to": &to} {
+		parsed, err := time.Parse("2006-01-02", c.Query(param))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid " + param + " date, use YYYY-MM-DD"})
+			return
+		}
+		*target = parsed
+	}
+
+	diff, err := h.holdingService.DiffHoldings(userID.(string), from, to)
+	if err != nil {
+		respondHoldingsError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, diff)
+}
+
+// bindHoldingsQuery reads the ?asOf= and ?valuation= parameters, responding with a 400 and
+// returning false when they are invalid
+func bindHoldingsQuery(c *gin.Context) (models.HoldingsQuery, bool) {
+	query := models.HoldingsQuery{}
+	if asOfParam := c.Query("asOf"); asOfParam != "" {
+		asOf, err := time.Parse("2006-01-02", asOfParam)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid asOf date, use YYYY-MM-DD"})
+			return query, false
+		}
+		query.AsOf = &asOf
+	}
+	switch c.Query("valuation") {
+	case "":
+	case "close":
+		if query.AsOf == nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "valuation=close requires asOf"})
+			return query, false
+		}
+		query.PriceAtClose = true
+	default:
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid valuation, use close"})
+		return query, false
+	}
+	return query, true
+}
+
+func respondHoldingsError(c *gin.Context, err error) {
+	if errors.Is(err, services.ErrInvalidHoldingsQuery) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+}
+
+// ListRealizedGains handles GET /holdings/realized, optionally filtered by ?year= of the
+// date the position was closed (the sell, or the covering buy of a short)
+func (h *HoldingHandler) ListRealizedGains(c *gin.Context) {
+	userID, ok := c.Get("user_id")
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+		return
+	}
+
+	year := 0
+	if yearParam := c.Query("year"); yearParam != "" {
+		parsed, err := strconv.Atoi(yearParam)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid year"})
+			return
+		}
+		year = parsed
+	}
+
+	gains, err := h.holdingService.ListRealizedGains(userID.(string))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	if year != 0 {
+		filtered := []models.RealizedGain{}
+		for _, gain := range gains {
+			closedOn := gain.SellDate
+			if gain.Short {
+				closedOn = gain.BuyDate
+			}
+			if closedOn.Year() == year {
+				filtered = append(filtered, gain)
+			}
+		}
+		gains = filtered
+	}
+
+	c.JSON(http.StatusOK, gains)
+}
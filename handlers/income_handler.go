@@ -0,0 +1,154 @@
+package handlers
+
+import (
+	"asset-dairy/models"
+	"asset-dairy/services"
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+)
+
+type IncomeHandler struct {
+	incomeService services.IncomeServiceInterface
+}
+
+func NewIncomeHandler(incomeService services.IncomeServiceInterface) *IncomeHandler {
+	return &IncomeHandler{
+		incomeService: incomeService,
+	}
+}
+
+// ListEvents handles GET /income, optionally filtered by ?year= of the pay date and ?ticker=
+func (h *IncomeHandler) ListEvents(c *gin.Context) {
+	userID, ok := c.Get("user_id")
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+		return
+	}
+	year, ok := yearQuery(c)
+	if !ok {
+		return
+	}
+
+	events, err := h.incomeService.ListEvents(userID.(string), year, c.Query("ticker"))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch income events"})
+		return
+	}
+	c.JSON(http.StatusOK, events)
+}
+
+// CreateEvent handles POST /income
+func (h *IncomeHandler) CreateEvent(c *gin.Context) {
+	userID, ok := c.Get("user_id")
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+		return
+	}
+	var req models.IncomeEventCreateRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	event, err := h.incomeService.CreateEvent(userID.(string), req)
+	if err != nil {
+		respondIncomeError(c, err, "Failed to create income event")
+		return
+	}
+	c.JSON(http.StatusCreated, event)
+}
+
+// UpdateEvent handles PUT /income/:id
+func (h *IncomeHandler) UpdateEvent(c *gin.Context) {
+	userID, ok := c.Get("user_id")
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+		return
+	}
+	var req models.IncomeEventUpdateRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	event, err := h.incomeService.UpdateEvent(userID.(string), c.Param("id"), req)
+	if err != nil {
+		respondIncomeError(c, err, "Failed to update income event")
+		return
+	}
+	c.JSON(http.StatusOK, event)
+}
+
+// DeleteEvent handles DELETE /income/:id
+func (h *IncomeHandler) DeleteEvent(c *gin.Context) {
+	userID, ok := c.Get("user_id")
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+		return
+	}
+	id := c.Param("id")
+	deleted, err := h.incomeService.DeleteEvent(userID.(string), id)
+	if err != nil {
+		if services.IsTradeValidationError(err) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete income event"})
+		return
+	}
+	if !deleted {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Income event not found"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"id": id, "deleted": true})
+}
+
+// GetSummary handles GET /income/summary?groupBy=ticker|year&year=&currency=
+func (h *IncomeHandler) GetSummary(c *gin.Context) {
+	userID, ok := c.Get("user_id")
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+		return
+	}
+	year, ok := yearQuery(c)
+	if !ok {
+		return
+	}
+
+	summary, err := h.incomeService.GetSummary(userID.(string), c.Query("currency"), c.Query("groupBy"), year)
+	if err != nil {
+		respondIncomeError(c, err, "Failed to summarize income")
+		return
+	}
+	c.JSON(http.StatusOK, summary)
+}
+
+// yearQuery parses the optional ?year= parameter, responding with 400 when it is not a number
+func yearQuery(c *gin.Context) (int, bool) {
+	yearParam := c.Query("year")
+	if yearParam == "" {
+		return 0, true
+	}
+	year, err := strconv.Atoi(yearParam)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid year"})
+		return 0, false
+	}
+	return year, true
+}
+
+func respondIncomeError(c *gin.Context, err error, message string) {
+	switch {
+	case errors.Is(err, services.ErrIncomeEventNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": "Income event not found"})
+	case errors.Is(err, services.ErrAccountNotFound):
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid or unauthorized accountId"})
+	case errors.Is(err, services.ErrInvalidIncomeEvent), errors.Is(err, services.ErrFxRateNotFound), services.IsTradeValidationError(err):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": message})
+	}
+}
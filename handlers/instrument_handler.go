@@ -0,0 +1,99 @@
+package handlers
+
+import (
+	"asset-dairy/models"
+	"asset-dairy/services"
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+type InstrumentHandler struct {
+	instrumentService services.InstrumentServiceInterface
+}
+
+func NewInstrumentHandler(instrumentService services.InstrumentServiceInterface) *InstrumentHandler {
+	return &InstrumentHandler{
+		instrumentService: instrumentService,
+	}
+}
+
+// SearchInstruments handles GET /instruments?q=
+func (h *InstrumentHandler) SearchInstruments(c *gin.Context) {
+	instruments, err := h.instrumentService.SearchInstruments(c.Query("q"))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to search instruments"})
+		return
+	}
+	c.JSON(http.StatusOK, instruments)
+}
+
+// GetInstrument handles GET /instruments/:id
+func (h *InstrumentHandler) GetInstrument(c *gin.Context) {
+	instrument, err := h.instrumentService.GetInstrument(c.Param("id"))
+	if err != nil {
+		respondInstrumentError(c, err, "Failed to fetch instrument")
+		return
+	}
+	c.JSON(http.StatusOK, instrument)
+}
+
+// CreateInstrument handles POST /admin/instruments
+func (h *InstrumentHandler) CreateInstrument(c *gin.Context) {
+	var req models.InstrumentCreateRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	instrument, err := h.instrumentService.CreateInstrument(req)
+	if err != nil {
+		respondInstrumentError(c, err, "Failed to create instrument")
+		return
+	}
+	c.JSON(http.StatusCreated, instrument)
+}
+
+// UpdateInstrument handles PUT /admin/instruments/:id, replacing the whole instrument
+func (h *InstrumentHandler) UpdateInstrument(c *gin.Context) {
+	var req models.InstrumentCreateRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	instrument, err := h.instrumentService.UpdateInstrument(c.Param("id"), req)
+	if err != nil {
+		respondInstrumentError(c, err, "Failed to update instrument")
+		return
+	}
+	c.JSON(http.StatusOK, instrument)
+}
+
+// DeleteInstrument handles DELETE /admin/instruments/:id. Trades keep their ticker and lose
+// the link to the instrument.
+func (h *InstrumentHandler) DeleteInstrument(c *gin.Context) {
+	id := c.Param("id")
+	deleted, err := h.instrumentService.DeleteInstrument(id)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete instrument"})
+		return
+	}
+	if !deleted {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Instrument not found"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"id": id, "deleted": true})
+}
+
+func respondInstrumentError(c *gin.Context, err error, message string) {
+	switch {
+	case errors.Is(err, services.ErrInstrumentNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": "Instrument not found"})
+	case errors.Is(err, services.ErrInvalidInstrument):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": message})
+	}
+}
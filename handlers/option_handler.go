@@ -0,0 +1,70 @@
+package handlers
+
+import (
+	"asset-dairy/models"
+	"asset-dairy/services"
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+type OptionHandler struct {
+	optionService services.OptionServiceInterface
+}
+
+func NewOptionHandler(optionService services.OptionServiceInterface) *OptionHandler {
+	return &OptionHandler{
+		optionService: optionService,
+	}
+}
+
+// ListPositions handles GET /holdings/options
+func (h *OptionHandler) ListPositions(c *gin.Context) {
+	userID, ok := c.Get("user_id")
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+		return
+	}
+
+	positions, err := h.optionService.ListPositions(userID.(string))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch option positions"})
+		return
+	}
+	c.JSON(http.StatusOK, positions)
+}
+
+// SettleOption handles POST /holdings/options/:instrumentId/settle and responds with the
+// trades it recorded
+func (h *OptionHandler) SettleOption(c *gin.Context) {
+	userID, ok := c.Get("user_id")
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+		return
+	}
+	var req models.OptionSettlementRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	trades, err := h.optionService.SettleOption(userID.(string), c.Param("instrumentId"), req)
+	if err != nil {
+		switch {
+		case errors.Is(err, services.ErrInstrumentNotFound):
+			c.JSON(http.StatusNotFound, gin.H{"error": "Instrument not found"})
+		case errors.Is(err, services.ErrInvalidOptionSettlement) || services.IsTradeValidationError(err):
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		default:
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to settle option"})
+		}
+		return
+	}
+
+	responses := make([]models.TradeResponse, 0, len(trades))
+	for _, trade := range trades {
+		responses = append(responses, newTradeResponse(trade))
+	}
+	c.JSON(http.StatusCreated, responses)
+}
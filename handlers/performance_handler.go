@@ -0,0 +1,61 @@
+package handlers
+
+import (
+	"asset-dairy/models"
+	"asset-dairy/services"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+type PerformanceHandler struct {
+	performanceService services.PerformanceServiceInterface
+}
+
+func NewPerformanceHandler(performanceService services.PerformanceServiceInterface) *PerformanceHandler {
+	return &PerformanceHandler{
+		performanceService: performanceService,
+	}
+}
+
+// GetPerformance handles GET /performance with either ?period= (MTD, QTD, YTD, 1Y, inception)
+// or a ?from=&to= range in YYYY-MM-DD. Without either it reports since inception.
+func (h *PerformanceHandler) GetPerformance(c *gin.Context) {
+	userID, ok := c.Get("user_id")
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+		return
+	}
+
+	var from, to time.Time
+	for param, target := range map[string]*time.Time{"from": &from, "to": &to} {
+		value := c.Query(param)
+		if value == "" {
+			continue
+		}
+		parsed, err := time.Parse("2006-01-02", value)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid " + param + " date, use YYYY-MM-DD"})
+			return
+		}
+		*target = parsed
+	}
+	period := c.Query("period")
+	if period == "" && from.IsZero() && to.IsZero() {
+		period = models.PerformancePeriodInception
+	}
+
+	report, err := h.performanceService.GetPerformance(userID.(string), c.Query("currency"), period, from, to)
+	if err != nil {
+		if errors.Is(err, services.ErrInvalidPerformancePeriod) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, report)
+}
@@ -0,0 +1,97 @@
+package handlers
+
+import (
+	"asset-dairy/services"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+type PortfolioHandler struct {
+	portfolioService services.PortfolioServiceInterface
+	snapshotService  services.SnapshotServiceInterface
+}
+
+func NewPortfolioHandler(portfolioService services.PortfolioServiceInterface, snapshotService services.SnapshotServiceInterface) *PortfolioHandler {
+	return &PortfolioHandler{
+		portfolioService: portfolioService,
+		snapshotService:  snapshotService,
+	}
+}
+
+// GetOverview handles GET /portfolio, reporting in ?currency= or the profile's default currency
+func (h *PortfolioHandler) GetOverview(c *gin.Context) {
+	userID, ok := c.Get("user_id")
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+		return
+	}
+
+	overview, err := h.portfolioService.GetOverview(userID.(string), c.Query("currency"))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, overview)
+}
+
+// GetSummary handles GET /portfolio/summary, reporting in ?currency= or the profile's default currency
+func (h *PortfolioHandler) GetSummary(c *gin.Context) {
+	userID, ok := c.Get("user_id")
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+		return
+	}
+
+	totals, err := h.portfolioService.GetTotals(userID.(string), c.Query("currency"))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, totals)
+}
+
+// GetHistory handles GET /portfolio/history?from=&to=&granularity=&accountId= from the daily
+// snapshots. The range defaults to the year up to today, the granularity to day.
+func (h *PortfolioHandler) GetHistory(c *gin.Context) {
+	userID, ok := c.Get("user_id")
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+		return
+	}
+
+	to := time.Now()
+	if toParam := c.Query("to"); toParam != "" {
+		parsed, err := time.Parse("2006-01-02", toParam)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid to date, use YYYY-MM-DD"})
+			return
+		}
+		to = parsed
+	}
+	from := to.AddDate(-1, 0, 0)
+	if fromParam := c.Query("from"); fromParam != "" {
+		parsed, err := time.Parse("2006-01-02", fromParam)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid from date, use YYYY-MM-DD"})
+			return
+		}
+		from = parsed
+	}
+
+	points, err := h.snapshotService.GetHistory(userID.(string), c.Query("accountId"), from, to, c.Query("granularity"))
+	if err != nil {
+		if errors.Is(err, services.ErrInvalidHistoryQuery) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, points)
+}
@@ -0,0 +1,110 @@
+package handlers
+
+import (
+	"asset-dairy/models"
+	"asset-dairy/services"
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+type PriceHandler struct {
+	priceService        services.PriceServiceInterface
+	priceHistoryService services.PriceHistoryServiceInterface
+}
+
+func NewPriceHandler(priceService services.PriceServiceInterface, priceHistoryService services.PriceHistoryServiceInterface) *PriceHandler {
+	return &PriceHandler{
+		priceService:        priceService,
+		priceHistoryService: priceHistoryService,
+	}
+}
+
+// ListPrices handles GET /prices
+func (h *PriceHandler) ListPrices(c *gin.Context) {
+	prices, err := h.priceService.ListPrices()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch prices"})
+		return
+	}
+	c.JSON(http.StatusOK, prices)
+}
+
+// UploadPrices handles POST /admin/prices with either a JSON array of quotes or a text/csv body
+func (h *PriceHandler) UploadPrices(c *gin.Context) {
+	var (
+		count int
+		err   error
+	)
+	if strings.HasPrefix(c.ContentType(), "text/csv") {
+		count, err = h.priceService.UploadPricesCSV(c.Request.Body)
+	} else {
+		var reqs []models.PriceUploadRequest
+		if bindErr := c.ShouldBindJSON(&reqs); bindErr != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": bindErr.Error()})
+			return
+		}
+		count, err = h.priceService.UploadPrices(reqs)
+	}
+	if err != nil {
+		if errors.Is(err, services.ErrInvalidPriceUpload) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to store prices"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"imported": count})
+}
+
+// GetPriceHistory handles GET /prices/:ticker?from=&to= (YYYY-MM-DD). The range defaults
+// to the year up to today.
+func (h *PriceHandler) GetPriceHistory(c *gin.Context) {
+	to := time.Now()
+	if toParam := c.Query("to"); toParam != "" {
+		parsed, err := time.Parse("2006-01-02", toParam)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid to date, use YYYY-MM-DD"})
+			return
+		}
+		to = parsed
+	}
+	from := to.AddDate(-1, 0, 0)
+	if fromParam := c.Query("from"); fromParam != "" {
+		parsed, err := time.Parse("2006-01-02", fromParam)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid from date, use YYYY-MM-DD"})
+			return
+		}
+		from = parsed
+	}
+
+	series, err := h.priceHistoryService.GetSeries(c.Param("ticker"), from, to)
+	if err != nil {
+		if errors.Is(err, services.ErrInvalidPriceRange) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch price history"})
+		return
+	}
+	c.JSON(http.StatusOK, series)
+}
+
+// UploadPriceHistory handles POST /admin/prices/history with a text/csv body of daily bars.
+// The ticker, currency and assetType query parameters apply to rows without those columns.
+func (h *PriceHandler) UploadPriceHistory(c *gin.Context) {
+	count, err := h.priceHistoryService.ImportCSV(c.Request.Body, c.Query("ticker"), c.Query("currency"), c.Query("assetType"))
+	if err != nil {
+		if errors.Is(err, services.ErrInvalidPriceUpload) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to store price history"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"imported": count})
+}
@@ -49,6 +49,7 @@ func (h *ProfileHandler) GetProfile(c *gin.Context) {
 				YearsInvesting:                       profile.InvestmentProfile.YearsInvesting,
 				MonthlyCashFlow:                      profile.InvestmentProfile.MonthlyCashFlow,
 				DefaultCurrency:                      profile.InvestmentProfile.DefaultCurrency,
+				CostBasisMethod:                      profile.InvestmentProfile.CostBasisMethod,
 			},
 		})
 	} else {
@@ -115,6 +116,7 @@ func (h *ProfileHandler) UpdateProfile(c *gin.Context) {
 			YearsInvesting:                       profile.InvestmentProfile.YearsInvesting,
 			MonthlyCashFlow:                      profile.InvestmentProfile.MonthlyCashFlow,
 			DefaultCurrency:                      profile.InvestmentProfile.DefaultCurrency,
+			CostBasisMethod:                      profile.InvestmentProfile.CostBasisMethod,
 		},
 	})
 }
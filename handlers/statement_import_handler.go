@@ -0,0 +1,113 @@
+package handlers
+
+import (
+	"asset-dairy/models"
+	"asset-dairy/services"
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+)
+
+type StatementImportHandler struct {
+	importService services.StatementImportServiceInterface
+}
+
+func NewStatementImportHandler(importService services.StatementImportServiceInterface) *StatementImportHandler {
+	return &StatementImportHandler{
+		importService: importService,
+	}
+}
+
+// ImportOFX handles POST /imports/ofx with a multipart/form-data upload of an OFX or QFX
+// statement in "file" and the account to import it into in "accountId". The transactions are
+// only previewed unless ?commit=true; those imported before are reported as duplicates.
+func (h *StatementImportHandler) ImportOFX(c *gin.Context) {
+	userID, ok := c.Get("user_id")
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+		return
+	}
+	commit, err := strconv.ParseBool(c.DefaultQuery("commit", "false"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid commit, use true or false"})
+		return
+	}
+	accountID := c.PostForm("accountId")
+	if accountID == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Missing accountId"})
+		return
+	}
+	fileHeader, err := c.FormFile("file")
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Missing file"})
+		return
+	}
+	file, err := fileHeader.Open()
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Unreadable file"})
+		return
+	}
+	defer file.Close()
+
+	result, err := h.importService.ImportOFX(userID.(string), accountID, file, commit)
+	if err != nil {
+		respondStatementImportError(c, err, "Failed to import statement")
+		return
+	}
+	status := http.StatusOK
+	if result.Committed {
+		status = http.StatusCreated
+	}
+	c.JSON(status, newStatementImportResponse(*result))
+}
+
+// newStatementImportResponse builds the response body of an import, counting the new,
+// duplicate and invalid rows
+func newStatementImportResponse(result models.StatementImportResult) models.StatementImportResponse {
+	response := models.StatementImportResponse{
+		AccountID: result.AccountID,
+		Rows:      make([]models.StatementImportRowResponse, 0, len(result.Rows)),
+		Committed: result.Committed,
+	}
+	for _, row := range result.Rows {
+		rowResponse := models.StatementImportRowResponse{
+			FITID:       row.FITID,
+			Type:        row.Type,
+			Date:        row.Date,
+			CashEntry:   row.CashEntry,
+			IncomeEvent: row.IncomeEvent,
+			Duplicate:   row.Duplicate,
+			Errors:      row.Errors,
+		}
+		if row.Trade != nil {
+			trade := newTradeResponse(*row.Trade)
+			rowResponse.Trade = &trade
+		}
+		switch {
+		case len(row.Errors) > 0:
+			response.InvalidRows++
+		case row.Duplicate:
+			rowResponse.Errors = []string{}
+			response.DuplicateRows++
+		default:
+			rowResponse.Errors = []string{}
+			response.ValidRows++
+		}
+		response.Rows = append(response.Rows, rowResponse)
+	}
+	return response
+}
+
+func respondStatementImportError(c *gin.Context, err error, message string) {
+	switch {
+	case errors.Is(err, services.ErrAccountNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": "Account not found"})
+	case errors.Is(err, services.ErrInvalidStatement) || errors.Is(err, services.ErrInvalidCashEntry) ||
+		errors.Is(err, services.ErrInvalidIncomeEvent) || services.IsTradeValidationError(err):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": message})
+	}
+}
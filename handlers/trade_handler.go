@@ -1,7 +1,9 @@
 package handlers
 
 import (
+	"errors"
 	"net/http"
+	"strconv"
 	"time"
 
 	"asset-dairy/models"
@@ -37,18 +39,7 @@ func (h *TradeHandler) ListTrades(c *gin.Context) {
 
 	var tradeResponses []models.TradeResponse
 	for _, trade := range trades {
-		tradeResponses = append(tradeResponses, models.TradeResponse{
-			ID:        trade.ID,
-			Type:      trade.Type,
-			AssetType: trade.AssetType,
-			Ticker:    trade.Ticker,
-			TradeDate: trade.TradeDate,
-			Quantity:  trade.Quantity,
-			Price:     trade.Price,
-			Currency:  trade.Currency,
-			AccountID: trade.AccountID,
-			Reason:    trade.Reason,
-		})
+		tradeResponses = append(tradeResponses, newTradeResponse(trade))
 	}
 
 	c.JSON(http.StatusOK, tradeResponses)
@@ -78,34 +69,38 @@ func (h *TradeHandler) CreateTrade(c *gin.Context) {
 		return
 	}
 	trade := models.Trade{
-		ID:        uuid.New().String(),
-		Type:      req.Type,
-		AssetType: req.AssetType,
-		Ticker:    req.Ticker,
-		TradeDate: tradeDate,
-		Quantity:  req.Quantity,
-		Price:     req.Price,
-		Currency:  req.Currency,
-		AccountID: req.AccountID,
-		Reason:    req.Reason,
-	}
-	if err := h.service.CreateTrade(userID.(string), trade); err != nil {
+		ID:          uuid.New().String(),
+		Type:        req.Type,
+		AssetType:   req.AssetType,
+		Ticker:      req.Ticker,
+		TradeDate:   tradeDate,
+		Quantity:    req.Quantity,
+		Price:       req.Price,
+		Currency:    req.Currency,
+		AccountID:   req.AccountID,
+		Reason:      req.Reason,
+		Fee:         req.Fee,
+		FeeCurrency: req.FeeCurrency,
+		Tax:         req.Tax,
+		TaxCurrency: req.TaxCurrency,
+	}
+	trade.InstrumentID = req.InstrumentID
+	if req.Multiplier != nil {
+		trade.Multiplier = *req.Multiplier
+	}
+	trade.PositionEffect = req.PositionEffect
+	trade.SettlementRate = req.SettlementRate
+	trade.LotAllocations = services.NewLotAllocations(trade.ID, req.LotAllocations)
+	createdTrade, err := h.service.CreateTrade(userID.(string), trade)
+	if err != nil {
+		if services.IsTradeValidationError(err) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create trade"})
 		return
 	}
-	tradeResponse := models.TradeResponse{
-		ID:        trade.ID,
-		Type:      trade.Type,
-		AssetType: trade.AssetType,
-		Ticker:    trade.Ticker,
-		TradeDate: trade.TradeDate,
-		Quantity:  trade.Quantity,
-		Price:     trade.Price,
-		Currency:  trade.Currency,
-		AccountID: trade.AccountID,
-		Reason:    trade.Reason,
-	}
-	c.JSON(http.StatusCreated, tradeResponse)
+	c.JSON(http.StatusCreated, newTradeResponse(*createdTrade))
 }
 
 // Update a trade
@@ -136,6 +131,10 @@ func (h *TradeHandler) UpdateTrade(c *gin.Context) {
 	}
 	updatedTrade, err := h.service.UpdateTrade(userID.(string), id, req)
 	if err != nil {
+		if services.IsTradeValidationError(err) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update trade"})
 		return
 	}
@@ -143,19 +142,7 @@ func (h *TradeHandler) UpdateTrade(c *gin.Context) {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "No fields to update"})
 		return
 	}
-	tradeResponse := models.TradeResponse{
-		ID:        updatedTrade.ID,
-		Type:      updatedTrade.Type,
-		AssetType: updatedTrade.AssetType,
-		Ticker:    updatedTrade.Ticker,
-		TradeDate: updatedTrade.TradeDate,
-		Quantity:  updatedTrade.Quantity,
-		Price:     updatedTrade.Price,
-		Currency:  updatedTrade.Currency,
-		AccountID: updatedTrade.AccountID,
-		Reason:    updatedTrade.Reason,
-	}
-	c.JSON(http.StatusOK, tradeResponse)
+	c.JSON(http.StatusOK, newTradeResponse(*updatedTrade))
 }
 
 // Delete a trade
@@ -168,6 +155,10 @@ func (h *TradeHandler) DeleteTrade(c *gin.Context) {
 	id := c.Param("id")
 	deleted, err := h.service.DeleteTrade(userID.(string), id)
 	if err != nil {
+		if services.IsTradeValidationError(err) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete trade"})
 		return
 	}
@@ -177,3 +168,119 @@ func (h *TradeHandler) DeleteTrade(c *gin.Context) {
 	}
 	c.JSON(http.StatusOK, gin.H{"id": id, "deleted": true})
 }
+
+// ListDuplicates handles GET /trades/duplicates, grouping trades that look like one trade
+// entered more than once. ?tolerance= is how far apart prices may be, as a fraction of the
+// higher one; it defaults to 0.01.
+func (h *TradeHandler) ListDuplicates(c *gin.Context) {
+	userID, ok := c.Get("user_id")
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+		return
+	}
+	tolerance := models.DefaultDuplicatePriceTolerance
+	if raw := c.Query("tolerance"); raw != "" {
+		parsed, err := strconv.ParseFloat(raw, 64)
+		if err != nil || parsed < 0 || parsed >= 1 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid tolerance, use a fraction from 0 to below 1"})
+			return
+		}
+		tolerance = parsed
+	}
+
+	groups, err := h.service.FindDuplicates(userID.(string), tolerance)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to find duplicate trades"})
+		return
+	}
+	response := make([]models.TradeDuplicateGroupResponse, 0, len(groups))
+	for _, group := range groups {
+		trades := make([]models.TradeResponse, 0, len(group.Trades))
+		for _, trade := range group.Trades {
+			trades = append(trades, newTradeResponse(trade))
+		}
+		response = append(response, models.TradeDuplicateGroupResponse{Trades: trades})
+	}
+	c.JSON(http.StatusOK, response)
+}
+
+// MergeDuplicates handles POST /trades/duplicates/merge, keeping one trade and deleting its
+// duplicates
+func (h *TradeHandler) MergeDuplicates(c *gin.Context) {
+	userID, ok := c.Get("user_id")
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+		return
+	}
+	var req models.TradeMergeRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	trade, err := h.service.MergeDuplicates(userID.(string), req)
+	if err != nil {
+		respondDuplicateError(c, err, "Failed to merge trades")
+		return
+	}
+	c.JSON(http.StatusOK, newTradeResponse(*trade))
+}
+
+// DismissDuplicates handles POST /trades/duplicates/dismiss, keeping the trades apart
+func (h *TradeHandler) DismissDuplicates(c *gin.Context) {
+	userID, ok := c.Get("user_id")
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+		return
+	}
+	var req models.TradeDismissRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if err := h.service.DismissDuplicates(userID.(string), req); err != nil {
+		respondDuplicateError(c, err, "Failed to dismiss duplicates")
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"tradeIds": req.TradeIDs, "dismissed": true})
+}
+
+func respondDuplicateError(c *gin.Context, err error, message string) {
+	switch {
+	case errors.Is(err, services.ErrTradeNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+	case errors.Is(err, services.ErrInvalidDuplicates) || services.IsTradeValidationError(err):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": message})
+	}
+}
+
+// newTradeResponse builds the response body of a trade
+func newTradeResponse(trade models.Trade) models.TradeResponse {
+	return models.TradeResponse{
+		ID:             trade.ID,
+		Type:           trade.Type,
+		AssetType:      trade.AssetType,
+		Ticker:         trade.Ticker,
+		TradeDate:      trade.TradeDate,
+		Quantity:       trade.Quantity,
+		Price:          trade.Price,
+		Currency:       trade.Currency,
+		AccountID:      trade.AccountID,
+		Reason:         trade.Reason,
+		Fee:            trade.Fee,
+		FeeCurrency:    trade.FeeCurrency,
+		Tax:            trade.Tax,
+		TaxCurrency:    trade.TaxCurrency,
+		LotAllocations: trade.LotAllocations,
+		InstrumentID:   trade.InstrumentID,
+		Multiplier:     trade.ContractSize(),
+		PositionEffect: trade.PositionEffect,
+		ExternalID:     trade.ExternalID,
+		Transfer:       trade.Transfer,
+		SettlementRate: trade.SettlementRate,
+		Warnings:       trade.Warnings,
+	}
+}
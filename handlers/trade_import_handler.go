@@ -0,0 +1,188 @@
+package handlers
+
+import (
+	"asset-dairy/models"
+	"asset-dairy/services"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+)
+
+type TradeImportHandler struct {
+	importService services.TradeImportServiceInterface
+}
+
+func NewTradeImportHandler(importService services.TradeImportServiceInterface) *TradeImportHandler {
+	return &TradeImportHandler{
+		importService: importService,
+	}
+}
+
+// ImportTrades handles POST /imports/trades with a multipart/form-data upload of the CSV in
+// "file" and either the ID of a saved profile in "profileId" or a JSON "mapping". The rows are
+// only previewed unless ?commit=true, which stores every valid row in one transaction.
+func (h *TradeImportHandler) ImportTrades(c *gin.Context) {
+	userID, ok := c.Get("user_id")
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+		return
+	}
+	commit, err := strconv.ParseBool(c.DefaultQuery("commit", "false"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid commit, use true or false"})
+		return
+	}
+	fileHeader, err := c.FormFile("file")
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Missing file"})
+		return
+	}
+
+	var mapping models.TradeImportMapping
+	if profileID := c.PostForm("profileId"); profileID != "" {
+		profile, err := h.importService.GetProfile(userID.(string), profileID)
+		if err != nil {
+			respondTradeImportError(c, err, "Failed to fetch import profile")
+			return
+		}
+		mapping = profile.Mapping
+	} else if raw := c.PostForm("mapping"); raw != "" {
+		if err := json.Unmarshal([]byte(raw), &mapping); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid mapping: " + err.Error()})
+			return
+		}
+	}
+
+	file, err := fileHeader.Open()
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Unreadable file"})
+		return
+	}
+	defer file.Close()
+
+	result, err := h.importService.ImportCSV(userID.(string), file, mapping, commit)
+	if err != nil {
+		respondTradeImportError(c, err, "Failed to import trades")
+		return
+	}
+	status := http.StatusOK
+	if result.Committed {
+		status = http.StatusCreated
+	}
+	c.JSON(status, newTradeImportResponse(*result))
+}
+
+// ListProfiles handles GET /imports/profiles
+func (h *TradeImportHandler) ListProfiles(c *gin.Context) {
+	userID, ok := c.Get("user_id")
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+		return
+	}
+
+	profiles, err := h.importService.ListProfiles(userID.(string))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch import profiles"})
+		return
+	}
+	c.JSON(http.StatusOK, profiles)
+}
+
+// CreateProfile handles POST /imports/profiles
+func (h *TradeImportHandler) CreateProfile(c *gin.Context) {
+	userID, ok := c.Get("user_id")
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+		return
+	}
+	var req models.TradeImportProfileRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	profile, err := h.importService.CreateProfile(userID.(string), req)
+	if err != nil {
+		respondTradeImportError(c, err, "Failed to create import profile")
+		return
+	}
+	c.JSON(http.StatusCreated, profile)
+}
+
+// UpdateProfile handles PUT /imports/profiles/:id, replacing the name and mapping
+func (h *TradeImportHandler) UpdateProfile(c *gin.Context) {
+	userID, ok := c.Get("user_id")
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+		return
+	}
+	var req models.TradeImportProfileRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	profile, err := h.importService.UpdateProfile(userID.(string), c.Param("id"), req)
+	if err != nil {
+		respondTradeImportError(c, err, "Failed to update import profile")
+		return
+	}
+	c.JSON(http.StatusOK, profile)
+}
+
+// DeleteProfile handles DELETE /imports/profiles/:id
+func (h *TradeImportHandler) DeleteProfile(c *gin.Context) {
+	userID, ok := c.Get("user_id")
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+		return
+	}
+	id := c.Param("id")
+	deleted, err := h.importService.DeleteProfile(userID.(string), id)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete import profile"})
+		return
+	}
+	if !deleted {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Import profile not found"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"id": id, "deleted": true})
+}
+
+// newTradeImportResponse builds the response body of an import, counting the valid rows
+func newTradeImportResponse(result models.TradeImportResult) models.TradeImportResponse {
+	response := models.TradeImportResponse{
+		Rows:      make([]models.TradeImportRowResponse, 0, len(result.Rows)),
+		Committed: result.Committed,
+	}
+	for _, row := range result.Rows {
+		rowResponse := models.TradeImportRowResponse{Row: row.Row, Errors: row.Errors}
+		if row.Trade != nil {
+			trade := newTradeResponse(*row.Trade)
+			rowResponse.Trade = &trade
+		}
+		if len(row.Errors) == 0 {
+			rowResponse.Errors = []string{}
+			response.ValidRows++
+		} else {
+			response.InvalidRows++
+		}
+		response.Rows = append(response.Rows, rowResponse)
+	}
+	return response
+}
+
+func respondTradeImportError(c *gin.Context, err error, message string) {
+	switch {
+	case errors.Is(err, services.ErrImportProfileNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": "Import profile not found"})
+	case errors.Is(err, services.ErrInvalidTradeImport) || services.IsTradeValidationError(err):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": message})
+	}
+}
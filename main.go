@@ -6,11 +6,13 @@ import (
 	"asset-dairy/repositories"
 	"asset-dairy/routes"
 	"asset-dairy/services"
+	"context"
 	"fmt"
 	"log"
 	"net/http"
 	"os"
 	"strings"
+	"time"
 
 	"github.com/gin-gonic/gin"
 	"github.com/joho/godotenv"
@@ -94,22 +96,80 @@ func main() {
 	accountRepo := repositories.NewAccountRepository(dbConn)
 	authRepo := repositories.NewAuthRepository(dbConn)
 	userRepo := repositories.NewUserRepository(dbConn)
+	priceRepo := repositories.NewPriceRepository(dbConn)
+	priceHistoryRepo := repositories.NewPriceHistoryRepository(dbConn)
+	fxRateRepo := repositories.NewFxRateRepository(dbConn)
+	snapshotRepo := repositories.NewPortfolioSnapshotRepository(dbConn)
+	cashLedgerRepo := repositories.NewCashLedgerRepository(dbConn)
+	incomeEventRepo := repositories.NewIncomeEventRepository(dbConn)
+	corporateActionRepo := repositories.NewCorporateActionRepository(dbConn)
+	instrumentRepo := repositories.NewInstrumentRepository(dbConn)
+	tradeImportProfileRepo := repositories.NewTradeImportProfileRepository(dbConn)
+	statementImportRepo := repositories.NewStatementImportRepository(dbConn)
 
 	// Initialize services
 	authService := services.NewAuthService(authRepo)
 	profileService := services.NewProfileService(profileRepo)
-	accountService := services.NewAccountService(accountRepo)
-	tradeService := services.NewTradeService(tradeRepo)
-	holdingService := services.NewHoldingService(tradeService)
+	fxBaseCurrency := os.Getenv("FX_BASE_CURRENCY")
+	if fxBaseCurrency == "" {
+		fxBaseCurrency = "USD"
+	}
+	fxService := services.NewFxService(fxRateRepo, fxBaseCurrency)
+	if ratesFile := os.Getenv("FX_RATES_FILE"); ratesFile != "" {
+		count, err := fxService.ImportFile(ratesFile)
+		if err != nil {
+			log.Printf("Failed to load fx rates from %s: %v", ratesFile, err)
+		} else {
+			log.Printf("Loaded %d fx rates from %s", count, ratesFile)
+		}
+	}
+	corporateActionService := services.NewCorporateActionService(corporateActionRepo, tradeRepo, fxService)
+	instrumentService := services.NewInstrumentService(instrumentRepo)
+	tradeService := services.NewTradeService(tradeRepo, fxService, corporateActionService, instrumentService)
+	accountService := services.NewAccountService(accountRepo, tradeService)
+	priceService := services.NewPriceService(priceRepo)
+	priceHistoryService := services.NewPriceHistoryService(priceHistoryRepo, priceRepo)
+	priceProvider := services.NewStoredPriceProvider(priceRepo, priceHistoryRepo)
+	incomeService := services.NewIncomeService(incomeEventRepo, profileService, fxService, tradeService)
+	holdingService := services.NewHoldingService(tradeService, profileService, accountService, priceProvider, fxService, incomeService, corporateActionService)
+	optionService := services.NewOptionService(tradeService, holdingService, instrumentService)
+	tradeImportService := services.NewTradeImportService(tradeService, accountService, tradeImportProfileRepo)
+	portfolioService := services.NewPortfolioService(holdingService, profileService, accountService, fxService)
+	cashLedgerService := services.NewCashLedgerService(cashLedgerRepo)
+	statementImportService := services.NewStatementImportService(tradeService, cashLedgerService, incomeService, accountService, instrumentService, corporateActionService, statementImportRepo)
+	performanceService := services.NewPerformanceService(tradeService, accountService, profileService, priceHistoryService, fxService, cashLedgerService, incomeService, corporateActionService)
+	snapshotService := services.NewSnapshotService(snapshotRepo, performanceService, profileService, fxService)
 	userService := services.NewUserService(userRepo)
 
+	// Write daily portfolio snapshots in the background, backfilling missing days on startup
+	snapshotInterval := time.Hour
+	if intervalStr := os.Getenv("SNAPSHOT_INTERVAL"); intervalStr != "" {
+		parsed, err := time.ParseDuration(intervalStr)
+		if err != nil || parsed <= 0 {
+			log.Fatalf("Invalid SNAPSHOT_INTERVAL: %s", intervalStr)
+		}
+		snapshotInterval = parsed
+	}
+	services.NewSnapshotScheduler(snapshotService, snapshotInterval).Start(context.Background())
+
 	// Initialize handlers
 	authHandler := handlers.NewAuthHandler(authService)
 	profileHandler := handlers.NewProfileHandler(profileService, userService)
 	accountHandler := handlers.NewAccountHandler(accountService)
 	tradeHandler := handlers.NewTradeHandler(tradeService)
 	holdingHandler := handlers.NewHoldingHandler(holdingService)
-	routes.SetupRoutes(r, authHandler, profileHandler, accountHandler, tradeHandler, holdingHandler)
+	priceHandler := handlers.NewPriceHandler(priceService, priceHistoryService)
+	portfolioHandler := handlers.NewPortfolioHandler(portfolioService, snapshotService)
+	fxHandler := handlers.NewFxHandler(fxService)
+	performanceHandler := handlers.NewPerformanceHandler(performanceService)
+	cashLedgerHandler := handlers.NewCashLedgerHandler(cashLedgerService)
+	incomeHandler := handlers.NewIncomeHandler(incomeService)
+	corporateActionHandler := handlers.NewCorporateActionHandler(corporateActionService)
+	instrumentHandler := handlers.NewInstrumentHandler(instrumentService)
+	optionHandler := handlers.NewOptionHandler(optionService)
+	tradeImportHandler := handlers.NewTradeImportHandler(tradeImportService)
+	statementImportHandler := handlers.NewStatementImportHandler(statementImportService)
+	routes.SetupRoutes(r, authHandler, profileHandler, accountHandler, tradeHandler, holdingHandler, priceHandler, portfolioHandler, fxHandler, performanceHandler, cashLedgerHandler, incomeHandler, corporateActionHandler, instrumentHandler, optionHandler, tradeImportHandler, statementImportHandler)
 
 	r.GET("/swagger/*any", ginSwaggerHandler()) // Swagger UI placeholder
 
@@ -0,0 +1,29 @@
+package middleware
+
+import (
+	"net/http"
+	"os"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// AdminOnly allows the request through only when the authenticated email is listed in ADMIN_EMAILS.
+// It must run after JWTAuthMiddleware.
+func AdminOnly() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		email, _ := c.Get("email")
+		emailStr, _ := email.(string)
+		if emailStr == "" {
+			c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": "Admin access required"})
+			return
+		}
+		for _, admin := range strings.Split(os.Getenv("ADMIN_EMAILS"), ",") {
+			if strings.EqualFold(strings.TrimSpace(admin), emailStr) {
+				c.Next()
+				return
+			}
+		}
+		c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": "Admin access required"})
+	}
+}
@@ -0,0 +1,6 @@
+-- +migrate Down
+ALTER TABLE accounts
+    DROP COLUMN cost_basis_method;
+
+ALTER TABLE investment_profiles
+    DROP COLUMN cost_basis_method;
@@ -0,0 +1,9 @@
+-- +migrate Up
+ALTER TABLE investment_profiles
+    ADD COLUMN cost_basis_method VARCHAR(10) NOT NULL DEFAULT 'fifo'
+        CHECK (cost_basis_method IN ('fifo', 'lifo', 'average', 'hifo'));
+
+-- NULL means the account follows the user's investment profile
+ALTER TABLE accounts
+    ADD COLUMN cost_basis_method VARCHAR(10)
+        CHECK (cost_basis_method IN ('fifo', 'lifo', 'average', 'hifo'));
@@ -0,0 +1,10 @@
+-- +migrate Up
+CREATE TABLE IF NOT EXISTS trade_lot_allocations (
+    id UUID PRIMARY KEY,
+    sell_trade_id UUID NOT NULL REFERENCES trades(id) ON DELETE CASCADE,
+    buy_trade_id UUID NOT NULL REFERENCES trades(id) ON DELETE CASCADE,
+    quantity NUMERIC NOT NULL CHECK (quantity > 0),
+    UNIQUE (sell_trade_id, buy_trade_id)
+);
+
+CREATE INDEX IF NOT EXISTS idx_trade_lot_allocations_buy_trade_id ON trade_lot_allocations (buy_trade_id);
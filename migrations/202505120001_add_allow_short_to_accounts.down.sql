@@ -0,0 +1,5 @@
+-- +migrate Down
+DROP INDEX IF EXISTS idx_trades_user_id_trade_date;
+
+ALTER TABLE accounts
+    DROP COLUMN allow_short;
@@ -0,0 +1,5 @@
+-- +migrate Up
+ALTER TABLE accounts
+    ADD COLUMN allow_short BOOLEAN NOT NULL DEFAULT FALSE;
+
+CREATE INDEX IF NOT EXISTS idx_trades_user_id_trade_date ON trades (user_id, trade_date, created_at, id);
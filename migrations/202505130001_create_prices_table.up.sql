@@ -0,0 +1,8 @@
+-- +migrate Up
+CREATE TABLE IF NOT EXISTS prices (
+    ticker VARCHAR(20) NOT NULL,
+    currency VARCHAR(10) NOT NULL,
+    price NUMERIC NOT NULL CHECK (price >= 0),
+    as_of TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT now(),
+    PRIMARY KEY (ticker, currency)
+);
@@ -0,0 +1,13 @@
+-- +migrate Up
+CREATE TABLE IF NOT EXISTS price_history (
+    ticker VARCHAR(20) NOT NULL,
+    date DATE NOT NULL,
+    asset_type VARCHAR(10),
+    currency VARCHAR(10) NOT NULL,
+    open NUMERIC,
+    high NUMERIC,
+    low NUMERIC,
+    close NUMERIC NOT NULL,
+    volume NUMERIC,
+    PRIMARY KEY (ticker, date)
+);
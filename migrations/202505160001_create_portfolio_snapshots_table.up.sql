@@ -0,0 +1,15 @@
+-- +migrate Up
+CREATE TABLE IF NOT EXISTS portfolio_snapshots (
+    id UUID PRIMARY KEY,
+    user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    account_id UUID REFERENCES accounts(id) ON DELETE CASCADE,
+    date DATE NOT NULL,
+    currency VARCHAR(10) NOT NULL,
+    value NUMERIC NOT NULL,
+    net_flow NUMERIC NOT NULL DEFAULT 0,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT now()
+);
+
+-- One portfolio row and one row per account for each user and day
+CREATE UNIQUE INDEX IF NOT EXISTS idx_portfolio_snapshots_user_date ON portfolio_snapshots (user_id, date) WHERE account_id IS NULL;
+CREATE UNIQUE INDEX IF NOT EXISTS idx_portfolio_snapshots_account_date ON portfolio_snapshots (user_id, account_id, date) WHERE account_id IS NOT NULL;
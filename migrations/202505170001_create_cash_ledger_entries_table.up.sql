@@ -0,0 +1,25 @@
+-- +migrate Up
+CREATE TABLE IF NOT EXISTS cash_ledger_entries (
+    id UUID PRIMARY KEY,
+    user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    account_id UUID NOT NULL REFERENCES accounts(id) ON DELETE CASCADE,
+    type VARCHAR(20) NOT NULL CHECK (type IN ('opening_balance', 'deposit', 'withdrawal', 'trade', 'fee', 'interest', 'adjustment')),
+    amount NUMERIC NOT NULL,
+    currency VARCHAR(10) NOT NULL,
+    original_amount NUMERIC,
+    original_currency VARCHAR(10),
+    fx_rate NUMERIC,
+    trade_id UUID REFERENCES trades(id) ON DELETE CASCADE,
+    entry_date DATE NOT NULL,
+    memo TEXT,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT now()
+);
+
+CREATE INDEX IF NOT EXISTS idx_cash_ledger_entries_account_date ON cash_ledger_entries (account_id, entry_date);
+CREATE UNIQUE INDEX IF NOT EXISTS idx_cash_ledger_entries_trade_id ON cash_ledger_entries (trade_id) WHERE trade_id IS NOT NULL;
+
+-- Balances entered before the ledger existed become opening balance entries
+INSERT INTO cash_ledger_entries (id, user_id, account_id, type, amount, currency, entry_date, memo)
+SELECT gen_random_uuid(), user_id, id, 'opening_balance', balance, currency, created_at::date, 'Balance before the cash ledger'
+FROM accounts
+WHERE balance <> 0;
@@ -0,0 +1,9 @@
+-- +migrate Down
+DELETE FROM cash_ledger_entries WHERE type = 'transfer';
+
+ALTER TABLE cash_ledger_entries DROP CONSTRAINT IF EXISTS cash_ledger_entries_type_check;
+ALTER TABLE cash_ledger_entries ADD CONSTRAINT cash_ledger_entries_type_check
+    CHECK (type IN ('opening_balance', 'deposit', 'withdrawal', 'trade', 'fee', 'interest', 'adjustment'));
+
+DROP INDEX IF EXISTS idx_cash_ledger_entries_transfer_id;
+ALTER TABLE cash_ledger_entries DROP COLUMN IF EXISTS transfer_id;
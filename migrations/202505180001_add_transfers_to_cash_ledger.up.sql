@@ -0,0 +1,8 @@
+-- +migrate Up
+ALTER TABLE cash_ledger_entries ADD COLUMN IF NOT EXISTS transfer_id UUID;
+
+ALTER TABLE cash_ledger_entries DROP CONSTRAINT IF EXISTS cash_ledger_entries_type_check;
+ALTER TABLE cash_ledger_entries ADD CONSTRAINT cash_ledger_entries_type_check
+    CHECK (type IN ('opening_balance', 'deposit', 'withdrawal', 'transfer', 'trade', 'fee', 'interest', 'adjustment'));
+
+CREATE INDEX IF NOT EXISTS idx_cash_ledger_entries_transfer_id ON cash_ledger_entries (transfer_id) WHERE transfer_id IS NOT NULL;
@@ -0,0 +1,6 @@
+-- +migrate Down
+ALTER TABLE trades
+    DROP COLUMN IF EXISTS tax_currency,
+    DROP COLUMN IF EXISTS tax,
+    DROP COLUMN IF EXISTS fee_currency,
+    DROP COLUMN IF EXISTS fee;
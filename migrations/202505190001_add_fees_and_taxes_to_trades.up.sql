@@ -0,0 +1,6 @@
+-- +migrate Up
+ALTER TABLE trades
+    ADD COLUMN IF NOT EXISTS fee NUMERIC NOT NULL DEFAULT 0 CHECK (fee >= 0),
+    ADD COLUMN IF NOT EXISTS fee_currency VARCHAR(10),
+    ADD COLUMN IF NOT EXISTS tax NUMERIC NOT NULL DEFAULT 0 CHECK (tax >= 0),
+    ADD COLUMN IF NOT EXISTS tax_currency VARCHAR(10);
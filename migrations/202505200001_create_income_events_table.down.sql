@@ -0,0 +1,11 @@
+-- +migrate Down
+DELETE FROM cash_ledger_entries WHERE type = 'income';
+
+ALTER TABLE cash_ledger_entries DROP CONSTRAINT IF EXISTS cash_ledger_entries_type_check;
+ALTER TABLE cash_ledger_entries ADD CONSTRAINT cash_ledger_entries_type_check
+    CHECK (type IN ('opening_balance', 'deposit', 'withdrawal', 'transfer', 'trade', 'fee', 'interest', 'adjustment'));
+
+DROP INDEX IF EXISTS idx_cash_ledger_entries_income_event_id;
+ALTER TABLE cash_ledger_entries DROP COLUMN IF EXISTS income_event_id;
+
+DROP TABLE IF EXISTS income_events;
@@ -0,0 +1,25 @@
+-- +migrate Up
+CREATE TABLE IF NOT EXISTS income_events (
+    id UUID PRIMARY KEY,
+    user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    account_id UUID NOT NULL REFERENCES accounts(id) ON DELETE CASCADE,
+    ticker VARCHAR(20) NOT NULL,
+    type VARCHAR(20) NOT NULL CHECK (type IN ('cash_dividend', 'stock_dividend', 'staking_reward', 'coupon')),
+    pay_date DATE NOT NULL,
+    quantity NUMERIC,
+    gross_amount NUMERIC NOT NULL CHECK (gross_amount >= 0),
+    withholding_tax NUMERIC NOT NULL DEFAULT 0 CHECK (withholding_tax >= 0),
+    currency VARCHAR(10) NOT NULL,
+    memo TEXT,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT now()
+);
+
+CREATE INDEX IF NOT EXISTS idx_income_events_user_date ON income_events (user_id, pay_date);
+
+-- Cash income is credited to the account through the ledger
+ALTER TABLE cash_ledger_entries ADD COLUMN IF NOT EXISTS income_event_id UUID REFERENCES income_events(id) ON DELETE CASCADE;
+CREATE UNIQUE INDEX IF NOT EXISTS idx_cash_ledger_entries_income_event_id ON cash_ledger_entries (income_event_id) WHERE income_event_id IS NOT NULL;
+
+ALTER TABLE cash_ledger_entries DROP CONSTRAINT IF EXISTS cash_ledger_entries_type_check;
+ALTER TABLE cash_ledger_entries ADD CONSTRAINT cash_ledger_entries_type_check
+    CHECK (type IN ('opening_balance', 'deposit', 'withdrawal', 'transfer', 'trade', 'fee', 'interest', 'income', 'adjustment'));
@@ -0,0 +1,14 @@
+-- +migrate Up
+CREATE TABLE IF NOT EXISTS corporate_actions (
+    id UUID PRIMARY KEY,
+    ticker VARCHAR(20) NOT NULL,
+    type VARCHAR(20) NOT NULL CHECK (type IN ('split')),
+    effective_date DATE NOT NULL,
+    new_shares NUMERIC NOT NULL CHECK (new_shares > 0),
+    old_shares NUMERIC NOT NULL CHECK (old_shares > 0),
+    cash_in_lieu_price NUMERIC CHECK (cash_in_lieu_price >= 0),
+    memo TEXT,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT now()
+);
+
+CREATE INDEX IF NOT EXISTS idx_corporate_actions_ticker_date ON corporate_actions (ticker, effective_date);
@@ -0,0 +1,15 @@
+-- +migrate Down
+DELETE FROM corporate_actions WHERE type <> 'split';
+
+DROP INDEX IF EXISTS idx_corporate_actions_new_ticker;
+
+ALTER TABLE corporate_actions DROP CONSTRAINT IF EXISTS corporate_actions_new_shares_check;
+ALTER TABLE corporate_actions ADD CONSTRAINT corporate_actions_new_shares_check CHECK (new_shares > 0);
+
+ALTER TABLE corporate_actions DROP CONSTRAINT IF EXISTS corporate_actions_type_check;
+ALTER TABLE corporate_actions ADD CONSTRAINT corporate_actions_type_check CHECK (type IN ('split'));
+
+ALTER TABLE corporate_actions
+    DROP COLUMN IF EXISTS cost_basis_percent,
+    DROP COLUMN IF EXISTS cash_per_share,
+    DROP COLUMN IF EXISTS new_ticker;
@@ -0,0 +1,15 @@
+-- +migrate Up
+ALTER TABLE corporate_actions
+    ADD COLUMN IF NOT EXISTS new_ticker VARCHAR(20),
+    ADD COLUMN IF NOT EXISTS cash_per_share NUMERIC CHECK (cash_per_share >= 0),
+    ADD COLUMN IF NOT EXISTS cost_basis_percent NUMERIC CHECK (cost_basis_percent >= 0 AND cost_basis_percent <= 100);
+
+ALTER TABLE corporate_actions DROP CONSTRAINT IF EXISTS corporate_actions_type_check;
+ALTER TABLE corporate_actions ADD CONSTRAINT corporate_actions_type_check
+    CHECK (type IN ('split', 'symbol_change', 'merger', 'spin_off'));
+
+-- An all-cash merger converts into no shares
+ALTER TABLE corporate_actions DROP CONSTRAINT IF EXISTS corporate_actions_new_shares_check;
+ALTER TABLE corporate_actions ADD CONSTRAINT corporate_actions_new_shares_check CHECK (new_shares >= 0);
+
+CREATE INDEX IF NOT EXISTS idx_corporate_actions_new_ticker ON corporate_actions (new_ticker) WHERE new_ticker IS NOT NULL;
@@ -0,0 +1,5 @@
+-- +migrate Down
+DROP INDEX IF EXISTS idx_trades_instrument_id;
+ALTER TABLE trades DROP COLUMN IF EXISTS instrument_id;
+
+DROP TABLE IF EXISTS instruments;
@@ -0,0 +1,24 @@
+-- +migrate Up
+CREATE TABLE IF NOT EXISTS instruments (
+    id UUID PRIMARY KEY,
+    symbol VARCHAR(20) NOT NULL,
+    name TEXT NOT NULL,
+    exchange VARCHAR(20),
+    asset_class VARCHAR(10) NOT NULL CHECK (asset_class IN ('stock', 'crypto')),
+    currency VARCHAR(10) NOT NULL,
+    isin VARCHAR(12),
+    cusip VARCHAR(9),
+    lot_size NUMERIC NOT NULL DEFAULT 1 CHECK (lot_size > 0),
+    price_precision INTEGER NOT NULL DEFAULT 2 CHECK (price_precision >= 0),
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT now(),
+    updated_at TIMESTAMP WITH TIME ZONE DEFAULT now(),
+    UNIQUE (symbol, currency)
+);
+
+CREATE INDEX IF NOT EXISTS idx_instruments_name ON instruments (LOWER(name));
+
+-- Tickers are stored upper case so trades typed as "aapl" and "AAPL" share a position
+UPDATE trades SET ticker = UPPER(TRIM(ticker)) WHERE ticker <> UPPER(TRIM(ticker));
+
+ALTER TABLE trades ADD COLUMN IF NOT EXISTS instrument_id UUID REFERENCES instruments(id) ON DELETE SET NULL;
+CREATE INDEX IF NOT EXISTS idx_trades_instrument_id ON trades (instrument_id);
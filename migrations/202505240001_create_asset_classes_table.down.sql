@@ -0,0 +1,15 @@
+-- +migrate Down
+ALTER TABLE trades DROP COLUMN IF EXISTS multiplier;
+
+ALTER TABLE instruments
+    DROP COLUMN IF EXISTS coupon_rate,
+    DROP COLUMN IF EXISTS face_value,
+    DROP COLUMN IF EXISTS multiplier;
+
+ALTER TABLE instruments DROP CONSTRAINT IF EXISTS instruments_asset_class_fkey;
+ALTER TABLE instruments ADD CONSTRAINT instruments_asset_class_check CHECK (asset_class IN ('stock', 'crypto')) NOT VALID;
+
+ALTER TABLE trades DROP CONSTRAINT IF EXISTS trades_asset_type_fkey;
+ALTER TABLE trades ADD CONSTRAINT trades_asset_type_check CHECK (asset_type IN ('stock', 'crypto')) NOT VALID;
+
+DROP TABLE IF EXISTS asset_classes;
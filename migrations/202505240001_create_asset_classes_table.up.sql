@@ -0,0 +1,32 @@
+-- +migrate Up
+CREATE TABLE IF NOT EXISTS asset_classes (
+    code VARCHAR(20) PRIMARY KEY,
+    name TEXT NOT NULL
+);
+
+INSERT INTO asset_classes (code, name) VALUES
+    ('stock', 'Stock'),
+    ('crypto', 'Crypto'),
+    ('etf', 'ETF'),
+    ('mutual_fund', 'Mutual fund'),
+    ('bond', 'Bond'),
+    ('option', 'Option'),
+    ('money_market', 'Money market fund')
+ON CONFLICT (code) DO NOTHING;
+
+-- Asset types reference the table instead of a fixed CHECK list
+ALTER TABLE trades DROP CONSTRAINT IF EXISTS trades_asset_type_check;
+ALTER TABLE trades ALTER COLUMN asset_type TYPE VARCHAR(20);
+ALTER TABLE trades ADD CONSTRAINT trades_asset_type_fkey FOREIGN KEY (asset_type) REFERENCES asset_classes(code);
+
+ALTER TABLE instruments DROP CONSTRAINT IF EXISTS instruments_asset_class_check;
+ALTER TABLE instruments ALTER COLUMN asset_class TYPE VARCHAR(20);
+ALTER TABLE instruments ADD CONSTRAINT instruments_asset_class_fkey FOREIGN KEY (asset_class) REFERENCES asset_classes(code);
+
+-- Contract multiplier of options, and face value and annual coupon rate (percent) of bonds
+ALTER TABLE instruments
+    ADD COLUMN IF NOT EXISTS multiplier NUMERIC CHECK (multiplier > 0),
+    ADD COLUMN IF NOT EXISTS face_value NUMERIC CHECK (face_value > 0),
+    ADD COLUMN IF NOT EXISTS coupon_rate NUMERIC CHECK (coupon_rate >= 0);
+
+ALTER TABLE trades ADD COLUMN IF NOT EXISTS multiplier NUMERIC NOT NULL DEFAULT 1 CHECK (multiplier > 0);
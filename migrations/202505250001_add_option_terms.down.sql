@@ -0,0 +1,10 @@
+-- +migrate Down
+ALTER TABLE trades DROP COLUMN IF EXISTS position_effect;
+
+ALTER TABLE instruments DROP CONSTRAINT IF EXISTS instruments_option_terms_check;
+
+ALTER TABLE instruments
+    DROP COLUMN IF EXISTS expiration_date,
+    DROP COLUMN IF EXISTS strike_price,
+    DROP COLUMN IF EXISTS option_type,
+    DROP COLUMN IF EXISTS underlying;
@@ -0,0 +1,17 @@
+-- +migrate Up
+-- Contract terms of option instruments
+ALTER TABLE instruments
+    ADD COLUMN IF NOT EXISTS underlying VARCHAR(20),
+    ADD COLUMN IF NOT EXISTS option_type VARCHAR(4) CHECK (option_type IN ('call', 'put')),
+    ADD COLUMN IF NOT EXISTS strike_price NUMERIC CHECK (strike_price > 0),
+    ADD COLUMN IF NOT EXISTS expiration_date DATE;
+
+-- Options carry all of the terms and nothing else carries any; options listed before the terms
+-- existed are left as they are
+ALTER TABLE instruments ADD CONSTRAINT instruments_option_terms_check CHECK (
+    (asset_class = 'option' AND underlying IS NOT NULL AND option_type IS NOT NULL AND strike_price IS NOT NULL AND expiration_date IS NOT NULL)
+    OR (asset_class <> 'option' AND underlying IS NULL AND option_type IS NULL AND strike_price IS NULL AND expiration_date IS NULL)
+) NOT VALID;
+
+-- Whether an option trade opens or closes a position
+ALTER TABLE trades ADD COLUMN IF NOT EXISTS position_effect VARCHAR(5) CHECK (position_effect IN ('open', 'close'));
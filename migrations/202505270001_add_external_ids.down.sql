@@ -0,0 +1,9 @@
+-- +migrate Down
+DROP INDEX IF EXISTS idx_income_events_account_external_id;
+ALTER TABLE income_events DROP COLUMN IF EXISTS external_id;
+
+DROP INDEX IF EXISTS idx_cash_ledger_entries_account_external_id;
+ALTER TABLE cash_ledger_entries DROP COLUMN IF EXISTS external_id;
+
+DROP INDEX IF EXISTS idx_trades_account_external_id;
+ALTER TABLE trades DROP COLUMN IF EXISTS external_id;
@@ -0,0 +1,11 @@
+-- +migrate Up
+-- The institution's ID of an imported transaction, such as an OFX FITID, so a statement can
+-- be imported again without duplicating what it already brought in
+ALTER TABLE trades ADD COLUMN IF NOT EXISTS external_id VARCHAR(255);
+CREATE UNIQUE INDEX IF NOT EXISTS idx_trades_account_external_id ON trades (account_id, external_id) WHERE external_id IS NOT NULL;
+
+ALTER TABLE cash_ledger_entries ADD COLUMN IF NOT EXISTS external_id VARCHAR(255);
+CREATE UNIQUE INDEX IF NOT EXISTS idx_cash_ledger_entries_account_external_id ON cash_ledger_entries (account_id, external_id) WHERE external_id IS NOT NULL;
+
+ALTER TABLE income_events ADD COLUMN IF NOT EXISTS external_id VARCHAR(255);
+CREATE UNIQUE INDEX IF NOT EXISTS idx_income_events_account_external_id ON income_events (account_id, external_id) WHERE external_id IS NOT NULL;
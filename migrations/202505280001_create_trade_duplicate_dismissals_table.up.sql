@@ -0,0 +1,13 @@
+-- +migrate Up
+-- Pairs of trades the user reviewed and kept apart although they look like duplicates
+CREATE TABLE IF NOT EXISTS trade_duplicate_dismissals (
+    user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    trade_id UUID NOT NULL REFERENCES trades(id) ON DELETE CASCADE,
+    other_trade_id UUID NOT NULL REFERENCES trades(id) ON DELETE CASCADE,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT now(),
+    PRIMARY KEY (trade_id, other_trade_id),
+    CHECK (trade_id < other_trade_id)
+);
+
+CREATE INDEX IF NOT EXISTS idx_trade_duplicate_dismissals_user_id ON trade_duplicate_dismissals (user_id);
+CREATE INDEX IF NOT EXISTS idx_trade_duplicate_dismissals_other_trade_id ON trade_duplicate_dismissals (other_trade_id);
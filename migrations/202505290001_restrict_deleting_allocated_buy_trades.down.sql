@@ -0,0 +1,3 @@
+-- +migrate Down
+ALTER TABLE trade_lot_allocations DROP CONSTRAINT IF EXISTS trade_lot_allocations_buy_trade_id_fkey;
+ALTER TABLE trade_lot_allocations ADD CONSTRAINT trade_lot_allocations_buy_trade_id_fkey FOREIGN KEY (buy_trade_id) REFERENCES trades(id) ON DELETE CASCADE;
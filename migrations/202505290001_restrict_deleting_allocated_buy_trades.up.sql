@@ -0,0 +1,6 @@
+-- +migrate Up
+-- Deleting a buy trade no longer drops the lot allocations of sells that draw it down; the
+-- sells must be changed first. NO ACTION is checked at the end of the statement, so deleting
+-- a user still removes their sells and buys together.
+ALTER TABLE trade_lot_allocations DROP CONSTRAINT IF EXISTS trade_lot_allocations_buy_trade_id_fkey;
+ALTER TABLE trade_lot_allocations ADD CONSTRAINT trade_lot_allocations_buy_trade_id_fkey FOREIGN KEY (buy_trade_id) REFERENCES trades(id) ON DELETE NO ACTION;
@@ -0,0 +1,8 @@
+-- +migrate Up
+-- Cash a corporate action pays, such as cash in lieu of fractional shares, is credited through the ledger
+ALTER TABLE cash_ledger_entries ADD COLUMN IF NOT EXISTS corporate_action_id UUID REFERENCES corporate_actions(id) ON DELETE CASCADE;
+CREATE INDEX IF NOT EXISTS idx_cash_ledger_entries_corporate_action_id ON cash_ledger_entries (corporate_action_id) WHERE corporate_action_id IS NOT NULL;
+
+ALTER TABLE cash_ledger_entries DROP CONSTRAINT IF EXISTS cash_ledger_entries_type_check;
+ALTER TABLE cash_ledger_entries ADD CONSTRAINT cash_ledger_entries_type_check
+    CHECK (type IN ('opening_balance', 'deposit', 'withdrawal', 'transfer', 'trade', 'fee', 'interest', 'income', 'corporate_action', 'adjustment'));
@@ -0,0 +1,2 @@
+-- +migrate Down
+ALTER TABLE trades DROP COLUMN IF EXISTS transfer;
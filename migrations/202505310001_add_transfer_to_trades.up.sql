@@ -0,0 +1,4 @@
+-- +migrate Up
+-- Securities moved between institutions are stored as trades; a transfer out closes lots
+-- without realizing a gain
+ALTER TABLE trades ADD COLUMN IF NOT EXISTS transfer BOOLEAN NOT NULL DEFAULT false;
@@ -0,0 +1,3 @@
+-- +migrate Up
+-- A rate given with the trade settles it when no FX rate is known on the trade date
+ALTER TABLE trades ADD COLUMN IF NOT EXISTS settlement_rate NUMERIC;
@@ -0,0 +1,12 @@
+-- +migrate Down
+DROP TRIGGER IF EXISTS corporate_actions_mark_snapshots_stale ON corporate_actions;
+DROP TRIGGER IF EXISTS income_events_mark_snapshots_stale ON income_events;
+DROP TRIGGER IF EXISTS cash_ledger_entries_mark_snapshots_stale ON cash_ledger_entries;
+DROP TRIGGER IF EXISTS trades_mark_snapshots_stale ON trades;
+DROP FUNCTION IF EXISTS mark_corporate_action_snapshots_stale();
+DROP FUNCTION IF EXISTS mark_ticker_snapshots_stale(VARCHAR, DATE);
+DROP FUNCTION IF EXISTS mark_income_event_snapshots_stale();
+DROP FUNCTION IF EXISTS mark_cash_entry_snapshots_stale();
+DROP FUNCTION IF EXISTS mark_trade_snapshots_stale();
+DROP FUNCTION IF EXISTS mark_portfolio_snapshots_stale(UUID, DATE);
+DROP TABLE IF EXISTS portfolio_snapshot_stale_dates;
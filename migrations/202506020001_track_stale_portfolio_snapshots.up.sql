@@ -0,0 +1,103 @@
+-- +migrate Up
+-- The earliest date from which a user's snapshots no longer match their records. Every change
+-- to a trade, cash entry, income event or corporate action moves it back to the date the change
+-- takes effect, and the next snapshot pass rebuilds from there. There is no foreign key on the
+-- user, since deleting a user deletes their trades and marks them while the user is going away.
+CREATE TABLE IF NOT EXISTS portfolio_snapshot_stale_dates (
+    user_id UUID PRIMARY KEY,
+    stale_from DATE NOT NULL,
+    marked_at TIMESTAMP WITH TIME ZONE NOT NULL
+);
+
+CREATE OR REPLACE FUNCTION mark_portfolio_snapshots_stale(marked_user_id UUID, marked_from DATE) RETURNS void AS $$
+    INSERT INTO portfolio_snapshot_stale_dates (user_id, stale_from, marked_at)
+    VALUES (marked_user_id, marked_from, clock_timestamp())
+    ON CONFLICT (user_id) DO UPDATE
+    SET stale_from = LEAST(portfolio_snapshot_stale_dates.stale_from, EXCLUDED.stale_from),
+        marked_at = EXCLUDED.marked_at;
+$$ LANGUAGE sql;
+
+CREATE OR REPLACE FUNCTION mark_trade_snapshots_stale() RETURNS trigger AS $$
+BEGIN
+    IF TG_OP <> 'INSERT' THEN
+        PERFORM mark_portfolio_snapshots_stale(OLD.user_id, OLD.trade_date);
+    END IF;
+    IF TG_OP <> 'DELETE' THEN
+        PERFORM mark_portfolio_snapshots_stale(NEW.user_id, NEW.trade_date);
+    END IF;
+    RETURN NULL;
+END;
+$$ LANGUAGE plpgsql;
+
+-- Corporate action cash is rebuilt from the trades and actions after every trade change, and
+-- both already mark the snapshots, so only the other entries do
+CREATE OR REPLACE FUNCTION mark_cash_entry_snapshots_stale() RETURNS trigger AS $$
+BEGIN
+    IF TG_OP <> 'INSERT' AND OLD.type <> 'corporate_action' THEN
+        PERFORM mark_portfolio_snapshots_stale(OLD.user_id, OLD.entry_date);
+    END IF;
+    IF TG_OP <> 'DELETE' AND NEW.type <> 'corporate_action' THEN
+        PERFORM mark_portfolio_snapshots_stale(NEW.user_id, NEW.entry_date);
+    END IF;
+    RETURN NULL;
+END;
+$$ LANGUAGE plpgsql;
+
+CREATE OR REPLACE FUNCTION mark_income_event_snapshots_stale() RETURNS trigger AS $$
+BEGIN
+    IF TG_OP <> 'INSERT' THEN
+        PERFORM mark_portfolio_snapshots_stale(OLD.user_id, OLD.pay_date);
+    END IF;
+    IF TG_OP <> 'DELETE' THEN
+        PERFORM mark_portfolio_snapshots_stale(NEW.user_id, NEW.pay_date);
+    END IF;
+    RETURN NULL;
+END;
+$$ LANGUAGE plpgsql;
+
+-- A corporate action is shared by every user holding its ticker, including under a symbol an
+-- earlier action renamed into it
+CREATE OR REPLACE FUNCTION mark_ticker_snapshots_stale(marked_ticker VARCHAR, marked_from DATE) RETURNS void AS $$
+    WITH RECURSIVE tickers (ticker) AS (
+        SELECT marked_ticker::text
+        UNION
+        SELECT corporate_actions.ticker::text FROM corporate_actions JOIN tickers ON corporate_actions.new_ticker = tickers.ticker
+    )
+    SELECT mark_portfolio_snapshots_stale(user_id, marked_from)
+    FROM (SELECT DISTINCT trades.user_id FROM trades JOIN tickers ON trades.ticker = tickers.ticker) AS holders;
+$$ LANGUAGE sql;
+
+CREATE OR REPLACE FUNCTION mark_corporate_action_snapshots_stale() RETURNS trigger AS $$
+BEGIN
+    IF TG_OP <> 'INSERT' THEN
+        PERFORM mark_ticker_snapshots_stale(OLD.ticker, OLD.effective_date);
+    END IF;
+    IF TG_OP <> 'DELETE' THEN
+        PERFORM mark_ticker_snapshots_stale(NEW.ticker, NEW.effective_date);
+    END IF;
+    RETURN NULL;
+END;
+$$ LANGUAGE plpgsql;
+
+DROP TRIGGER IF EXISTS trades_mark_snapshots_stale ON trades;
+CREATE TRIGGER trades_mark_snapshots_stale AFTER INSERT OR UPDATE OR DELETE ON trades
+    FOR EACH ROW EXECUTE FUNCTION mark_trade_snapshots_stale();
+
+DROP TRIGGER IF EXISTS cash_ledger_entries_mark_snapshots_stale ON cash_ledger_entries;
+CREATE TRIGGER cash_ledger_entries_mark_snapshots_stale AFTER INSERT OR UPDATE OR DELETE ON cash_ledger_entries
+    FOR EACH ROW EXECUTE FUNCTION mark_cash_entry_snapshots_stale();
+
+DROP TRIGGER IF EXISTS income_events_mark_snapshots_stale ON income_events;
+CREATE TRIGGER income_events_mark_snapshots_stale AFTER INSERT OR UPDATE OR DELETE ON income_events
+    FOR EACH ROW EXECUTE FUNCTION mark_income_event_snapshots_stale();
+
+DROP TRIGGER IF EXISTS corporate_actions_mark_snapshots_stale ON corporate_actions;
+CREATE TRIGGER corporate_actions_mark_snapshots_stale AFTER INSERT OR UPDATE OR DELETE ON corporate_actions
+    FOR EACH ROW EXECUTE FUNCTION mark_corporate_action_snapshots_stale();
+
+-- Changes made before they were tracked are unknown, so existing snapshots are rebuilt once
+INSERT INTO portfolio_snapshot_stale_dates (user_id, stale_from, marked_at)
+SELECT user_id, MIN(trade_date), now()
+FROM trades
+GROUP BY user_id
+ON CONFLICT (user_id) DO NOTHING;
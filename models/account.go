@@ -1,12 +1,14 @@
 package models
 
 type Account struct {
-	ID       string  `gorm:"primaryKey;type:uuid" json:"id"`
-	UserID   string  `gorm:"type:uuid;not null;index" json:"user_id"`
-	User     User    `gorm:"foreignKey:UserID;references:ID;onUpdate:CASCADE;onDelete:CASCADE" json:"user"`
-	Name     string  `gorm:"not null" json:"name"`
-	Currency string  `gorm:"not null" json:"currency"`
-	Balance  float64 `gorm:"not null" json:"balance"`
+	ID              string  `gorm:"primaryKey;type:uuid" json:"id"`
+	UserID          string  `gorm:"type:uuid;not null;index" json:"user_id"`
+	User            User    `gorm:"foreignKey:UserID;references:ID;onUpdate:CASCADE;onDelete:CASCADE" json:"user"`
+	Name            string  `gorm:"not null" json:"name"`
+	Currency        string  `gorm:"not null" json:"currency"`
+	Balance         float64 `gorm:"not null" json:"balance"`
+	CostBasisMethod *string `gorm:"nullable" json:"costBasisMethod,omitempty"` // overrides the investment profile when set
+	AllowShort      bool    `gorm:"not null;default:false" json:"allowShort"`  // sells may take positions below zero
 }
 
 func (Account) TableName() string {
@@ -14,20 +16,27 @@ func (Account) TableName() string {
 }
 
 type AccountCreateRequest struct {
-	Name     string  `json:"name" binding:"required"`
-	Currency string  `json:"currency" binding:"required"`
-	Balance  float64 `json:"balance" binding:"required"`
+	Name            string  `json:"name" binding:"required"`
+	Currency        string  `json:"currency" binding:"required"`
+	Balance         float64 `json:"balance" binding:"required"`
+	CostBasisMethod *string `json:"costBasisMethod" binding:"omitempty,oneof=fifo lifo average hifo"`
+	AllowShort      bool    `json:"allowShort"`
 }
 
 type AccountUpdateRequest struct {
-	Name     string  `json:"name"`
-	Currency string  `json:"currency"`
-	Balance  float64 `json:"balance"`
+	Name                 string   `json:"name"`
+	Currency             string   `json:"currency"`
+	Balance              *float64 `json:"balance"`
+	CostBasisMethod      *string  `json:"costBasisMethod" binding:"omitempty,excluded_with=ClearCostBasisMethod,oneof=fifo lifo average hifo"`
+	ClearCostBasisMethod bool     `json:"clearCostBasisMethod"` // removes the override so the account follows the investment profile
+	AllowShort           *bool    `json:"allowShort"`
 }
 
 type AccountResponse struct {
-	ID       string  `json:"id"`
-	Name     string  `json:"name"`
-	Currency string  `json:"currency"`
-	Balance  float64 `json:"balance"`
+	ID              string  `json:"id"`
+	Name            string  `json:"name"`
+	Currency        string  `json:"currency"`
+	Balance         float64 `json:"balance"`
+	CostBasisMethod *string `json:"costBasisMethod,omitempty"`
+	AllowShort      bool    `json:"allowShort"`
 }
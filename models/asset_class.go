@@ -0,0 +1,28 @@
+package models
+
+// Asset classes of trades and instruments. The asset_classes table lists the same codes, so a
+// new class is a row there, a constant and an entry of AssetClasses here, and an entry in the
+// request bindings.
+const (
+	AssetClassStock       = "stock"
+	AssetClassCrypto      = "crypto"
+	AssetClassETF         = "etf"
+	AssetClassMutualFund  = "mutual_fund"
+	AssetClassBond        = "bond"
+	AssetClassOption      = "option"
+	AssetClassMoneyMarket = "money_market"
+)
+
+// AssetClasses lists every asset class code
+var AssetClasses = []string{
+	AssetClassStock,
+	AssetClassCrypto,
+	AssetClassETF,
+	AssetClassMutualFund,
+	AssetClassBond,
+	AssetClassOption,
+	AssetClassMoneyMarket,
+}
+
+// DefaultOptionMultiplier is the number of underlying shares in a standard equity option contract
+const DefaultOptionMultiplier = 100.0
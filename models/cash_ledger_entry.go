@@ -0,0 +1,87 @@
+package models
+
+import "time"
+
+// Cash ledger entry types
+const (
+	CashEntryOpeningBalance  = "opening_balance"
+	CashEntryDeposit         = "deposit"
+	CashEntryWithdrawal      = "withdrawal"
+	CashEntryTransfer        = "transfer"
+	CashEntryTrade           = "trade"
+	CashEntryFee             = "fee"
+	CashEntryInterest        = "interest"
+	CashEntryIncome          = "income"
+	CashEntryCorporateAction = "corporate_action"
+	CashEntryAdjustment      = "adjustment"
+)
+
+// CashLedgerEntry is one movement of cash in an account. Amount is signed (credits are
+// positive) and in the account currency; an account's balance is the sum of its entries.
+// Entries converted from another currency keep the original amount and the rate used.
+type CashLedgerEntry struct {
+	ID                string    `gorm:"primaryKey;type:uuid" json:"id"`
+	UserID            string    `gorm:"type:uuid;not null;index" json:"user_id"`
+	AccountID         string    `gorm:"type:uuid;not null;index" json:"accountId"`
+	Type              string    `gorm:"not null" json:"type"`
+	Amount            float64   `gorm:"not null" json:"amount"`
+	Currency          string    `gorm:"not null" json:"currency"`
+	OriginalAmount    *float64  `gorm:"nullable" json:"originalAmount,omitempty"`
+	OriginalCurrency  *string   `gorm:"nullable" json:"originalCurrency,omitempty"`
+	FxRate            *float64  `gorm:"nullable" json:"fxRate,omitempty"`
+	TradeID           *string   `gorm:"type:uuid" json:"tradeId,omitempty"`
+	TransferID        *string   `gorm:"type:uuid" json:"transferId,omitempty"` // shared by both legs of a transfer
+	IncomeEventID     *string   `gorm:"type:uuid" json:"incomeEventId,omitempty"`
+	CorporateActionID *string   `gorm:"type:uuid" json:"corporateActionId,omitempty"`
+	EntryDate         time.Time `gorm:"type:date;not null" json:"entryDate"`
+	Memo              *string   `gorm:"nullable" json:"memo,omitempty"`
+	ExternalID        *string   `gorm:"nullable" json:"externalId,omitempty"` // the institution's ID of an imported entry
+	CreatedAt         time.Time `gorm:"autoCreateTime" json:"createdAt"`
+}
+
+func (CashLedgerEntry) TableName() string {
+	return "cash_ledger_entries"
+}
+
+// IsExternalFlow reports whether the entry moves money into or out of the account from
+// outside it, as opposed to trading, fees, interest and income, which are part of its return
+func (e CashLedgerEntry) IsExternalFlow() bool {
+	switch e.Type {
+	case CashEntryOpeningBalance, CashEntryDeposit, CashEntryWithdrawal, CashEntryTransfer, CashEntryAdjustment:
+		return true
+	}
+	return false
+}
+
+// CashLedgerEntryCreateRequest records a fee debited from or interest credited to an account
+type CashLedgerEntryCreateRequest struct {
+	Type      string  `json:"type" binding:"required,oneof=fee interest"`
+	Amount    float64 `json:"amount" binding:"required,gt=0"`
+	EntryDate string  `json:"entryDate" binding:"required"`
+	Memo      *string `json:"memo"`
+}
+
+// CashMovementRequest deposits money into or withdraws it from an account
+type CashMovementRequest struct {
+	Amount float64 `json:"amount" binding:"required,gt=0"`
+	Date   string  `json:"date" binding:"required"`
+	Memo   *string `json:"memo"`
+}
+
+// CashTransferRequest moves Amount, in the source account currency, between two accounts. Rate
+// converts it into the destination currency and is required when the currencies differ.
+type CashTransferRequest struct {
+	FromAccountID string   `json:"fromAccountId" binding:"required"`
+	ToAccountID   string   `json:"toAccountId" binding:"required"`
+	Amount        float64  `json:"amount" binding:"required,gt=0"`
+	Rate          *float64 `json:"rate" binding:"omitempty,gt=0"`
+	Date          string   `json:"date" binding:"required"`
+	Memo          *string  `json:"memo"`
+}
+
+// CashTransfer is the pair of ledger entries written for a transfer
+type CashTransfer struct {
+	ID   string          `json:"id"`
+	From CashLedgerEntry `json:"from"`
+	To   CashLedgerEntry `json:"to"`
+}
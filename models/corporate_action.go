@@ -0,0 +1,102 @@
+package models
+
+import "time"
+
+// Corporate action types
+const (
+	CorporateActionSplit        = "split"
+	CorporateActionSymbolChange = "symbol_change"
+	CorporateActionMerger       = "merger"
+	CorporateActionSpinOff      = "spin_off"
+)
+
+// CorporateAction is an event that changes the positions in a ticker for every holder. Lots
+// opened before EffectiveDate are adjusted; trades on or after it are taken to be in post-action
+// units. Every action converts OldShares shares of Ticker into NewShares shares:
+//   - a split keeps the ticker, so a reverse split has NewShares below OldShares
+//   - a symbol change carries the lots to NewTicker unchanged apart from the ratio
+//   - a merger converts the lots into NewTicker and may pay CashPerShare per old share; when it
+//     pays both, CostBasisPercent of the basis carries to the new shares and the rest is
+//     realized against the cash
+//   - a spin-off keeps the lots and distributes NewShares of NewTicker per OldShares held,
+//     moving CostBasisPercent of the basis to them
+//
+// When CashInLieuPrice is set, fractional shares left by the action are paid out at that price
+// per share received, in the position's currency.
+type CorporateAction struct {
+	ID               string    `gorm:"primaryKey;type:uuid" json:"id"`
+	Ticker           string    `gorm:"not null" json:"ticker"`
+	Type             string    `gorm:"not null" json:"type"`
+	EffectiveDate    time.Time `gorm:"type:date;not null" json:"effectiveDate"`
+	NewTicker        *string   `gorm:"nullable" json:"newTicker,omitempty"`
+	NewShares        float64   `gorm:"not null" json:"newShares"`
+	OldShares        float64   `gorm:"not null" json:"oldShares"`
+	CashPerShare     *float64  `gorm:"nullable" json:"cashPerShare,omitempty"`
+	CostBasisPercent *float64  `gorm:"nullable" json:"costBasisPercent,omitempty"`
+	CashInLieuPrice  *float64  `gorm:"nullable" json:"cashInLieuPrice,omitempty"`
+	Memo             *string   `gorm:"nullable" json:"memo,omitempty"`
+	CreatedAt        time.Time `gorm:"autoCreateTime" json:"createdAt"`
+}
+
+func (CorporateAction) TableName() string {
+	return "corporate_actions"
+}
+
+// Ratio is the number of shares received for each share held before the action
+func (a CorporateAction) Ratio() float64 {
+	if a.OldShares == 0 {
+		return 1
+	}
+	return a.NewShares / a.OldShares
+}
+
+// CarriedBasis is the fraction of a lot's cost basis that moves to NewTicker
+func (a CorporateAction) CarriedBasis() float64 {
+	switch a.Type {
+	case CorporateActionSymbolChange:
+		return 1
+	case CorporateActionMerger:
+		if a.CostBasisPercent != nil {
+			return *a.CostBasisPercent / 100
+		}
+		if a.NewShares == 0 {
+			return 0
+		}
+		return 1
+	case CorporateActionSpinOff:
+		if a.CostBasisPercent != nil {
+			return *a.CostBasisPercent / 100
+		}
+	}
+	return 0
+}
+
+// Cash is the cash paid per share held before the action
+func (a CorporateAction) Cash() float64 {
+	if a.CashPerShare == nil {
+		return 0
+	}
+	return *a.CashPerShare
+}
+
+type CorporateActionCreateRequest struct {
+	Ticker           string   `json:"ticker" binding:"required"`
+	Type             string   `json:"type" binding:"required,oneof=split symbol_change merger spin_off"`
+	EffectiveDate    string   `json:"effectiveDate" binding:"required"`
+	NewTicker        *string  `json:"newTicker"`
+	NewShares        float64  `json:"newShares" binding:"gte=0"`
+	OldShares        float64  `json:"oldShares" binding:"gte=0"`
+	CashPerShare     *float64 `json:"cashPerShare" binding:"omitempty,gte=0"`
+	CostBasisPercent *float64 `json:"costBasisPercent" binding:"omitempty,gte=0,lte=100"`
+	CashInLieuPrice  *float64 `json:"cashInLieuPrice" binding:"omitempty,gte=0"`
+	Memo             *string  `json:"memo"`
+}
+
+// HoldingLineage is one corporate action that carried lots into a holding from another ticker
+type HoldingLineage struct {
+	CorporateActionID string    `json:"corporateActionId"`
+	Type              string    `json:"type"`
+	EffectiveDate     time.Time `json:"effectiveDate"`
+	FromTicker        string    `json:"fromTicker"`
+	ToTicker          string    `json:"toTicker"`
+}
@@ -0,0 +1,9 @@
+package models
+
+// Cost-basis methods used to pick which open lots a sell draws down
+const (
+	CostBasisFIFO    = "fifo"    // oldest lots first
+	CostBasisLIFO    = "lifo"    // newest lots first
+	CostBasisAverage = "average" // moving weighted average of all open lots
+	CostBasisHIFO    = "hifo"    // highest-cost lots first
+)
@@ -0,0 +1,15 @@
+package models
+
+import "time"
+
+// FxRate is the daily rate of a currency pair: one BaseCurrency buys Rate QuoteCurrency
+type FxRate struct {
+	BaseCurrency  string    `gorm:"primaryKey" json:"baseCurrency" db:"base_currency"`
+	QuoteCurrency string    `gorm:"primaryKey" json:"quoteCurrency" db:"quote_currency"`
+	Date          time.Time `gorm:"primaryKey;type:date" json:"date" db:"date"`
+	Rate          float64   `gorm:"not null" json:"rate" db:"rate"`
+}
+
+func (FxRate) TableName() string {
+	return "fx_rates"
+}
@@ -1,5 +1,7 @@
 package models
 
+import "time"
+
 // Holding represents a user's current asset holdings
 type Holding struct {
 	Ticker       string  `json:"ticker" db:"ticker"`
@@ -7,4 +9,80 @@ type Holding struct {
 	AveragePrice float64 `json:"averagePrice" db:"average_price"`
 	AssetType    string  `json:"assetType" db:"asset_type"`
 	Currency     string  `json:"currency" db:"currency"`
+	// Market fields are only set when a quote in the holding's currency is available
+	MarketPrice          *float64 `json:"marketPrice,omitempty"`
+	MarketValue          *float64 `json:"marketValue,omitempty"`
+	UnrealizedPnl        *float64 `json:"unrealizedPnl,omitempty"`
+	UnrealizedPnlPercent *float64 `json:"unrealizedPnlPercent,omitempty"`
+	// TrailingIncome is the gross cash dividends and coupons of the last twelve months in the
+	// holding's currency; YieldOnCostPercent divides it by the cost basis
+	TrailingIncome     *float64 `json:"trailingIncome,omitempty"`
+	YieldOnCostPercent *float64 `json:"yieldOnCostPercent,omitempty"`
+	// Lineage is the chain of symbol changes, mergers and spin-offs that carried lots into the
+	// holding, oldest first
+	Lineage []HoldingLineage `json:"lineage,omitempty"`
+	// Multiplier is the contract size of options and bonds; it is omitted when 1
+	Multiplier float64 `json:"multiplier,omitempty"`
+	// Lots are the open lots behind the position, only listed in per-account views
+	Lots []HoldingLot `json:"lots,omitempty"`
+	// UnconvertedCharges is set when an open lot's cost counts a fee or tax, or the value of
+	// units received as income, in its own currency for lack of a rate into the holding's currency
+	UnconvertedCharges bool `json:"unconvertedCharges,omitempty"`
+}
+
+// HoldingLot is the open part of one buy, or of one short sale with a negative quantity
+type HoldingLot struct {
+	TradeID   string    `json:"tradeId"`
+	TradeDate time.Time `json:"tradeDate"`
+	Quantity  float64   `json:"quantity"`
+	Price     float64   `json:"price"`
+}
+
+// HoldingsQuery selects the date holdings are replayed to. Without AsOf they include every
+// trade and are valued at the latest quotes; with it they only include trades dated up to
+// AsOf and are valued at the closes of that date when PriceAtClose is set.
+type HoldingsQuery struct {
+	AsOf         *time.Time
+	PriceAtClose bool
+}
+
+// HoldingChange compares a position between the two dates of a holdings diff
+type HoldingChange struct {
+	Ticker           string  `json:"ticker"`
+	AssetType        string  `json:"assetType"`
+	Currency         string  `json:"currency"`
+	FromQuantity     float64 `json:"fromQuantity"`
+	ToQuantity       float64 `json:"toQuantity"`
+	QuantityChange   float64 `json:"quantityChange"`
+	FromAveragePrice float64 `json:"fromAveragePrice"`
+	ToAveragePrice   float64 `json:"toAveragePrice"`
+}
+
+// HoldingsDiff lists the positions opened, closed and changed between two dates
+type HoldingsDiff struct {
+	From    time.Time       `json:"from"`
+	To      time.Time       `json:"to"`
+	Opened  []HoldingChange `json:"opened"`
+	Closed  []HoldingChange `json:"closed"`
+	Changed []HoldingChange `json:"changed"`
+}
+
+// AccountHoldings are the positions held in one account, matched only against its own trades
+type AccountHoldings struct {
+	AccountID   string    `json:"accountId"`
+	AccountName string    `json:"accountName"`
+	Holdings    []Holding `json:"holdings"`
+}
+
+// ContractSize is the holding's multiplier, treating an unset one as 1
+func (h Holding) ContractSize() float64 {
+	if h.Multiplier == 0 {
+		return 1
+	}
+	return h.Multiplier
+}
+
+// CostBasis is what the open quantity cost, negative for a short position
+func (h Holding) CostBasis() float64 {
+	return h.Quantity * h.AveragePrice * h.ContractSize()
 }
@@ -0,0 +1,73 @@
+package models
+
+import "time"
+
+// Instrument is a tradable security or coin in the shared catalog. Symbol and Currency identify
+// it the same way trades and prices do; trades that reference an instrument take both from it.
+type Instrument struct {
+	ID         string  `gorm:"primaryKey;type:uuid" json:"id"`
+	Symbol     string  `gorm:"not null" json:"symbol"`
+	Name       string  `gorm:"not null" json:"name"`
+	Exchange   *string `gorm:"nullable" json:"exchange,omitempty"`
+	AssetClass string  `gorm:"not null" json:"assetClass"` // one of the AssetClass constants, as a trade's AssetType
+	Currency   string  `gorm:"not null" json:"currency"`
+	ISIN       *string `gorm:"column:isin;nullable" json:"isin,omitempty"`
+	CUSIP      *string `gorm:"column:cusip;nullable" json:"cusip,omitempty"`
+	// LotSize is the board lot the exchange quotes in; PricePrecision is the number of decimals
+	// prices are quoted to
+	LotSize        float64   `gorm:"not null;default:1" json:"lotSize"`
+	PricePrecision int       `gorm:"not null;default:2" json:"pricePrecision"`
+	CreatedAt      time.Time `gorm:"autoCreateTime" json:"createdAt"`
+	UpdatedAt      time.Time `gorm:"autoUpdateTime" json:"updatedAt"`
+	// Multiplier is the contract size of an option. FaceValue and CouponRate (annual, in
+	// percent) describe a bond, whose price is quoted in percent of face value.
+	Multiplier *float64 `gorm:"nullable" json:"multiplier,omitempty"`
+	FaceValue  *float64 `gorm:"nullable" json:"faceValue,omitempty"`
+	CouponRate *float64 `gorm:"nullable" json:"couponRate,omitempty"`
+	// Underlying, OptionType, StrikePrice and ExpirationDate are the contract terms of an
+	// option; other instruments leave them empty
+	Underlying     *string    `gorm:"nullable" json:"underlying,omitempty"`
+	OptionType     *string    `gorm:"nullable" json:"optionType,omitempty"`
+	StrikePrice    *float64   `gorm:"nullable" json:"strikePrice,omitempty"`
+	ExpirationDate *time.Time `gorm:"type:date;nullable" json:"expirationDate,omitempty"`
+}
+
+func (Instrument) TableName() string {
+	return "instruments"
+}
+
+// ContractSize is what one unit of price is worth per unit of quantity: the multiplier when
+// set, 100 shares for an option without one, and a hundredth of the face value for a bond
+func (i Instrument) ContractSize() float64 {
+	switch {
+	case i.Multiplier != nil:
+		return *i.Multiplier
+	case i.AssetClass == AssetClassOption:
+		return DefaultOptionMultiplier
+	case i.AssetClass == AssetClassBond && i.FaceValue != nil:
+		return *i.FaceValue / 100
+	}
+	return 1
+}
+
+type InstrumentCreateRequest struct {
+	Symbol         string   `json:"symbol" binding:"required"`
+	Name           string   `json:"name" binding:"required"`
+	Exchange       *string  `json:"exchange"`
+	AssetClass     string   `json:"assetClass" binding:"required,oneof=stock crypto etf mutual_fund bond option money_market"`
+	Currency       string   `json:"currency" binding:"required"`
+	ISIN           *string  `json:"isin" binding:"omitempty,len=12,alphanum"`
+	CUSIP          *string  `json:"cusip" binding:"omitempty,len=9,alphanum"`
+	LotSize        *float64 `json:"lotSize" binding:"omitempty,gt=0"`
+	PricePrecision *int     `json:"pricePrecision" binding:"omitempty,gte=0,lte=10"`
+	Multiplier     *float64 `json:"multiplier" binding:"omitempty,gt=0"`
+	// FaceValue and CouponRate only apply to bonds
+	FaceValue  *float64 `json:"faceValue" binding:"omitempty,gt=0"`
+	CouponRate *float64 `json:"couponRate" binding:"omitempty,gte=0"`
+	// Underlying, OptionType, StrikePrice and ExpirationDate (YYYY-MM-DD) are required for
+	// options and rejected for anything else
+	Underlying     *string  `json:"underlying"`
+	OptionType     *string  `json:"optionType" binding:"omitempty,oneof=call put"`
+	StrikePrice    *float64 `json:"strikePrice" binding:"omitempty,gt=0"`
+	ExpirationDate *string  `json:"expirationDate"`
+}
@@ -10,6 +10,7 @@ type InvestmentProfile struct {
 	YearsInvesting                       int     `gorm:"nullable" json:"yearsInvesting" db:"years_investing"`
 	MonthlyCashFlow                      float64 `gorm:"nullable" json:"monthlyCashFlow" db:"monthly_cash_flow"`
 	DefaultCurrency                      string  `gorm:"nullable" json:"defaultCurrency" db:"default_currency"`
+	CostBasisMethod                      string  `gorm:"not null;default:fifo" json:"costBasisMethod" db:"cost_basis_method" binding:"omitempty,oneof=fifo lifo average hifo"`
 }
 
 func (InvestmentProfile) TableName() string {
@@ -24,4 +25,5 @@ type InvestmentProfileCreateRequest struct {
 	YearsInvesting                       int     `json:"yearsInvesting"`
 	MonthlyCashFlow                      float64 `json:"monthlyCashFlow"`
 	DefaultCurrency                      string  `json:"defaultCurrency"`
+	CostBasisMethod                      string  `json:"costBasisMethod" binding:"omitempty,oneof=fifo lifo average hifo"`
 }
@@ -0,0 +1,19 @@
+package models
+
+// TradeLotAllocation assigns part of a sell trade to the lot opened by a specific buy trade
+type TradeLotAllocation struct {
+	ID          string  `gorm:"primaryKey;type:uuid" json:"id" db:"id"`
+	SellTradeID string  `gorm:"type:uuid;not null;index" json:"sellTradeId" db:"sell_trade_id"`
+	BuyTradeID  string  `gorm:"type:uuid;not null;index" json:"buyTradeId" db:"buy_trade_id"`
+	Quantity    float64 `gorm:"not null" json:"quantity" db:"quantity"`
+}
+
+func (TradeLotAllocation) TableName() string {
+	return "trade_lot_allocations"
+}
+
+// LotAllocationRequest picks the buy trade a sell draws down and how much of it
+type LotAllocationRequest struct {
+	BuyTradeID string  `json:"buyTradeId" binding:"required"`
+	Quantity   float64 `json:"quantity" binding:"required,gt=0"`
+}
@@ -0,0 +1,42 @@
+package models
+
+import "time"
+
+// Option types
+const (
+	OptionTypeCall = "call"
+	OptionTypePut  = "put"
+)
+
+// Position effects of option trades
+const (
+	PositionEffectOpen  = "open"
+	PositionEffectClose = "close"
+)
+
+// Ways an option position ends at expiry: worthless, exercised by the holder, or assigned to
+// the writer
+const (
+	OptionOutcomeExpire   = "expire"
+	OptionOutcomeExercise = "exercise"
+	OptionOutcomeAssign   = "assign"
+)
+
+// OptionPosition is an open option holding together with its contract terms
+type OptionPosition struct {
+	Holding
+	InstrumentID   string    `json:"instrumentId"`
+	Underlying     string    `json:"underlying"`
+	OptionType     string    `json:"optionType"`
+	StrikePrice    float64   `json:"strikePrice"`
+	ExpirationDate time.Time `json:"expirationDate"`
+	DaysToExpiry   int       `json:"daysToExpiry"`
+}
+
+// OptionSettlementRequest closes the open positions in an option at expiry. Date defaults to
+// the expiration date; AccountID limits the settlement to one account.
+type OptionSettlementRequest struct {
+	Outcome   string  `json:"outcome" binding:"required,oneof=expire exercise assign"`
+	Date      string  `json:"date"`
+	AccountID *string `json:"accountId"`
+}
@@ -0,0 +1,36 @@
+package models
+
+import "time"
+
+// Performance period names accepted by GET /performance
+const (
+	PerformancePeriodMTD       = "MTD"
+	PerformancePeriodQTD       = "QTD"
+	PerformancePeriodYTD       = "YTD"
+	PerformancePeriod1Y        = "1Y"
+	PerformancePeriodInception = "inception"
+)
+
+// PerformanceReport is the return of the whole portfolio and of each account over one date range
+type PerformanceReport struct {
+	Currency          string              `json:"currency"`
+	Period            string              `json:"period,omitempty"`
+	From              time.Time           `json:"from"`
+	To                time.Time           `json:"to"`
+	Portfolio         PerformanceResult   `json:"portfolio"`
+	Accounts          []PerformanceResult `json:"accounts"`
+	MissingCurrencies []string            `json:"missingCurrencies"`
+}
+
+// PerformanceResult holds the returns of one scope. Returns are percentages and are
+// omitted when they cannot be computed, for example when nothing was invested.
+type PerformanceResult struct {
+	AccountID                  string   `json:"accountId,omitempty"`
+	Name                       string   `json:"name,omitempty"`
+	StartValue                 float64  `json:"startValue"`
+	EndValue                   float64  `json:"endValue"`
+	NetFlows                   float64  `json:"netFlows"` // money put in minus money taken out during the range
+	Gain                       float64  `json:"gain"`
+	TimeWeightedReturnPercent  *float64 `json:"timeWeightedReturnPercent,omitempty"`
+	MoneyWeightedReturnPercent *float64 `json:"moneyWeightedReturnPercent,omitempty"` // annualized (XIRR)
+}
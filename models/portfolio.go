@@ -0,0 +1,52 @@
+package models
+
+import "time"
+
+// PortfolioTotals is the cost and market value of all holdings converted into one currency
+type PortfolioTotals struct {
+	Currency             string    `json:"currency"`
+	TotalCost            float64   `json:"totalCost"`
+	TotalValue           float64   `json:"totalValue"`
+	UnrealizedPnl        float64   `json:"unrealizedPnl"`
+	UnrealizedPnlPercent *float64  `json:"unrealizedPnlPercent,omitempty"`
+	HoldingCount         int       `json:"holdingCount"`
+	UnpricedTickers      []string  `json:"unpricedTickers"`   // valued at cost for lack of a quote
+	MissingCurrencies    []string  `json:"missingCurrencies"` // left out for lack of an exchange rate
+	AsOf                 time.Time `json:"asOf"`
+}
+
+// PortfolioOverview breaks the value of cash and holdings down by account, asset type and
+// currency. Values are in the reporting currency; allocations are percentages of TotalValue.
+type PortfolioOverview struct {
+	Currency          string                `json:"currency"`
+	TotalValue        float64               `json:"totalValue"`
+	CashValue         float64               `json:"cashValue"`
+	HoldingsValue     float64               `json:"holdingsValue"`
+	Accounts          []AccountAllocation   `json:"accounts"`
+	AssetTypes        []PortfolioAllocation `json:"assetTypes"`
+	Currencies        []PortfolioAllocation `json:"currencies"`
+	UnpricedTickers   []string              `json:"unpricedTickers"`
+	MissingCurrencies []string              `json:"missingCurrencies"`
+	AsOf              time.Time             `json:"asOf"`
+}
+
+// AccountAllocation is the cash and holdings of one account
+type AccountAllocation struct {
+	AccountID         string    `json:"accountId"`
+	Name              string    `json:"name"`
+	Currency          string    `json:"currency"`
+	CashBalance       float64   `json:"cashBalance"` // in the account currency
+	CashValue         float64   `json:"cashValue"`
+	HoldingsValue     float64   `json:"holdingsValue"`
+	Value             float64   `json:"value"`
+	AllocationPercent float64   `json:"allocationPercent"`
+	Holdings          []Holding `json:"holdings"`
+}
+
+// PortfolioAllocation is the share of the portfolio under one asset type or currency.
+// Cash is reported under the "cash" asset type.
+type PortfolioAllocation struct {
+	Key               string  `json:"key"`
+	Value             float64 `json:"value"`
+	AllocationPercent float64 `json:"allocationPercent"`
+}
@@ -0,0 +1,46 @@
+package models
+
+import "time"
+
+// PortfolioSnapshot is the end-of-day value of a user's portfolio (AccountID nil) or of one account
+type PortfolioSnapshot struct {
+	ID        string    `gorm:"primaryKey;type:uuid" json:"id" db:"id"`
+	UserID    string    `gorm:"type:uuid;not null;index" json:"user_id" db:"user_id"`
+	AccountID *string   `gorm:"type:uuid" json:"accountId,omitempty" db:"account_id"`
+	Date      time.Time `gorm:"type:date;not null" json:"date" db:"date"`
+	Currency  string    `gorm:"not null" json:"currency" db:"currency"`
+	Value     float64   `gorm:"not null" json:"value" db:"value"`
+	NetFlow   float64   `gorm:"not null" json:"netFlow" db:"net_flow"`
+	CreatedAt time.Time `gorm:"autoCreateTime" json:"createdAt" db:"created_at"`
+}
+
+func (PortfolioSnapshot) TableName() string {
+	return "portfolio_snapshots"
+}
+
+// PortfolioSnapshotStaleDate is the earliest date from which a user's snapshots no longer match
+// their records. Database triggers move it back whenever a change takes effect earlier.
+type PortfolioSnapshotStaleDate struct {
+	UserID    string    `gorm:"primaryKey;type:uuid" json:"userId" db:"user_id"`
+	StaleFrom time.Time `gorm:"type:date;not null" json:"staleFrom" db:"stale_from"`
+	MarkedAt  time.Time `gorm:"not null" json:"markedAt" db:"marked_at"`
+}
+
+func (PortfolioSnapshotStaleDate) TableName() string {
+	return "portfolio_snapshot_stale_dates"
+}
+
+// Granularities accepted by GET /portfolio/history
+const (
+	HistoryGranularityDay   = "day"
+	HistoryGranularityWeek  = "week"
+	HistoryGranularityMonth = "month"
+)
+
+// PortfolioHistoryPoint is the value at the end of a day, week or month and the net flow during it
+type PortfolioHistoryPoint struct {
+	Date     time.Time `json:"date"`
+	Currency string    `json:"currency"`
+	Value    float64   `json:"value"`
+	NetFlow  float64   `json:"netFlow"`
+}
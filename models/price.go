@@ -0,0 +1,23 @@
+package models
+
+import "time"
+
+// Price is the latest known market quote of a ticker in a currency
+type Price struct {
+	Ticker   string    `gorm:"primaryKey" json:"ticker" db:"ticker"`
+	Currency string    `gorm:"primaryKey" json:"currency" db:"currency"`
+	Price    float64   `gorm:"not null" json:"price" db:"price"`
+	AsOf     time.Time `gorm:"not null" json:"asOf" db:"as_of"`
+}
+
+func (Price) TableName() string {
+	return "prices"
+}
+
+// PriceUploadRequest is one quote in an admin price upload
+type PriceUploadRequest struct {
+	Ticker   string  `json:"ticker" binding:"required"`
+	Currency string  `json:"currency" binding:"required"`
+	Price    float64 `json:"price" binding:"required,gt=0"`
+	AsOf     string  `json:"asOf"` // YYYY-MM-DD or RFC 3339, defaults to now
+}
@@ -0,0 +1,39 @@
+package models
+
+import "time"
+
+// PriceHistory is the daily bar of a ticker; at most one per ticker and date
+type PriceHistory struct {
+	Ticker    string    `gorm:"primaryKey" json:"ticker" db:"ticker"`
+	Date      time.Time `gorm:"primaryKey;type:date" json:"date" db:"date"`
+	AssetType string    `gorm:"nullable" json:"assetType,omitempty" db:"asset_type"`
+	Currency  string    `gorm:"not null" json:"currency" db:"currency"`
+	Open      *float64  `gorm:"nullable" json:"open,omitempty" db:"open"`
+	High      *float64  `gorm:"nullable" json:"high,omitempty" db:"high"`
+	Low       *float64  `gorm:"nullable" json:"low,omitempty" db:"low"`
+	Close     float64   `gorm:"not null" json:"close" db:"close"`
+	Volume    *float64  `gorm:"nullable" json:"volume,omitempty" db:"volume"`
+}
+
+func (PriceHistory) TableName() string {
+	return "price_history"
+}
+
+// PricePoint is one calendar day of a price series. Filled points carry the
+// last known close forward over weekends, holidays and other missing days.
+type PricePoint struct {
+	Date   time.Time `json:"date"`
+	Open   *float64  `json:"open,omitempty"`
+	High   *float64  `json:"high,omitempty"`
+	Low    *float64  `json:"low,omitempty"`
+	Close  float64   `json:"close"`
+	Volume *float64  `json:"volume,omitempty"`
+	Filled bool      `json:"filled"`
+}
+
+// PriceSeries is the response of a price history query
+type PriceSeries struct {
+	Ticker   string       `json:"ticker"`
+	Currency string       `json:"currency"`
+	Points   []PricePoint `json:"points"`
+}
@@ -22,4 +22,5 @@ type InvestmentProfileResponse struct {
 	YearsInvesting                       int     `json:"yearsInvesting"`
 	MonthlyCashFlow                      float64 `json:"monthlyCashFlow"`
 	DefaultCurrency                      string  `json:"defaultCurrency"`
+	CostBasisMethod                      string  `json:"costBasisMethod"`
 }
@@ -0,0 +1,27 @@
+package models
+
+import "time"
+
+// RealizedGain represents one sell matched against one buy lot. For a short
+// position (Short is true) the sell opened the lot and the buy covered it. Fractional
+// shares paid out as cash in lieu carry the corporate action instead of a sell trade.
+type RealizedGain struct {
+	AccountID         string    `json:"accountId"`
+	Ticker            string    `json:"ticker"`
+	AssetType         string    `json:"assetType"`
+	Currency          string    `json:"currency"`
+	BuyTradeID        string    `json:"buyTradeId"`
+	SellTradeID       string    `json:"sellTradeId"`
+	BuyDate           time.Time `json:"buyDate"`
+	SellDate          time.Time `json:"sellDate"`
+	Quantity          float64   `json:"quantity"`
+	CostBasis         float64   `json:"costBasis"`
+	Proceeds          float64   `json:"proceeds"`
+	Gain              float64   `json:"gain"`
+	HoldingPeriodDays int       `json:"holdingPeriodDays"`
+	Short             bool      `json:"short"`
+	CorporateActionID string    `json:"corporateActionId,omitempty"`
+	// UnconvertedCharges is set when the cost or proceeds count a fee or tax, or the value of
+	// units received as income, in its own currency for lack of a rate into the trade currency
+	UnconvertedCharges bool `json:"unconvertedCharges,omitempty"`
+}
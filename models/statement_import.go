@@ -0,0 +1,55 @@
+package models
+
+import "time"
+
+// ImportedExternalIDs are the external IDs already stored in an account, by kind of record
+type ImportedExternalIDs struct {
+	Trades       map[string]bool
+	CashEntries  map[string]bool
+	IncomeEvents map[string]bool
+}
+
+// StatementImportResult is the outcome of a statement import, transaction by transaction in
+// file order
+type StatementImportResult struct {
+	AccountID string
+	Rows      []StatementImportRow
+	Committed bool
+}
+
+// StatementImportRow is one transaction of an imported statement and the records it maps to:
+// a trade, a cash ledger entry or an income event, or two of them for reinvested income and
+// transfers of securities. Records an earlier import already stored are left out, and a row
+// left without any is a duplicate. A row is valid when it has no errors.
+type StatementImportRow struct {
+	FITID       string
+	Type        string // the statement's transaction type, such as BUYSTOCK or STMTTRN
+	Date        time.Time
+	Trade       *Trade
+	CashEntry   *CashLedgerEntry
+	IncomeEvent *IncomeEvent
+	Duplicate   bool
+	Errors      []string
+}
+
+type StatementImportRowResponse struct {
+	FITID       string           `json:"fitId"`
+	Type        string           `json:"type"`
+	Date        time.Time        `json:"date"`
+	Trade       *TradeResponse   `json:"trade,omitempty"`
+	CashEntry   *CashLedgerEntry `json:"cashEntry,omitempty"`
+	IncomeEvent *IncomeEvent     `json:"incomeEvent,omitempty"`
+	Duplicate   bool             `json:"duplicate"`
+	Errors      []string         `json:"errors"`
+}
+
+type StatementImportResponse struct {
+	AccountID string                       `json:"accountId"`
+	Rows      []StatementImportRowResponse `json:"rows"`
+	// ValidRows counts the new transactions, DuplicateRows those imported before
+	ValidRows     int `json:"validRows"`
+	DuplicateRows int `json:"duplicateRows"`
+	InvalidRows   int `json:"invalidRows"`
+	// Committed is false for a preview; when true the valid rows were stored
+	Committed bool `json:"committed"`
+}
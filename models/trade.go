@@ -8,7 +8,7 @@ type Trade struct {
 	UserID    string    `gorm:"type:uuid;not null;index" json:"user_id" db:"user_id"`
 	User      User      `gorm:"foreignKey:UserID;references:ID;onUpdate:CASCADE;onDelete:CASCADE" json:"user"`
 	Type      string    `gorm:"not null" json:"type" db:"type"`            // buy or sell
-	AssetType string    `gorm:"not null" json:"assetType" db:"asset_type"` // stock or crypto
+	AssetType string    `gorm:"not null" json:"assetType" db:"asset_type"` // one of the AssetClass constants
 	Ticker    string    `gorm:"not null" json:"ticker" db:"ticker"`
 	TradeDate time.Time `gorm:"not null" json:"tradeDate" db:"trade_date"`
 	Quantity  float64   `gorm:"not null" json:"quantity" db:"quantity"`
@@ -17,29 +17,85 @@ type Trade struct {
 	AccountID string    `gorm:"type:uuid;not null;index" json:"accountId" db:"account_id"`
 	Account   Account   `gorm:"foreignKey:AccountID;references:ID;onUpdate:CASCADE" json:"account"`
 	Reason    *string   `gorm:"nullable" json:"reason,omitempty" db:"reason"`
+	// Fee and Tax are charged on top of a buy and taken out of a sell's proceeds. Their
+	// currencies default to the trade currency when nil.
+	Fee         float64   `gorm:"not null;default:0" json:"fee" db:"fee"`
+	FeeCurrency *string   `gorm:"nullable" json:"feeCurrency,omitempty" db:"fee_currency"`
+	Tax         float64   `gorm:"not null;default:0" json:"tax" db:"tax"`
+	TaxCurrency *string   `gorm:"nullable" json:"taxCurrency,omitempty" db:"tax_currency"`
+	CreatedAt   time.Time `gorm:"autoCreateTime" json:"createdAt" db:"created_at"` // tiebreaker for trades on the same date
+	// LotAllocations pins a sell to specific buy lots instead of the cost-basis method
+	LotAllocations []TradeLotAllocation `gorm:"foreignKey:SellTradeID" json:"lotAllocations,omitempty"`
+	// InstrumentID links the trade to the instrument catalog; Ticker, AssetType and Currency
+	// then follow the instrument
+	InstrumentID *string `gorm:"type:uuid;nullable" json:"instrumentId,omitempty" db:"instrument_id"`
+	// Multiplier scales price times quantity into money, such as the contract size of an option
+	Multiplier float64 `gorm:"not null;default:1" json:"multiplier" db:"multiplier"`
+	// PositionEffect marks an option trade as opening or closing a position
+	PositionEffect *string `gorm:"nullable" json:"positionEffect,omitempty" db:"position_effect"`
+	// ExternalID is the institution's ID of an imported trade, unique within the account
+	ExternalID *string `gorm:"nullable" json:"externalId,omitempty" db:"external_id"`
+	// Transfer marks securities moved into or out of the account rather than traded; a
+	// transfer out closes lots without realizing a gain
+	Transfer bool `gorm:"not null;default:false" json:"transfer" db:"transfer"`
+	// SettlementRate converts the trade currency into the account currency, in account units per
+	// trade unit, when no stored FX rate should be used
+	SettlementRate *float64 `gorm:"nullable" json:"settlementRate,omitempty" db:"settlement_rate"`
+	// Settlement is the cash ledger entry written with the trade; it is not read back
+	Settlement *CashLedgerEntry `gorm:"-" json:"-"`
+	// Warnings flag a new trade that looks like one already stored; they are not stored
+	Warnings []string `gorm:"-" json:"-"`
+	// UnconvertedCharges marks a fee or tax, or the value of units received as income, that had
+	// no rate into the trade currency and is counted as if it were in it; it is not stored
+	UnconvertedCharges bool `gorm:"-" json:"-"`
 }
 
 func (Trade) TableName() string {
 	return "trades"
 }
 
+// ContractSize is the trade's multiplier, treating an unset one as 1
+func (t Trade) ContractSize() float64 {
+	if t.Multiplier == 0 {
+		return 1
+	}
+	return t.Multiplier
+}
+
 // TradeCreateRequest for creating a trade
 // (optional: can be used for binding in handlers)
 type TradeCreateRequest struct {
-	Type      string  `json:"type" binding:"required,oneof=buy sell"`
-	AssetType string  `json:"assetType" binding:"required,oneof=stock crypto"`
-	Ticker    string  `json:"ticker" binding:"required"`
-	TradeDate string  `json:"tradeDate" binding:"required"`
-	Quantity  float64 `json:"quantity" binding:"required"`
-	Price     float64 `json:"price" binding:"required"`
-	Currency  string  `json:"currency" binding:"required"`
-	AccountID string  `json:"accountId" binding:"required"`
-	Reason    *string `json:"reason"`
+	Type        string  `json:"type" binding:"required,oneof=buy sell"`
+	AssetType   string  `json:"assetType" binding:"required_without=InstrumentID,omitempty,oneof=stock crypto etf mutual_fund bond option money_market"`
+	Ticker      string  `json:"ticker" binding:"required_without=InstrumentID"`
+	TradeDate   string  `json:"tradeDate" binding:"required"`
+	Quantity    float64 `json:"quantity" binding:"required"`
+	Price       float64 `json:"price" binding:"required"`
+	Currency    string  `json:"currency" binding:"required_without=InstrumentID"`
+	AccountID   string  `json:"accountId" binding:"required"`
+	Reason      *string `json:"reason"`
+	Fee         float64 `json:"fee" binding:"omitempty,gte=0"`
+	FeeCurrency *string `json:"feeCurrency"`
+	Tax         float64 `json:"tax" binding:"omitempty,gte=0"`
+	TaxCurrency *string `json:"taxCurrency"`
+	// LotAllocations is only accepted on sell trades
+	LotAllocations []LotAllocationRequest `json:"lotAllocations" binding:"omitempty,dive"`
+	// InstrumentID takes the ticker, asset type and currency from the instrument catalog,
+	// so they may be left out
+	InstrumentID *string `json:"instrumentId"`
+	// Multiplier is taken from the instrument when one is linked; otherwise it defaults to 100
+	// for an option and 1 for anything else
+	Multiplier *float64 `json:"multiplier" binding:"omitempty,gt=0"`
+	// PositionEffect is only accepted on option trades
+	PositionEffect *string `json:"positionEffect" binding:"omitempty,oneof=open close"`
+	// SettlementRate settles a trade in another currency than its account at this rate instead
+	// of the FX rates known on the trade date
+	SettlementRate *float64 `json:"settlementRate" binding:"omitempty,gt=0"`
 }
 
 type TradeUpdateRequest struct {
 	Type      string  `json:"type" binding:"omitempty,oneof=buy sell"`
-	AssetType string  `json:"assetType" binding:"omitempty,oneof=stock crypto"`
+	AssetType string  `json:"assetType" binding:"omitempty,oneof=stock crypto etf mutual_fund bond option money_market"`
 	Ticker    string  `json:"ticker" binding:"omitempty"`
 	TradeDate string  `json:"tradeDate" binding:"omitempty"`
 	Quantity  float64 `json:"quantity" binding:"omitempty"`
@@ -47,17 +103,43 @@ type TradeUpdateRequest struct {
 	Currency  string  `json:"currency" binding:"omitempty"`
 	AccountID string  `json:"accountId" binding:"omitempty"`
 	Reason    *string `json:"reason"`
+	// Fee and Tax are pointers so they can be cleared with 0
+	Fee         *float64 `json:"fee" binding:"omitempty,gte=0"`
+	FeeCurrency *string  `json:"feeCurrency"`
+	Tax         *float64 `json:"tax" binding:"omitempty,gte=0"`
+	TaxCurrency *string  `json:"taxCurrency"`
+	// LotAllocations replaces the existing allocations when present; an empty list clears them
+	LotAllocations []LotAllocationRequest `json:"lotAllocations" binding:"omitempty,dive"`
+	// InstrumentID links the trade to another instrument; an empty string unlinks it
+	InstrumentID *string  `json:"instrumentId"`
+	Multiplier   *float64 `json:"multiplier" binding:"omitempty,gt=0"`
+	// PositionEffect is only accepted on option trades
+	PositionEffect *string `json:"positionEffect" binding:"omitempty,oneof=open close"`
+	// SettlementRate replaces the stored rate; a new currency or account without one drops it
+	SettlementRate *float64 `json:"settlementRate" binding:"omitempty,gt=0"`
 }
 
 type TradeResponse struct {
-	ID        string    `json:"id" db:"id"`
-	Type      string    `json:"type" db:"type"`            // buy or sell
-	AssetType string    `json:"assetType" db:"asset_type"` // stock or crypto
-	Ticker    string    `json:"ticker" db:"ticker"`
-	TradeDate time.Time `json:"tradeDate" db:"trade_date"`
-	Quantity  float64   `json:"quantity" db:"quantity"`
-	Price     float64   `json:"price" db:"price"`
-	Currency  string    `json:"currency" db:"currency"` // e.g., USD, TWD
-	AccountID string    `json:"accountId" db:"account_id"`
-	Reason    *string   `json:"reason,omitempty" db:"reason"`
+	ID             string               `json:"id" db:"id"`
+	Type           string               `json:"type" db:"type"`            // buy or sell
+	AssetType      string               `json:"assetType" db:"asset_type"` // one of the AssetClass constants
+	Ticker         string               `json:"ticker" db:"ticker"`
+	TradeDate      time.Time            `json:"tradeDate" db:"trade_date"`
+	Quantity       float64              `json:"quantity" db:"quantity"`
+	Price          float64              `json:"price" db:"price"`
+	Currency       string               `json:"currency" db:"currency"` // e.g., USD, TWD
+	AccountID      string               `json:"accountId" db:"account_id"`
+	Reason         *string              `json:"reason,omitempty" db:"reason"`
+	Fee            float64              `json:"fee" db:"fee"`
+	FeeCurrency    *string              `json:"feeCurrency,omitempty" db:"fee_currency"`
+	Tax            float64              `json:"tax" db:"tax"`
+	TaxCurrency    *string              `json:"taxCurrency,omitempty" db:"tax_currency"`
+	LotAllocations []TradeLotAllocation `json:"lotAllocations,omitempty"`
+	InstrumentID   *string              `json:"instrumentId,omitempty" db:"instrument_id"`
+	Multiplier     float64              `json:"multiplier" db:"multiplier"`
+	PositionEffect *string              `json:"positionEffect,omitempty" db:"position_effect"`
+	ExternalID     *string              `json:"externalId,omitempty" db:"external_id"`
+	Transfer       bool                 `json:"transfer" db:"transfer"`
+	SettlementRate *float64             `json:"settlementRate,omitempty" db:"settlement_rate"`
+	Warnings       []string             `json:"warnings,omitempty"`
 }
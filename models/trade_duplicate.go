@@ -0,0 +1,41 @@
+package models
+
+import "time"
+
+// DefaultDuplicatePriceTolerance is how far apart, relative to the higher one, the prices of
+// two otherwise identical trades may be for them to be flagged as likely duplicates
+const DefaultDuplicatePriceTolerance = 0.01
+
+// TradeDuplicateDismissal records that two trades flagged as likely duplicates are both real.
+// TradeID is the lower of the two IDs.
+type TradeDuplicateDismissal struct {
+	UserID       string    `gorm:"type:uuid;not null;index" json:"user_id"`
+	TradeID      string    `gorm:"primaryKey;type:uuid" json:"tradeId"`
+	OtherTradeID string    `gorm:"primaryKey;type:uuid" json:"otherTradeId"`
+	CreatedAt    time.Time `gorm:"autoCreateTime" json:"createdAt"`
+}
+
+func (TradeDuplicateDismissal) TableName() string {
+	return "trade_duplicate_dismissals"
+}
+
+// TradeDuplicateGroup is a set of trades that look like one trade entered more than once:
+// same account, ticker, date, type and quantity, with prices within the tolerance
+type TradeDuplicateGroup struct {
+	Trades []Trade
+}
+
+type TradeDuplicateGroupResponse struct {
+	Trades []TradeResponse `json:"trades"`
+}
+
+// TradeMergeRequest keeps one trade of a duplicate group and deletes the others
+type TradeMergeRequest struct {
+	KeepTradeID string   `json:"keepTradeId" binding:"required"`
+	TradeIDs    []string `json:"tradeIds" binding:"required,min=1"`
+}
+
+// TradeDismissRequest marks trades flagged as likely duplicates as distinct trades
+type TradeDismissRequest struct {
+	TradeIDs []string `json:"tradeIds" binding:"required,min=2"`
+}
@@ -0,0 +1,88 @@
+package models
+
+import "time"
+
+// TradeImportColumns names the CSV header of each trade field. An empty name falls back to
+// the field's own name, so a file with a "tradeDate" header needs no mapping for it.
+type TradeImportColumns struct {
+	TradeDate string `json:"tradeDate,omitempty"`
+	Type      string `json:"type,omitempty"`
+	Ticker    string `json:"ticker,omitempty"`
+	Quantity  string `json:"quantity,omitempty"`
+	Price     string `json:"price,omitempty"`
+	Currency  string `json:"currency,omitempty"`
+	Account   string `json:"account,omitempty"` // the account ID or name
+	AssetType string `json:"assetType,omitempty"`
+	Fee       string `json:"fee,omitempty"`
+	Tax       string `json:"tax,omitempty"`
+	Reason    string `json:"reason,omitempty"`
+}
+
+// TradeImportMapping describes how the rows of a broker's CSV export become trades
+type TradeImportMapping struct {
+	Columns TradeImportColumns `json:"columns"`
+	// Delimiter separates the fields of a row; it defaults to a comma
+	Delimiter string `json:"delimiter,omitempty"`
+	// DateFormat spells the trade date with YYYY, MM and DD, such as DD/MM/YYYY; it defaults
+	// to YYYY-MM-DD
+	DateFormat string `json:"dateFormat,omitempty"`
+	// TypeSynonyms maps the broker's words for a trade type, such as BUY, Sell or 買進, to buy
+	// or sell. They are matched ignoring case; buy and sell themselves are always understood.
+	TypeSynonyms map[string]string `json:"typeSynonyms,omitempty"`
+	// DecimalSeparator is "." (the default) or ","; the other one is read as a thousands
+	// separator
+	DecimalSeparator string `json:"decimalSeparator,omitempty"`
+	// The defaults fill in for a missing column or an empty cell. The currency falls back to
+	// the account's and the asset type to stock.
+	DefaultAccountID string `json:"defaultAccountId,omitempty"`
+	DefaultCurrency  string `json:"defaultCurrency,omitempty"`
+	DefaultAssetType string `json:"defaultAssetType,omitempty"`
+}
+
+// TradeImportProfile is a mapping the user saved under a name, such as their broker's
+type TradeImportProfile struct {
+	ID        string             `gorm:"primaryKey;type:uuid" json:"id"`
+	UserID    string             `gorm:"type:uuid;not null;index" json:"user_id"`
+	Name      string             `gorm:"not null" json:"name"`
+	Mapping   TradeImportMapping `gorm:"type:jsonb;serializer:json;not null" json:"mapping"`
+	CreatedAt time.Time          `gorm:"autoCreateTime" json:"createdAt"`
+	UpdatedAt time.Time          `gorm:"autoUpdateTime" json:"updatedAt"`
+}
+
+func (TradeImportProfile) TableName() string {
+	return "trade_import_profiles"
+}
+
+type TradeImportProfileRequest struct {
+	Name    string             `json:"name" binding:"required"`
+	Mapping TradeImportMapping `json:"mapping"`
+}
+
+// TradeImportResult is the outcome of an import, row by row in file order
+type TradeImportResult struct {
+	Rows      []TradeImportRow
+	Committed bool
+}
+
+// TradeImportRow is one row of an imported file. Trade is nil when the row could not be read
+// as a trade; a row is valid when it has no errors.
+type TradeImportRow struct {
+	Row    int
+	Trade  *Trade
+	Errors []string
+}
+
+type TradeImportRowResponse struct {
+	Row    int            `json:"row"` // line of the file the row starts on, the header being line 1
+	Trade  *TradeResponse `json:"trade,omitempty"`
+	Errors []string       `json:"errors"`
+}
+
+type TradeImportResponse struct {
+	Rows        []TradeImportRowResponse `json:"rows"`
+	ValidRows   int                      `json:"validRows"`
+	InvalidRows int                      `json:"invalidRows"`
+	// Committed is false for a preview or a file without valid rows; when true the valid rows
+	// were stored
+	Committed bool `json:"committed"`
+}
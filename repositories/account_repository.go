@@ -2,16 +2,20 @@ package repositories
 
 import (
 	"log"
+	"math"
 
 	"asset-dairy/models"
 
 	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 )
 
 type AccountRepositoryInterface interface {
 	ListAccounts(userID string) ([]models.Account, error)
-	CreateAccount(userID string, acc *models.Account) error
-	UpdateAccount(userID, accID string, req models.AccountUpdateRequest) (*models.Account, error)
+	GetAccount(userID, accID string) (*models.Account, error)
+	HasActivity(accID string) (bool, error)
+	CreateAccount(userID string, acc *models.Account, openingBalance *models.CashLedgerEntry) error
+	UpdateAccount(userID, accID string, req models.AccountUpdateRequest, adjustment *models.CashLedgerEntry) (*models.Account, error)
 	DeleteAccount(userID, accID string) error
 }
 
@@ -34,56 +38,127 @@ func (r *AccountRepository) ListAccounts(userID string) ([]models.Account, error
 	accounts := make([]models.Account, len(gormAccounts))
 	for i, gormAcc := range gormAccounts {
 		accounts[i] = models.Account{
-			ID:       gormAcc.ID,
-			Name:     gormAcc.Name,
-			Currency: gormAcc.Currency,
-			Balance:  gormAcc.Balance,
+			ID:              gormAcc.ID,
+			Name:            gormAcc.Name,
+			Currency:        gormAcc.Currency,
+			Balance:         gormAcc.Balance,
+			CostBasisMethod: gormAcc.CostBasisMethod,
+			AllowShort:      gormAcc.AllowShort,
 		}
 	}
 	return accounts, nil
 }
 
-func (r *AccountRepository) CreateAccount(userID string, acc *models.Account) error {
-	gormAcc := models.Account{
-		ID:       acc.ID,
-		UserID:   userID,
-		Name:     acc.Name,
-		Currency: acc.Currency,
-		Balance:  acc.Balance,
+func (r *AccountRepository) GetAccount(userID, accID string) (*models.Account, error) {
+	var gormAccount models.Account
+	result := r.DB.Where(&models.Account{ID: accID, UserID: userID}).First(&gormAccount)
+	if result.Error != nil {
+		log.Println("Failed to find account:", result.Error)
+		return nil, result.Error
 	}
+	return &models.Account{
+		ID:              gormAccount.ID,
+		Name:            gormAccount.Name,
+		Currency:        gormAccount.Currency,
+		Balance:         gormAccount.Balance,
+		CostBasisMethod: gormAccount.CostBasisMethod,
+		AllowShort:      gormAccount.AllowShort,
+	}, nil
+}
 
-	result := r.DB.Create(&gormAcc)
+// HasActivity reports whether the account has any trades or cash ledger entries
+func (r *AccountRepository) HasActivity(accID string) (bool, error) {
+	var count int64
+	result := r.DB.Raw(`SELECT (SELECT COUNT(*) FROM trades WHERE account_id = ?) + (SELECT COUNT(*) FROM cash_ledger_entries WHERE account_id = ?)`, accID, accID).Scan(&count)
 	if result.Error != nil {
-		log.Println("Failed to create account:", result.Error)
-		return result.Error
+		log.Println("Failed to check account activity:", result.Error)
+		return false, result.Error
 	}
-	return nil
+	return count > 0, nil
 }
 
-func (r *AccountRepository) UpdateAccount(userID, accID string, req models.AccountUpdateRequest) (*models.Account, error) {
-	var gormAccount models.Account
-	result := r.DB.Where(&models.Account{ID: accID, UserID: userID}).First(&gormAccount)
-	if result.Error != nil {
-		log.Println("Failed to find account:", result.Error)
-		return nil, result.Error
+// CreateAccount stores the account with its opening balance entry, if any
+func (r *AccountRepository) CreateAccount(userID string, acc *models.Account, openingBalance *models.CashLedgerEntry) error {
+	gormAcc := models.Account{
+		ID:              acc.ID,
+		UserID:          userID,
+		Name:            acc.Name,
+		Currency:        acc.Currency,
+		Balance:         acc.Balance,
+		CostBasisMethod: acc.CostBasisMethod,
+		AllowShort:      acc.AllowShort,
 	}
 
-	// Update fields from request
-	gormAccount.Name = req.Name
-	gormAccount.Currency = req.Currency
-	gormAccount.Balance = req.Balance
+	return r.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(&gormAcc).Error; err != nil {
+			log.Println("Failed to create account:", err)
+			return err
+		}
+		if openingBalance == nil {
+			return nil
+		}
+		if err := createCashEntry(tx, openingBalance); err != nil {
+			return err
+		}
+		return refreshAccountBalances(tx, gormAcc.ID)
+	})
+}
 
-	result = r.DB.Save(&gormAccount)
-	if result.Error != nil {
-		log.Println("Failed to update account:", result.Error)
-		return nil, result.Error
+// UpdateAccount saves the account settings. The balance is not written directly: when the
+// request names one, the adjustment entry records its difference from the balance read under a
+// row lock, and the balance is refreshed from the ledger. A balance already matching records
+// nothing.
+func (r *AccountRepository) UpdateAccount(userID, accID string, req models.AccountUpdateRequest, adjustment *models.CashLedgerEntry) (*models.Account, error) {
+	var gormAccount models.Account
+	err := r.DB.Transaction(func(tx *gorm.DB) error {
+		result := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Where(&models.Account{ID: accID, UserID: userID}).First(&gormAccount)
+		if result.Error != nil {
+			log.Println("Failed to find account:", result.Error)
+			return result.Error
+		}
+
+		// Update fields from request
+		gormAccount.Name = req.Name
+		gormAccount.Currency = req.Currency
+		if req.CostBasisMethod != nil {
+			gormAccount.CostBasisMethod = req.CostBasisMethod
+		} else if req.ClearCostBasisMethod {
+			gormAccount.CostBasisMethod = nil
+		}
+		if req.AllowShort != nil {
+			gormAccount.AllowShort = *req.AllowShort
+		}
+
+		if err := tx.Omit("Balance").Save(&gormAccount).Error; err != nil {
+			log.Println("Failed to update account:", err)
+			return err
+		}
+		if req.Balance == nil || adjustment == nil {
+			return nil
+		}
+		adjustment.Amount = *req.Balance - gormAccount.Balance
+		if math.Abs(adjustment.Amount) < 1e-9 {
+			return nil
+		}
+		if err := createCashEntry(tx, adjustment); err != nil {
+			return err
+		}
+		if err := refreshAccountBalances(tx, gormAccount.ID); err != nil {
+			return err
+		}
+		return tx.Model(&models.Account{}).Where("id = ?", gormAccount.ID).Select("balance").Scan(&gormAccount.Balance).Error
+	})
+	if err != nil {
+		return nil, err
 	}
 
 	return &models.Account{
-		ID:       gormAccount.ID,
-		Name:     gormAccount.Name,
-		Currency: gormAccount.Currency,
-		Balance:  gormAccount.Balance,
+		ID:              gormAccount.ID,
+		Name:            gormAccount.Name,
+		Currency:        gormAccount.Currency,
+		Balance:         gormAccount.Balance,
+		CostBasisMethod: gormAccount.CostBasisMethod,
+		AllowShort:      gormAccount.AllowShort,
 	}, nil
 }
 
@@ -0,0 +1,102 @@
+package repositories
+
+import (
+	"log"
+
+	"asset-dairy/models"
+
+	"gorm.io/gorm"
+)
+
+// CashLedgerRepositoryInterface defines methods for account cash ledger operations
+type CashLedgerRepositoryInterface interface {
+	GetAccount(userID, accountID string) (*models.Account, error)
+	ListEntries(userID, accountID string) ([]models.CashLedgerEntry, error)
+	ListUserEntries(userID string) ([]models.CashLedgerEntry, error)
+	CreateEntries(entries []models.CashLedgerEntry) error
+}
+
+// CashLedgerRepository implements CashLedgerRepositoryInterface
+type CashLedgerRepository struct {
+	db *gorm.DB
+}
+
+// NewCashLedgerRepository creates a new CashLedgerRepository instance
+func NewCashLedgerRepository(db *gorm.DB) *CashLedgerRepository {
+	return &CashLedgerRepository{db: db}
+}
+
+// GetAccount retrieves one of the user's accounts
+func (r *CashLedgerRepository) GetAccount(userID, accountID string) (*models.Account, error) {
+	var account models.Account
+	result := r.db.Where(&models.Account{ID: accountID, UserID: userID}).First(&account)
+	if result.Error != nil {
+		log.Println("Failed to find account:", result.Error)
+		return nil, result.Error
+	}
+	return &account, nil
+}
+
+// ListEntries retrieves the ledger of one of the user's accounts, oldest first
+func (r *CashLedgerRepository) ListEntries(userID, accountID string) ([]models.CashLedgerEntry, error) {
+	var entries []models.CashLedgerEntry
+	result := r.db.Where(&models.CashLedgerEntry{UserID: userID, AccountID: accountID}).Order("entry_date ASC, created_at ASC").Find(&entries)
+	if result.Error != nil {
+		log.Println("Failed to fetch cash ledger:", result.Error)
+		return nil, result.Error
+	}
+	return entries, nil
+}
+
+// ListUserEntries retrieves the ledger entries of all the user's accounts, oldest first
+func (r *CashLedgerRepository) ListUserEntries(userID string) ([]models.CashLedgerEntry, error) {
+	var entries []models.CashLedgerEntry
+	result := r.db.Where(&models.CashLedgerEntry{UserID: userID}).Order("entry_date ASC, created_at ASC").Find(&entries)
+	if result.Error != nil {
+		log.Println("Failed to fetch cash ledger:", result.Error)
+		return nil, result.Error
+	}
+	return entries, nil
+}
+
+// CreateEntries stores the entries and refreshes the balances of their accounts in one transaction
+func (r *CashLedgerRepository) CreateEntries(entries []models.CashLedgerEntry) error {
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		accountIDs := []string{}
+		for i := range entries {
+			if err := createCashEntry(tx, &entries[i]); err != nil {
+				return err
+			}
+			accountIDs = append(accountIDs, entries[i].AccountID)
+		}
+		return refreshAccountBalances(tx, accountIDs...)
+	})
+}
+
+func createCashEntry(tx *gorm.DB, entry *models.CashLedgerEntry) error {
+	if err := tx.Create(entry).Error; err != nil {
+		log.Println("Failed to create cash ledger entry:", err)
+		return err
+	}
+	return nil
+}
+
+// refreshAccountBalances sets each account's balance to the sum of its ledger entries. It must
+// run in the transaction that changed the ledger so the balance never drifts from it.
+func refreshAccountBalances(tx *gorm.DB, accountIDs ...string) error {
+	seen := make(map[string]bool, len(accountIDs))
+	for _, accountID := range accountIDs {
+		if accountID == "" || seen[accountID] {
+			continue
+		}
+		seen[accountID] = true
+		result := tx.Exec(`UPDATE accounts SET balance = (
+			SELECT COALESCE(SUM(amount), 0) FROM cash_ledger_entries WHERE account_id = ?
+		) WHERE id = ?`, accountID, accountID)
+		if result.Error != nil {
+			log.Println("Failed to refresh account balance:", result.Error)
+			return result.Error
+		}
+	}
+	return nil
+}
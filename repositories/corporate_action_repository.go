@@ -0,0 +1,109 @@
+package repositories
+
+import (
+	"log"
+	"strings"
+
+	"asset-dairy/models"
+
+	"gorm.io/gorm"
+)
+
+// CorporateActionRepositoryInterface defines methods for corporate action storage
+type CorporateActionRepositoryInterface interface {
+	ListActions(ticker string) ([]models.CorporateAction, error)
+	CreateAction(action models.CorporateAction) error
+	UpdateAction(action models.CorporateAction) (bool, error)
+	DeleteAction(actionID string) (bool, error)
+	ReplaceCashEntries(userID string, entries []models.CashLedgerEntry) error
+}
+
+// CorporateActionRepository implements CorporateActionRepositoryInterface
+type CorporateActionRepository struct {
+	db *gorm.DB
+}
+
+// NewCorporateActionRepository creates a new CorporateActionRepository instance
+func NewCorporateActionRepository(db *gorm.DB) *CorporateActionRepository {
+	return &CorporateActionRepository{db: db}
+}
+
+// ListActions retrieves the corporate actions that change a ticker or lead into it, or those of
+// every ticker when it is empty, in the order they took effect
+func (r *CorporateActionRepository) ListActions(ticker string) ([]models.CorporateAction, error) {
+	var actions []models.CorporateAction
+	query := r.db.Order("effective_date ASC, created_at ASC")
+	if ticker != "" {
+		query = query.Where("UPPER(ticker) = ? OR UPPER(new_ticker) = ?", strings.ToUpper(ticker), strings.ToUpper(ticker))
+	}
+	if result := query.Find(&actions); result.Error != nil {
+		log.Println("Failed to fetch corporate actions:", result.Error)
+		return nil, result.Error
+	}
+	return actions, nil
+}
+
+func (r *CorporateActionRepository) CreateAction(action models.CorporateAction) error {
+	if err := r.db.Create(&action).Error; err != nil {
+		log.Println("Failed to create corporate action:", err)
+		return err
+	}
+	return nil
+}
+
+// UpdateAction replaces every field of a stored action and reports whether it existed
+func (r *CorporateActionRepository) UpdateAction(action models.CorporateAction) (bool, error) {
+	result := r.db.Model(&models.CorporateAction{}).Where("id = ?", action.ID).Select("*").Omit("id", "created_at").Updates(&action)
+	if result.Error != nil {
+		log.Println("Failed to update corporate action:", result.Error)
+		return false, result.Error
+	}
+	return result.RowsAffected > 0, nil
+}
+
+// DeleteAction removes the action; the cash it paid goes with it and the balances of the
+// accounts it was paid into are refreshed
+func (r *CorporateActionRepository) DeleteAction(actionID string) (bool, error) {
+	deleted := false
+	err := r.db.Transaction(func(tx *gorm.DB) error {
+		var accountIDs []string
+		if err := tx.Model(&models.CashLedgerEntry{}).Where("corporate_action_id = ?", actionID).Pluck("account_id", &accountIDs).Error; err != nil {
+			log.Println("Failed to find corporate action cash:", err)
+			return err
+		}
+		result := tx.Where("id = ?", actionID).Delete(&models.CorporateAction{})
+		if result.Error != nil {
+			log.Println("Failed to delete corporate action:", result.Error)
+			return result.Error
+		}
+		deleted = result.RowsAffected > 0
+		return refreshAccountBalances(tx, accountIDs...)
+	})
+	if err != nil {
+		return false, err
+	}
+	return deleted, nil
+}
+
+// ReplaceCashEntries swaps the user's ledger entries of cash paid by corporate actions for the
+// given ones and refreshes the balances of the accounts on either side, in one transaction
+func (r *CorporateActionRepository) ReplaceCashEntries(userID string, entries []models.CashLedgerEntry) error {
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		var accountIDs []string
+		if err := tx.Model(&models.CashLedgerEntry{}).Where("user_id = ? AND type = ?", userID, models.CashEntryCorporateAction).Pluck("account_id", &accountIDs).Error; err != nil {
+			log.Println("Failed to find corporate action cash:", err)
+			return err
+		}
+		if err := tx.Where("user_id = ? AND type = ?", userID, models.CashEntryCorporateAction).Delete(&models.CashLedgerEntry{}).Error; err != nil {
+			log.Println("Failed to clear corporate action cash:", err)
+			return err
+		}
+		for i := range entries {
+			if err := createCashEntry(tx, &entries[i]); err != nil {
+				return err
+			}
+			accountIDs = append(accountIDs, entries[i].AccountID)
+		}
+		return refreshAccountBalances(tx, accountIDs...)
+	})
+}
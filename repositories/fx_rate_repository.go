@@ -0,0 +1,108 @@
+package repositories
+
+import (
+	"log"
+	"time"
+
+	"asset-dairy/models"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// FxRateRepositoryInterface defines methods for daily exchange rate storage
+type FxRateRepositoryInterface interface {
+	ListLatestRates(asOf time.Time) ([]models.FxRate, error)
+	ListRates(from, to time.Time) ([]models.FxRate, error)
+	UpsertRates(rates []models.FxRate) error
+}
+
+// FxRateRepository implements FxRateRepositoryInterface
+type FxRateRepository struct {
+	db *gorm.DB
+}
+
+// NewFxRateRepository creates a new FxRateRepository instance
+func NewFxRateRepository(db *gorm.DB) *FxRateRepository {
+	return &FxRateRepository{db: db}
+}
+
+// ListLatestRates retrieves the newest rate of every currency pair dated on or before asOf
+func (r *FxRateRepository) ListLatestRates(asOf time.Time) ([]models.FxRate, error) {
+	var rates []models.FxRate
+	result := r.db.Raw(`SELECT DISTINCT ON (base_currency, quote_currency) base_currency, quote_currency, date, rate
+		FROM fx_rates WHERE date <= ?
+		ORDER BY base_currency, quote_currency, date DESC`, asOf).Scan(&rates)
+	if result.Error != nil {
+		log.Println("Failed to fetch fx rates:", result.Error)
+		return nil, result.Error
+	}
+	return rates, nil
+}
+
+// ListRates retrieves every rate dated from from through to, oldest first
+func (r *FxRateRepository) ListRates(from, to time.Time) ([]models.FxRate, error) {
+	var rates []models.FxRate
+	result := r.db.Where("date >= ? AND date <= ?", from, to).Order("date").Find(&rates)
+	if result.Error != nil {
+		log.Println("Failed to fetch fx rates:", result.Error)
+		return nil, result.Error
+	}
+	return rates, nil
+}
+
+// UpsertRates stores the rates, replacing any stored rate of the same pair and date. Snapshots
+// convert at these rates, so every user with trades or cash has their snapshots marked stale
+// from the earliest rate that is new or changed. Reloading the same rates marks nothing.
+func (r *FxRateRepository) UpsertRates(rates []models.FxRate) error {
+	if len(rates) == 0 {
+		return nil
+	}
+	from, to := rates[0].Date, rates[0].Date
+	for _, rate := range rates {
+		if rate.Date.Before(from) {
+			from = rate.Date
+		}
+		if rate.Date.After(to) {
+			to = rate.Date
+		}
+	}
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		var stored []models.FxRate
+		if err := tx.Where("date >= ? AND date <= ?", from, to).Find(&stored).Error; err != nil {
+			log.Println("Failed to fetch fx rates:", err)
+			return err
+		}
+		storedRates := make(map[string]float64, len(stored))
+		for _, rate := range stored {
+			storedRates[rate.BaseCurrency+"_"+rate.QuoteCurrency+"_"+rate.Date.Format("2006-01-02")] = rate.Rate
+		}
+		var earliest *time.Time
+		for _, rate := range rates {
+			value, ok := storedRates[rate.BaseCurrency+"_"+rate.QuoteCurrency+"_"+rate.Date.Format("2006-01-02")]
+			if (!ok || value != rate.Rate) && (earliest == nil || rate.Date.Before(*earliest)) {
+				date := rate.Date
+				earliest = &date
+			}
+		}
+		if earliest == nil {
+			return nil
+		}
+
+		result := tx.Clauses(clause.OnConflict{
+			Columns:   []clause.Column{{Name: "base_currency"}, {Name: "quote_currency"}, {Name: "date"}},
+			DoUpdates: clause.AssignmentColumns([]string{"rate"}),
+		}).CreateInBatches(&rates, 500)
+		if result.Error != nil {
+			log.Println("Failed to upsert fx rates:", result.Error)
+			return result.Error
+		}
+		err := tx.Exec(`SELECT mark_portfolio_snapshots_stale(user_id, ?)
+			FROM (SELECT user_id FROM trades UNION SELECT user_id FROM cash_ledger_entries) AS users`, *earliest).Error
+		if err != nil {
+			log.Println("Failed to mark snapshots stale:", err)
+			return err
+		}
+		return nil
+	})
+}
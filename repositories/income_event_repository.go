@@ -0,0 +1,132 @@
+package repositories
+
+import (
+	"log"
+
+	"asset-dairy/models"
+
+	"gorm.io/gorm"
+)
+
+// IncomeEventRepositoryInterface defines methods for income-event-related database operations
+type IncomeEventRepositoryInterface interface {
+	ListEvents(userID string) ([]models.IncomeEvent, error)
+	GetEvent(userID, eventID string) (*models.IncomeEvent, error)
+	CreateEvent(event models.IncomeEvent) error
+	UpdateEvent(event models.IncomeEvent) error
+	DeleteEvent(userID, eventID string) (bool, error)
+	GetAccountCurrency(userID, accountID string) (string, error)
+}
+
+// IncomeEventRepository implements IncomeEventRepositoryInterface
+type IncomeEventRepository struct {
+	db *gorm.DB
+}
+
+// NewIncomeEventRepository creates a new IncomeEventRepository instance
+func NewIncomeEventRepository(db *gorm.DB) *IncomeEventRepository {
+	return &IncomeEventRepository{db: db}
+}
+
+// ListEvents retrieves the user's income events, oldest first
+func (r *IncomeEventRepository) ListEvents(userID string) ([]models.IncomeEvent, error) {
+	var events []models.IncomeEvent
+	result := r.db.Where(&models.IncomeEvent{UserID: userID}).Order("pay_date ASC, created_at ASC").Find(&events)
+	if result.Error != nil {
+		log.Println("Failed to fetch income events:", result.Error)
+		return nil, result.Error
+	}
+	return events, nil
+}
+
+// GetEvent retrieves a single income event of the user
+func (r *IncomeEventRepository) GetEvent(userID, eventID string) (*models.IncomeEvent, error) {
+	var event models.IncomeEvent
+	result := r.db.Where(&models.IncomeEvent{ID: eventID, UserID: userID}).First(&event)
+	if result.Error != nil {
+		log.Println("Failed to find income event:", result.Error)
+		return nil, result.Error
+	}
+	return &event, nil
+}
+
+// CreateEvent stores the event with its cash settlement, if any
+func (r *IncomeEventRepository) CreateEvent(event models.IncomeEvent) error {
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(&event).Error; err != nil {
+			log.Println("Failed to create income event:", err)
+			return err
+		}
+		return replaceIncomeSettlement(tx, event.ID, event.Settlement, event.AccountID)
+	})
+}
+
+// UpdateEvent saves the already merged event and replaces its cash settlement
+func (r *IncomeEventRepository) UpdateEvent(event models.IncomeEvent) error {
+	var previous models.IncomeEvent
+	if err := r.db.Where(&models.IncomeEvent{ID: event.ID, UserID: event.UserID}).First(&previous).Error; err != nil {
+		log.Println("Failed to find income event:", err)
+		return err
+	}
+
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Save(&event).Error; err != nil {
+			log.Println("Failed to update income event:", err)
+			return err
+		}
+		return replaceIncomeSettlement(tx, event.ID, event.Settlement, previous.AccountID, event.AccountID)
+	})
+}
+
+// DeleteEvent removes the event; its settlement goes with it and the account balance is refreshed
+func (r *IncomeEventRepository) DeleteEvent(userID, eventID string) (bool, error) {
+	deleted := false
+	err := r.db.Transaction(func(tx *gorm.DB) error {
+		var accountIDs []string
+		if err := tx.Model(&models.IncomeEvent{}).Where("id = ? AND user_id = ?", eventID, userID).Pluck("account_id", &accountIDs).Error; err != nil {
+			log.Println("Failed to find income event:", err)
+			return err
+		}
+		result := tx.Where("id = ? AND user_id = ?", eventID, userID).Delete(&models.IncomeEvent{})
+		if result.Error != nil {
+			log.Println("Failed to delete income event:", result.Error)
+			return result.Error
+		}
+		deleted = result.RowsAffected > 0
+		return refreshAccountBalances(tx, accountIDs...)
+	})
+	if err != nil {
+		return false, err
+	}
+	return deleted, nil
+}
+
+// GetAccountCurrency returns the currency of one of the user's accounts
+func (r *IncomeEventRepository) GetAccountCurrency(userID, accountID string) (string, error) {
+	var currencies []string
+	result := r.db.Model(&models.Account{}).Where("id = ? AND user_id = ?", accountID, userID).Pluck("currency", &currencies)
+	if result.Error != nil {
+		log.Println("Failed to fetch account currency:", result.Error)
+		return "", result.Error
+	}
+	if len(currencies) == 0 {
+		return "", gorm.ErrRecordNotFound
+	}
+	return currencies[0], nil
+}
+
+// replaceIncomeSettlement swaps the event's cash ledger entry for the given one, if any, and
+// refreshes the balances of the affected accounts
+func replaceIncomeSettlement(tx *gorm.DB, eventID string, settlement *models.CashLedgerEntry, accountIDs ...string) error {
+	if err := tx.Where("income_event_id = ?", eventID).Delete(&models.CashLedgerEntry{}).Error; err != nil {
+		log.Println("Failed to clear income settlement:", err)
+		return err
+	}
+	if settlement != nil {
+		if err := createCashEntry(tx, settlement); err != nil {
+			return err
+		}
+		accountIDs = append(accountIDs, settlement.AccountID)
+	}
+	return refreshAccountBalances(tx, accountIDs...)
+}
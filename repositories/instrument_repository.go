@@ -0,0 +1,113 @@
+package repositories
+
+import (
+	"errors"
+	"log"
+	"strings"
+
+	"asset-dairy/models"
+
+	"gorm.io/gorm"
+)
+
+// InstrumentRepositoryInterface defines methods for instrument catalog storage
+type InstrumentRepositoryInterface interface {
+	SearchInstruments(query string, limit int) ([]models.Instrument, error)
+	GetInstrument(instrumentID string) (*models.Instrument, error)
+	FindInstrument(symbol, currency string) (*models.Instrument, error)
+	CreateInstrument(instrument models.Instrument) error
+	UpdateInstrument(instrument models.Instrument) (bool, error)
+	DeleteInstrument(instrumentID string) (bool, error)
+	HasTrades(instrumentID string) (bool, error)
+}
+
+// InstrumentRepository implements InstrumentRepositoryInterface
+type InstrumentRepository struct {
+	db *gorm.DB
+}
+
+// NewInstrumentRepository creates a new InstrumentRepository instance
+func NewInstrumentRepository(db *gorm.DB) *InstrumentRepository {
+	return &InstrumentRepository{db: db}
+}
+
+// SearchInstruments retrieves instruments whose symbol, name, ISIN or CUSIP contains the query,
+// exact symbol matches first, or every instrument when the query is empty
+func (r *InstrumentRepository) SearchInstruments(query string, limit int) ([]models.Instrument, error) {
+	var instruments []models.Instrument
+	db := r.db
+	if query = strings.TrimSpace(query); query != "" {
+		pattern := "%" + strings.ToLower(query) + "%"
+		db = db.Where("LOWER(symbol) LIKE ? OR LOWER(name) LIKE ? OR LOWER(isin) LIKE ? OR LOWER(cusip) LIKE ?", pattern, pattern, pattern, pattern).
+			Order(gorm.Expr("CASE WHEN UPPER(symbol) = ? THEN 0 ELSE 1 END", strings.ToUpper(query)))
+	}
+	if result := db.Order("symbol ASC, currency ASC").Limit(limit).Find(&instruments); result.Error != nil {
+		log.Println("Failed to search instruments:", result.Error)
+		return nil, result.Error
+	}
+	return instruments, nil
+}
+
+func (r *InstrumentRepository) GetInstrument(instrumentID string) (*models.Instrument, error) {
+	var instrument models.Instrument
+	if result := r.db.Where("id = ?", instrumentID).First(&instrument); result.Error != nil {
+		if !errors.Is(result.Error, gorm.ErrRecordNotFound) {
+			log.Println("Failed to find instrument:", result.Error)
+		}
+		return nil, result.Error
+	}
+	return &instrument, nil
+}
+
+// FindInstrument returns the instrument listed under a symbol in a currency, or nil when the
+// catalog has none
+func (r *InstrumentRepository) FindInstrument(symbol, currency string) (*models.Instrument, error) {
+	var instruments []models.Instrument
+	result := r.db.Where("UPPER(symbol) = ? AND UPPER(currency) = ?", strings.ToUpper(symbol), strings.ToUpper(currency)).Limit(1).Find(&instruments)
+	if result.Error != nil {
+		log.Println("Failed to find instrument:", result.Error)
+		return nil, result.Error
+	}
+	if len(instruments) == 0 {
+		return nil, nil
+	}
+	return &instruments[0], nil
+}
+
+func (r *InstrumentRepository) CreateInstrument(instrument models.Instrument) error {
+	if err := r.db.Create(&instrument).Error; err != nil {
+		log.Println("Failed to create instrument:", err)
+		return err
+	}
+	return nil
+}
+
+// UpdateInstrument replaces every field of a stored instrument and reports whether it existed
+func (r *InstrumentRepository) UpdateInstrument(instrument models.Instrument) (bool, error) {
+	result := r.db.Model(&models.Instrument{}).Where("id = ?", instrument.ID).Select("*").Omit("id", "created_at").Updates(&instrument)
+	if result.Error != nil {
+		log.Println("Failed to update instrument:", result.Error)
+		return false, result.Error
+	}
+	return result.RowsAffected > 0, nil
+}
+
+// HasTrades reports whether any trade is linked to the instrument
+func (r *InstrumentRepository) HasTrades(instrumentID string) (bool, error) {
+	var count int64
+	result := r.db.Model(&models.Trade{}).Where("instrument_id = ?", instrumentID).Count(&count)
+	if result.Error != nil {
+		log.Println("Failed to check instrument trades:", result.Error)
+		return false, result.Error
+	}
+	return count > 0, nil
+}
+
+func (r *InstrumentRepository) DeleteInstrument(instrumentID string) (bool, error) {
+	result := r.db.Where("id = ?", instrumentID).Delete(&models.Instrument{})
+	if result.Error != nil {
+		log.Println("Failed to delete instrument:", result.Error)
+		return false, result.Error
+	}
+	return result.RowsAffected > 0, nil
+}
@@ -0,0 +1,135 @@
+package repositories
+
+import (
+	"log"
+	"time"
+
+	"asset-dairy/models"
+
+	"gorm.io/gorm"
+)
+
+// PortfolioSnapshotRepositoryInterface defines methods for daily valuation snapshot storage
+type PortfolioSnapshotRepositoryInterface interface {
+	ListSnapshotUserIDs() ([]string, error)
+	LatestSnapshot(userID string) (*models.PortfolioSnapshot, error)
+	EarliestTradeDate(userID string) (*time.Time, error)
+	GetStaleDate(userID string) (*models.PortfolioSnapshotStaleDate, error)
+	ReplaceSnapshots(userID string, from, to time.Time, snapshots []models.PortfolioSnapshot, stale *models.PortfolioSnapshotStaleDate) error
+	ListSnapshots(userID string, accountID *string, from, to time.Time) ([]models.PortfolioSnapshot, error)
+}
+
+// PortfolioSnapshotRepository implements PortfolioSnapshotRepositoryInterface
+type PortfolioSnapshotRepository struct {
+	db *gorm.DB
+}
+
+// NewPortfolioSnapshotRepository creates a new PortfolioSnapshotRepository instance
+func NewPortfolioSnapshotRepository(db *gorm.DB) *PortfolioSnapshotRepository {
+	return &PortfolioSnapshotRepository{db: db}
+}
+
+// ListSnapshotUserIDs retrieves the users that have at least one trade
+func (r *PortfolioSnapshotRepository) ListSnapshotUserIDs() ([]string, error) {
+	var userIDs []string
+	result := r.db.Model(&models.Trade{}).Distinct().Pluck("user_id", &userIDs)
+	if result.Error != nil {
+		log.Println("Failed to fetch snapshot users:", result.Error)
+		return nil, result.Error
+	}
+	return userIDs, nil
+}
+
+// LatestSnapshot retrieves the newest portfolio-level snapshot of a user, or nil when there is none
+func (r *PortfolioSnapshotRepository) LatestSnapshot(userID string) (*models.PortfolioSnapshot, error) {
+	var snapshots []models.PortfolioSnapshot
+	result := r.db.Where("user_id = ? AND account_id IS NULL", userID).Order("date DESC").Limit(1).Find(&snapshots)
+	if result.Error != nil {
+		log.Println("Failed to fetch latest snapshot:", result.Error)
+		return nil, result.Error
+	}
+	if len(snapshots) == 0 {
+		return nil, nil
+	}
+	return &snapshots[0], nil
+}
+
+// EarliestTradeDate retrieves the date of a user's first trade, or nil when there are none
+func (r *PortfolioSnapshotRepository) EarliestTradeDate(userID string) (*time.Time, error) {
+	var dates []time.Time
+	result := r.db.Model(&models.Trade{}).
+		Where("user_id = ?", userID).
+		Order("trade_date ASC").Limit(1).Pluck("trade_date", &dates)
+	if result.Error != nil {
+		log.Println("Failed to fetch earliest trade date:", result.Error)
+		return nil, result.Error
+	}
+	if len(dates) == 0 {
+		return nil, nil
+	}
+	return &dates[0], nil
+}
+
+// GetStaleDate retrieves the date from which a user's snapshots are out of date, or nil when
+// they all match the user's records
+func (r *PortfolioSnapshotRepository) GetStaleDate(userID string) (*models.PortfolioSnapshotStaleDate, error) {
+	var stale []models.PortfolioSnapshotStaleDate
+	result := r.db.Where("user_id = ?", userID).Limit(1).Find(&stale)
+	if result.Error != nil {
+		log.Println("Failed to fetch stale snapshot date:", result.Error)
+		return nil, result.Error
+	}
+	if len(stale) == 0 {
+		return nil, nil
+	}
+	return &stale[0], nil
+}
+
+// ReplaceSnapshots swaps a user's snapshots between two dates, inclusive, for the given ones,
+// and clears the stale date they were rebuilt for unless a change marked it again meanwhile.
+// A transaction-scoped advisory lock on the user serializes concurrent writers, so several
+// server instances snapshotting the same user end up with a single set of rows.
+func (r *PortfolioSnapshotRepository) ReplaceSnapshots(userID string, from, to time.Time, snapshots []models.PortfolioSnapshot, stale *models.PortfolioSnapshotStaleDate) error {
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Exec("SELECT pg_advisory_xact_lock(hashtext('portfolio_snapshots:' || ?))", userID).Error; err != nil {
+			log.Println("Failed to lock snapshots:", err)
+			return err
+		}
+		if stale != nil {
+			if err := tx.Where("user_id = ? AND marked_at = ?", userID, stale.MarkedAt).Delete(&models.PortfolioSnapshotStaleDate{}).Error; err != nil {
+				log.Println("Failed to clear stale snapshot date:", err)
+				return err
+			}
+		}
+		if err := tx.Where("user_id = ? AND date BETWEEN ? AND ?", userID, from, to).Delete(&models.PortfolioSnapshot{}).Error; err != nil {
+			log.Println("Failed to delete snapshots:", err)
+			return err
+		}
+		if len(snapshots) == 0 {
+			return nil
+		}
+		if err := tx.CreateInBatches(&snapshots, 500).Error; err != nil {
+			log.Println("Failed to create snapshots:", err)
+			return err
+		}
+		return nil
+	})
+}
+
+// ListSnapshots retrieves the snapshots of a user's portfolio, or of one account when accountID
+// is set, between two dates, inclusive, oldest first
+func (r *PortfolioSnapshotRepository) ListSnapshots(userID string, accountID *string, from, to time.Time) ([]models.PortfolioSnapshot, error) {
+	var snapshots []models.PortfolioSnapshot
+	query := r.db.Where("user_id = ? AND date BETWEEN ? AND ?", userID, from, to)
+	if accountID != nil {
+		query = query.Where("account_id = ?", *accountID)
+	} else {
+		query = query.Where("account_id IS NULL")
+	}
+	result := query.Order("date ASC").Find(&snapshots)
+	if result.Error != nil {
+		log.Println("Failed to fetch snapshots:", result.Error)
+		return nil, result.Error
+	}
+	return snapshots, nil
+}
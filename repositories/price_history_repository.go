@@ -0,0 +1,85 @@
+package repositories
+
+import (
+	"log"
+	"time"
+
+	"asset-dairy/models"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// PriceHistoryRepositoryInterface defines methods for daily price bar storage
+type PriceHistoryRepositoryInterface interface {
+	ListRange(ticker string, from, to time.Time) ([]models.PriceHistory, error)
+	FindLatestBefore(ticker string, date time.Time) (*models.PriceHistory, error)
+	UpsertBars(bars []models.PriceHistory) error
+}
+
+// PriceHistoryRepository implements PriceHistoryRepositoryInterface
+type PriceHistoryRepository struct {
+	db *gorm.DB
+}
+
+// NewPriceHistoryRepository creates a new PriceHistoryRepository instance
+func NewPriceHistoryRepository(db *gorm.DB) *PriceHistoryRepository {
+	return &PriceHistoryRepository{db: db}
+}
+
+// ListRange retrieves the stored bars of a ticker between two dates, inclusive, oldest first
+func (r *PriceHistoryRepository) ListRange(ticker string, from, to time.Time) ([]models.PriceHistory, error) {
+	var bars []models.PriceHistory
+	result := r.db.Where("ticker = ? AND date BETWEEN ? AND ?", ticker, from, to).Order("date ASC").Find(&bars)
+	if result.Error != nil {
+		log.Println("Failed to fetch price history:", result.Error)
+		return nil, result.Error
+	}
+	return bars, nil
+}
+
+// FindLatestBefore retrieves the newest bar of a ticker strictly before the date, or nil when there is none
+func (r *PriceHistoryRepository) FindLatestBefore(ticker string, date time.Time) (*models.PriceHistory, error) {
+	var bars []models.PriceHistory
+	result := r.db.Where("ticker = ? AND date < ?", ticker, date).Order("date DESC").Limit(1).Find(&bars)
+	if result.Error != nil {
+		log.Println("Failed to fetch price history:", result.Error)
+		return nil, result.Error
+	}
+	if len(bars) == 0 {
+		return nil, nil
+	}
+	return &bars[0], nil
+}
+
+// UpsertBars stores the bars, replacing any stored bar of the same ticker and date. Snapshots
+// value positions at these closes, so every holder of a ticker has their snapshots marked stale
+// from its earliest bar.
+func (r *PriceHistoryRepository) UpsertBars(bars []models.PriceHistory) error {
+	if len(bars) == 0 {
+		return nil
+	}
+	earliest := make(map[string]time.Time)
+	for _, bar := range bars {
+		if date, ok := earliest[bar.Ticker]; !ok || bar.Date.Before(date) {
+			earliest[bar.Ticker] = bar.Date
+		}
+	}
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		result := tx.Clauses(clause.OnConflict{
+			Columns:   []clause.Column{{Name: "ticker"}, {Name: "date"}},
+			DoUpdates: clause.AssignmentColumns([]string{"asset_type", "currency", "open", "high", "low", "close", "volume"}),
+		}).CreateInBatches(&bars, 500)
+		if result.Error != nil {
+			log.Println("Failed to upsert price history:", result.Error)
+			return result.Error
+		}
+		for ticker, date := range earliest {
+			if err := tx.Exec("SELECT mark_ticker_snapshots_stale(?, ?)", ticker, date).Error; err != nil {
+				log.Println("Failed to mark snapshots stale:", err)
+				return err
+			}
+		}
+		return nil
+	})
+}
@@ -0,0 +1,71 @@
+package repositories
+
+import (
+	"log"
+
+	"asset-dairy/models"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// PriceRepositoryInterface defines methods for latest market quote storage
+type PriceRepositoryInterface interface {
+	ListPrices() ([]models.Price, error)
+	FindPrices(tickers []string) ([]models.Price, error)
+	UpsertPrices(prices []models.Price) error
+}
+
+// PriceRepository implements PriceRepositoryInterface
+type PriceRepository struct {
+	db *gorm.DB
+}
+
+// NewPriceRepository creates a new PriceRepository instance
+func NewPriceRepository(db *gorm.DB) *PriceRepository {
+	return &PriceRepository{db: db}
+}
+
+// ListPrices retrieves every stored quote
+func (r *PriceRepository) ListPrices() ([]models.Price, error) {
+	var prices []models.Price
+	result := r.db.Order("ticker ASC, currency ASC").Find(&prices)
+	if result.Error != nil {
+		log.Println("Failed to fetch prices:", result.Error)
+		return nil, result.Error
+	}
+	return prices, nil
+}
+
+// FindPrices retrieves the quotes of the given tickers in every currency
+func (r *PriceRepository) FindPrices(tickers []string) ([]models.Price, error) {
+	var prices []models.Price
+	if len(tickers) == 0 {
+		return prices, nil
+	}
+	result := r.db.Where("ticker IN ?", tickers).Find(&prices)
+	if result.Error != nil {
+		log.Println("Failed to fetch prices:", result.Error)
+		return nil, result.Error
+	}
+	return prices, nil
+}
+
+// UpsertPrices stores the quotes, replacing an older quote of the same ticker and currency
+func (r *PriceRepository) UpsertPrices(prices []models.Price) error {
+	if len(prices) == 0 {
+		return nil
+	}
+	result := r.db.Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "ticker"}, {Name: "currency"}},
+		DoUpdates: clause.AssignmentColumns([]string{"price", "as_of"}),
+		Where: clause.Where{Exprs: []clause.Expression{
+			clause.Expr{SQL: "prices.as_of <= excluded.as_of"},
+		}},
+	}).Create(&prices)
+	if result.Error != nil {
+		log.Println("Failed to upsert prices:", result.Error)
+		return result.Error
+	}
+	return nil
+}
@@ -64,6 +64,7 @@ func (r *ProfileRepository) GetProfile(userID string) (*models.Profile, error) {
 			YearsInvesting:                       int(investmentProfile.YearsInvesting),
 			MonthlyCashFlow:                      investmentProfile.MonthlyCashFlow,
 			DefaultCurrency:                      investmentProfile.DefaultCurrency,
+			CostBasisMethod:                      investmentProfile.CostBasisMethod,
 		},
 	}, nil
 }
@@ -125,6 +126,11 @@ func (r *ProfileRepository) UpdateProfile(userID string, req *models.UserUpdateR
 		var existingProfile models.InvestmentProfile
 		result = r.db.Where(&models.InvestmentProfile{UserID: userID}).First(&existingProfile)
 
+		costBasisMethod := req.InvestmentProfile.CostBasisMethod
+		if costBasisMethod == "" {
+			costBasisMethod = models.CostBasisFIFO
+		}
+
 		if result.Error == gorm.ErrRecordNotFound {
 			// Create new investment profile
 			newProfile := models.InvestmentProfile{
@@ -136,6 +142,7 @@ func (r *ProfileRepository) UpdateProfile(userID string, req *models.UserUpdateR
 				YearsInvesting:                       int(req.InvestmentProfile.YearsInvesting),
 				MonthlyCashFlow:                      req.InvestmentProfile.MonthlyCashFlow,
 				DefaultCurrency:                      req.InvestmentProfile.DefaultCurrency,
+				CostBasisMethod:                      costBasisMethod,
 			}
 			existingProfile = newProfile
 			result = r.db.Create(&newProfile)
@@ -148,6 +155,7 @@ func (r *ProfileRepository) UpdateProfile(userID string, req *models.UserUpdateR
 			existingProfile.YearsInvesting = int(req.InvestmentProfile.YearsInvesting)
 			existingProfile.MonthlyCashFlow = req.InvestmentProfile.MonthlyCashFlow
 			existingProfile.DefaultCurrency = req.InvestmentProfile.DefaultCurrency
+			existingProfile.CostBasisMethod = costBasisMethod
 			result = r.db.Save(&existingProfile)
 		} else {
 			log.Println("Failed to process investment profile:", result.Error)
@@ -171,6 +179,7 @@ func (r *ProfileRepository) UpdateProfile(userID string, req *models.UserUpdateR
 				YearsInvesting:                       int(existingProfile.YearsInvesting),
 				MonthlyCashFlow:                      existingProfile.MonthlyCashFlow,
 				DefaultCurrency:                      existingProfile.DefaultCurrency,
+				CostBasisMethod:                      existingProfile.CostBasisMethod,
 			},
 		}, nil
 	}
@@ -0,0 +1,85 @@
+package repositories
+
+import (
+	"log"
+
+	"asset-dairy/models"
+
+	"gorm.io/gorm"
+)
+
+// StatementImportRepositoryInterface defines methods for de-duplicating imported statements
+type StatementImportRepositoryInterface interface {
+	ListExternalIDs(userID, accountID string) (*models.ImportedExternalIDs, error)
+	CreateRecords(userID string, trades []models.Trade, entries []models.CashLedgerEntry, events []models.IncomeEvent) error
+}
+
+// StatementImportRepository implements StatementImportRepositoryInterface
+type StatementImportRepository struct {
+	db *gorm.DB
+}
+
+// NewStatementImportRepository creates a new StatementImportRepository instance
+func NewStatementImportRepository(db *gorm.DB) *StatementImportRepository {
+	return &StatementImportRepository{db: db}
+}
+
+// ListExternalIDs retrieves the external IDs of the trades, cash ledger entries and income
+// events already stored in one of the user's accounts
+func (r *StatementImportRepository) ListExternalIDs(userID, accountID string) (*models.ImportedExternalIDs, error) {
+	imported := &models.ImportedExternalIDs{
+		Trades:       map[string]bool{},
+		CashEntries:  map[string]bool{},
+		IncomeEvents: map[string]bool{},
+	}
+	for _, source := range []struct {
+		model interface{}
+		ids   map[string]bool
+	}{
+		{&models.Trade{}, imported.Trades},
+		{&models.CashLedgerEntry{}, imported.CashEntries},
+		{&models.IncomeEvent{}, imported.IncomeEvents},
+	} {
+		var ids []string
+		result := r.db.Model(source.model).
+			Where("user_id = ? AND account_id = ? AND external_id IS NOT NULL", userID, accountID).
+			Pluck("external_id", &ids)
+		if result.Error != nil {
+			log.Println("Failed to fetch external IDs:", result.Error)
+			return nil, result.Error
+		}
+		for _, id := range ids {
+			source.ids[id] = true
+		}
+	}
+	return imported, nil
+}
+
+// CreateRecords stores the trades, cash ledger entries and income events of a statement, with
+// their settlements, in one transaction, so a failed import stores nothing
+func (r *StatementImportRepository) CreateRecords(userID string, trades []models.Trade, entries []models.CashLedgerEntry, events []models.IncomeEvent) error {
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		for _, trade := range trades {
+			if err := createTrade(tx, userID, trade); err != nil {
+				return err
+			}
+		}
+		accountIDs := []string{}
+		for i := range entries {
+			if err := createCashEntry(tx, &entries[i]); err != nil {
+				return err
+			}
+			accountIDs = append(accountIDs, entries[i].AccountID)
+		}
+		for i := range events {
+			if err := tx.Create(&events[i]).Error; err != nil {
+				log.Println("Failed to create income event:", err)
+				return err
+			}
+			if err := replaceIncomeSettlement(tx, events[i].ID, events[i].Settlement, events[i].AccountID); err != nil {
+				return err
+			}
+		}
+		return refreshAccountBalances(tx, accountIDs...)
+	})
+}
@@ -0,0 +1,97 @@
+package repositories
+
+import (
+	"errors"
+	"log"
+
+	"asset-dairy/models"
+
+	"gorm.io/gorm"
+)
+
+// TradeImportProfileRepositoryInterface defines methods for saved trade import mappings
+type TradeImportProfileRepositoryInterface interface {
+	ListProfiles(userID string) ([]models.TradeImportProfile, error)
+	GetProfile(userID, profileID string) (*models.TradeImportProfile, error)
+	FindProfileByName(userID, name string) (*models.TradeImportProfile, error)
+	CreateProfile(profile models.TradeImportProfile) error
+	UpdateProfile(profile models.TradeImportProfile) (bool, error)
+	DeleteProfile(userID, profileID string) (bool, error)
+}
+
+// TradeImportProfileRepository implements TradeImportProfileRepositoryInterface
+type TradeImportProfileRepository struct {
+	db *gorm.DB
+}
+
+// NewTradeImportProfileRepository creates a new TradeImportProfileRepository instance
+func NewTradeImportProfileRepository(db *gorm.DB) *TradeImportProfileRepository {
+	return &TradeImportProfileRepository{db: db}
+}
+
+// ListProfiles retrieves the user's import profiles by name
+func (r *TradeImportProfileRepository) ListProfiles(userID string) ([]models.TradeImportProfile, error) {
+	var profiles []models.TradeImportProfile
+	result := r.db.Where(&models.TradeImportProfile{UserID: userID}).Order("name ASC").Find(&profiles)
+	if result.Error != nil {
+		log.Println("Failed to fetch import profiles:", result.Error)
+		return nil, result.Error
+	}
+	return profiles, nil
+}
+
+func (r *TradeImportProfileRepository) GetProfile(userID, profileID string) (*models.TradeImportProfile, error) {
+	var profile models.TradeImportProfile
+	result := r.db.Where(&models.TradeImportProfile{ID: profileID, UserID: userID}).First(&profile)
+	if result.Error != nil {
+		if !errors.Is(result.Error, gorm.ErrRecordNotFound) {
+			log.Println("Failed to find import profile:", result.Error)
+		}
+		return nil, result.Error
+	}
+	return &profile, nil
+}
+
+// FindProfileByName returns the user's profile with the name, or nil when there is none
+func (r *TradeImportProfileRepository) FindProfileByName(userID, name string) (*models.TradeImportProfile, error) {
+	var profiles []models.TradeImportProfile
+	result := r.db.Where(&models.TradeImportProfile{UserID: userID, Name: name}).Limit(1).Find(&profiles)
+	if result.Error != nil {
+		log.Println("Failed to find import profile:", result.Error)
+		return nil, result.Error
+	}
+	if len(profiles) == 0 {
+		return nil, nil
+	}
+	return &profiles[0], nil
+}
+
+func (r *TradeImportProfileRepository) CreateProfile(profile models.TradeImportProfile) error {
+	if err := r.db.Create(&profile).Error; err != nil {
+		log.Println("Failed to create import profile:", err)
+		return err
+	}
+	return nil
+}
+
+// UpdateProfile replaces the name and mapping of a stored profile and reports whether it existed
+func (r *TradeImportProfileRepository) UpdateProfile(profile models.TradeImportProfile) (bool, error) {
+	result := r.db.Model(&models.TradeImportProfile{}).
+		Where("id = ? AND user_id = ?", profile.ID, profile.UserID).
+		Select("name", "mapping", "updated_at").
+		Updates(&profile)
+	if result.Error != nil {
+		log.Println("Failed to update import profile:", result.Error)
+		return false, result.Error
+	}
+	return result.RowsAffected > 0, nil
+}
+
+func (r *TradeImportProfileRepository) DeleteProfile(userID, profileID string) (bool, error) {
+	result := r.db.Where("id = ? AND user_id = ?", profileID, userID).Delete(&models.TradeImportProfile{})
+	if result.Error != nil {
+		log.Println("Failed to delete import profile:", result.Error)
+		return false, result.Error
+	}
+	return result.RowsAffected > 0, nil
+}
@@ -2,21 +2,32 @@ package repositories
 
 import (
 	"log"
-	"time"
 
 	"asset-dairy/models"
 
 	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 )
 
 // TradeRepositoryInterface defines methods for trade-related database operations
 type TradeRepositoryInterface interface {
 	ListTrades(userID string) ([]models.Trade, error)
+	ListTradingUserIDs() ([]string, error)
+	GetTrade(userID, tradeID string) (*models.Trade, error)
 	CreateTrade(userID string, trade models.Trade) error
-	UpdateTrade(userID, tradeID string, req models.TradeUpdateRequest) (*models.Trade, error)
+	CreateTrades(userID string, trades []models.Trade) error
+	UpdateTrade(userID string, trade models.Trade) (*models.Trade, error)
 	DeleteTrade(userID, tradeID string) (bool, error)
 	IsAccountOwnedByUser(accountID, userID string) (bool, error)
 	IsTradeOwnedByUser(tradeID, userID string) (bool, error)
+	ListShortableAccountIDs(userID string) ([]string, error)
+	ListReceivedUnits(userID string) ([]models.IncomeEvent, error)
+	GetAccountCurrency(userID, accountID string) (string, error)
+	GetCostBasisMethods(userID string) (string, map[string]string, error)
+	MergeTrades(userID, keepTradeID string, tradeIDs []string, externalID *string, sells []models.Trade) error
+	ListDuplicateDismissals(userID string) ([]models.TradeDuplicateDismissal, error)
+	DismissDuplicates(dismissals []models.TradeDuplicateDismissal) error
+	WithUserLock(userID string, fn func() error) error
 }
 
 // TradeRepository implements TradeRepositoryInterface
@@ -29,10 +40,27 @@ func NewTradeRepository(db *gorm.DB) *TradeRepository {
 	return &TradeRepository{db: db}
 }
 
-// ListTrades retrieves all trades for a given user
+// WithUserLock runs fn while holding a transaction-scoped advisory lock on the user's trades, so
+// checking a change against the history and storing it never interleaves with another change
+// of the same user, on this server instance or another. fn must not take the lock again.
+func (r *TradeRepository) WithUserLock(userID string, fn func() error) error {
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Exec("SELECT pg_advisory_xact_lock(hashtext('trades:' || ?))", userID).Error; err != nil {
+			log.Println("Failed to lock trades:", err)
+			return err
+		}
+		return fn()
+	})
+}
+
+// ListTrades retrieves all trades for a given user in chronological order,
+// using creation time and ID to order trades on the same date deterministically
 func (r *TradeRepository) ListTrades(userID string) ([]models.Trade, error) {
 	var gormTrades []models.Trade
-	result := r.db.Where(&models.Trade{UserID: userID}).Find(&gormTrades)
+	result := r.db.Preload("LotAllocations").
+		Where(&models.Trade{UserID: userID}).
+		Order("trade_date ASC, created_at ASC, id ASC").
+		Find(&gormTrades)
 	if result.Error != nil {
 		log.Println("TradeRepository: Failed to fetch trades:", result.Error)
 		return nil, result.Error
@@ -41,16 +69,28 @@ func (r *TradeRepository) ListTrades(userID string) ([]models.Trade, error) {
 	trades := []models.Trade{}
 	for _, gormTrade := range gormTrades {
 		trade := models.Trade{
-			ID:        gormTrade.ID,
-			Type:      gormTrade.Type,
-			AssetType: gormTrade.AssetType,
-			Ticker:    gormTrade.Ticker,
-			TradeDate: gormTrade.TradeDate,
-			Quantity:  gormTrade.Quantity,
-			Price:     gormTrade.Price,
-			Currency:  gormTrade.Currency,
-			AccountID: gormTrade.AccountID,
-			Reason:    gormTrade.Reason,
+			ID:             gormTrade.ID,
+			Type:           gormTrade.Type,
+			AssetType:      gormTrade.AssetType,
+			Ticker:         gormTrade.Ticker,
+			TradeDate:      gormTrade.TradeDate,
+			Quantity:       gormTrade.Quantity,
+			Price:          gormTrade.Price,
+			Currency:       gormTrade.Currency,
+			AccountID:      gormTrade.AccountID,
+			Reason:         gormTrade.Reason,
+			Fee:            gormTrade.Fee,
+			FeeCurrency:    gormTrade.FeeCurrency,
+			Tax:            gormTrade.Tax,
+			TaxCurrency:    gormTrade.TaxCurrency,
+			CreatedAt:      gormTrade.CreatedAt,
+			LotAllocations: gormTrade.LotAllocations,
+			InstrumentID:   gormTrade.InstrumentID,
+			Multiplier:     gormTrade.Multiplier,
+			PositionEffect: gormTrade.PositionEffect,
+			ExternalID:     gormTrade.ExternalID,
+			Transfer:       gormTrade.Transfer,
+			SettlementRate: gormTrade.SettlementRate,
 		}
 		trades = append(trades, trade)
 	}
@@ -58,6 +98,51 @@ func (r *TradeRepository) ListTrades(userID string) ([]models.Trade, error) {
 	return trades, nil
 }
 
+// ListTradingUserIDs retrieves the IDs of the users who have recorded trades
+func (r *TradeRepository) ListTradingUserIDs() ([]string, error) {
+	var userIDs []string
+	if err := r.db.Model(&models.Trade{}).Distinct("user_id").Pluck("user_id", &userIDs).Error; err != nil {
+		log.Println("Failed to fetch trading users:", err)
+		return nil, err
+	}
+	return userIDs, nil
+}
+
+// GetTrade retrieves a single trade of the user together with its lot allocations
+func (r *TradeRepository) GetTrade(userID, tradeID string) (*models.Trade, error) {
+	var gormTrade models.Trade
+	result := r.db.Preload("LotAllocations").Where(&models.Trade{ID: tradeID, UserID: userID}).First(&gormTrade)
+	if result.Error != nil {
+		log.Println("Failed to find trade:", result.Error)
+		return nil, result.Error
+	}
+
+	return &models.Trade{
+		ID:             gormTrade.ID,
+		Type:           gormTrade.Type,
+		AssetType:      gormTrade.AssetType,
+		Ticker:         gormTrade.Ticker,
+		TradeDate:      gormTrade.TradeDate,
+		Quantity:       gormTrade.Quantity,
+		Price:          gormTrade.Price,
+		Currency:       gormTrade.Currency,
+		AccountID:      gormTrade.AccountID,
+		Reason:         gormTrade.Reason,
+		Fee:            gormTrade.Fee,
+		FeeCurrency:    gormTrade.FeeCurrency,
+		Tax:            gormTrade.Tax,
+		TaxCurrency:    gormTrade.TaxCurrency,
+		CreatedAt:      gormTrade.CreatedAt,
+		LotAllocations: gormTrade.LotAllocations,
+		InstrumentID:   gormTrade.InstrumentID,
+		Multiplier:     gormTrade.Multiplier,
+		PositionEffect: gormTrade.PositionEffect,
+		ExternalID:     gormTrade.ExternalID,
+		Transfer:       gormTrade.Transfer,
+		SettlementRate: gormTrade.SettlementRate,
+	}, nil
+}
+
 func (r *TradeRepository) IsAccountOwnedByUser(accountID, userID string) (bool, error) {
 	var count int64
 	result := r.db.Model(&models.Account{}).Where(&models.Account{ID: accountID, UserID: userID}).Count(&count)
@@ -70,89 +155,296 @@ func (r *TradeRepository) IsTradeOwnedByUser(tradeID, userID string) (bool, erro
 	return count > 0, result.Error
 }
 
-func (r *TradeRepository) CreateTrade(userID string, trade models.Trade) error {
-	gormTrade := &models.Trade{
-		ID:        trade.ID,
-		UserID:    userID,
-		Type:      trade.Type,
-		AssetType: trade.AssetType,
-		Ticker:    trade.Ticker,
-		TradeDate: trade.TradeDate,
-		Quantity:  trade.Quantity,
-		Price:     trade.Price,
-		Currency:  trade.Currency,
-		AccountID: trade.AccountID,
-		Reason:    trade.Reason,
+// ListShortableAccountIDs returns the IDs of the user's accounts that allow short positions
+func (r *TradeRepository) ListShortableAccountIDs(userID string) ([]string, error) {
+	var ids []string
+	result := r.db.Model(&models.Account{}).Where("user_id = ? AND allow_short", userID).Pluck("id", &ids)
+	if result.Error != nil {
+		log.Println("Failed to fetch shortable accounts:", result.Error)
+		return nil, result.Error
 	}
-
-	result := r.db.Create(gormTrade)
-	return result.Error
+	return ids, nil
 }
 
-func (r *TradeRepository) UpdateTrade(userID, tradeID string, req models.TradeUpdateRequest) (*models.Trade, error) {
-	var gormTrade models.Trade
-	result := r.db.Where(&models.Trade{ID: tradeID, UserID: userID}).First(&gormTrade)
+// ListReceivedUnits retrieves the user's income events that paid out units, such as stock
+// dividends and staking rewards, which add to positions like buys
+func (r *TradeRepository) ListReceivedUnits(userID string) ([]models.IncomeEvent, error) {
+	var events []models.IncomeEvent
+	result := r.db.Where("user_id = ? AND quantity IS NOT NULL", userID).Order("pay_date, created_at").Find(&events)
 	if result.Error != nil {
-		log.Println("Failed to find trade:", result.Error)
+		log.Println("Failed to fetch received units:", result.Error)
 		return nil, result.Error
 	}
+	return events, nil
+}
 
-	// Update fields if provided
-	if req.Type != "" {
-		gormTrade.Type = req.Type
+// GetAccountCurrency returns the currency of one of the user's accounts
+func (r *TradeRepository) GetAccountCurrency(userID, accountID string) (string, error) {
+	var currencies []string
+	result := r.db.Model(&models.Account{}).Where("id = ? AND user_id = ?", accountID, userID).Pluck("currency", &currencies)
+	if result.Error != nil {
+		log.Println("Failed to fetch account currency:", result.Error)
+		return "", result.Error
 	}
-	if req.AssetType != "" {
-		gormTrade.AssetType = req.AssetType
+	if len(currencies) == 0 {
+		return "", gorm.ErrRecordNotFound
 	}
-	if req.TradeDate != "" {
-		tradeDate, err := time.Parse("2006-01-02", req.TradeDate)
-		if err != nil {
-			return nil, err
-		}
-		gormTrade.TradeDate = tradeDate
+	return currencies[0], nil
+}
+
+// GetCostBasisMethods returns the cost-basis method of the user's investment profile, empty
+// when there is none, and the methods of the accounts that override it keyed by account ID
+func (r *TradeRepository) GetCostBasisMethods(userID string) (string, map[string]string, error) {
+	var defaultMethods []string
+	result := r.db.Model(&models.InvestmentProfile{}).Where("user_id = ?", userID).Pluck("cost_basis_method", &defaultMethods)
+	if result.Error != nil {
+		log.Println("Failed to fetch cost basis method:", result.Error)
+		return "", nil, result.Error
 	}
-	if req.Ticker != "" {
-		gormTrade.Ticker = req.Ticker
+	defaultMethod := ""
+	if len(defaultMethods) > 0 {
+		defaultMethod = defaultMethods[0]
 	}
-	if req.Quantity != 0 {
-		gormTrade.Quantity = req.Quantity
+
+	var accounts []models.Account
+	result = r.db.Select("id", "cost_basis_method").Where("user_id = ? AND cost_basis_method IS NOT NULL", userID).Find(&accounts)
+	if result.Error != nil {
+		log.Println("Failed to fetch account cost basis methods:", result.Error)
+		return "", nil, result.Error
 	}
-	if req.Price != 0 {
-		gormTrade.Price = req.Price
+	accountMethods := make(map[string]string, len(accounts))
+	for _, account := range accounts {
+		accountMethods[account.ID] = *account.CostBasisMethod
 	}
-	if req.Currency != "" {
-		gormTrade.Currency = req.Currency
+	return defaultMethod, accountMethods, nil
+}
+
+// CreateTrade stores the trade with its lot allocations and cash settlement
+func (r *TradeRepository) CreateTrade(userID string, trade models.Trade) error {
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		return createTrade(tx, userID, trade)
+	})
+}
+
+// CreateTrades stores the trades with their lot allocations and cash settlements in one
+// transaction
+func (r *TradeRepository) CreateTrades(userID string, trades []models.Trade) error {
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		for _, trade := range trades {
+			if err := createTrade(tx, userID, trade); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+func createTrade(tx *gorm.DB, userID string, trade models.Trade) error {
+	gormTrade := &models.Trade{
+		ID:             trade.ID,
+		UserID:         userID,
+		Type:           trade.Type,
+		AssetType:      trade.AssetType,
+		Ticker:         trade.Ticker,
+		TradeDate:      trade.TradeDate,
+		Quantity:       trade.Quantity,
+		Price:          trade.Price,
+		Currency:       trade.Currency,
+		AccountID:      trade.AccountID,
+		Reason:         trade.Reason,
+		Fee:            trade.Fee,
+		FeeCurrency:    trade.FeeCurrency,
+		Tax:            trade.Tax,
+		TaxCurrency:    trade.TaxCurrency,
+		InstrumentID:   trade.InstrumentID,
+		Multiplier:     trade.ContractSize(),
+		PositionEffect: trade.PositionEffect,
+		ExternalID:     trade.ExternalID,
+		Transfer:       trade.Transfer,
+		SettlementRate: trade.SettlementRate,
+		CreatedAt:      trade.CreatedAt,
 	}
-	if req.Reason != nil {
-		gormTrade.Reason = req.Reason
+
+	if err := tx.Create(gormTrade).Error; err != nil {
+		log.Println("Failed to create trade:", err)
+		return err
 	}
+	if err := replaceLotAllocations(tx, trade.ID, trade.LotAllocations); err != nil {
+		return err
+	}
+	return replaceSettlement(tx, trade.ID, trade.Settlement, trade.AccountID)
+}
 
-	result = r.db.Save(&gormTrade)
+// UpdateTrade saves the already merged trade and replaces its lot allocations and cash settlement
+func (r *TradeRepository) UpdateTrade(userID string, trade models.Trade) (*models.Trade, error) {
+	var gormTrade models.Trade
+	result := r.db.Where(&models.Trade{ID: trade.ID, UserID: userID}).First(&gormTrade)
 	if result.Error != nil {
-		log.Println("Failed to update trade:", result.Error)
+		log.Println("Failed to find trade:", result.Error)
 		return nil, result.Error
 	}
+	previousAccountID := gormTrade.AccountID
+
+	gormTrade.Type = trade.Type
+	gormTrade.AssetType = trade.AssetType
+	gormTrade.Ticker = trade.Ticker
+	gormTrade.TradeDate = trade.TradeDate
+	gormTrade.Quantity = trade.Quantity
+	gormTrade.Price = trade.Price
+	gormTrade.Currency = trade.Currency
+	gormTrade.AccountID = trade.AccountID
+	gormTrade.Reason = trade.Reason
+	gormTrade.Fee = trade.Fee
+	gormTrade.FeeCurrency = trade.FeeCurrency
+	gormTrade.Tax = trade.Tax
+	gormTrade.TaxCurrency = trade.TaxCurrency
+	gormTrade.InstrumentID = trade.InstrumentID
+	gormTrade.Multiplier = trade.ContractSize()
+	gormTrade.PositionEffect = trade.PositionEffect
+	gormTrade.SettlementRate = trade.SettlementRate
+
+	err := r.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Omit("LotAllocations").Save(&gormTrade).Error; err != nil {
+			log.Println("Failed to update trade:", err)
+			return err
+		}
+		if err := replaceLotAllocations(tx, gormTrade.ID, trade.LotAllocations); err != nil {
+			return err
+		}
+		return replaceSettlement(tx, gormTrade.ID, trade.Settlement, previousAccountID, gormTrade.AccountID)
+	})
+	if err != nil {
+		return nil, err
+	}
 
 	return &models.Trade{
-		ID:        gormTrade.ID,
-		Type:      gormTrade.Type,
-		AssetType: gormTrade.AssetType,
-		Ticker:    gormTrade.Ticker,
-		TradeDate: gormTrade.TradeDate,
-		Quantity:  gormTrade.Quantity,
-		Price:     gormTrade.Price,
-		Currency:  gormTrade.Currency,
-		AccountID: gormTrade.AccountID,
-		Reason:    gormTrade.Reason,
+		ID:             gormTrade.ID,
+		Type:           gormTrade.Type,
+		AssetType:      gormTrade.AssetType,
+		Ticker:         gormTrade.Ticker,
+		TradeDate:      gormTrade.TradeDate,
+		Quantity:       gormTrade.Quantity,
+		Price:          gormTrade.Price,
+		Currency:       gormTrade.Currency,
+		AccountID:      gormTrade.AccountID,
+		Reason:         gormTrade.Reason,
+		Fee:            gormTrade.Fee,
+		FeeCurrency:    gormTrade.FeeCurrency,
+		Tax:            gormTrade.Tax,
+		TaxCurrency:    gormTrade.TaxCurrency,
+		LotAllocations: trade.LotAllocations,
+		InstrumentID:   gormTrade.InstrumentID,
+		Multiplier:     gormTrade.Multiplier,
+		PositionEffect: gormTrade.PositionEffect,
+		ExternalID:     gormTrade.ExternalID,
+		Transfer:       gormTrade.Transfer,
+		SettlementRate: gormTrade.SettlementRate,
 	}, nil
 }
 
+// replaceLotAllocations swaps the stored allocations of a sell trade for the given ones
+func replaceLotAllocations(tx *gorm.DB, sellTradeID string, allocations []models.TradeLotAllocation) error {
+	if err := tx.Where(&models.TradeLotAllocation{SellTradeID: sellTradeID}).Delete(&models.TradeLotAllocation{}).Error; err != nil {
+		log.Println("Failed to clear lot allocations:", err)
+		return err
+	}
+	if len(allocations) == 0 {
+		return nil
+	}
+	if err := tx.Create(&allocations).Error; err != nil {
+		log.Println("Failed to create lot allocations:", err)
+		return err
+	}
+	return nil
+}
+
+// replaceSettlement swaps the trade's cash ledger entry for the given one, if any, and refreshes
+// the balances of the affected accounts
+func replaceSettlement(tx *gorm.DB, tradeID string, settlement *models.CashLedgerEntry, accountIDs ...string) error {
+	if err := tx.Where("trade_id = ?", tradeID).Delete(&models.CashLedgerEntry{}).Error; err != nil {
+		log.Println("Failed to clear trade settlement:", err)
+		return err
+	}
+	if settlement != nil {
+		if err := createCashEntry(tx, settlement); err != nil {
+			return err
+		}
+		accountIDs = append(accountIDs, settlement.AccountID)
+	}
+	return refreshAccountBalances(tx, accountIDs...)
+}
+
+// DeleteTrade removes the trade; its settlement goes with it and the account balance is refreshed
 func (r *TradeRepository) DeleteTrade(userID, tradeID string) (bool, error) {
-	result := r.db.Where("id = ? AND user_id = ?", tradeID, userID).Delete(&models.Trade{})
+	deleted := false
+	err := r.db.Transaction(func(tx *gorm.DB) error {
+		var accountIDs []string
+		if err := tx.Model(&models.Trade{}).Where("id = ? AND user_id = ?", tradeID, userID).Pluck("account_id", &accountIDs).Error; err != nil {
+			log.Println("Failed to find trade:", err)
+			return err
+		}
+		result := tx.Where("id = ? AND user_id = ?", tradeID, userID).Delete(&models.Trade{})
+		if result.Error != nil {
+			log.Println("Failed to delete trade:", result.Error)
+			return result.Error
+		}
+		deleted = result.RowsAffected > 0
+		return refreshAccountBalances(tx, accountIDs...)
+	})
+	if err != nil {
+		return false, err
+	}
+
+	return deleted, nil
+}
+
+// MergeTrades deletes the duplicates of a trade in one transaction, refreshing the balances
+// their settlements touched. The sells are stored with their lot allocations moved off the
+// duplicates first. A non-nil external ID is then given to the kept trade, so a statement that
+// brought in a deleted duplicate is still recognized when imported again.
+func (r *TradeRepository) MergeTrades(userID, keepTradeID string, tradeIDs []string, externalID *string, sells []models.Trade) error {
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		for _, sell := range sells {
+			if err := replaceLotAllocations(tx, sell.ID, sell.LotAllocations); err != nil {
+				return err
+			}
+		}
+		var accountIDs []string
+		if err := tx.Model(&models.Trade{}).Where("id IN ? AND user_id = ?", tradeIDs, userID).Pluck("account_id", &accountIDs).Error; err != nil {
+			log.Println("Failed to find trades:", err)
+			return err
+		}
+		if err := tx.Where("id IN ? AND user_id = ?", tradeIDs, userID).Delete(&models.Trade{}).Error; err != nil {
+			log.Println("Failed to delete trades:", err)
+			return err
+		}
+		if externalID != nil {
+			result := tx.Model(&models.Trade{}).Where("id = ? AND user_id = ?", keepTradeID, userID).Update("external_id", *externalID)
+			if result.Error != nil {
+				log.Println("Failed to update trade:", result.Error)
+				return result.Error
+			}
+		}
+		return refreshAccountBalances(tx, accountIDs...)
+	})
+}
+
+// ListDuplicateDismissals retrieves the pairs of trades the user kept apart
+func (r *TradeRepository) ListDuplicateDismissals(userID string) ([]models.TradeDuplicateDismissal, error) {
+	var dismissals []models.TradeDuplicateDismissal
+	result := r.db.Where(&models.TradeDuplicateDismissal{UserID: userID}).Find(&dismissals)
 	if result.Error != nil {
-		log.Println("Failed to delete trade:", result.Error)
-		return false, result.Error
+		log.Println("Failed to fetch duplicate dismissals:", result.Error)
+		return nil, result.Error
 	}
+	return dismissals, nil
+}
 
-	return result.RowsAffected > 0, nil
+// DismissDuplicates stores the pairs, skipping those already dismissed
+func (r *TradeRepository) DismissDuplicates(dismissals []models.TradeDuplicateDismissal) error {
+	if err := r.db.Clauses(clause.OnConflict{DoNothing: true}).Create(&dismissals).Error; err != nil {
+		log.Println("Failed to dismiss duplicates:", err)
+		return err
+	}
+	return nil
 }
@@ -13,6 +13,17 @@ func SetupRoutes(r *gin.Engine,
 	accountHandler *handlers.AccountHandler,
 	tradeHandler *handlers.TradeHandler,
 	holdingHandler *handlers.HoldingHandler,
+	priceHandler *handlers.PriceHandler,
+	portfolioHandler *handlers.PortfolioHandler,
+	fxHandler *handlers.FxHandler,
+	performanceHandler *handlers.PerformanceHandler,
+	cashLedgerHandler *handlers.CashLedgerHandler,
+	incomeHandler *handlers.IncomeHandler,
+	corporateActionHandler *handlers.CorporateActionHandler,
+	instrumentHandler *handlers.InstrumentHandler,
+	optionHandler *handlers.OptionHandler,
+	tradeImportHandler *handlers.TradeImportHandler,
+	statementImportHandler *handlers.StatementImportHandler,
 ) {
 	// Public routes
 	public := r.Group("/auth")
@@ -47,17 +58,78 @@ func SetupRoutes(r *gin.Engine,
 			accounts.POST("", accountHandler.CreateAccount)
 			accounts.PUT("/:id", accountHandler.UpdateAccount)
 			accounts.DELETE("/:id", accountHandler.DeleteAccount)
+			accounts.GET("/:id/holdings", holdingHandler.ListAccountHoldings)
+			accounts.GET("/:id/ledger", cashLedgerHandler.ListEntries)
+			accounts.POST("/:id/ledger", cashLedgerHandler.CreateEntry)
+			accounts.POST("/:id/deposits", cashLedgerHandler.Deposit)
+			accounts.POST("/:id/withdrawals", cashLedgerHandler.Withdraw)
 		}
 
+		protected.POST("/transfers", cashLedgerHandler.Transfer)
+
 		trades := protected.Group("/trades")
 		{
 			trades.GET("", tradeHandler.ListTrades)
 			trades.POST("", tradeHandler.CreateTrade)
+			trades.GET("/duplicates", tradeHandler.ListDuplicates)
+			trades.POST("/duplicates/merge", tradeHandler.MergeDuplicates)
+			trades.POST("/duplicates/dismiss", tradeHandler.DismissDuplicates)
 			trades.PUT("/:id", tradeHandler.UpdateTrade)
 			trades.DELETE("/:id", tradeHandler.DeleteTrade)
 		}
 
+		imports := protected.Group("/imports")
+		{
+			imports.POST("/trades", tradeImportHandler.ImportTrades)
+			imports.POST("/ofx", statementImportHandler.ImportOFX)
+			imports.GET("/profiles", tradeImportHandler.ListProfiles)
+			imports.POST("/profiles", tradeImportHandler.CreateProfile)
+			imports.PUT("/profiles/:id", tradeImportHandler.UpdateProfile)
+			imports.DELETE("/profiles/:id", tradeImportHandler.DeleteProfile)
+		}
+
+		income := protected.Group("/income")
+		{
+			income.GET("", incomeHandler.ListEvents)
+			income.POST("", incomeHandler.CreateEvent)
+			income.GET("/summary", incomeHandler.GetSummary)
+			income.PUT("/:id", incomeHandler.UpdateEvent)
+			income.DELETE("/:id", incomeHandler.DeleteEvent)
+		}
+
 		// Asset routes
 		protected.GET("/holdings", holdingHandler.ListHoldings)
+		protected.GET("/holdings/realized", holdingHandler.ListRealizedGains)
+		protected.GET("/holdings/diff", holdingHandler.DiffHoldings)
+		protected.GET("/holdings/options", optionHandler.ListPositions)
+		protected.POST("/holdings/options/:instrumentId/settle", optionHandler.SettleOption)
+
+		protected.GET("/portfolio", portfolioHandler.GetOverview)
+		protected.GET("/portfolio/summary", portfolioHandler.GetSummary)
+		protected.GET("/portfolio/history", portfolioHandler.GetHistory)
+		protected.GET("/performance", performanceHandler.GetPerformance)
+
+		protected.GET("/corporate-actions", corporateActionHandler.ListActions)
+
+		protected.GET("/instruments", instrumentHandler.SearchInstruments)
+		protected.GET("/instruments/:id", instrumentHandler.GetInstrument)
+
+		protected.GET("/prices", priceHandler.ListPrices)
+		protected.GET("/prices/:ticker", priceHandler.GetPriceHistory)
+
+		// Admin routes
+		admin := protected.Group("/admin")
+		admin.Use(middleware.AdminOnly())
+		{
+			admin.POST("/prices", priceHandler.UploadPrices)
+			admin.POST("/prices/history", priceHandler.UploadPriceHistory)
+			admin.POST("/fx-rates", fxHandler.UploadRates)
+			admin.POST("/corporate-actions", corporateActionHandler.CreateAction)
+			admin.PUT("/corporate-actions/:id", corporateActionHandler.UpdateAction)
+			admin.DELETE("/corporate-actions/:id", corporateActionHandler.DeleteAction)
+			admin.POST("/instruments", instrumentHandler.CreateInstrument)
+			admin.PUT("/instruments/:id", instrumentHandler.UpdateInstrument)
+			admin.DELETE("/instruments/:id", instrumentHandler.DeleteInstrument)
+		}
 	}
 }
@@ -3,10 +3,19 @@ package services
 import (
 	"asset-dairy/models"
 	"asset-dairy/repositories"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
 
 	"github.com/google/uuid"
 )
 
+var (
+	ErrAccountCurrencyLocked = errors.New("account currency cannot change once the account has trades or cash entries")
+	ErrAccountShortLocked    = errors.New("short positions cannot be disallowed while the account's history holds one")
+)
+
 type AccountServiceInterface interface {
 	ListAccounts(userID string) ([]models.Account, error)
 	CreateAccount(userID string, req models.AccountCreateRequest) (*models.Account, error)
@@ -15,11 +24,14 @@ type AccountServiceInterface interface {
 }
 
 type AccountService struct {
-	repo repositories.AccountRepositoryInterface
+	repo         repositories.AccountRepositoryInterface
+	tradeService TradeServiceInterface
 }
 
-func NewAccountService(repo repositories.AccountRepositoryInterface) *AccountService {
-	return &AccountService{repo: repo}
+// NewAccountService creates an AccountService. The trade service checks the account's history
+// before short positions are disallowed in it.
+func NewAccountService(repo repositories.AccountRepositoryInterface, tradeService TradeServiceInterface) *AccountService {
+	return &AccountService{repo: repo, tradeService: tradeService}
 }
 
 func (s *AccountService) ListAccounts(userID string) ([]models.Account, error) {
@@ -29,13 +41,20 @@ func (s *AccountService) ListAccounts(userID string) ([]models.Account, error) {
 func (s *AccountService) CreateAccount(userID string, req models.AccountCreateRequest) (*models.Account, error) {
 	id := uuid.New().String()
 	acc := &models.Account{
-		ID:       id,
-		Name:     req.Name,
-		Currency: req.Currency,
-		Balance:  req.Balance,
+		ID:              id,
+		Name:            req.Name,
+		Currency:        req.Currency,
+		Balance:         req.Balance,
+		CostBasisMethod: req.CostBasisMethod,
+		AllowShort:      req.AllowShort,
 	}
 
-	err := s.repo.CreateAccount(userID, acc)
+	var openingBalance *models.CashLedgerEntry
+	if req.Balance != 0 {
+		openingBalance = newBalanceEntry(userID, acc, models.CashEntryOpeningBalance, req.Balance)
+	}
+
+	err := s.repo.CreateAccount(userID, acc, openingBalance)
 	if err != nil {
 		return nil, err
 	}
@@ -43,10 +62,67 @@ func (s *AccountService) CreateAccount(userID string, req models.AccountCreateRe
 	return acc, nil
 }
 
+// UpdateAccount saves the account settings. A balance different from the current one is
+// recorded as an adjustment entry in the cash ledger rather than overwritten; an omitted
+// balance leaves the cash as it is. Short positions can only be disallowed when the account's
+// history never held one.
 func (s *AccountService) UpdateAccount(userID, accID string, req models.AccountUpdateRequest) (*models.Account, error) {
-	return s.repo.UpdateAccount(userID, accID, req)
+	current, err := s.repo.GetAccount(userID, accID)
+	if err != nil {
+		return nil, err
+	}
+	if !strings.EqualFold(req.Currency, current.Currency) {
+		active, err := s.repo.HasActivity(accID)
+		if err != nil {
+			return nil, err
+		}
+		if active {
+			return nil, ErrAccountCurrencyLocked
+		}
+	}
+
+	// The repository sets the amount from the balance it reads in its transaction
+	var adjustment *models.CashLedgerEntry
+	if req.Balance != nil {
+		current.Currency = req.Currency
+		adjustment = newBalanceEntry(userID, current, models.CashEntryAdjustment, 0)
+	}
+	if req.AllowShort == nil || *req.AllowShort || !current.AllowShort {
+		return s.repo.UpdateAccount(userID, accID, req, adjustment)
+	}
+
+	// No trade may go short between the check and the update
+	var updated *models.Account
+	err = s.tradeService.WithUserLock(userID, func() error {
+		err := s.tradeService.ValidateDisallowShort(userID, accID)
+		if errors.Is(err, ErrPositionOversold) {
+			return fmt.Errorf("%w: %v", ErrAccountShortLocked, err)
+		}
+		if err != nil {
+			return err
+		}
+		updated, err = s.repo.UpdateAccount(userID, accID, req, adjustment)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return updated, nil
 }
 
 func (s *AccountService) DeleteAccount(userID, accID string) error {
 	return s.repo.DeleteAccount(userID, accID)
 }
+
+// newBalanceEntry builds a ledger entry dated today that moves the account balance by amount
+func newBalanceEntry(userID string, acc *models.Account, entryType string, amount float64) *models.CashLedgerEntry {
+	return &models.CashLedgerEntry{
+		ID:        uuid.New().String(),
+		UserID:    userID,
+		AccountID: acc.ID,
+		Type:      entryType,
+		Amount:    amount,
+		Currency:  acc.Currency,
+		EntryDate: truncateToDate(time.Now()),
+	}
+}
@@ -0,0 +1,172 @@
+package services
+
+import (
+	"asset-dairy/models"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+// MockAccountRepository is a mock implementation of AccountRepositoryInterface
+type MockAccountRepository struct {
+	mock.Mock
+}
+
+func (m *MockAccountRepository) GetAccount(userID, accID string) (*models.Account, error) {
+	args := m.Called(userID, accID)
+	return args.Get(0).(*models.Account), args.Error(1)
+}
+
+func (m *MockAccountRepository) HasActivity(accID string) (bool, error) {
+	args := m.Called(accID)
+	return args.Bool(0), args.Error(1)
+}
+
+func (m *MockAccountRepository) CreateAccount(userID string, acc *models.Account, openingBalance *models.CashLedgerEntry) error {
+	args := m.Called(userID, acc, openingBalance)
+	return args.Error(0)
+}
+
+func (m *MockAccountRepository) UpdateAccount(userID, accID string, req models.AccountUpdateRequest, adjustment *models.CashLedgerEntry) (*models.Account, error) {
+	args := m.Called(userID, accID, req, adjustment)
+	return args.Get(0).(*models.Account), args.Error(1)
+}
+
+// Add stub methods to satisfy AccountRepositoryInterface
+func (m *MockAccountRepository) ListAccounts(userID string) ([]models.Account, error) {
+	panic("not implemented")
+}
+func (m *MockAccountRepository) DeleteAccount(userID, accID string) error {
+	panic("not implemented")
+}
+
+func TestUpdateAccountRecordsBalanceAsAdjustment(t *testing.T) {
+	balance := 1500.0
+	tests := []struct {
+		name               string
+		balance            *float64
+		expectedAdjustment bool
+	}{
+		{name: "balance should be recorded as an adjustment", balance: &balance, expectedAdjustment: true},
+		{name: "omitted balance should record no adjustment", expectedAdjustment: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockRepo := new(MockAccountRepository)
+			service := NewAccountService(mockRepo, new(MockTradeService))
+			req := models.AccountUpdateRequest{Name: "Broker", Currency: "USD", Balance: tt.balance}
+
+			mockRepo.On("GetAccount", "user1", "acc1").Return(&models.Account{ID: "acc1", Currency: "USD", Balance: 1000}, nil)
+			mockRepo.On("UpdateAccount", "user1", "acc1", req, mock.MatchedBy(func(entry *models.CashLedgerEntry) bool {
+				if !tt.expectedAdjustment {
+					return entry == nil
+				}
+				return entry != nil && entry.Type == models.CashEntryAdjustment && entry.AccountID == "acc1" && entry.Currency == "USD"
+			})).Return(&models.Account{ID: "acc1", Currency: "USD", Balance: 1500}, nil)
+
+			_, err := service.UpdateAccount("user1", "acc1", req)
+
+			assert.NoError(t, err)
+			mockRepo.AssertExpectations(t)
+		})
+	}
+}
+
+func TestUpdateAccountRejectsCurrencyChangeWithActivity(t *testing.T) {
+	mockRepo := new(MockAccountRepository)
+	service := NewAccountService(mockRepo, new(MockTradeService))
+
+	mockRepo.On("GetAccount", "user1", "acc1").Return(&models.Account{ID: "acc1", Currency: "USD", Balance: 1000}, nil)
+	mockRepo.On("HasActivity", "acc1").Return(true, nil)
+
+	_, err := service.UpdateAccount("user1", "acc1", models.AccountUpdateRequest{Name: "Broker", Currency: "TWD"})
+
+	assert.ErrorIs(t, err, ErrAccountCurrencyLocked)
+	mockRepo.AssertNotCalled(t, "UpdateAccount", mock.Anything, mock.Anything, mock.Anything, mock.Anything)
+}
+
+func TestUpdateAccountDisallowShort(t *testing.T) {
+	day := func(d int) time.Time {
+		return time.Date(2024, 1, d, 0, 0, 0, 0, time.UTC)
+	}
+	allow, disallow := true, false
+	buy := models.Trade{ID: "b1", Type: "buy", AssetType: "stock", Ticker: "AAPL", TradeDate: day(1), Quantity: 10, Price: 100, Currency: "USD", AccountID: "acc1"}
+	tests := []struct {
+		name          string
+		allowShort    *bool
+		trades        []models.Trade
+		expectedError error
+	}{
+		{
+			name:       "history without shorts should allow disallowing them",
+			allowShort: &disallow,
+			trades: []models.Trade{
+				buy,
+				{ID: "s1", Type: "sell", AssetType: "stock", Ticker: "AAPL", TradeDate: day(2), Quantity: 10, Price: 110, Currency: "USD", AccountID: "acc1"},
+			},
+		},
+		{
+			name:       "history with a short sale should keep shorts allowed",
+			allowShort: &disallow,
+			trades: []models.Trade{
+				buy,
+				{ID: "s1", Type: "sell", AssetType: "stock", Ticker: "AAPL", TradeDate: day(2), Quantity: 12, Price: 110, Currency: "USD", AccountID: "acc1"},
+			},
+			expectedError: ErrAccountShortLocked,
+		},
+		{
+			name:       "short sale in another account should not count",
+			allowShort: &disallow,
+			trades: []models.Trade{
+				buy,
+				{ID: "s1", Type: "sell", AssetType: "stock", Ticker: "AAPL", TradeDate: day(2), Quantity: 5, Price: 110, Currency: "USD", AccountID: "acc2"},
+			},
+		},
+		{
+			name:       "written option should not count as a short",
+			allowShort: &disallow,
+			trades: []models.Trade{
+				{ID: "o1", Type: "sell", AssetType: "option", Ticker: "AAPL240621C00200000", TradeDate: day(1), Quantity: 1, Price: 3, Currency: "USD", AccountID: "acc1", PositionEffect: stringPtr(models.PositionEffectOpen)},
+			},
+		},
+		{
+			name:       "allowing shorts should not check the history",
+			allowShort: &allow,
+		},
+		{
+			name: "omitted allowShort should not check the history",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockTradeRepo := new(MockTradeRepository)
+			mockTradeRepo.On("ListTrades", "user1").Return(tt.trades, nil)
+			mockTradeRepo.On("ListReceivedUnits", "user1").Return([]models.IncomeEvent{}, nil)
+			mockTradeRepo.On("ListShortableAccountIDs", "user1").Return([]string{"acc1", "acc2"}, nil)
+			mockTradeRepo.On("GetCostBasisMethods", "user1").Return("", map[string]string{}, nil)
+			mockRepo := new(MockAccountRepository)
+			mockRepo.On("GetAccount", "user1", "acc1").Return(&models.Account{ID: "acc1", Currency: "USD", AllowShort: true}, nil)
+			mockRepo.On("UpdateAccount", "user1", "acc1", mock.Anything, mock.Anything).Return(&models.Account{ID: "acc1", Currency: "USD"}, nil)
+
+			tradeService := NewTradeService(mockTradeRepo, new(MockFxService), withCorporateActions(), noInstruments())
+			service := NewAccountService(mockRepo, tradeService)
+
+			_, err := service.UpdateAccount("user1", "acc1", models.AccountUpdateRequest{Name: "Broker", Currency: "USD", AllowShort: tt.allowShort})
+
+			if tt.expectedError != nil {
+				assert.True(t, errors.Is(err, tt.expectedError), "expected %v, got %v", tt.expectedError, err)
+				mockRepo.AssertNotCalled(t, "UpdateAccount", mock.Anything, mock.Anything, mock.Anything, mock.Anything)
+				return
+			}
+			assert.NoError(t, err)
+			if tt.allowShort == nil || *tt.allowShort {
+				mockTradeRepo.AssertNotCalled(t, "ListTrades", "user1")
+			}
+		})
+	}
+}
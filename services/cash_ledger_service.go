@@ -0,0 +1,219 @@
+package services
+
+import (
+	"asset-dairy/models"
+	"asset-dairy/repositories"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+var (
+	ErrAccountNotFound  = errors.New("account not found")
+	ErrInvalidCashEntry = errors.New("invalid cash entry")
+	ErrInvalidTransfer  = errors.New("invalid transfer")
+)
+
+type CashLedgerServiceInterface interface {
+	ListEntries(userID, accountID string) ([]models.CashLedgerEntry, error)
+	ListUserEntries(userID string) ([]models.CashLedgerEntry, error)
+	CreateEntry(userID, accountID string, req models.CashLedgerEntryCreateRequest) (*models.CashLedgerEntry, error)
+	Deposit(userID, accountID string, req models.CashMovementRequest) (*models.CashLedgerEntry, error)
+	Withdraw(userID, accountID string, req models.CashMovementRequest) (*models.CashLedgerEntry, error)
+	Transfer(userID string, req models.CashTransferRequest) (*models.CashTransfer, error)
+	ValidateEntries(userID, accountID string, entries []models.CashLedgerEntry) ([]models.CashLedgerEntry, error)
+	RecordEntries(userID, accountID string, entries []models.CashLedgerEntry) ([]models.CashLedgerEntry, error)
+}
+
+type CashLedgerService struct {
+	repo repositories.CashLedgerRepositoryInterface
+}
+
+func NewCashLedgerService(repo repositories.CashLedgerRepositoryInterface) *CashLedgerService {
+	return &CashLedgerService{repo: repo}
+}
+
+// ListEntries returns the ledger of one of the user's accounts, oldest first
+func (s *CashLedgerService) ListEntries(userID, accountID string) ([]models.CashLedgerEntry, error) {
+	if _, err := s.account(userID, accountID); err != nil {
+		return nil, err
+	}
+	return s.repo.ListEntries(userID, accountID)
+}
+
+// ListUserEntries returns the ledger entries of all the user's accounts, oldest first
+func (s *CashLedgerService) ListUserEntries(userID string) ([]models.CashLedgerEntry, error) {
+	return s.repo.ListUserEntries(userID)
+}
+
+// CreateEntry records a fee, debited from the account, or interest, credited to it
+func (s *CashLedgerService) CreateEntry(userID, accountID string, req models.CashLedgerEntryCreateRequest) (*models.CashLedgerEntry, error) {
+	account, err := s.account(userID, accountID)
+	if err != nil {
+		return nil, err
+	}
+	entryDate, err := time.Parse("2006-01-02", req.EntryDate)
+	if err != nil {
+		return nil, fmt.Errorf("%w: entryDate must be YYYY-MM-DD", ErrInvalidCashEntry)
+	}
+
+	amount := req.Amount
+	if req.Type == models.CashEntryFee {
+		amount = -amount
+	}
+	entry := models.CashLedgerEntry{
+		ID:        uuid.New().String(),
+		UserID:    userID,
+		AccountID: account.ID,
+		Type:      req.Type,
+		Amount:    amount,
+		Currency:  account.Currency,
+		EntryDate: entryDate,
+		Memo:      req.Memo,
+	}
+	if err := s.repo.CreateEntries([]models.CashLedgerEntry{entry}); err != nil {
+		return nil, err
+	}
+	return &entry, nil
+}
+
+// Deposit records money paid into the account from outside the portfolio
+func (s *CashLedgerService) Deposit(userID, accountID string, req models.CashMovementRequest) (*models.CashLedgerEntry, error) {
+	return s.recordMovement(userID, accountID, models.CashEntryDeposit, req.Amount, req)
+}
+
+// Withdraw records money taken out of the account and the portfolio
+func (s *CashLedgerService) Withdraw(userID, accountID string, req models.CashMovementRequest) (*models.CashLedgerEntry, error) {
+	return s.recordMovement(userID, accountID, models.CashEntryWithdrawal, -req.Amount, req)
+}
+
+func (s *CashLedgerService) recordMovement(userID, accountID, entryType string, amount float64, req models.CashMovementRequest) (*models.CashLedgerEntry, error) {
+	account, err := s.account(userID, accountID)
+	if err != nil {
+		return nil, err
+	}
+	date, err := time.Parse("2006-01-02", req.Date)
+	if err != nil {
+		return nil, fmt.Errorf("%w: date must be YYYY-MM-DD", ErrInvalidCashEntry)
+	}
+
+	entry := models.CashLedgerEntry{
+		ID:        uuid.New().String(),
+		UserID:    userID,
+		AccountID: account.ID,
+		Type:      entryType,
+		Amount:    amount,
+		Currency:  account.Currency,
+		EntryDate: date,
+		Memo:      req.Memo,
+	}
+	if err := s.repo.CreateEntries([]models.CashLedgerEntry{entry}); err != nil {
+		return nil, err
+	}
+	return &entry, nil
+}
+
+// Transfer moves money between two of the user's accounts as a debit and a credit sharing one
+// transfer ID. When the currencies differ the credit is converted at the given rate.
+func (s *CashLedgerService) Transfer(userID string, req models.CashTransferRequest) (*models.CashTransfer, error) {
+	if req.FromAccountID == req.ToAccountID {
+		return nil, fmt.Errorf("%w: source and destination must be different accounts", ErrInvalidTransfer)
+	}
+	from, err := s.account(userID, req.FromAccountID)
+	if err != nil {
+		return nil, err
+	}
+	to, err := s.account(userID, req.ToAccountID)
+	if err != nil {
+		return nil, err
+	}
+	date, err := time.Parse("2006-01-02", req.Date)
+	if err != nil {
+		return nil, fmt.Errorf("%w: date must be YYYY-MM-DD", ErrInvalidTransfer)
+	}
+
+	transferID := uuid.New().String()
+	debit := models.CashLedgerEntry{
+		ID:         uuid.New().String(),
+		UserID:     userID,
+		AccountID:  from.ID,
+		Type:       models.CashEntryTransfer,
+		Amount:     -req.Amount,
+		Currency:   from.Currency,
+		TransferID: &transferID,
+		EntryDate:  date,
+		Memo:       req.Memo,
+	}
+	credit := debit
+	credit.ID = uuid.New().String()
+	credit.AccountID = to.ID
+	credit.Amount = req.Amount
+	credit.Currency = to.Currency
+
+	if !strings.EqualFold(from.Currency, to.Currency) {
+		if req.Rate == nil {
+			return nil, fmt.Errorf("%w: rate is required between %s and %s", ErrInvalidTransfer, from.Currency, to.Currency)
+		}
+		originalAmount := req.Amount
+		originalCurrency := from.Currency
+		rate := *req.Rate
+		credit.Amount = req.Amount * rate
+		credit.OriginalAmount = &originalAmount
+		credit.OriginalCurrency = &originalCurrency
+		credit.FxRate = &rate
+	}
+
+	if err := s.repo.CreateEntries([]models.CashLedgerEntry{debit, credit}); err != nil {
+		return nil, err
+	}
+	return &models.CashTransfer{ID: transferID, From: debit, To: credit}, nil
+}
+
+// ValidateEntries checks deposits, withdrawals, fees and interest built by the caller, such as
+// those read from a statement, and returns them as they would be stored. Amounts are signed
+// and in the account currency.
+func (s *CashLedgerService) ValidateEntries(userID, accountID string, entries []models.CashLedgerEntry) ([]models.CashLedgerEntry, error) {
+	account, err := s.account(userID, accountID)
+	if err != nil {
+		return nil, err
+	}
+	prepared := make([]models.CashLedgerEntry, len(entries))
+	for i, entry := range entries {
+		switch entry.Type {
+		case models.CashEntryDeposit, models.CashEntryWithdrawal, models.CashEntryFee, models.CashEntryInterest:
+		default:
+			return nil, fmt.Errorf("%w: %s entries cannot be recorded directly", ErrInvalidCashEntry, entry.Type)
+		}
+		entry.ID = uuid.New().String()
+		entry.UserID = userID
+		entry.AccountID = account.ID
+		entry.Currency = account.Currency
+		prepared[i] = entry
+	}
+	return prepared, nil
+}
+
+// RecordEntries stores entries built by the caller in one transaction
+func (s *CashLedgerService) RecordEntries(userID, accountID string, entries []models.CashLedgerEntry) ([]models.CashLedgerEntry, error) {
+	recorded, err := s.ValidateEntries(userID, accountID, entries)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.repo.CreateEntries(recorded); err != nil {
+		return nil, err
+	}
+	return recorded, nil
+}
+
+// account loads one of the user's accounts, mapping a missing one to ErrAccountNotFound
+func (s *CashLedgerService) account(userID, accountID string) (*models.Account, error) {
+	account, err := s.repo.GetAccount(userID, accountID)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, ErrAccountNotFound
+	}
+	return account, err
+}
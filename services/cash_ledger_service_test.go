@@ -0,0 +1,94 @@
+package services
+
+import (
+	"asset-dairy/models"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+// MockCashLedgerRepository is a mock implementation of CashLedgerRepositoryInterface
+type MockCashLedgerRepository struct {
+	mock.Mock
+}
+
+func (m *MockCashLedgerRepository) GetAccount(userID, accountID string) (*models.Account, error) {
+	args := m.Called(userID, accountID)
+	return args.Get(0).(*models.Account), args.Error(1)
+}
+
+func (m *MockCashLedgerRepository) CreateEntries(entries []models.CashLedgerEntry) error {
+	args := m.Called(entries)
+	return args.Error(0)
+}
+
+// Add stub methods to satisfy CashLedgerRepositoryInterface
+func (m *MockCashLedgerRepository) ListEntries(userID, accountID string) ([]models.CashLedgerEntry, error) {
+	panic("not implemented")
+}
+func (m *MockCashLedgerRepository) ListUserEntries(userID string) ([]models.CashLedgerEntry, error) {
+	panic("not implemented")
+}
+
+func TestTransfer(t *testing.T) {
+	rate := 32.0
+	tests := []struct {
+		name                   string
+		req                    models.CashTransferRequest
+		expectedCredit         float64
+		expectedOriginalAmount *float64
+		expectedError          error
+	}{
+		{
+			name:                   "transfer between currencies should convert at the given rate",
+			req:                    models.CashTransferRequest{FromAccountID: "usd", ToAccountID: "twd", Amount: 100, Rate: &rate, Date: "2024-01-02"},
+			expectedCredit:         3200,
+			expectedOriginalAmount: floatPtr(100),
+		},
+		{
+			name:           "transfer in one currency should move the amount as is",
+			req:            models.CashTransferRequest{FromAccountID: "usd", ToAccountID: "usd-2", Amount: 100, Date: "2024-01-02"},
+			expectedCredit: 100,
+		},
+		{
+			name:          "transfer between currencies without a rate should be rejected",
+			req:           models.CashTransferRequest{FromAccountID: "usd", ToAccountID: "twd", Amount: 100, Date: "2024-01-02"},
+			expectedError: ErrInvalidTransfer,
+		},
+		{
+			name:          "transfer within one account should be rejected",
+			req:           models.CashTransferRequest{FromAccountID: "usd", ToAccountID: "usd", Amount: 100, Date: "2024-01-02"},
+			expectedError: ErrInvalidTransfer,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockRepo := new(MockCashLedgerRepository)
+			service := NewCashLedgerService(mockRepo)
+			mockRepo.On("GetAccount", "user1", "usd").Return(&models.Account{ID: "usd", Currency: "USD"}, nil)
+			mockRepo.On("GetAccount", "user1", "usd-2").Return(&models.Account{ID: "usd-2", Currency: "USD"}, nil)
+			mockRepo.On("GetAccount", "user1", "twd").Return(&models.Account{ID: "twd", Currency: "TWD"}, nil)
+			mockRepo.On("CreateEntries", mock.Anything).Return(nil)
+
+			transfer, err := service.Transfer("user1", tt.req)
+
+			if tt.expectedError != nil {
+				assert.ErrorIs(t, err, tt.expectedError)
+				mockRepo.AssertNotCalled(t, "CreateEntries", mock.Anything)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, models.CashEntryTransfer, transfer.To.Type)
+			assert.Equal(t, transfer.ID, *transfer.From.TransferID)
+			assert.Equal(t, transfer.ID, *transfer.To.TransferID)
+			assert.Equal(t, tt.req.FromAccountID, transfer.From.AccountID)
+			assert.Equal(t, -tt.req.Amount, transfer.From.Amount)
+			assert.Equal(t, tt.req.ToAccountID, transfer.To.AccountID)
+			assert.Equal(t, tt.expectedCredit, transfer.To.Amount)
+			assert.Equal(t, tt.expectedOriginalAmount, transfer.To.OriginalAmount)
+			mockRepo.AssertCalled(t, "CreateEntries", []models.CashLedgerEntry{transfer.From, transfer.To})
+		})
+	}
+}
@@ -0,0 +1,266 @@
+package services
+
+import (
+	"asset-dairy/models"
+	"asset-dairy/repositories"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+var (
+	ErrCorporateActionNotFound = errors.New("corporate action not found")
+	ErrInvalidCorporateAction  = errors.New("invalid corporate action")
+)
+
+type CorporateActionServiceInterface interface {
+	ListActions(ticker string) ([]models.CorporateAction, error)
+	CreateAction(req models.CorporateActionCreateRequest) (*models.CorporateAction, error)
+	UpdateAction(actionID string, req models.CorporateActionCreateRequest) (*models.CorporateAction, error)
+	DeleteAction(actionID string) (bool, error)
+	SyncCash(userID string) error
+}
+
+type CorporateActionService struct {
+	repo      repositories.CorporateActionRepositoryInterface
+	tradeRepo repositories.TradeRepositoryInterface
+	fxService FxServiceInterface
+}
+
+// NewCorporateActionService creates a CorporateActionService. The trades decide how much cash
+// each action pays into the users' accounts, and the fx service converts it into the account
+// currency.
+func NewCorporateActionService(repo repositories.CorporateActionRepositoryInterface, tradeRepo repositories.TradeRepositoryInterface, fxService FxServiceInterface) *CorporateActionService {
+	return &CorporateActionService{repo: repo, tradeRepo: tradeRepo, fxService: fxService}
+}
+
+// ListActions returns the corporate actions that change a ticker or lead into it, or those of
+// every ticker when it is empty, in the order they took effect
+func (s *CorporateActionService) ListActions(ticker string) ([]models.CorporateAction, error) {
+	return s.repo.ListActions(ticker)
+}
+
+func (s *CorporateActionService) CreateAction(req models.CorporateActionCreateRequest) (*models.CorporateAction, error) {
+	action, err := newCorporateAction(uuid.New().String(), req)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.repo.CreateAction(*action); err != nil {
+		return nil, err
+	}
+	if err := s.syncAllCash(); err != nil {
+		return nil, err
+	}
+	return action, nil
+}
+
+// UpdateAction replaces the stored action with the request
+func (s *CorporateActionService) UpdateAction(actionID string, req models.CorporateActionCreateRequest) (*models.CorporateAction, error) {
+	action, err := newCorporateAction(actionID, req)
+	if err != nil {
+		return nil, err
+	}
+	updated, err := s.repo.UpdateAction(*action)
+	if err != nil {
+		return nil, err
+	}
+	if !updated {
+		return nil, ErrCorporateActionNotFound
+	}
+	if err := s.syncAllCash(); err != nil {
+		return nil, err
+	}
+	return action, nil
+}
+
+func (s *CorporateActionService) DeleteAction(actionID string) (bool, error) {
+	deleted, err := s.repo.DeleteAction(actionID)
+	if err != nil || !deleted {
+		return deleted, err
+	}
+	return true, s.syncAllCash()
+}
+
+// SyncCash rewrites the ledger entries of the cash corporate actions paid into the user's
+// accounts, the cash of a merger and cash in lieu of fractional shares, from a replay of the
+// user's trades.
+// Each account holding a position is paid on the effective date, converted into the account
+// currency at the rates known then. It runs after every change to the trades or the actions.
+func (s *CorporateActionService) SyncCash(userID string) error {
+	trades, err := s.tradeRepo.ListTrades(userID)
+	if err != nil {
+		return err
+	}
+	events, err := s.tradeRepo.ListReceivedUnits(userID)
+	if err != nil {
+		return err
+	}
+	received, err := receivedUnitTrades(s.fxService, trades, events)
+	if err != nil {
+		return err
+	}
+	defaultMethod, accountMethods, err := s.tradeRepo.GetCostBasisMethods(userID)
+	if err != nil {
+		return err
+	}
+	actions, err := s.repo.ListActions("")
+	if err != nil {
+		return err
+	}
+	// Charges change prices but not quantities, so the stored trades replay as they are
+	matcher := matchTrades(append(trades, received...), costBasisSettings{defaultMethod: defaultMethod, accountMethods: accountMethods}, actions)
+
+	entries := make([]models.CashLedgerEntry, 0, len(matcher.payouts))
+	for _, payout := range matcher.payouts {
+		entry, err := s.cashEntry(userID, payout)
+		if err != nil {
+			return err
+		}
+		entries = append(entries, *entry)
+	}
+	return s.repo.ReplaceCashEntries(userID, entries)
+}
+
+// syncAllCash rewrites the corporate action cash of every user with trades, each while their
+// trades are locked against other changes
+func (s *CorporateActionService) syncAllCash() error {
+	userIDs, err := s.tradeRepo.ListTradingUserIDs()
+	if err != nil {
+		return err
+	}
+	for _, userID := range userIDs {
+		err := s.tradeRepo.WithUserLock(userID, func() error {
+			return s.SyncCash(userID)
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// cashEntry builds the ledger entry crediting a payout, or debiting it when negative, to its
+// account
+func (s *CorporateActionService) cashEntry(userID string, payout actionPayout) (*models.CashLedgerEntry, error) {
+	accountCurrency, err := s.tradeRepo.GetAccountCurrency(userID, payout.accountID)
+	if err != nil {
+		return nil, err
+	}
+	actionID := payout.action.ID
+	entry := &models.CashLedgerEntry{
+		ID:                uuid.New().String(),
+		UserID:            userID,
+		AccountID:         payout.accountID,
+		Type:              models.CashEntryCorporateAction,
+		Amount:            payout.amount,
+		Currency:          accountCurrency,
+		CorporateActionID: &actionID,
+		EntryDate:         payout.action.EffectiveDate,
+		Memo:              payout.action.Memo,
+	}
+	if payout.currency == "" || strings.EqualFold(payout.currency, accountCurrency) {
+		return entry, nil
+	}
+
+	converter, err := s.fxService.Converter(payout.action.EffectiveDate)
+	if err != nil {
+		return nil, err
+	}
+	rate, err := converter.Rate(payout.currency, accountCurrency)
+	if err != nil {
+		return nil, err
+	}
+	amount := payout.amount
+	originalCurrency := payout.currency
+	entry.Amount = amount * rate
+	entry.OriginalAmount = &amount
+	entry.OriginalCurrency = &originalCurrency
+	entry.FxRate = &rate
+	return entry, nil
+}
+
+// newCorporateAction validates a request and builds the action it describes
+func newCorporateAction(id string, req models.CorporateActionCreateRequest) (*models.CorporateAction, error) {
+	effectiveDate, err := time.Parse("2006-01-02", req.EffectiveDate)
+	if err != nil {
+		return nil, fmt.Errorf("%w: effectiveDate must be YYYY-MM-DD", ErrInvalidCorporateAction)
+	}
+	action := &models.CorporateAction{
+		ID:               id,
+		Ticker:           normalizeTicker(req.Ticker),
+		Type:             req.Type,
+		EffectiveDate:    effectiveDate,
+		NewShares:        req.NewShares,
+		OldShares:        req.OldShares,
+		CashPerShare:     req.CashPerShare,
+		CostBasisPercent: req.CostBasisPercent,
+		CashInLieuPrice:  req.CashInLieuPrice,
+		Memo:             req.Memo,
+	}
+	if req.NewTicker != nil && strings.TrimSpace(*req.NewTicker) != "" {
+		newTicker := normalizeTicker(*req.NewTicker)
+		action.NewTicker = &newTicker
+	}
+	if err := validateCorporateAction(action); err != nil {
+		return nil, err
+	}
+	return action, nil
+}
+
+// validateCorporateAction checks the fields each action type needs, defaulting a missing
+// ratio to one share for one where the type allows it
+func validateCorporateAction(action *models.CorporateAction) error {
+	if action.Type == models.CorporateActionSplit {
+		if action.NewTicker != nil {
+			return fmt.Errorf("%w: a split cannot change the ticker", ErrInvalidCorporateAction)
+		}
+		if action.NewShares <= 0 || action.OldShares <= 0 {
+			return fmt.Errorf("%w: newShares and oldShares must be positive", ErrInvalidCorporateAction)
+		}
+		return nil
+	}
+
+	if action.OldShares == 0 {
+		action.OldShares = 1
+	}
+	if action.Type == models.CorporateActionSymbolChange && action.NewShares == 0 {
+		action.NewShares = 1
+	}
+	if action.NewTicker == nil && (action.Type != models.CorporateActionMerger || action.NewShares > 0) {
+		return fmt.Errorf("%w: newTicker is required", ErrInvalidCorporateAction)
+	}
+	if action.NewTicker != nil && *action.NewTicker == action.Ticker {
+		return fmt.Errorf("%w: newTicker must differ from ticker", ErrInvalidCorporateAction)
+	}
+
+	switch action.Type {
+	case models.CorporateActionSymbolChange:
+		if action.CashPerShare != nil || action.CostBasisPercent != nil {
+			return fmt.Errorf("%w: a symbol change pays no cash and carries the whole cost basis", ErrInvalidCorporateAction)
+		}
+	case models.CorporateActionMerger:
+		if action.NewShares == 0 && action.Cash() == 0 {
+			return fmt.Errorf("%w: a merger must pay shares, cash or both", ErrInvalidCorporateAction)
+		}
+		if action.NewShares > 0 && action.Cash() > 0 && action.CostBasisPercent == nil {
+			return fmt.Errorf("%w: costBasisPercent is required when a merger pays both shares and cash", ErrInvalidCorporateAction)
+		}
+		if (action.NewShares == 0 || action.Cash() == 0) && action.CostBasisPercent != nil {
+			return fmt.Errorf("%w: costBasisPercent only applies to a merger paying both shares and cash", ErrInvalidCorporateAction)
+		}
+	case models.CorporateActionSpinOff:
+		if action.NewShares <= 0 {
+			return fmt.Errorf("%w: newShares must be positive", ErrInvalidCorporateAction)
+		}
+		if action.CostBasisPercent == nil {
+			return fmt.Errorf("%w: costBasisPercent is required for a spin-off", ErrInvalidCorporateAction)
+		}
+		if action.CashPerShare != nil {
+			return fmt.Errorf("%w: a spin-off pays no cash", ErrInvalidCorporateAction)
+		}
+	}
+	return nil
+}
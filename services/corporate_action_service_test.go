@@ -0,0 +1,142 @@
+package services
+
+import (
+	"asset-dairy/models"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+// MockCorporateActionRepository is a mock implementation of CorporateActionRepositoryInterface
+type MockCorporateActionRepository struct {
+	mock.Mock
+}
+
+func (m *MockCorporateActionRepository) ListActions(ticker string) ([]models.CorporateAction, error) {
+	args := m.Called(ticker)
+	return args.Get(0).([]models.CorporateAction), args.Error(1)
+}
+
+func (m *MockCorporateActionRepository) ReplaceCashEntries(userID string, entries []models.CashLedgerEntry) error {
+	args := m.Called(userID, entries)
+	return args.Error(0)
+}
+
+// Add stub methods to satisfy CorporateActionRepositoryInterface
+func (m *MockCorporateActionRepository) CreateAction(action models.CorporateAction) error {
+	panic("not implemented")
+}
+func (m *MockCorporateActionRepository) UpdateAction(action models.CorporateAction) (bool, error) {
+	panic("not implemented")
+}
+func (m *MockCorporateActionRepository) DeleteAction(actionID string) (bool, error) {
+	panic("not implemented")
+}
+
+func TestSyncCash(t *testing.T) {
+	day := func(d int) time.Time {
+		return time.Date(2024, 1, d, 0, 0, 0, 0, time.UTC)
+	}
+	inLieuPrice, cashPerShare := 40.0, 15.0
+	// A one-for-four reverse split paying cash in lieu of the fractional share at 40
+	reverseSplit := models.CorporateAction{ID: "ca1", Ticker: "XYZ", Type: models.CorporateActionSplit, EffectiveDate: day(5), NewShares: 1, OldShares: 4, CashInLieuPrice: &inLieuPrice}
+	cashMerger := models.CorporateAction{ID: "ca1", Ticker: "XYZ", Type: models.CorporateActionMerger, EffectiveDate: day(5), OldShares: 1, CashPerShare: &cashPerShare}
+	buy := func(id, accountID string, quantity float64) models.Trade {
+		return models.Trade{ID: id, Type: "buy", AssetType: "stock", Ticker: "XYZ", TradeDate: day(2), Quantity: quantity, Price: 10, Currency: "USD", AccountID: accountID}
+	}
+	type expectedEntry struct {
+		accountID      string
+		amount         float64
+		currency       string
+		originalAmount *float64
+	}
+	originalAmount := 20.0
+	tests := []struct {
+		name            string
+		action          models.CorporateAction
+		trades          []models.Trade
+		accountCurrency map[string]string
+		expectedEntries []expectedEntry
+	}{
+		{
+			name:            "cash in lieu should be credited to each account holding the position",
+			action:          reverseSplit,
+			trades:          []models.Trade{buy("b1", "acc-1", 10), buy("b2", "acc-2", 7)},
+			accountCurrency: map[string]string{"acc-1": "USD", "acc-2": "USD"},
+			expectedEntries: []expectedEntry{
+				{accountID: "acc-1", amount: 20, currency: "USD"},
+				{accountID: "acc-2", amount: 30, currency: "USD"},
+			},
+		},
+		{
+			name:            "cash in lieu should be converted into the account currency",
+			action:          reverseSplit,
+			trades:          []models.Trade{buy("b1", "acc-1", 10)},
+			accountCurrency: map[string]string{"acc-1": "TWD"},
+			expectedEntries: []expectedEntry{
+				{accountID: "acc-1", amount: 640, currency: "TWD", originalAmount: &originalAmount},
+			},
+		},
+		{
+			name:            "whole shares should leave no cash",
+			action:          reverseSplit,
+			trades:          []models.Trade{buy("b1", "acc-1", 8)},
+			accountCurrency: map[string]string{"acc-1": "USD"},
+			expectedEntries: []expectedEntry{},
+		},
+		{
+			name:   "merger cash should be credited to a long position and debited from a short one",
+			action: cashMerger,
+			trades: []models.Trade{
+				buy("b1", "acc-1", 10),
+				{ID: "s1", Type: "sell", AssetType: "stock", Ticker: "XYZ", TradeDate: day(3), Quantity: 4, Price: 10, Currency: "USD", AccountID: "acc-2"},
+			},
+			accountCurrency: map[string]string{"acc-1": "USD", "acc-2": "USD"},
+			expectedEntries: []expectedEntry{
+				{accountID: "acc-1", amount: 150, currency: "USD"},
+				{accountID: "acc-2", amount: -60, currency: "USD"},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockTradeRepo := new(MockTradeRepository)
+			mockTradeRepo.On("ListTrades", "test-user").Return(tt.trades, nil)
+			mockTradeRepo.On("ListReceivedUnits", "test-user").Return([]models.IncomeEvent{}, nil)
+			mockTradeRepo.On("GetCostBasisMethods", "test-user").Return("", map[string]string{}, nil)
+			for accountID, currency := range tt.accountCurrency {
+				mockTradeRepo.On("GetAccountCurrency", "test-user", accountID).Return(currency, nil)
+			}
+			mockRepo := new(MockCorporateActionRepository)
+			mockRepo.On("ListActions", "").Return([]models.CorporateAction{tt.action}, nil)
+			mockRepo.On("ReplaceCashEntries", "test-user", mock.Anything).Return(nil)
+			mockFxService := new(MockFxService)
+			mockFxService.On("Converter").Return(NewFxConverter([]models.FxRate{{BaseCurrency: "USD", QuoteCurrency: "TWD", Rate: 32}}, "USD"), nil)
+
+			service := NewCorporateActionService(mockRepo, mockTradeRepo, mockFxService)
+
+			err := service.SyncCash("test-user")
+
+			assert.NoError(t, err)
+			entries := mockRepo.Calls[1].Arguments.Get(1).([]models.CashLedgerEntry)
+			assert.Len(t, entries, len(tt.expectedEntries))
+			for i, expected := range tt.expectedEntries {
+				entry := entries[i]
+				assert.Equal(t, expected.accountID, entry.AccountID)
+				assert.Equal(t, models.CashEntryCorporateAction, entry.Type)
+				assert.InDelta(t, expected.amount, entry.Amount, 1e-9)
+				assert.Equal(t, expected.currency, entry.Currency)
+				assert.Equal(t, "ca1", *entry.CorporateActionID)
+				assert.Equal(t, day(5), entry.EntryDate)
+				if expected.originalAmount != nil {
+					assert.InDelta(t, *expected.originalAmount, *entry.OriginalAmount, 1e-9)
+				} else {
+					assert.Nil(t, entry.OriginalAmount)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,43 @@
+package services
+
+import (
+	"encoding/csv"
+	"strings"
+)
+
+// csvColumns maps normalized header names to their column index
+type csvColumns map[string]int
+
+// readCSVColumns reads the header row. Names are matched case-insensitively and
+// ignoring spaces, dashes and underscores, so "As Of", "as_of" and "asOf" are the same column.
+func readCSVColumns(reader *csv.Reader) (csvColumns, error) {
+	header, err := reader.Read()
+	if err != nil {
+		return nil, err
+	}
+	columns := make(csvColumns, len(header))
+	for i, name := range header {
+		columns[normalizeColumnName(name)] = i
+	}
+	return columns, nil
+}
+
+func normalizeColumnName(name string) string {
+	name = strings.ToLower(strings.TrimSpace(strings.TrimPrefix(name, "\ufeff")))
+	return strings.NewReplacer(" ", "", "_", "", "-", "").Replace(name)
+}
+
+// has reports whether the column is present
+func (c csvColumns) has(name string) bool {
+	_, ok := c[normalizeColumnName(name)]
+	return ok
+}
+
+// value returns the trimmed cell of the named column, or "" when the column is absent
+func (c csvColumns) value(record []string, name string) string {
+	i, ok := c[normalizeColumnName(name)]
+	if !ok || i >= len(record) {
+		return ""
+	}
+	return strings.TrimSpace(record[i])
+}
@@ -0,0 +1,223 @@
+package services
+
+import (
+	"asset-dairy/models"
+	"asset-dairy/repositories"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var (
+	ErrFxRateNotFound  = errors.New("fx rate not found")
+	ErrInvalidFxUpload = errors.New("invalid fx rate upload")
+)
+
+type FxServiceInterface interface {
+	BaseCurrency() string
+	Converter(asOf time.Time) (*FxConverter, error)
+	DailyConverters(from, to time.Time) (map[time.Time]*FxConverter, error)
+	ImportCSV(r io.Reader) (int, error)
+	ImportFile(path string) (int, error)
+}
+
+type FxService struct {
+	repo         repositories.FxRateRepositoryInterface
+	baseCurrency string
+}
+
+// NewFxService creates a new FxService. Pairs without a stored rate are converted
+// through the base currency.
+func NewFxService(repo repositories.FxRateRepositoryInterface, baseCurrency string) *FxService {
+	return &FxService{repo: repo, baseCurrency: strings.ToUpper(baseCurrency)}
+}
+
+// BaseCurrency is the currency rates are triangulated through
+func (s *FxService) BaseCurrency() string {
+	return s.baseCurrency
+}
+
+// Converter loads the newest rate of every pair known on asOf
+func (s *FxService) Converter(asOf time.Time) (*FxConverter, error) {
+	rates, err := s.repo.ListLatestRates(truncateToDate(asOf))
+	if err != nil {
+		return nil, err
+	}
+	return NewFxConverter(rates, s.baseCurrency), nil
+}
+
+// DailyConverters returns a converter for every day from from through to, each holding the
+// newest rates known on that day. Days without new rates share the previous day's converter.
+func (s *FxService) DailyConverters(from, to time.Time) (map[time.Time]*FxConverter, error) {
+	from, to = truncateToDate(from), truncateToDate(to)
+	initial, err := s.repo.ListLatestRates(from)
+	if err != nil {
+		return nil, err
+	}
+	updates, err := s.repo.ListRates(from.AddDate(0, 0, 1), to)
+	if err != nil {
+		return nil, err
+	}
+
+	latest := make(map[string]models.FxRate, len(initial))
+	for _, rate := range initial {
+		latest[rate.BaseCurrency+"_"+rate.QuoteCurrency] = rate
+	}
+	converters := make(map[time.Time]*FxConverter)
+	var converter *FxConverter
+	next := 0
+	for date := from; !date.After(to); date = date.AddDate(0, 0, 1) {
+		changed := converter == nil
+		for ; next < len(updates) && !truncateToDate(updates[next].Date).After(date); next++ {
+			rate := updates[next]
+			latest[rate.BaseCurrency+"_"+rate.QuoteCurrency] = rate
+			changed = true
+		}
+		if changed {
+			rates := make([]models.FxRate, 0, len(latest))
+			for _, rate := range latest {
+				rates = append(rates, rate)
+			}
+			converter = NewFxConverter(rates, s.baseCurrency)
+		}
+		converters[date] = converter
+	}
+	return converters, nil
+}
+
+// ImportCSV stores rates from a CSV with date, base, quote and rate columns. A row
+// repeating a pair and date replaces the earlier one.
+func (s *FxService) ImportCSV(r io.Reader) (int, error) {
+	reader := csv.NewReader(r)
+	reader.TrimLeadingSpace = true
+	columns, err := readCSVColumns(reader)
+	if err != nil {
+		return 0, fmt.Errorf("%w: missing header", ErrInvalidFxUpload)
+	}
+	for _, required := range []string{"date", "base", "quote", "rate"} {
+		if !columns.has(required) {
+			return 0, fmt.Errorf("%w: missing %s column", ErrInvalidFxUpload, required)
+		}
+	}
+
+	rates := []models.FxRate{}
+	index := make(map[string]int)
+	for row := 2; ; row++ {
+		record, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return 0, fmt.Errorf("%w: row %d: %v", ErrInvalidFxUpload, row, err)
+		}
+		rate, err := parseFxRate(columns, record)
+		if err != nil {
+			return 0, fmt.Errorf("%w: row %d: %v", ErrInvalidFxUpload, row, err)
+		}
+		key := rate.BaseCurrency + "_" + rate.QuoteCurrency + "_" + rate.Date.Format("2006-01-02")
+		if i, exists := index[key]; exists {
+			rates[i] = rate
+			continue
+		}
+		index[key] = len(rates)
+		rates = append(rates, rate)
+	}
+
+	if err := s.repo.UpsertRates(rates); err != nil {
+		return 0, err
+	}
+	return len(rates), nil
+}
+
+// ImportFile loads rates from a local CSV file, so conversions work without a rate feed
+func (s *FxService) ImportFile(path string) (int, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return 0, err
+	}
+	defer file.Close()
+	return s.ImportCSV(file)
+}
+
+func parseFxRate(columns csvColumns, record []string) (models.FxRate, error) {
+	rate := models.FxRate{
+		BaseCurrency:  strings.ToUpper(columns.value(record, "base")),
+		QuoteCurrency: strings.ToUpper(columns.value(record, "quote")),
+	}
+	if rate.BaseCurrency == "" || rate.QuoteCurrency == "" || rate.BaseCurrency == rate.QuoteCurrency {
+		return rate, errors.New("base and quote must be two different currencies")
+	}
+	date, err := time.Parse("2006-01-02", columns.value(record, "date"))
+	if err != nil {
+		return rate, errors.New("invalid date, use YYYY-MM-DD")
+	}
+	rate.Date = date
+	value, err := strconv.ParseFloat(columns.value(record, "rate"), 64)
+	if err != nil || value <= 0 {
+		return rate, errors.New("rate must be a positive number")
+	}
+	rate.Rate = value
+	return rate, nil
+}
+
+// FxConverter converts amounts with a fixed set of rates. A pair is looked up
+// directly, then inverted, then triangulated through the base currency.
+type FxConverter struct {
+	baseCurrency string
+	rates        map[string]float64
+}
+
+// NewFxConverter indexes the rates by pair; later rates of the same pair win
+func NewFxConverter(rates []models.FxRate, baseCurrency string) *FxConverter {
+	converter := &FxConverter{
+		baseCurrency: strings.ToUpper(baseCurrency),
+		rates:        make(map[string]float64, len(rates)),
+	}
+	for _, rate := range rates {
+		converter.rates[rate.BaseCurrency+"_"+rate.QuoteCurrency] = rate.Rate
+	}
+	return converter
+}
+
+// Rate returns how many units of to one unit of from buys
+func (c *FxConverter) Rate(from, to string) (float64, error) {
+	from, to = strings.ToUpper(from), strings.ToUpper(to)
+	if from == to {
+		return 1, nil
+	}
+	if rate, ok := c.pairRate(from, to); ok {
+		return rate, nil
+	}
+	if c.baseCurrency != "" && from != c.baseCurrency && to != c.baseCurrency {
+		toBase, okFrom := c.pairRate(from, c.baseCurrency)
+		fromBase, okTo := c.pairRate(c.baseCurrency, to)
+		if okFrom && okTo {
+			return toBase * fromBase, nil
+		}
+	}
+	return 0, fmt.Errorf("%w: %s to %s", ErrFxRateNotFound, from, to)
+}
+
+// Convert returns the amount in from expressed in to
+func (c *FxConverter) Convert(amount float64, from, to string) (float64, error) {
+	rate, err := c.Rate(from, to)
+	if err != nil {
+		return 0, err
+	}
+	return amount * rate, nil
+}
+
+func (c *FxConverter) pairRate(from, to string) (float64, bool) {
+	if rate, ok := c.rates[from+"_"+to]; ok {
+		return rate, true
+	}
+	if rate, ok := c.rates[to+"_"+from]; ok && rate != 0 {
+		return 1 / rate, true
+	}
+	return 0, false
+}
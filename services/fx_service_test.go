@@ -0,0 +1,105 @@
+package services
+
+import (
+	"asset-dairy/models"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+// MockFxRateRepository is a mock implementation of FxRateRepositoryInterface
+type MockFxRateRepository struct {
+	mock.Mock
+}
+
+func (m *MockFxRateRepository) ListLatestRates(asOf time.Time) ([]models.FxRate, error) {
+	args := m.Called(asOf)
+	return args.Get(0).([]models.FxRate), args.Error(1)
+}
+
+func (m *MockFxRateRepository) ListRates(from, to time.Time) ([]models.FxRate, error) {
+	args := m.Called(from, to)
+	return args.Get(0).([]models.FxRate), args.Error(1)
+}
+
+// Add stub methods to satisfy FxRateRepositoryInterface
+func (m *MockFxRateRepository) UpsertRates(rates []models.FxRate) error {
+	panic("not implemented")
+}
+
+func TestFxConverter(t *testing.T) {
+	converter := NewFxConverter([]models.FxRate{
+		{BaseCurrency: "USD", QuoteCurrency: "TWD", Rate: 32},
+		{BaseCurrency: "EUR", QuoteCurrency: "USD", Rate: 1.1},
+	}, "USD")
+	tests := []struct {
+		name           string
+		amount         float64
+		from           string
+		to             string
+		expectedAmount float64
+		expectedError  error
+	}{
+		{name: "direct rate should convert", amount: 10, from: "USD", to: "TWD", expectedAmount: 320},
+		{name: "inverse rate should convert", amount: 320, from: "TWD", to: "USD", expectedAmount: 10},
+		{name: "rates through the base currency should be combined", amount: 10, from: "EUR", to: "TWD", expectedAmount: 352},
+		{name: "same currency in another case should keep the amount", amount: 5, from: "twd", to: "TWD", expectedAmount: 5},
+		{name: "currency without a rate should be rejected", amount: 10, from: "JPY", to: "TWD", expectedError: ErrFxRateNotFound},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			amount, err := converter.Convert(tt.amount, tt.from, tt.to)
+
+			if tt.expectedError != nil {
+				assert.ErrorIs(t, err, tt.expectedError)
+				return
+			}
+			assert.NoError(t, err)
+			assert.InDelta(t, tt.expectedAmount, amount, 1e-9)
+		})
+	}
+}
+
+func TestDailyConverters(t *testing.T) {
+	day := func(d int) time.Time { return time.Date(2024, 1, d, 0, 0, 0, 0, time.UTC) }
+	repo := new(MockFxRateRepository)
+	repo.On("ListLatestRates", day(1)).Return([]models.FxRate{
+		{BaseCurrency: "USD", QuoteCurrency: "TWD", Date: day(1), Rate: 32},
+		{BaseCurrency: "EUR", QuoteCurrency: "USD", Date: day(1), Rate: 1.1},
+	}, nil)
+	repo.On("ListRates", day(2), day(4)).Return([]models.FxRate{
+		{BaseCurrency: "USD", QuoteCurrency: "TWD", Date: day(3), Rate: 31},
+	}, nil)
+	converters, err := NewFxService(repo, "USD").DailyConverters(day(1).Add(15*time.Hour), day(4))
+	assert.NoError(t, err)
+	assert.Len(t, converters, 4)
+	assert.Same(t, converters[day(1)], converters[day(2)], "days without new rates should share a converter")
+	assert.Same(t, converters[day(3)], converters[day(4)])
+
+	tests := []struct {
+		name         string
+		date         time.Time
+		from         string
+		to           string
+		expectedRate float64
+	}{
+		{name: "first day should use the latest stored rates", date: day(1), from: "USD", to: "TWD", expectedRate: 32},
+		{name: "day before a new rate should keep the old one", date: day(2), from: "USD", to: "TWD", expectedRate: 32},
+		{name: "day of a new rate should use it", date: day(3), from: "USD", to: "TWD", expectedRate: 31},
+		{name: "later day should keep the new rate", date: day(4), from: "USD", to: "TWD", expectedRate: 31},
+		{name: "unchanged pair should carry over", date: day(4), from: "EUR", to: "USD", expectedRate: 1.1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rate, err := converters[tt.date].Rate(tt.from, tt.to)
+
+			assert.NoError(t, err)
+			assert.InDelta(t, tt.expectedRate, rate, 1e-9)
+		})
+	}
+	repo.AssertExpectations(t)
+}
@@ -2,107 +2,453 @@ package services
 
 import (
 	"asset-dairy/models"
+	"errors"
+	"fmt"
+	"math"
+	"strings"
+	"time"
 )
 
+var ErrInvalidHoldingsQuery = errors.New("invalid holdings query")
+
 type HoldingServiceInterface interface {
 	ListHoldings(userID string) ([]models.Holding, error)
+	ListHoldingsAsOf(userID string, query models.HoldingsQuery) ([]models.Holding, error)
+	ListRealizedGains(userID string) ([]models.RealizedGain, error)
+	ListAccountHoldings(userID string) (map[string][]models.Holding, error)
+	ListHoldingsByAccount(userID string, query models.HoldingsQuery) ([]models.AccountHoldings, error)
+	GetAccountHoldings(userID, accountID string, query models.HoldingsQuery) (*models.AccountHoldings, error)
+	DiffHoldings(userID string, from, to time.Time) (*models.HoldingsDiff, error)
 }
 
 type HoldingService struct {
-	tradeService TradeServiceInterface
-}
-
-// Lot represents a batch of shares bought at a specific price
-type Lot struct {
-	Quantity     float64
-	Price        float64
-	RemainingQty float64
+	tradeService   TradeServiceInterface
+	profileService ProfileServiceInterface
+	accountService AccountServiceInterface
+	priceProvider  PriceProvider
+	fxService      FxServiceInterface
+	incomeService  IncomeServiceInterface
+	actionService  CorporateActionServiceInterface
 }
 
-func NewHoldingService(tradeService TradeServiceInterface) *HoldingService {
+// NewHoldingService creates a HoldingService. The fx service converts fees and taxes charged
+// in a currency other than the trade's; income events supply the yield on cost, and corporate
+// actions adjust the lots.
+func NewHoldingService(tradeService TradeServiceInterface, profileService ProfileServiceInterface, accountService AccountServiceInterface, priceProvider PriceProvider, fxService FxServiceInterface, incomeService IncomeServiceInterface, actionService CorporateActionServiceInterface) *HoldingService {
 	return &HoldingService{
-		tradeService: tradeService,
+		tradeService:   tradeService,
+		profileService: profileService,
+		accountService: accountService,
+		priceProvider:  priceProvider,
+		fxService:      fxService,
+		incomeService:  incomeService,
+		actionService:  actionService,
 	}
 }
 
 func (s *HoldingService) ListHoldings(userID string) ([]models.Holding, error) {
-	trades, err := s.tradeService.ListTrades(userID)
+	return s.ListHoldingsAsOf(userID, models.HoldingsQuery{})
+}
+
+// ListHoldingsAsOf returns the holdings on the query date, replaying only the trades and
+// corporate actions dated up to it. Lots are matched within each account and the positions
+// of every account are summed, so the totals agree with the per-account views.
+func (s *HoldingService) ListHoldingsAsOf(userID string, query models.HoldingsQuery) ([]models.Holding, error) {
+	if err := checkHoldingsQuery(query); err != nil {
+		return nil, err
+	}
+	matcher, err := s.matchUserTrades(userID, query.AsOf)
 	if err != nil {
 		return nil, err
 	}
 
-	// Map to track assets by ticker and currency
-	assetMap := make(map[string]*models.Holding)
-	// Map to track lots for each asset
-	lotsMap := make(map[string][]*Lot)
+	holdings := matcher.holdings()
+	if err := s.applyPrices(holdings, query); err != nil {
+		return nil, err
+	}
+	events, err := s.incomeService.ListEvents(userID, 0, "")
+	if err != nil {
+		return nil, err
+	}
+	if err := s.applyYieldOnCost(holdings, events, queryDate(query)); err != nil {
+		return nil, err
+	}
+	return holdings, nil
+}
 
-	for _, trade := range trades {
-		key := trade.Ticker + "_" + trade.Currency
-		asset, exists := assetMap[key]
-		if !exists {
-			asset = &models.Holding{
-				Ticker:    trade.Ticker,
-				AssetType: trade.AssetType,
-				Currency:  trade.Currency,
-			}
-			assetMap[key] = asset
-			lotsMap[key] = []*Lot{}
+// ListRealizedGains returns one record per sell-to-lot match across the user's trade history,
+// each sell matched against the lots of its own account
+func (s *HoldingService) ListRealizedGains(userID string) ([]models.RealizedGain, error) {
+	matcher, err := s.matchUserTrades(userID, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	return matcher.realizedGains(), nil
+}
+
+// DiffHoldings compares the holdings at the end of two dates. Positions held on both dates
+// are changed when their quantity or average price differs.
+func (s *HoldingService) DiffHoldings(userID string, from, to time.Time) (*models.HoldingsDiff, error) {
+	if from.After(to) {
+		return nil, fmt.Errorf("%w: from must not be after to", ErrInvalidHoldingsQuery)
+	}
+	if err := checkHoldingsQuery(models.HoldingsQuery{AsOf: &to}); err != nil {
+		return nil, err
+	}
+	trades, costBasis, actions, err := s.replayInputs(userID)
+	if err != nil {
+		return nil, err
+	}
+
+	before := matchTradesThrough(trades, costBasis, actions, from).holdings()
+	after := matchTradesThrough(trades, costBasis, actions, to).holdings()
+	diff := diffHoldings(before, after)
+	diff.From, diff.To = truncateToDate(from), truncateToDate(to)
+	return diff, nil
+}
+
+// ListAccountHoldings returns the holdings of each account keyed by account ID, matching
+// lots only against trades of the same account
+func (s *HoldingService) ListAccountHoldings(userID string) (map[string][]models.Holding, error) {
+	return s.accountHoldings(userID, "", models.HoldingsQuery{}, false)
+}
+
+// ListHoldingsByAccount returns the holdings of every account with open positions on the
+// query date, in the order the accounts are listed, with the open lots of each position
+func (s *HoldingService) ListHoldingsByAccount(userID string, query models.HoldingsQuery) ([]models.AccountHoldings, error) {
+	if err := checkHoldingsQuery(query); err != nil {
+		return nil, err
+	}
+	accounts, err := s.accountService.ListAccounts(userID)
+	if err != nil {
+		return nil, err
+	}
+	holdingsByAccount, err := s.accountHoldings(userID, "", query, true)
+	if err != nil {
+		return nil, err
+	}
+
+	grouped := []models.AccountHoldings{}
+	for _, account := range accounts {
+		if holdings := holdingsByAccount[account.ID]; len(holdings) > 0 {
+			grouped = append(grouped, models.AccountHoldings{AccountID: account.ID, AccountName: account.Name, Holdings: holdings})
 		}
+	}
+	return grouped, nil
+}
 
-		if trade.Type == "buy" {
-			// Add new lot for buy
-			lot := &Lot{
-				Quantity:     trade.Quantity,
-				Price:        trade.Price,
-				RemainingQty: trade.Quantity,
-			}
-			lotsMap[key] = append(lotsMap[key], lot)
-			asset.Quantity += trade.Quantity
-		} else if trade.Type == "sell" {
-			// Implement FIFO for sells
-			remainingSellQty := trade.Quantity
-			for _, lot := range lotsMap[key] {
-				if remainingSellQty <= 0 {
-					break
-				}
-				if lot.RemainingQty > 0 {
-					if lot.RemainingQty >= remainingSellQty {
-						lot.RemainingQty -= remainingSellQty
-						remainingSellQty = 0
-					} else {
-						remainingSellQty -= lot.RemainingQty
-						lot.RemainingQty = 0
-					}
-				}
-			}
-			asset.Quantity -= trade.Quantity
+// GetAccountHoldings returns the holdings of one of the user's accounts on the query date with
+// their open lots
+func (s *HoldingService) GetAccountHoldings(userID, accountID string, query models.HoldingsQuery) (*models.AccountHoldings, error) {
+	if err := checkHoldingsQuery(query); err != nil {
+		return nil, err
+	}
+	accounts, err := s.accountService.ListAccounts(userID)
+	if err != nil {
+		return nil, err
+	}
+	for _, account := range accounts {
+		if account.ID != accountID {
+			continue
 		}
+		holdingsByAccount, err := s.accountHoldings(userID, accountID, query, true)
+		if err != nil {
+			return nil, err
+		}
+		holdings := holdingsByAccount[accountID]
+		if holdings == nil {
+			holdings = []models.Holding{}
+		}
+		return &models.AccountHoldings{AccountID: account.ID, AccountName: account.Name, Holdings: holdings}, nil
 	}
+	return nil, ErrAccountNotFound
+}
 
-	// Calculate average price based on remaining lots
-	for key, asset := range assetMap {
-		if asset.Quantity > 0 {
-			var totalCost float64
-			var totalRemainingQty float64
-			for _, lot := range lotsMap[key] {
-				if lot.RemainingQty > 0 {
-					totalCost += lot.Price * lot.RemainingQty
-					totalRemainingQty += lot.RemainingQty
-				}
-			}
-			if totalRemainingQty > 0 {
-				asset.AveragePrice = totalCost / totalRemainingQty
+// accountHoldings matches the trades of each account on their own, or only those of
+// onlyAccountID when it is set, and returns the priced holdings on the query date keyed by
+// account ID
+func (s *HoldingService) accountHoldings(userID, onlyAccountID string, query models.HoldingsQuery, withLots bool) (map[string][]models.Holding, error) {
+	trades, costBasis, actions, err := s.replayInputs(userID)
+	if err != nil {
+		return nil, err
+	}
+
+	events, err := s.incomeService.ListEvents(userID, 0, "")
+	if err != nil {
+		return nil, err
+	}
+
+	if onlyAccountID != "" {
+		accountTrades := []models.Trade{}
+		for _, trade := range trades {
+			if trade.AccountID == onlyAccountID {
+				accountTrades = append(accountTrades, trade)
 			}
 		}
+		trades = accountTrades
 	}
+	eventsByAccount := make(map[string][]models.IncomeEvent)
+	for _, event := range events {
+		eventsByAccount[event.AccountID] = append(eventsByAccount[event.AccountID], event)
+	}
+	holdingsByAccount := replayTrades(trades, costBasis, actions, query.AsOf).accountHoldings(withLots)
+	for accountID, holdings := range holdingsByAccount {
+		if err := s.applyPrices(holdings, query); err != nil {
+			return nil, err
+		}
+		if err := s.applyYieldOnCost(holdings, eventsByAccount[accountID], queryDate(query)); err != nil {
+			return nil, err
+		}
+	}
+	return holdingsByAccount, nil
+}
 
-	// Convert map to slice and filter out zero quantity assets
-	assets := []models.Holding{}
-	for _, asset := range assetMap {
-		if asset.Quantity > 0 {
-			assets = append(assets, *asset)
+// matchUserTrades replays the user's trades with their cost-basis settings and the corporate
+// actions, up to asOf when it is set
+func (s *HoldingService) matchUserTrades(userID string, asOf *time.Time) (*lotMatcher, error) {
+	trades, costBasis, actions, err := s.replayInputs(userID)
+	if err != nil {
+		return nil, err
+	}
+	return replayTrades(trades, costBasis, actions, asOf), nil
+}
+
+// replayInputs loads what a replay of the user's trades needs: the trades, their cost-basis
+// settings and the corporate actions
+func (s *HoldingService) replayInputs(userID string) ([]models.Trade, costBasisSettings, []models.CorporateAction, error) {
+	trades, err := s.listTrades(userID)
+	if err != nil {
+		return nil, costBasisSettings{}, nil, err
+	}
+
+	costBasis, err := s.costBasisSettings(userID)
+	if err != nil {
+		return nil, costBasisSettings{}, nil, err
+	}
+
+	actions, err := s.actionService.ListActions("")
+	if err != nil {
+		return nil, costBasisSettings{}, nil, err
+	}
+
+	return trades, costBasis, actions, nil
+}
+
+// replayTrades matches every trade with the actions effective today, or only the trades and
+// actions dated up to asOf when it is set
+func replayTrades(trades []models.Trade, costBasis costBasisSettings, actions []models.CorporateAction, asOf *time.Time) *lotMatcher {
+	if asOf == nil {
+		return matchTrades(trades, costBasis, actions)
+	}
+	return matchTradesThrough(trades, costBasis, actions, *asOf)
+}
+
+// checkHoldingsQuery rejects an as-of date in the future
+func checkHoldingsQuery(query models.HoldingsQuery) error {
+	if query.AsOf != nil && truncateToDate(*query.AsOf).After(truncateToDate(time.Now())) {
+		return fmt.Errorf("%w: asOf must not be in the future", ErrInvalidHoldingsQuery)
+	}
+	return nil
+}
+
+// queryDate is the date trailing income is measured up to
+func queryDate(query models.HoldingsQuery) time.Time {
+	if query.AsOf == nil {
+		return time.Now()
+	}
+	return *query.AsOf
+}
+
+// listTrades returns the user's trades with fees and taxes in the trade currency, followed by
+// buys of the units received as income
+func (s *HoldingService) listTrades(userID string) ([]models.Trade, error) {
+	trades, err := s.tradeService.ListTrades(userID)
+	if err != nil {
+		return nil, err
+	}
+	events, err := s.incomeService.ListEvents(userID, 0, "")
+	if err != nil {
+		return nil, err
+	}
+	received, err := receivedUnitTrades(s.fxService, trades, events)
+	if err != nil {
+		return nil, err
+	}
+	normalized, err := normalizeTradeCharges(s.fxService, trades)
+	if err != nil {
+		return nil, err
+	}
+	return append(normalized, received...), nil
+}
+
+// costBasisSettings reads the profile-wide cost-basis method and any per-account overrides
+func (s *HoldingService) costBasisSettings(userID string) (costBasisSettings, error) {
+	settings := costBasisSettings{
+		defaultMethod:  models.CostBasisFIFO,
+		accountMethods: make(map[string]string),
+	}
+
+	profile, err := s.profileService.GetProfile(userID)
+	if err != nil {
+		return settings, err
+	}
+	if profile.InvestmentProfile != nil && profile.InvestmentProfile.CostBasisMethod != "" {
+		settings.defaultMethod = profile.InvestmentProfile.CostBasisMethod
+	}
+
+	accounts, err := s.accountService.ListAccounts(userID)
+	if err != nil {
+		return settings, err
+	}
+	for _, acc := range accounts {
+		if acc.CostBasisMethod != nil {
+			settings.accountMethods[acc.ID] = *acc.CostBasisMethod
+		}
+	}
+
+	return settings, nil
+}
+
+// applyPrices values the holdings at the latest quotes, or at the closes of the query date
+// when asked to; holdings as of a past date are otherwise left unvalued
+func (s *HoldingService) applyPrices(holdings []models.Holding, query models.HoldingsQuery) error {
+	if len(holdings) == 0 || (query.AsOf != nil && !query.PriceAtClose) {
+		return nil
+	}
+	tickers := make([]string, 0, len(holdings))
+	for _, holding := range holdings {
+		tickers = append(tickers, holding.Ticker)
+	}
+	var prices []models.Price
+	var err error
+	if query.AsOf == nil {
+		prices, err = s.priceProvider.LatestPrices(tickers)
+	} else {
+		prices, err = s.priceProvider.ClosingPrices(tickers, *query.AsOf)
+	}
+	if err != nil {
+		return err
+	}
+	applyMarketPrices(holdings, prices)
+	return nil
+}
+
+// applyMarketPrices fills in market value and unrealized gains for holdings with a quote in their currency
+func applyMarketPrices(holdings []models.Holding, prices []models.Price) {
+	quotes := make(map[string]float64, len(prices))
+	for _, price := range prices {
+		quotes[price.Ticker+"_"+price.Currency] = price.Price
+	}
+
+	for i := range holdings {
+		holding := &holdings[i]
+		marketPrice, ok := quotes[holding.Ticker+"_"+holding.Currency]
+		if !ok {
+			continue
+		}
+		costBasis := holding.CostBasis()
+		marketValue := holding.Quantity * marketPrice * holding.ContractSize()
+		unrealizedPnl := marketValue - costBasis
+		holding.MarketPrice = &marketPrice
+		holding.MarketValue = &marketValue
+		holding.UnrealizedPnl = &unrealizedPnl
+		if costBasis != 0 {
+			unrealizedPnlPercent := unrealizedPnl / math.Abs(costBasis) * 100
+			holding.UnrealizedPnlPercent = &unrealizedPnlPercent
+		}
+	}
+}
+
+// diffHoldings sorts the positions of two dates into opened, closed and changed, keeping the
+// order they were first traded in
+func diffHoldings(before, after []models.Holding) *models.HoldingsDiff {
+	diff := &models.HoldingsDiff{Opened: []models.HoldingChange{}, Closed: []models.HoldingChange{}, Changed: []models.HoldingChange{}}
+	held := make(map[string]models.Holding, len(before))
+	for _, holding := range before {
+		held[holding.Ticker+"_"+holding.Currency] = holding
+	}
+	for _, holding := range after {
+		key := holding.Ticker + "_" + holding.Currency
+		previous, ok := held[key]
+		delete(held, key)
+		change := models.HoldingChange{
+			Ticker:         holding.Ticker,
+			AssetType:      holding.AssetType,
+			Currency:       holding.Currency,
+			ToQuantity:     holding.Quantity,
+			ToAveragePrice: holding.AveragePrice,
+		}
+		if !ok {
+			change.QuantityChange = holding.Quantity
+			diff.Opened = append(diff.Opened, change)
+			continue
 		}
+		change.FromQuantity = previous.Quantity
+		change.FromAveragePrice = previous.AveragePrice
+		change.QuantityChange = holding.Quantity - previous.Quantity
+		if math.Abs(change.QuantityChange) > quantityEpsilon || math.Abs(holding.AveragePrice-previous.AveragePrice) > quantityEpsilon {
+			diff.Changed = append(diff.Changed, change)
+		}
+	}
+	for _, holding := range before {
+		if _, ok := held[holding.Ticker+"_"+holding.Currency]; !ok {
+			continue
+		}
+		diff.Closed = append(diff.Closed, models.HoldingChange{
+			Ticker:           holding.Ticker,
+			AssetType:        holding.AssetType,
+			Currency:         holding.Currency,
+			FromQuantity:     holding.Quantity,
+			QuantityChange:   -holding.Quantity,
+			FromAveragePrice: holding.AveragePrice,
+		})
 	}
+	return diff
+}
 
-	return assets, nil
+// applyYieldOnCost fills in the trailing income of long holdings, converted into each holding's
+// currency at the rates known on asOf, and its yield on their cost basis. A holding whose
+// income has no rate into its currency is left without them.
+func (s *HoldingService) applyYieldOnCost(holdings []models.Holding, events []models.IncomeEvent, asOf time.Time) error {
+	income := trailingIncome(events, asOf)
+	var converter *FxConverter
+	for i := range holdings {
+		holding := &holdings[i]
+		paid, ok := income[strings.ToUpper(holding.Ticker)]
+		if !ok || holding.Quantity <= 0 {
+			continue
+		}
+		amount, converted := 0.0, true
+		for currency, paidAmount := range paid {
+			if strings.EqualFold(currency, holding.Currency) {
+				amount += paidAmount
+				continue
+			}
+			if converter == nil {
+				var err error
+				if converter, err = s.fxService.Converter(asOf); err != nil {
+					return err
+				}
+			}
+			value, err := converter.Convert(paidAmount, currency, holding.Currency)
+			if errors.Is(err, ErrFxRateNotFound) {
+				converted = false
+				break
+			}
+			if err != nil {
+				return err
+			}
+			amount += value
+		}
+		if !converted {
+			continue
+		}
+		holding.TrailingIncome = &amount
+		if costBasis := holding.CostBasis(); costBasis > 0 {
+			yieldOnCost := amount / costBasis * 100
+			holding.YieldOnCostPercent = &yieldOnCost
+		}
+	}
+	return nil
 }
@@ -2,7 +2,9 @@ package services
 
 import (
 	"asset-dairy/models"
+	"errors"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/mock"
@@ -18,8 +20,26 @@ func (m *MockTradeService) ListTrades(userID string) ([]models.Trade, error) {
 	return args.Get(0).([]models.Trade), args.Error(1)
 }
 
+func (m *MockTradeService) CreateTrade(userID string, trade models.Trade) (*models.Trade, error) {
+	args := m.Called(userID, trade)
+	if created, ok := args.Get(0).(func(string, models.Trade) *models.Trade); ok {
+		return created(userID, trade), args.Error(1)
+	}
+	created, _ := args.Get(0).(*models.Trade)
+	return created, args.Error(1)
+}
+
+func (m *MockTradeService) CreateTrades(userID string, trades []models.Trade) ([]models.Trade, error) {
+	args := m.Called(userID, trades)
+	if created, ok := args.Get(0).(func(string, []models.Trade) []models.Trade); ok {
+		return created(userID, trades), args.Error(1)
+	}
+	created, _ := args.Get(0).([]models.Trade)
+	return created, args.Error(1)
+}
+
 // Add stub methods to satisfy TradeServiceInterface
-func (m *MockTradeService) CreateTrade(userID string, trade models.Trade) error {
+func (m *MockTradeService) ValidateTrades(userID string, trades []models.Trade) ([]models.Trade, []error, error) {
 	panic("not implemented")
 }
 func (m *MockTradeService) UpdateTrade(userID, tradeID string, req models.TradeUpdateRequest) (*models.Trade, error) {
@@ -34,13 +54,188 @@ func (m *MockTradeService) IsAccountOwnedByUser(accountID, userID string) (bool,
 func (m *MockTradeService) IsTradeOwnedByUser(tradeID, userID string) (bool, error) {
 	panic("not implemented")
 }
+func (m *MockTradeService) FindDuplicates(userID string, tolerance float64) ([]models.TradeDuplicateGroup, error) {
+	panic("not implemented")
+}
+func (m *MockTradeService) MergeDuplicates(userID string, req models.TradeMergeRequest) (*models.Trade, error) {
+	panic("not implemented")
+}
+func (m *MockTradeService) DismissDuplicates(userID string, req models.TradeDismissRequest) error {
+	panic("not implemented")
+}
+func (m *MockTradeService) ValidateReceivedUnits(userID string, before, after *models.IncomeEvent) error {
+	panic("not implemented")
+}
+func (m *MockTradeService) ValidateDisallowShort(userID, accountID string) error {
+	panic("not implemented")
+}
+func (m *MockTradeService) WithUserLock(userID string, fn func() error) error {
+	panic("not implemented")
+}
+
+// MockProfileService is a mock implementation of ProfileServiceInterface
+type MockProfileService struct {
+	mock.Mock
+}
+
+func (m *MockProfileService) GetProfile(userID string) (*models.Profile, error) {
+	args := m.Called(userID)
+	return args.Get(0).(*models.Profile), args.Error(1)
+}
+
+// Add stub methods to satisfy ProfileServiceInterface
+func (m *MockProfileService) ChangePassword(userID string, currentPassword, newPassword string) error {
+	panic("not implemented")
+}
+func (m *MockProfileService) UpdateProfile(userID string, req *models.UserUpdateRequest) (*models.Profile, error) {
+	panic("not implemented")
+}
+
+// MockAccountService is a mock implementation of AccountServiceInterface
+type MockAccountService struct {
+	mock.Mock
+}
+
+func (m *MockAccountService) ListAccounts(userID string) ([]models.Account, error) {
+	args := m.Called(userID)
+	return args.Get(0).([]models.Account), args.Error(1)
+}
+
+// Add stub methods to satisfy AccountServiceInterface
+func (m *MockAccountService) CreateAccount(userID string, req models.AccountCreateRequest) (*models.Account, error) {
+	panic("not implemented")
+}
+func (m *MockAccountService) UpdateAccount(userID, accID string, req models.AccountUpdateRequest) (*models.Account, error) {
+	panic("not implemented")
+}
+func (m *MockAccountService) DeleteAccount(userID, accID string) error {
+	panic("not implemented")
+}
+
+// MockIncomeService is a mock implementation of IncomeServiceInterface
+type MockIncomeService struct {
+	mock.Mock
+}
+
+func (m *MockIncomeService) ListEvents(userID string, year int, ticker string) ([]models.IncomeEvent, error) {
+	args := m.Called(userID, year, ticker)
+	return args.Get(0).([]models.IncomeEvent), args.Error(1)
+}
+
+// Add stub methods to satisfy IncomeServiceInterface
+func (m *MockIncomeService) CreateEvent(userID string, req models.IncomeEventCreateRequest) (*models.IncomeEvent, error) {
+	panic("not implemented")
+}
+func (m *MockIncomeService) ValidateEvent(userID string, event models.IncomeEvent) (*models.IncomeEvent, error) {
+	panic("not implemented")
+}
+func (m *MockIncomeService) RecordEvent(userID string, event models.IncomeEvent) (*models.IncomeEvent, error) {
+	panic("not implemented")
+}
+func (m *MockIncomeService) UpdateEvent(userID, eventID string, req models.IncomeEventUpdateRequest) (*models.IncomeEvent, error) {
+	panic("not implemented")
+}
+func (m *MockIncomeService) DeleteEvent(userID, eventID string) (bool, error) {
+	panic("not implemented")
+}
+func (m *MockIncomeService) GetSummary(userID, currency, groupBy string, year int) (*models.IncomeSummary, error) {
+	panic("not implemented")
+}
+
+// noIncome returns an income service mock without any events
+func noIncome() *MockIncomeService {
+	mockIncomeService := new(MockIncomeService)
+	mockIncomeService.On("ListEvents", "test-user", 0, "").Return([]models.IncomeEvent{}, nil)
+	return mockIncomeService
+}
+
+// MockCorporateActionService is a mock implementation of CorporateActionServiceInterface
+type MockCorporateActionService struct {
+	mock.Mock
+}
+
+func (m *MockCorporateActionService) ListActions(ticker string) ([]models.CorporateAction, error) {
+	args := m.Called(ticker)
+	return args.Get(0).([]models.CorporateAction), args.Error(1)
+}
+
+func (m *MockCorporateActionService) SyncCash(userID string) error {
+	args := m.Called(userID)
+	return args.Error(0)
+}
+
+// Add stub methods to satisfy CorporateActionServiceInterface
+func (m *MockCorporateActionService) CreateAction(req models.CorporateActionCreateRequest) (*models.CorporateAction, error) {
+	panic("not implemented")
+}
+func (m *MockCorporateActionService) UpdateAction(actionID string, req models.CorporateActionCreateRequest) (*models.CorporateAction, error) {
+	panic("not implemented")
+}
+func (m *MockCorporateActionService) DeleteAction(actionID string) (bool, error) {
+	panic("not implemented")
+}
+
+// withCorporateActions returns a corporate action service mock serving the given actions
+func withCorporateActions(actions ...models.CorporateAction) *MockCorporateActionService {
+	if actions == nil {
+		actions = []models.CorporateAction{}
+	}
+	mockActionService := new(MockCorporateActionService)
+	mockActionService.On("ListActions", "").Return(actions, nil)
+	mockActionService.On("SyncCash", mock.Anything).Return(nil)
+	return mockActionService
+}
+
+// stubPriceProvider serves a fixed set of quotes, and closes keyed by YYYY-MM-DD date
+type stubPriceProvider struct {
+	prices []models.Price
+	closes map[string][]models.Price
+}
+
+func (p stubPriceProvider) LatestPrices(tickers []string) ([]models.Price, error) {
+	return p.prices, nil
+}
+
+func (p stubPriceProvider) ClosingPrices(tickers []string, date time.Time) ([]models.Price, error) {
+	return p.closes[date.Format("2006-01-02")], nil
+}
+
+// newMockedHoldingService wires a HoldingService to mocks returning the given trades,
+// profile-wide cost-basis method and accounts
+func newMockedHoldingService(trades []models.Trade, costBasisMethod string, accounts []models.Account) (*HoldingService, *MockTradeService) {
+	mockTradeService := new(MockTradeService)
+	mockTradeService.On("ListTrades", "test-user").Return(trades, nil)
+
+	mockProfileService := new(MockProfileService)
+	mockProfileService.On("GetProfile", "test-user").Return(&models.Profile{
+		InvestmentProfile: &models.InvestmentProfile{CostBasisMethod: costBasisMethod},
+	}, nil)
+
+	if accounts == nil {
+		accounts = []models.Account{}
+	}
+	mockAccountService := new(MockAccountService)
+	mockAccountService.On("ListAccounts", "test-user").Return(accounts, nil)
+
+	return NewHoldingService(mockTradeService, mockProfileService, mockAccountService, stubPriceProvider{}, new(MockFxService), noIncome(), withCorporateActions()), mockTradeService
+}
+
+func stringPtr(s string) *string {
+	return &s
+}
+
+func floatPtr(f float64) *float64 {
+	return &f
+}
 
 func TestListAssets(t *testing.T) {
 	tests := []struct {
-		name           string
-		trades         []models.Trade
-		expectedAssets []models.Holding
-		expectedError  error
+		name            string
+		costBasisMethod string
+		accounts        []models.Account
+		trades          []models.Trade
+		expectedAssets  []models.Holding
+		expectedError   error
 	}{
 		{
 			name:           "no trades should return empty list",
@@ -217,16 +412,146 @@ func TestListAssets(t *testing.T) {
 			},
 			expectedError: nil,
 		},
+		{
+			name:            "lifo sell should consume the newest lot first",
+			costBasisMethod: models.CostBasisLIFO,
+			trades: []models.Trade{
+				{Type: "buy", AssetType: "stock", Ticker: "AAPL", Quantity: 10, Price: 100, Currency: "USD"},
+				{Type: "buy", AssetType: "stock", Ticker: "AAPL", Quantity: 5, Price: 200, Currency: "USD"},
+				{Type: "sell", AssetType: "stock", Ticker: "AAPL", Quantity: 5, Price: 300, Currency: "USD"},
+			},
+			expectedAssets: []models.Holding{
+				{Ticker: "AAPL", Quantity: 10, AveragePrice: 100, AssetType: "stock", Currency: "USD"},
+			},
+		},
+		{
+			name:            "hifo sell should consume the most expensive lot first",
+			costBasisMethod: models.CostBasisHIFO,
+			trades: []models.Trade{
+				{Type: "buy", AssetType: "stock", Ticker: "AAPL", Quantity: 5, Price: 100, Currency: "USD"},
+				{Type: "buy", AssetType: "stock", Ticker: "AAPL", Quantity: 5, Price: 300, Currency: "USD"},
+				{Type: "buy", AssetType: "stock", Ticker: "AAPL", Quantity: 5, Price: 200, Currency: "USD"},
+				{Type: "sell", AssetType: "stock", Ticker: "AAPL", Quantity: 5, Price: 250, Currency: "USD"},
+			},
+			expectedAssets: []models.Holding{
+				{Ticker: "AAPL", Quantity: 10, AveragePrice: (5*100 + 5*200) / 10, AssetType: "stock", Currency: "USD"},
+			},
+		},
+		{
+			name:            "average cost sell should keep the moving average price",
+			costBasisMethod: models.CostBasisAverage,
+			trades: []models.Trade{
+				{Type: "buy", AssetType: "stock", Ticker: "AAPL", Quantity: 10, Price: 100, Currency: "USD"},
+				{Type: "buy", AssetType: "stock", Ticker: "AAPL", Quantity: 10, Price: 200, Currency: "USD"},
+				{Type: "sell", AssetType: "stock", Ticker: "AAPL", Quantity: 10, Price: 300, Currency: "USD"},
+			},
+			expectedAssets: []models.Holding{
+				{Ticker: "AAPL", Quantity: 10, AveragePrice: 150, AssetType: "stock", Currency: "USD"},
+			},
+		},
+		{
+			name:            "account override should take precedence over the profile method",
+			costBasisMethod: models.CostBasisFIFO,
+			accounts: []models.Account{
+				{ID: "acc-1", CostBasisMethod: stringPtr(models.CostBasisLIFO)},
+			},
+			trades: []models.Trade{
+				{Type: "buy", AssetType: "stock", Ticker: "AAPL", Quantity: 10, Price: 100, Currency: "USD", AccountID: "acc-1"},
+				{Type: "buy", AssetType: "stock", Ticker: "AAPL", Quantity: 5, Price: 200, Currency: "USD", AccountID: "acc-1"},
+				{Type: "sell", AssetType: "stock", Ticker: "AAPL", Quantity: 5, Price: 300, Currency: "USD", AccountID: "acc-1"},
+			},
+			expectedAssets: []models.Holding{
+				{Ticker: "AAPL", Quantity: 10, AveragePrice: 100, AssetType: "stock", Currency: "USD"},
+			},
+		},
+		{
+			name:            "lot allocations should take precedence over the cost-basis method",
+			costBasisMethod: models.CostBasisFIFO,
+			trades: []models.Trade{
+				{ID: "b1", Type: "buy", AssetType: "stock", Ticker: "AAPL", Quantity: 10, Price: 100, Currency: "USD"},
+				{ID: "b2", Type: "buy", AssetType: "stock", Ticker: "AAPL", Quantity: 5, Price: 200, Currency: "USD"},
+				{
+					ID: "s1", Type: "sell", AssetType: "stock", Ticker: "AAPL", Quantity: 6, Price: 300, Currency: "USD",
+					LotAllocations: []models.TradeLotAllocation{{SellTradeID: "s1", BuyTradeID: "b2", Quantity: 5}},
+				},
+			},
+			expectedAssets: []models.Holding{
+				{Ticker: "AAPL", Quantity: 9, AveragePrice: 100, AssetType: "stock", Currency: "USD"},
+			},
+		},
+		{
+			name: "sell beyond the long quantity should open a short position",
+			trades: []models.Trade{
+				{Type: "buy", AssetType: "stock", Ticker: "AAPL", Quantity: 5, Price: 100, Currency: "USD"},
+				{Type: "sell", AssetType: "stock", Ticker: "AAPL", Quantity: 8, Price: 150, Currency: "USD"},
+				{Type: "sell", AssetType: "stock", Ticker: "AAPL", Quantity: 3, Price: 130, Currency: "USD"},
+			},
+			expectedAssets: []models.Holding{
+				{Ticker: "AAPL", Quantity: -6, AveragePrice: (3*150 + 3*130) / 6, AssetType: "stock", Currency: "USD"},
+			},
+		},
+		{
+			name: "buy should cover the oldest short lot first and open a long lot with the rest",
+			trades: []models.Trade{
+				{Type: "sell", AssetType: "stock", Ticker: "AAPL", Quantity: 5, Price: 150, Currency: "USD"},
+				{Type: "sell", AssetType: "stock", Ticker: "AAPL", Quantity: 5, Price: 130, Currency: "USD"},
+				{Type: "buy", AssetType: "stock", Ticker: "AAPL", Quantity: 7, Price: 100, Currency: "USD"},
+				{Type: "buy", AssetType: "stock", Ticker: "TSLA", Quantity: 1, Price: 200, Currency: "USD"},
+				{Type: "buy", AssetType: "stock", Ticker: "AAPL", Quantity: 5, Price: 90, Currency: "USD"},
+			},
+			expectedAssets: []models.Holding{
+				{Ticker: "AAPL", Quantity: 2, AveragePrice: 90, AssetType: "stock", Currency: "USD"},
+				{Ticker: "TSLA", Quantity: 1, AveragePrice: 200, AssetType: "stock", Currency: "USD"},
+			},
+		},
+		{
+			name: "trades should be matched in trade date order regardless of input order",
+			trades: []models.Trade{
+				{Type: "sell", AssetType: "stock", Ticker: "AAPL", TradeDate: time.Date(2024, 1, 3, 0, 0, 0, 0, time.UTC), Quantity: 5, Price: 300, Currency: "USD"},
+				{Type: "buy", AssetType: "stock", Ticker: "AAPL", TradeDate: time.Date(2024, 1, 2, 0, 0, 0, 0, time.UTC), Quantity: 5, Price: 200, Currency: "USD"},
+				{Type: "buy", AssetType: "stock", Ticker: "AAPL", TradeDate: time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC), Quantity: 10, Price: 100, Currency: "USD"},
+			},
+			expectedAssets: []models.Holding{
+				{Ticker: "AAPL", Quantity: 10, AveragePrice: (5*100 + 5*200) / 10, AssetType: "stock", Currency: "USD"},
+			},
+		},
+		{
+			name: "positions in different accounts should be matched apart and summed",
+			trades: []models.Trade{
+				{ID: "b1", Type: "buy", AssetType: "stock", Ticker: "AAPL", TradeDate: time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC), Quantity: 10, Price: 100, Currency: "USD", AccountID: "acc-1"},
+				{ID: "b2", Type: "buy", AssetType: "stock", Ticker: "AAPL", TradeDate: time.Date(2024, 1, 2, 0, 0, 0, 0, time.UTC), Quantity: 5, Price: 120, Currency: "USD", AccountID: "acc-2"},
+				{ID: "s1", Type: "sell", AssetType: "stock", Ticker: "AAPL", TradeDate: time.Date(2024, 1, 3, 0, 0, 0, 0, time.UTC), Quantity: 2, Price: 130, Currency: "USD", AccountID: "acc-2"},
+			},
+			expectedAssets: []models.Holding{
+				{Ticker: "AAPL", Quantity: 13, AveragePrice: (10*100 + 3*120) / 13.0, AssetType: "stock", Currency: "USD"},
+			},
+		},
+		{
+			name: "short position in another account should reduce the quantity but not the average price",
+			trades: []models.Trade{
+				{ID: "b1", Type: "buy", AssetType: "stock", Ticker: "AAPL", TradeDate: time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC), Quantity: 10, Price: 100, Currency: "USD", AccountID: "acc-1"},
+				{ID: "s1", Type: "sell", AssetType: "stock", Ticker: "AAPL", TradeDate: time.Date(2024, 1, 2, 0, 0, 0, 0, time.UTC), Quantity: 4, Price: 150, Currency: "USD", AccountID: "acc-2"},
+			},
+			expectedAssets: []models.Holding{
+				{Ticker: "AAPL", Quantity: 6, AveragePrice: 100, AssetType: "stock", Currency: "USD"},
+			},
+		},
+		{
+			name: "net short position should keep the average short sale price",
+			trades: []models.Trade{
+				{ID: "b1", Type: "buy", AssetType: "stock", Ticker: "AAPL", TradeDate: time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC), Quantity: 2, Price: 100, Currency: "USD", AccountID: "acc-1"},
+				{ID: "s1", Type: "sell", AssetType: "stock", Ticker: "AAPL", TradeDate: time.Date(2024, 1, 2, 0, 0, 0, 0, time.UTC), Quantity: 5, Price: 150, Currency: "USD", AccountID: "acc-2"},
+			},
+			expectedAssets: []models.Holding{
+				{Ticker: "AAPL", Quantity: -3, AveragePrice: 150, AssetType: "stock", Currency: "USD"},
+			},
+		},
 	}
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			// Setup mock
-			mockTradeService := new(MockTradeService)
-			mockTradeService.On("ListTrades", "test-user").Return(tt.trades, tt.expectedError)
-
-			// Create service with mock
-			service := NewHoldingService(mockTradeService)
+			// Create service with mocks
+			service, mockTradeService := newMockedHoldingService(tt.trades, tt.costBasisMethod, tt.accounts)
 
 			// Call service method
 			assets, err := service.ListHoldings("test-user")
@@ -240,3 +565,736 @@ func TestListAssets(t *testing.T) {
 		})
 	}
 }
+
+func TestListRealizedGains(t *testing.T) {
+	day := func(d int) time.Time {
+		return time.Date(2024, 1, d, 0, 0, 0, 0, time.UTC)
+	}
+	tests := []struct {
+		name            string
+		costBasisMethod string
+		trades          []models.Trade
+		expectedGains   []models.RealizedGain
+	}{
+		{
+			name: "buys only should realize nothing",
+			trades: []models.Trade{
+				{ID: "b1", Type: "buy", AssetType: "stock", Ticker: "AAPL", TradeDate: day(1), Quantity: 10, Price: 100, Currency: "USD"},
+			},
+			expectedGains: []models.RealizedGain{},
+		},
+		{
+			name: "transfer out should close lots without realizing a gain",
+			trades: []models.Trade{
+				{ID: "b1", Type: "buy", AssetType: "stock", Ticker: "AAPL", TradeDate: day(1), Quantity: 10, Price: 100, Currency: "USD"},
+				{ID: "t1", Type: "sell", AssetType: "stock", Ticker: "AAPL", TradeDate: day(5), Quantity: 4, Price: 100, Currency: "USD", Transfer: true},
+				{ID: "s1", Type: "sell", AssetType: "stock", Ticker: "AAPL", TradeDate: day(11), Quantity: 6, Price: 150, Currency: "USD"},
+			},
+			expectedGains: []models.RealizedGain{
+				{
+					Ticker: "AAPL", AssetType: "stock", Currency: "USD",
+					BuyTradeID: "b1", SellTradeID: "s1", BuyDate: day(1), SellDate: day(11),
+					Quantity: 6, CostBasis: 600, Proceeds: 900, Gain: 300, HoldingPeriodDays: 10,
+				},
+			},
+		},
+		{
+			name: "sell spanning two lots should emit one record per lot",
+			trades: []models.Trade{
+				{ID: "b1", Type: "buy", AssetType: "stock", Ticker: "AAPL", TradeDate: day(1), Quantity: 10, Price: 100, Currency: "USD"},
+				{ID: "b2", Type: "buy", AssetType: "stock", Ticker: "AAPL", TradeDate: day(2), Quantity: 5, Price: 200, Currency: "USD"},
+				{ID: "s1", Type: "sell", AssetType: "stock", Ticker: "AAPL", TradeDate: day(11), Quantity: 12, Price: 300, Currency: "USD"},
+			},
+			expectedGains: []models.RealizedGain{
+				{
+					Ticker: "AAPL", AssetType: "stock", Currency: "USD",
+					BuyTradeID: "b1", SellTradeID: "s1", BuyDate: day(1), SellDate: day(11),
+					Quantity: 10, CostBasis: 1000, Proceeds: 3000, Gain: 2000, HoldingPeriodDays: 10,
+				},
+				{
+					Ticker: "AAPL", AssetType: "stock", Currency: "USD",
+					BuyTradeID: "b2", SellTradeID: "s1", BuyDate: day(2), SellDate: day(11),
+					Quantity: 2, CostBasis: 400, Proceeds: 600, Gain: 200, HoldingPeriodDays: 9,
+				},
+			},
+		},
+		{
+			name:            "lifo sell should realize against the newest lot",
+			costBasisMethod: models.CostBasisLIFO,
+			trades: []models.Trade{
+				{ID: "b1", Type: "buy", AssetType: "stock", Ticker: "AAPL", TradeDate: day(1), Quantity: 10, Price: 100, Currency: "USD"},
+				{ID: "b2", Type: "buy", AssetType: "stock", Ticker: "AAPL", TradeDate: day(2), Quantity: 5, Price: 200, Currency: "USD"},
+				{ID: "s1", Type: "sell", AssetType: "stock", Ticker: "AAPL", TradeDate: day(11), Quantity: 5, Price: 300, Currency: "USD"},
+			},
+			expectedGains: []models.RealizedGain{
+				{
+					Ticker: "AAPL", AssetType: "stock", Currency: "USD",
+					BuyTradeID: "b2", SellTradeID: "s1", BuyDate: day(2), SellDate: day(11),
+					Quantity: 5, CostBasis: 1000, Proceeds: 1500, Gain: 500, HoldingPeriodDays: 9,
+				},
+			},
+		},
+		{
+			name:            "hifo sell should realize against the most expensive lot",
+			costBasisMethod: models.CostBasisHIFO,
+			trades: []models.Trade{
+				{ID: "b1", Type: "buy", AssetType: "stock", Ticker: "AAPL", TradeDate: day(1), Quantity: 5, Price: 300, Currency: "USD"},
+				{ID: "b2", Type: "buy", AssetType: "stock", Ticker: "AAPL", TradeDate: day(2), Quantity: 5, Price: 100, Currency: "USD"},
+				{ID: "s1", Type: "sell", AssetType: "stock", Ticker: "AAPL", TradeDate: day(3), Quantity: 5, Price: 200, Currency: "USD"},
+			},
+			expectedGains: []models.RealizedGain{
+				{
+					Ticker: "AAPL", AssetType: "stock", Currency: "USD",
+					BuyTradeID: "b1", SellTradeID: "s1", BuyDate: day(1), SellDate: day(3),
+					Quantity: 5, CostBasis: 1500, Proceeds: 1000, Gain: -500, HoldingPeriodDays: 2,
+				},
+			},
+		},
+		{
+			name:            "average cost sell should book every lot at the average price",
+			costBasisMethod: models.CostBasisAverage,
+			trades: []models.Trade{
+				{ID: "b1", Type: "buy", AssetType: "stock", Ticker: "AAPL", TradeDate: day(1), Quantity: 10, Price: 100, Currency: "USD"},
+				{ID: "b2", Type: "buy", AssetType: "stock", Ticker: "AAPL", TradeDate: day(2), Quantity: 10, Price: 200, Currency: "USD"},
+				{ID: "s1", Type: "sell", AssetType: "stock", Ticker: "AAPL", TradeDate: day(3), Quantity: 10, Price: 300, Currency: "USD"},
+			},
+			expectedGains: []models.RealizedGain{
+				{
+					Ticker: "AAPL", AssetType: "stock", Currency: "USD",
+					BuyTradeID: "b1", SellTradeID: "s1", BuyDate: day(1), SellDate: day(3),
+					Quantity: 5, CostBasis: 750, Proceeds: 1500, Gain: 750, HoldingPeriodDays: 2,
+				},
+				{
+					Ticker: "AAPL", AssetType: "stock", Currency: "USD",
+					BuyTradeID: "b2", SellTradeID: "s1", BuyDate: day(2), SellDate: day(3),
+					Quantity: 5, CostBasis: 750, Proceeds: 1500, Gain: 750, HoldingPeriodDays: 1,
+				},
+			},
+		},
+		{
+			name: "fees and taxes should raise cost basis and lower proceeds",
+			trades: []models.Trade{
+				{ID: "b1", Type: "buy", AssetType: "stock", Ticker: "AAPL", TradeDate: day(1), Quantity: 10, Price: 100, Currency: "USD", Fee: 10},
+				{ID: "s1", Type: "sell", AssetType: "stock", Ticker: "AAPL", TradeDate: day(3), Quantity: 10, Price: 120, Currency: "USD", Fee: 12, Tax: 3},
+			},
+			expectedGains: []models.RealizedGain{
+				{
+					Ticker: "AAPL", AssetType: "stock", Currency: "USD",
+					BuyTradeID: "b1", SellTradeID: "s1", BuyDate: day(1), SellDate: day(3),
+					Quantity: 10, CostBasis: 1010, Proceeds: 1185, Gain: 175, HoldingPeriodDays: 2,
+				},
+			},
+		},
+		{
+			name: "covering a short should realize the short sale against the buy",
+			trades: []models.Trade{
+				{ID: "s1", Type: "sell", AssetType: "stock", Ticker: "AAPL", TradeDate: day(1), Quantity: 10, Price: 150, Currency: "USD"},
+				{ID: "b1", Type: "buy", AssetType: "stock", Ticker: "AAPL", TradeDate: day(6), Quantity: 4, Price: 100, Currency: "USD"},
+			},
+			expectedGains: []models.RealizedGain{
+				{
+					Ticker: "AAPL", AssetType: "stock", Currency: "USD",
+					BuyTradeID: "b1", SellTradeID: "s1", BuyDate: day(6), SellDate: day(1),
+					Quantity: 4, CostBasis: 400, Proceeds: 600, Gain: 200, HoldingPeriodDays: 5, Short: true,
+				},
+			},
+		},
+		{
+			name: "sell should realize against the lots of its own account",
+			trades: []models.Trade{
+				{ID: "b1", Type: "buy", AssetType: "stock", Ticker: "AAPL", TradeDate: day(1), Quantity: 10, Price: 100, Currency: "USD", AccountID: "acc-1"},
+				{ID: "b2", Type: "buy", AssetType: "stock", Ticker: "AAPL", TradeDate: day(2), Quantity: 5, Price: 120, Currency: "USD", AccountID: "acc-2"},
+				{ID: "s1", Type: "sell", AssetType: "stock", Ticker: "AAPL", TradeDate: day(3), Quantity: 2, Price: 130, Currency: "USD", AccountID: "acc-2"},
+			},
+			expectedGains: []models.RealizedGain{
+				{
+					AccountID: "acc-2", Ticker: "AAPL", AssetType: "stock", Currency: "USD",
+					BuyTradeID: "b2", SellTradeID: "s1", BuyDate: day(2), SellDate: day(3),
+					Quantity: 2, CostBasis: 240, Proceeds: 260, Gain: 20, HoldingPeriodDays: 1,
+				},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			service, mockTradeService := newMockedHoldingService(tt.trades, tt.costBasisMethod, nil)
+
+			gains, err := service.ListRealizedGains("test-user")
+
+			assert.NoError(t, err)
+			assert.Equal(t, tt.expectedGains, gains)
+			mockTradeService.AssertExpectations(t)
+		})
+	}
+}
+
+func TestListHoldingsConvertsForeignFees(t *testing.T) {
+	tradeDate := time.Date(2024, 1, 2, 0, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name                string
+		trades              []models.Trade
+		expectedPrices      map[string]float64
+		expectedUnconverted map[string]bool
+	}{
+		{
+			name: "fee in another currency should be converted into the trade currency",
+			trades: []models.Trade{
+				{ID: "b1", Type: "buy", AssetType: "stock", Ticker: "AAPL", TradeDate: tradeDate, Quantity: 10, Price: 100, Currency: "USD", Fee: 320, FeeCurrency: stringPtr("TWD")},
+			},
+			expectedPrices:      map[string]float64{"AAPL": 101},
+			expectedUnconverted: map[string]bool{"AAPL": false},
+		},
+		{
+			name: "fee without a rate should be kept unconverted and flagged without failing other holdings",
+			trades: []models.Trade{
+				{ID: "b1", Type: "buy", AssetType: "stock", Ticker: "AAPL", TradeDate: tradeDate, Quantity: 10, Price: 100, Currency: "USD", Fee: 320, FeeCurrency: stringPtr("TWD")},
+				{ID: "b2", Type: "buy", AssetType: "stock", Ticker: "SAP", TradeDate: tradeDate, Quantity: 10, Price: 100, Currency: "EUR", Fee: 10, FeeCurrency: stringPtr("CHF")},
+			},
+			expectedPrices:      map[string]float64{"AAPL": 101, "SAP": 101},
+			expectedUnconverted: map[string]bool{"AAPL": false, "SAP": true},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockTradeService := new(MockTradeService)
+			mockTradeService.On("ListTrades", "test-user").Return(tt.trades, nil)
+			mockProfileService := new(MockProfileService)
+			mockProfileService.On("GetProfile", "test-user").Return(&models.Profile{}, nil)
+			mockAccountService := new(MockAccountService)
+			mockAccountService.On("ListAccounts", "test-user").Return([]models.Account{}, nil)
+			mockFxService := new(MockFxService)
+			mockFxService.On("Converter").Return(NewFxConverter([]models.FxRate{{BaseCurrency: "USD", QuoteCurrency: "TWD", Rate: 32}}, "USD"), nil)
+
+			service := NewHoldingService(mockTradeService, mockProfileService, mockAccountService, stubPriceProvider{}, mockFxService, noIncome(), withCorporateActions())
+
+			holdings, err := service.ListHoldings("test-user")
+
+			assert.NoError(t, err)
+			assert.Len(t, holdings, len(tt.expectedPrices))
+			for _, holding := range holdings {
+				assert.InDelta(t, tt.expectedPrices[holding.Ticker], holding.AveragePrice, 1e-9)
+				assert.Equal(t, tt.expectedUnconverted[holding.Ticker], holding.UnconvertedCharges)
+			}
+			mockFxService.AssertExpectations(t)
+		})
+	}
+}
+
+func TestListHoldingsMarketValue(t *testing.T) {
+	trades := []models.Trade{
+		{Type: "buy", AssetType: "stock", Ticker: "AAPL", Quantity: 10, Price: 100, Currency: "USD"},
+		{Type: "sell", AssetType: "stock", Ticker: "TSLA", Quantity: 2, Price: 200, Currency: "USD"},
+		{Type: "buy", AssetType: "crypto", Ticker: "BTC", Quantity: 1, Price: 50000, Currency: "USD"},
+	}
+	prices := []models.Price{
+		{Ticker: "AAPL", Currency: "USD", Price: 120},
+		{Ticker: "TSLA", Currency: "USD", Price: 150},
+		{Ticker: "BTC", Currency: "EUR", Price: 40000},
+	}
+	float := func(v float64) *float64 {
+		return &v
+	}
+
+	mockTradeService := new(MockTradeService)
+	mockTradeService.On("ListTrades", "test-user").Return(trades, nil)
+	mockProfileService := new(MockProfileService)
+	mockProfileService.On("GetProfile", "test-user").Return(&models.Profile{}, nil)
+	mockAccountService := new(MockAccountService)
+	mockAccountService.On("ListAccounts", "test-user").Return([]models.Account{}, nil)
+
+	service := NewHoldingService(mockTradeService, mockProfileService, mockAccountService, stubPriceProvider{prices: prices}, new(MockFxService), noIncome(), withCorporateActions())
+
+	holdings, err := service.ListHoldings("test-user")
+
+	assert.NoError(t, err)
+	assert.Equal(t, []models.Holding{
+		{
+			Ticker: "AAPL", Quantity: 10, AveragePrice: 100, AssetType: "stock", Currency: "USD",
+			MarketPrice: float(120), MarketValue: float(1200), UnrealizedPnl: float(200), UnrealizedPnlPercent: float(20),
+		},
+		{
+			Ticker: "TSLA", Quantity: -2, AveragePrice: 200, AssetType: "stock", Currency: "USD",
+			MarketPrice: float(150), MarketValue: float(-300), UnrealizedPnl: float(100), UnrealizedPnlPercent: float(25),
+		},
+		// A quote in another currency is not applied
+		{Ticker: "BTC", Quantity: 1, AveragePrice: 50000, AssetType: "crypto", Currency: "USD"},
+	}, holdings)
+}
+
+func TestListHoldingsByAccount(t *testing.T) {
+	day := func(d int) time.Time {
+		return time.Date(2024, 1, d, 0, 0, 0, 0, time.UTC)
+	}
+	trades := []models.Trade{
+		{ID: "b1", Type: "buy", AssetType: "stock", Ticker: "AAPL", TradeDate: day(1), Quantity: 10, Price: 100, Currency: "USD", AccountID: "acc-1"},
+		{ID: "b2", Type: "buy", AssetType: "stock", Ticker: "AAPL", TradeDate: day(2), Quantity: 5, Price: 120, Currency: "USD", AccountID: "acc-2"},
+		// FIFO across accounts would take this from the older lot at broker A
+		{ID: "s1", Type: "sell", AssetType: "stock", Ticker: "AAPL", TradeDate: day(3), Quantity: 2, Price: 130, Currency: "USD", AccountID: "acc-2"},
+	}
+	accounts := []models.Account{
+		{ID: "acc-1", Name: "Broker A"},
+		{ID: "acc-2", Name: "Broker B"},
+		{ID: "acc-3", Name: "Broker C"},
+	}
+
+	mockTradeService := new(MockTradeService)
+	mockTradeService.On("ListTrades", "test-user").Return(trades, nil)
+	mockProfileService := new(MockProfileService)
+	mockProfileService.On("GetProfile", "test-user").Return(&models.Profile{}, nil)
+	mockAccountService := new(MockAccountService)
+	mockAccountService.On("ListAccounts", "test-user").Return(accounts, nil)
+
+	service := NewHoldingService(mockTradeService, mockProfileService, mockAccountService, stubPriceProvider{}, new(MockFxService), noIncome(), withCorporateActions())
+
+	grouped, err := service.ListHoldingsByAccount("test-user", models.HoldingsQuery{})
+	assert.NoError(t, err)
+	assert.Equal(t, []models.AccountHoldings{
+		{
+			AccountID: "acc-1", AccountName: "Broker A",
+			Holdings: []models.Holding{{
+				Ticker: "AAPL", Quantity: 10, AveragePrice: 100, AssetType: "stock", Currency: "USD",
+				Lots: []models.HoldingLot{{TradeID: "b1", TradeDate: day(1), Quantity: 10, Price: 100}},
+			}},
+		},
+		{
+			AccountID: "acc-2", AccountName: "Broker B",
+			Holdings: []models.Holding{{
+				Ticker: "AAPL", Quantity: 3, AveragePrice: 120, AssetType: "stock", Currency: "USD",
+				Lots: []models.HoldingLot{{TradeID: "b2", TradeDate: day(2), Quantity: 3, Price: 120}},
+			}},
+		},
+	}, grouped)
+
+	empty, err := service.GetAccountHoldings("test-user", "acc-3", models.HoldingsQuery{})
+	assert.NoError(t, err)
+	assert.Equal(t, &models.AccountHoldings{AccountID: "acc-3", AccountName: "Broker C", Holdings: []models.Holding{}}, empty)
+
+	_, err = service.GetAccountHoldings("test-user", "someone-elses", models.HoldingsQuery{})
+	assert.True(t, errors.Is(err, ErrAccountNotFound), "expected %v, got %v", ErrAccountNotFound, err)
+}
+
+func TestListHoldingsAsOf(t *testing.T) {
+	day := func(d int) time.Time {
+		return time.Date(2024, 1, d, 0, 0, 0, 0, time.UTC)
+	}
+	trades := []models.Trade{
+		{ID: "b1", Type: "buy", AssetType: "stock", Ticker: "AAPL", TradeDate: day(1), Quantity: 10, Price: 100, Currency: "USD"},
+		{ID: "b2", Type: "buy", AssetType: "stock", Ticker: "MSFT", TradeDate: day(2), Quantity: 4, Price: 300, Currency: "USD"},
+		{ID: "s1", Type: "sell", AssetType: "stock", Ticker: "AAPL", TradeDate: day(5), Quantity: 10, Price: 110, Currency: "USD"},
+	}
+	prices := stubPriceProvider{
+		prices: []models.Price{{Ticker: "MSFT", Currency: "USD", Price: 400}},
+		closes: map[string][]models.Price{"2024-01-03": {
+			{Ticker: "AAPL", Currency: "USD", Price: 105},
+			{Ticker: "MSFT", Currency: "USD", Price: 310},
+		}},
+	}
+
+	mockTradeService := new(MockTradeService)
+	mockTradeService.On("ListTrades", "test-user").Return(trades, nil)
+	mockProfileService := new(MockProfileService)
+	mockProfileService.On("GetProfile", "test-user").Return(&models.Profile{}, nil)
+	mockAccountService := new(MockAccountService)
+	mockAccountService.On("ListAccounts", "test-user").Return([]models.Account{}, nil)
+
+	service := NewHoldingService(mockTradeService, mockProfileService, mockAccountService, prices, new(MockFxService), noIncome(), withCorporateActions())
+
+	// A time later in the day still includes that day's trades
+	asOf := day(3).Add(15 * time.Hour)
+	unvalued, err := service.ListHoldingsAsOf("test-user", models.HoldingsQuery{AsOf: &asOf})
+	assert.NoError(t, err)
+	assert.Len(t, unvalued, 2)
+	assert.Nil(t, unvalued[0].MarketValue)
+
+	valued, err := service.ListHoldingsAsOf("test-user", models.HoldingsQuery{AsOf: &asOf, PriceAtClose: true})
+	assert.NoError(t, err)
+	assert.Len(t, valued, 2)
+	assert.Equal(t, "AAPL", valued[0].Ticker)
+	assert.Equal(t, 10.0, valued[0].Quantity)
+	assert.InDelta(t, 1050, *valued[0].MarketValue, 1e-9)
+	assert.InDelta(t, 50, *valued[0].UnrealizedPnl, 1e-9)
+	assert.InDelta(t, 1240, *valued[1].MarketValue, 1e-9)
+
+	current, err := service.ListHoldings("test-user")
+	assert.NoError(t, err)
+	assert.Len(t, current, 1)
+	assert.InDelta(t, 1600, *current[0].MarketValue, 1e-9)
+
+	future := time.Now().AddDate(0, 0, 2)
+	_, err = service.ListHoldingsAsOf("test-user", models.HoldingsQuery{AsOf: &future})
+	assert.True(t, errors.Is(err, ErrInvalidHoldingsQuery), "expected %v, got %v", ErrInvalidHoldingsQuery, err)
+}
+
+func TestDiffHoldings(t *testing.T) {
+	day := func(d int) time.Time {
+		return time.Date(2024, 1, d, 0, 0, 0, 0, time.UTC)
+	}
+	trades := []models.Trade{
+		{ID: "b1", Type: "buy", AssetType: "stock", Ticker: "AAPL", TradeDate: day(1), Quantity: 10, Price: 100, Currency: "USD"},
+		{ID: "b2", Type: "buy", AssetType: "stock", Ticker: "MSFT", TradeDate: day(1), Quantity: 4, Price: 300, Currency: "USD"},
+		{ID: "b3", Type: "buy", AssetType: "stock", Ticker: "KO", TradeDate: day(1), Quantity: 20, Price: 60, Currency: "USD"},
+		{ID: "b4", Type: "buy", AssetType: "stock", Ticker: "MSFT", TradeDate: day(8), Quantity: 4, Price: 340, Currency: "USD"},
+		{ID: "s1", Type: "sell", AssetType: "stock", Ticker: "AAPL", TradeDate: day(9), Quantity: 10, Price: 110, Currency: "USD"},
+		{ID: "b5", Type: "buy", AssetType: "stock", Ticker: "NVDA", TradeDate: day(10), Quantity: 2, Price: 500, Currency: "USD"},
+		// After the end of the diff
+		{ID: "b6", Type: "buy", AssetType: "stock", Ticker: "TSLA", TradeDate: day(20), Quantity: 1, Price: 200, Currency: "USD"},
+	}
+	service, _ := newMockedHoldingService(trades, "", []models.Account{})
+
+	diff, err := service.DiffHoldings("test-user", day(5), day(10))
+	assert.NoError(t, err)
+	assert.Equal(t, day(5), diff.From)
+	assert.Equal(t, day(10), diff.To)
+	assert.Equal(t, []models.HoldingChange{
+		{Ticker: "NVDA", AssetType: "stock", Currency: "USD", ToQuantity: 2, QuantityChange: 2, ToAveragePrice: 500},
+	}, diff.Opened)
+	assert.Equal(t, []models.HoldingChange{
+		{Ticker: "AAPL", AssetType: "stock", Currency: "USD", FromQuantity: 10, QuantityChange: -10, FromAveragePrice: 100},
+	}, diff.Closed)
+	assert.Equal(t, []models.HoldingChange{
+		{Ticker: "MSFT", AssetType: "stock", Currency: "USD", FromQuantity: 4, ToQuantity: 8, QuantityChange: 4, FromAveragePrice: 300, ToAveragePrice: 320},
+	}, diff.Changed)
+
+	_, err = service.DiffHoldings("test-user", day(10), day(5))
+	assert.True(t, errors.Is(err, ErrInvalidHoldingsQuery), "expected %v, got %v", ErrInvalidHoldingsQuery, err)
+}
+
+func TestListHoldingsAppliesContractMultipliers(t *testing.T) {
+	day := func(d int) time.Time {
+		return time.Date(2024, 1, d, 0, 0, 0, 0, time.UTC)
+	}
+	trades := []models.Trade{
+		{ID: "b1", Type: "buy", AssetType: "option", Ticker: "AAPL240621C00200000", TradeDate: day(1), Quantity: 2, Price: 3.5, Currency: "USD", Multiplier: 100},
+		{ID: "s1", Type: "sell", AssetType: "option", Ticker: "AAPL240621C00200000", TradeDate: day(5), Quantity: 1, Price: 5, Currency: "USD", Multiplier: 100},
+		// Bonds are quoted in percent of a 1,000 face value
+		{ID: "b2", Type: "buy", AssetType: "bond", Ticker: "US912828Z781", TradeDate: day(2), Quantity: 10, Price: 98, Currency: "USD", Multiplier: 10},
+	}
+	prices := []models.Price{
+		{Ticker: "AAPL240621C00200000", Currency: "USD", Price: 4},
+		{Ticker: "US912828Z781", Currency: "USD", Price: 101},
+	}
+
+	mockTradeService := new(MockTradeService)
+	mockTradeService.On("ListTrades", "test-user").Return(trades, nil)
+	mockProfileService := new(MockProfileService)
+	mockProfileService.On("GetProfile", "test-user").Return(&models.Profile{}, nil)
+	mockAccountService := new(MockAccountService)
+	mockAccountService.On("ListAccounts", "test-user").Return([]models.Account{}, nil)
+
+	service := NewHoldingService(mockTradeService, mockProfileService, mockAccountService, stubPriceProvider{prices: prices}, new(MockFxService), noIncome(), withCorporateActions())
+
+	holdings, err := service.ListHoldings("test-user")
+	assert.NoError(t, err)
+	assert.Len(t, holdings, 2)
+	assert.Equal(t, 100.0, holdings[0].Multiplier)
+	assert.Equal(t, 1.0, holdings[0].Quantity)
+	assert.Equal(t, 3.5, holdings[0].AveragePrice)
+	assert.InDelta(t, 400, *holdings[0].MarketValue, 1e-9)
+	assert.InDelta(t, 50, *holdings[0].UnrealizedPnl, 1e-9)
+	assert.Equal(t, 10.0, holdings[1].Multiplier)
+	assert.InDelta(t, 10100, *holdings[1].MarketValue, 1e-9)
+	assert.InDelta(t, 300, *holdings[1].UnrealizedPnl, 1e-9)
+
+	gains, err := service.ListRealizedGains("test-user")
+	assert.NoError(t, err)
+	assert.Len(t, gains, 1)
+	assert.InDelta(t, 350, gains[0].CostBasis, 1e-9)
+	assert.InDelta(t, 500, gains[0].Proceeds, 1e-9)
+	assert.InDelta(t, 150, gains[0].Gain, 1e-9)
+}
+
+func TestListHoldingsYieldOnCost(t *testing.T) {
+	now := time.Now()
+	buy := models.Trade{ID: "b1", Type: "buy", AssetType: "stock", Ticker: "KO", TradeDate: now.AddDate(-2, 0, 0), Quantity: 100, Price: 50, Currency: "USD", AccountID: "acc-1"}
+	dividends := []models.IncomeEvent{
+		{Ticker: "KO", Type: models.IncomeCashDividend, PayDate: now.AddDate(0, -13, 0), GrossAmount: 40, Currency: "USD", AccountID: "acc-1"},
+		{Ticker: "KO", Type: models.IncomeCashDividend, PayDate: now.AddDate(0, -9, 0), GrossAmount: 45, WithholdingTax: 13.5, Currency: "USD", AccountID: "acc-1"},
+		{Ticker: "KO", Type: models.IncomeCashDividend, PayDate: now.AddDate(0, -3, 0), GrossAmount: 45, Currency: "USD", AccountID: "acc-1"},
+	}
+	tests := []struct {
+		name                   string
+		trades                 []models.Trade
+		events                 []models.IncomeEvent
+		expectedQuantity       float64
+		expectedAveragePrice   float64
+		expectedTrailingIncome *float64
+		expectedYieldOnCost    *float64
+		expectedUnconverted    bool
+	}{
+		{
+			name:                   "cash income of the past year should yield on the cost basis",
+			trades:                 []models.Trade{buy},
+			events:                 dividends,
+			expectedQuantity:       100,
+			expectedAveragePrice:   50,
+			expectedTrailingIncome: floatPtr(90),
+			expectedYieldOnCost:    floatPtr(1.8),
+		},
+		{
+			name:   "stock dividend should add a lot at its value on the pay date",
+			trades: []models.Trade{buy},
+			events: append([]models.IncomeEvent{
+				{ID: "e1", Ticker: "KO", Type: models.IncomeStockDividend, PayDate: now.AddDate(0, -1, 0), GrossAmount: 600, Quantity: floatPtr(10), Currency: "USD", AccountID: "acc-1"},
+			}, dividends...),
+			expectedQuantity:       110,
+			expectedAveragePrice:   5600.0 / 110,
+			expectedTrailingIncome: floatPtr(90),
+			expectedYieldOnCost:    floatPtr(90.0 / 5600 * 100),
+		},
+		{
+			name:   "stock dividend without a value should add a lot at no cost",
+			trades: []models.Trade{buy},
+			events: []models.IncomeEvent{
+				{ID: "e1", Ticker: "KO", Type: models.IncomeStockDividend, PayDate: now.AddDate(0, -1, 0), Quantity: floatPtr(10), Currency: "USD", AccountID: "acc-1"},
+			},
+			expectedQuantity:     110,
+			expectedAveragePrice: 5000.0 / 110,
+		},
+		{
+			name:   "staking reward should add a lot to the position it was earned on",
+			trades: []models.Trade{{ID: "b1", Type: "buy", AssetType: "crypto", Ticker: "ETH", TradeDate: now.AddDate(-1, 0, 0), Quantity: 1, Price: 2000, Currency: "USD", AccountID: "acc-1"}},
+			events: []models.IncomeEvent{
+				{ID: "e1", Ticker: "ETH", Type: models.IncomeStakingReward, PayDate: now.AddDate(0, -1, 0), GrossAmount: 1000, Quantity: floatPtr(0.5), Currency: "USD", AccountID: "acc-1"},
+			},
+			expectedQuantity:     1.5,
+			expectedAveragePrice: 2000,
+		},
+		{
+			name:   "stock dividend in another currency should add a lot at its converted value",
+			trades: []models.Trade{buy},
+			events: []models.IncomeEvent{
+				{ID: "e1", Ticker: "KO", Type: models.IncomeStockDividend, PayDate: now.AddDate(0, -1, 0), GrossAmount: 19200, Quantity: floatPtr(10), Currency: "TWD", AccountID: "acc-1"},
+			},
+			expectedQuantity:     110,
+			expectedAveragePrice: 5600.0 / 110,
+		},
+		{
+			name:   "stock dividend in a currency without a rate should keep its value as entered and be marked",
+			trades: []models.Trade{buy},
+			events: []models.IncomeEvent{
+				{ID: "e1", Ticker: "KO", Type: models.IncomeStockDividend, PayDate: now.AddDate(0, -1, 0), GrossAmount: 550, Quantity: floatPtr(10), Currency: "EUR", AccountID: "acc-1"},
+			},
+			expectedQuantity:     110,
+			expectedAveragePrice: 5550.0 / 110,
+			expectedUnconverted:  true,
+		},
+		{
+			name:   "income paid in another currency should be converted into the holding's currency",
+			trades: []models.Trade{buy},
+			events: []models.IncomeEvent{
+				{Ticker: "KO", Type: models.IncomeCashDividend, PayDate: now.AddDate(0, -3, 0), GrossAmount: 3200, Currency: "TWD", AccountID: "acc-1"},
+			},
+			expectedQuantity:       100,
+			expectedAveragePrice:   50,
+			expectedTrailingIncome: floatPtr(100),
+			expectedYieldOnCost:    floatPtr(2),
+		},
+		{
+			name:   "income paid in a currency without a rate should leave the yield out",
+			trades: []models.Trade{buy},
+			events: []models.IncomeEvent{
+				{Ticker: "KO", Type: models.IncomeCashDividend, PayDate: now.AddDate(0, -3, 0), GrossAmount: 30, Currency: "EUR", AccountID: "acc-1"},
+			},
+			expectedQuantity:     100,
+			expectedAveragePrice: 50,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockTradeService := new(MockTradeService)
+			mockTradeService.On("ListTrades", "test-user").Return(tt.trades, nil)
+			mockProfileService := new(MockProfileService)
+			mockProfileService.On("GetProfile", "test-user").Return(&models.Profile{}, nil)
+			mockAccountService := new(MockAccountService)
+			mockAccountService.On("ListAccounts", "test-user").Return([]models.Account{}, nil)
+			mockIncomeService := new(MockIncomeService)
+			mockIncomeService.On("ListEvents", "test-user", 0, "").Return(tt.events, nil)
+			mockFxService := new(MockFxService)
+			mockFxService.On("Converter").Return(NewFxConverter([]models.FxRate{{BaseCurrency: "USD", QuoteCurrency: "TWD", Rate: 32}}, "USD"), nil)
+
+			service := NewHoldingService(mockTradeService, mockProfileService, mockAccountService, stubPriceProvider{}, mockFxService, mockIncomeService, withCorporateActions())
+
+			holdings, err := service.ListHoldings("test-user")
+
+			assert.NoError(t, err)
+			assert.Len(t, holdings, 1)
+			assert.InDelta(t, tt.expectedQuantity, holdings[0].Quantity, 1e-9)
+			assert.InDelta(t, tt.expectedAveragePrice, holdings[0].AveragePrice, 1e-9)
+			assert.Equal(t, tt.expectedUnconverted, holdings[0].UnconvertedCharges)
+			if tt.expectedTrailingIncome == nil {
+				assert.Nil(t, holdings[0].TrailingIncome)
+				assert.Nil(t, holdings[0].YieldOnCostPercent)
+				return
+			}
+			assert.InDelta(t, *tt.expectedTrailingIncome, *holdings[0].TrailingIncome, 1e-9)
+			assert.InDelta(t, *tt.expectedYieldOnCost, *holdings[0].YieldOnCostPercent, 1e-9)
+		})
+	}
+}
+
+func TestListHoldingsAppliesSplits(t *testing.T) {
+	day := func(d int) time.Time {
+		return time.Date(2024, 1, d, 0, 0, 0, 0, time.UTC)
+	}
+	cashInLieu := 12.0
+	tests := []struct {
+		name             string
+		trades           []models.Trade
+		action           models.CorporateAction
+		expectedHoldings []models.Holding
+		expectedGains    []models.RealizedGain
+	}{
+		{
+			name: "forward split should scale lots opened before the effective date only",
+			trades: []models.Trade{
+				{ID: "b1", Type: "buy", AssetType: "stock", Ticker: "NVDA", TradeDate: day(1), Quantity: 10, Price: 400, Currency: "USD"},
+				{ID: "b2", Type: "buy", AssetType: "stock", Ticker: "NVDA", TradeDate: day(10), Quantity: 10, Price: 90, Currency: "USD"},
+				{ID: "s1", Type: "sell", AssetType: "stock", Ticker: "NVDA", TradeDate: day(11), Quantity: 40, Price: 110, Currency: "USD"},
+			},
+			action: models.CorporateAction{ID: "ca1", Ticker: "NVDA", Type: models.CorporateActionSplit, EffectiveDate: day(10), NewShares: 4, OldShares: 1},
+			expectedHoldings: []models.Holding{
+				{Ticker: "NVDA", Quantity: 10, AveragePrice: 90, AssetType: "stock", Currency: "USD"},
+			},
+			expectedGains: []models.RealizedGain{
+				{
+					Ticker: "NVDA", AssetType: "stock", Currency: "USD",
+					BuyTradeID: "b1", SellTradeID: "s1", BuyDate: day(1), SellDate: day(11),
+					Quantity: 40, CostBasis: 4000, Proceeds: 4400, Gain: 400, HoldingPeriodDays: 10,
+				},
+			},
+		},
+		{
+			name: "reverse split should pay fractional shares as cash in lieu",
+			trades: []models.Trade{
+				{ID: "b1", Type: "buy", AssetType: "stock", Ticker: "GE", TradeDate: day(1), Quantity: 25, Price: 1, Currency: "USD"},
+			},
+			action: models.CorporateAction{ID: "ca1", Ticker: "GE", Type: models.CorporateActionSplit, EffectiveDate: day(5), NewShares: 1, OldShares: 10, CashInLieuPrice: &cashInLieu},
+			expectedHoldings: []models.Holding{
+				{Ticker: "GE", Quantity: 2, AveragePrice: 10, AssetType: "stock", Currency: "USD"},
+			},
+			expectedGains: []models.RealizedGain{
+				{
+					Ticker: "GE", AssetType: "stock", Currency: "USD",
+					BuyTradeID: "b1", BuyDate: day(1), SellDate: day(5),
+					Quantity: 0.5, CostBasis: 5, Proceeds: 6, Gain: 1, HoldingPeriodDays: 4, CorporateActionID: "ca1",
+				},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockTradeService := new(MockTradeService)
+			mockTradeService.On("ListTrades", "test-user").Return(tt.trades, nil)
+			mockProfileService := new(MockProfileService)
+			mockProfileService.On("GetProfile", "test-user").Return(&models.Profile{}, nil)
+			mockAccountService := new(MockAccountService)
+			mockAccountService.On("ListAccounts", "test-user").Return([]models.Account{}, nil)
+
+			service := NewHoldingService(mockTradeService, mockProfileService, mockAccountService, stubPriceProvider{}, new(MockFxService), noIncome(), withCorporateActions(tt.action))
+
+			holdings, err := service.ListHoldings("test-user")
+			assert.NoError(t, err)
+			assert.Equal(t, tt.expectedHoldings, holdings)
+
+			gains, err := service.ListRealizedGains("test-user")
+			assert.NoError(t, err)
+			assert.Equal(t, tt.expectedGains, gains)
+		})
+	}
+}
+
+func TestListHoldingsFollowsTickerChanges(t *testing.T) {
+	day := func(d int) time.Time {
+		return time.Date(2024, 1, d, 0, 0, 0, 0, time.UTC)
+	}
+	cashPerShare, mergerBasis, spinOffBasis := 20.0, 75.0, 25.0
+	tests := []struct {
+		name             string
+		trades           []models.Trade
+		action           models.CorporateAction
+		expectedHoldings []models.Holding
+		expectedGains    []models.RealizedGain
+	}{
+		{
+			name: "symbol change should carry lots to the new ticker",
+			trades: []models.Trade{
+				{ID: "b1", Type: "buy", AssetType: "stock", Ticker: "FB", TradeDate: day(1), Quantity: 10, Price: 100, Currency: "USD"},
+				{ID: "s1", Type: "sell", AssetType: "stock", Ticker: "META", TradeDate: day(6), Quantity: 4, Price: 150, Currency: "USD"},
+			},
+			action: models.CorporateAction{ID: "ca1", Ticker: "FB", Type: models.CorporateActionSymbolChange, EffectiveDate: day(5), NewTicker: stringPtr("META"), NewShares: 1, OldShares: 1},
+			expectedHoldings: []models.Holding{
+				{
+					Ticker: "META", Quantity: 6, AveragePrice: 100, AssetType: "stock", Currency: "USD",
+					Lineage: []models.HoldingLineage{{CorporateActionID: "ca1", Type: models.CorporateActionSymbolChange, EffectiveDate: day(5), FromTicker: "FB", ToTicker: "META"}},
+				},
+			},
+			expectedGains: []models.RealizedGain{
+				{
+					Ticker: "META", AssetType: "stock", Currency: "USD",
+					BuyTradeID: "b1", SellTradeID: "s1", BuyDate: day(1), SellDate: day(6),
+					Quantity: 4, CostBasis: 400, Proceeds: 600, Gain: 200, HoldingPeriodDays: 5,
+				},
+			},
+		},
+		{
+			name: "cash and stock merger should realize the cash against the basis left behind",
+			trades: []models.Trade{
+				{ID: "b1", Type: "buy", AssetType: "stock", Ticker: "XYZ", TradeDate: day(1), Quantity: 10, Price: 50, Currency: "USD"},
+			},
+			action: models.CorporateAction{ID: "ca1", Ticker: "XYZ", Type: models.CorporateActionMerger, EffectiveDate: day(5), NewTicker: stringPtr("ABC"), NewShares: 1, OldShares: 2, CashPerShare: &cashPerShare, CostBasisPercent: &mergerBasis},
+			expectedHoldings: []models.Holding{
+				{
+					Ticker: "ABC", Quantity: 5, AveragePrice: 75, AssetType: "stock", Currency: "USD",
+					Lineage: []models.HoldingLineage{{CorporateActionID: "ca1", Type: models.CorporateActionMerger, EffectiveDate: day(5), FromTicker: "XYZ", ToTicker: "ABC"}},
+				},
+			},
+			expectedGains: []models.RealizedGain{
+				{
+					Ticker: "XYZ", AssetType: "stock", Currency: "USD",
+					BuyTradeID: "b1", BuyDate: day(1), SellDate: day(5),
+					Quantity: 10, CostBasis: 125, Proceeds: 200, Gain: 75, HoldingPeriodDays: 4, CorporateActionID: "ca1",
+				},
+			},
+		},
+		{
+			name: "spin-off should move part of the cost basis to the new ticker",
+			trades: []models.Trade{
+				{ID: "b1", Type: "buy", AssetType: "stock", Ticker: "PARENT", TradeDate: day(1), Quantity: 10, Price: 40, Currency: "USD"},
+			},
+			action: models.CorporateAction{ID: "ca1", Ticker: "PARENT", Type: models.CorporateActionSpinOff, EffectiveDate: day(5), NewTicker: stringPtr("SPIN"), NewShares: 1, OldShares: 2, CostBasisPercent: &spinOffBasis},
+			expectedHoldings: []models.Holding{
+				{Ticker: "PARENT", Quantity: 10, AveragePrice: 30, AssetType: "stock", Currency: "USD"},
+				{
+					Ticker: "SPIN", Quantity: 5, AveragePrice: 20, AssetType: "stock", Currency: "USD",
+					Lineage: []models.HoldingLineage{{CorporateActionID: "ca1", Type: models.CorporateActionSpinOff, EffectiveDate: day(5), FromTicker: "PARENT", ToTicker: "SPIN"}},
+				},
+			},
+			expectedGains: []models.RealizedGain{},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockTradeService := new(MockTradeService)
+			mockTradeService.On("ListTrades", "test-user").Return(tt.trades, nil)
+			mockProfileService := new(MockProfileService)
+			mockProfileService.On("GetProfile", "test-user").Return(&models.Profile{}, nil)
+			mockAccountService := new(MockAccountService)
+			mockAccountService.On("ListAccounts", "test-user").Return([]models.Account{}, nil)
+
+			service := NewHoldingService(mockTradeService, mockProfileService, mockAccountService, stubPriceProvider{}, new(MockFxService), noIncome(), withCorporateActions(tt.action))
+
+			holdings, err := service.ListHoldings("test-user")
+			assert.NoError(t, err)
+			assert.Equal(t, tt.expectedHoldings, holdings)
+
+			gains, err := service.ListRealizedGains("test-user")
+			assert.NoError(t, err)
+			assert.Equal(t, tt.expectedGains, gains)
+		})
+	}
+}
@@ -0,0 +1,396 @@
+package services
+
+import (
+	"asset-dairy/models"
+	"asset-dairy/repositories"
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+var (
+	ErrIncomeEventNotFound = errors.New("income event not found")
+	ErrInvalidIncomeEvent  = errors.New("invalid income event")
+)
+
+type IncomeServiceInterface interface {
+	ListEvents(userID string, year int, ticker string) ([]models.IncomeEvent, error)
+	CreateEvent(userID string, req models.IncomeEventCreateRequest) (*models.IncomeEvent, error)
+	ValidateEvent(userID string, event models.IncomeEvent) (*models.IncomeEvent, error)
+	RecordEvent(userID string, event models.IncomeEvent) (*models.IncomeEvent, error)
+	UpdateEvent(userID, eventID string, req models.IncomeEventUpdateRequest) (*models.IncomeEvent, error)
+	DeleteEvent(userID, eventID string) (bool, error)
+	GetSummary(userID, currency, groupBy string, year int) (*models.IncomeSummary, error)
+}
+
+type IncomeService struct {
+	repo           repositories.IncomeEventRepositoryInterface
+	profileService ProfileServiceInterface
+	fxService      FxServiceInterface
+	tradeService   TradeServiceInterface
+}
+
+// NewIncomeService creates an IncomeService. The fx service converts income paid in a
+// currency other than the account's, and summaries into the reporting currency. The trade
+// service checks that changing or deleting received units leaves no sell short.
+func NewIncomeService(repo repositories.IncomeEventRepositoryInterface, profileService ProfileServiceInterface, fxService FxServiceInterface, tradeService TradeServiceInterface) *IncomeService {
+	return &IncomeService{
+		repo:           repo,
+		profileService: profileService,
+		fxService:      fxService,
+		tradeService:   tradeService,
+	}
+}
+
+// ListEvents returns the user's income events, oldest first, optionally narrowed to the
+// pay-date year and ticker
+func (s *IncomeService) ListEvents(userID string, year int, ticker string) ([]models.IncomeEvent, error) {
+	events, err := s.repo.ListEvents(userID)
+	if err != nil {
+		return nil, err
+	}
+	filtered := []models.IncomeEvent{}
+	for _, event := range events {
+		if year != 0 && event.PayDate.Year() != year {
+			continue
+		}
+		if ticker != "" && !strings.EqualFold(event.Ticker, ticker) {
+			continue
+		}
+		filtered = append(filtered, event)
+	}
+	return filtered, nil
+}
+
+func (s *IncomeService) CreateEvent(userID string, req models.IncomeEventCreateRequest) (*models.IncomeEvent, error) {
+	payDate, err := time.Parse("2006-01-02", req.PayDate)
+	if err != nil {
+		return nil, fmt.Errorf("%w: payDate must be YYYY-MM-DD", ErrInvalidIncomeEvent)
+	}
+	return s.RecordEvent(userID, models.IncomeEvent{
+		AccountID:      req.AccountID,
+		Ticker:         req.Ticker,
+		Type:           req.Type,
+		PayDate:        payDate,
+		Quantity:       req.Quantity,
+		GrossAmount:    req.GrossAmount,
+		WithholdingTax: req.WithholdingTax,
+		Currency:       req.Currency,
+		Memo:           req.Memo,
+	})
+}
+
+// ValidateEvent checks a new event built by the caller, such as one read from a statement, and
+// returns it as it would be stored, with the settlement of a cash payout
+func (s *IncomeService) ValidateEvent(userID string, event models.IncomeEvent) (*models.IncomeEvent, error) {
+	event.ID = uuid.New().String()
+	event.UserID = userID
+	event.Currency = strings.ToUpper(event.Currency)
+	if err := s.prepare(&event); err != nil {
+		return nil, err
+	}
+	return &event, nil
+}
+
+// RecordEvent stores a new event built by the caller
+func (s *IncomeService) RecordEvent(userID string, event models.IncomeEvent) (*models.IncomeEvent, error) {
+	prepared, err := s.ValidateEvent(userID, event)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.repo.CreateEvent(*prepared); err != nil {
+		return nil, err
+	}
+	return prepared, nil
+}
+
+func (s *IncomeService) UpdateEvent(userID, eventID string, req models.IncomeEventUpdateRequest) (*models.IncomeEvent, error) {
+	existing, err := s.repo.GetEvent(userID, eventID)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, ErrIncomeEventNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	event := *existing
+	if req.AccountID != "" {
+		event.AccountID = req.AccountID
+	}
+	if req.Ticker != "" {
+		event.Ticker = req.Ticker
+	}
+	if req.Type != "" {
+		event.Type = req.Type
+	}
+	if req.PayDate != "" {
+		payDate, err := time.Parse("2006-01-02", req.PayDate)
+		if err != nil {
+			return nil, fmt.Errorf("%w: payDate must be YYYY-MM-DD", ErrInvalidIncomeEvent)
+		}
+		event.PayDate = payDate
+	}
+	if req.Quantity != nil {
+		event.Quantity = req.Quantity
+	}
+	if req.GrossAmount != nil {
+		event.GrossAmount = *req.GrossAmount
+	}
+	if req.WithholdingTax != nil {
+		event.WithholdingTax = *req.WithholdingTax
+	}
+	if req.Currency != "" {
+		event.Currency = strings.ToUpper(req.Currency)
+	}
+	if req.Memo != nil {
+		event.Memo = req.Memo
+	}
+
+	if err := s.prepare(&event); err != nil {
+		return nil, err
+	}
+	err = s.tradeService.WithUserLock(userID, func() error {
+		if err := s.tradeService.ValidateReceivedUnits(userID, existing, &event); err != nil {
+			return err
+		}
+		return s.repo.UpdateEvent(event)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &event, nil
+}
+
+// DeleteEvent removes the event and its settlement. Units it added must not be needed by a
+// later sell.
+func (s *IncomeService) DeleteEvent(userID, eventID string) (bool, error) {
+	deleted := false
+	err := s.tradeService.WithUserLock(userID, func() error {
+		existing, err := s.repo.GetEvent(userID, eventID)
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if err := s.tradeService.ValidateReceivedUnits(userID, existing, nil); err != nil {
+			return err
+		}
+		deleted, err = s.repo.DeleteEvent(userID, eventID)
+		return err
+	})
+	return deleted, err
+}
+
+// prepare validates the event and attaches the cash ledger entry that credits a cash payout,
+// net of withholding tax, to its account
+func (s *IncomeService) prepare(event *models.IncomeEvent) error {
+	if event.WithholdingTax > event.GrossAmount {
+		return fmt.Errorf("%w: withholdingTax cannot exceed grossAmount", ErrInvalidIncomeEvent)
+	}
+	if event.IsCash() {
+		event.Quantity = nil
+	} else if event.Quantity == nil {
+		return fmt.Errorf("%w: quantity is required for %s", ErrInvalidIncomeEvent, event.Type)
+	}
+
+	accountCurrency, err := s.repo.GetAccountCurrency(event.UserID, event.AccountID)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return ErrAccountNotFound
+	}
+	if err != nil {
+		return err
+	}
+	event.Settlement = nil
+	if !event.IsCash() {
+		return nil
+	}
+
+	amount := event.NetAmount()
+	entry := &models.CashLedgerEntry{
+		ID:            uuid.New().String(),
+		UserID:        event.UserID,
+		AccountID:     event.AccountID,
+		Type:          models.CashEntryIncome,
+		Amount:        amount,
+		Currency:      accountCurrency,
+		IncomeEventID: &event.ID,
+		EntryDate:     event.PayDate,
+		Memo:          event.Memo,
+	}
+	if !strings.EqualFold(event.Currency, accountCurrency) {
+		converter, err := s.fxService.Converter(event.PayDate)
+		if err != nil {
+			return err
+		}
+		rate, err := converter.Rate(event.Currency, accountCurrency)
+		if err != nil {
+			return err
+		}
+		originalCurrency := event.Currency
+		entry.Amount = amount * rate
+		entry.OriginalAmount = &amount
+		entry.OriginalCurrency = &originalCurrency
+		entry.FxRate = &rate
+	}
+	event.Settlement = entry
+	return nil
+}
+
+// GetSummary totals the user's income by ticker or by pay-date year in the reporting
+// currency, optionally for one year only
+func (s *IncomeService) GetSummary(userID, currency, groupBy string, year int) (*models.IncomeSummary, error) {
+	if groupBy == "" {
+		groupBy = models.IncomeGroupByTicker
+	}
+	if groupBy != models.IncomeGroupByTicker && groupBy != models.IncomeGroupByYear {
+		return nil, fmt.Errorf("%w: groupBy must be ticker or year", ErrInvalidIncomeEvent)
+	}
+	currency, err := reportingCurrency(s.profileService, s.fxService, userID, currency)
+	if err != nil {
+		return nil, err
+	}
+	events, err := s.ListEvents(userID, year, "")
+	if err != nil {
+		return nil, err
+	}
+
+	summary := &models.IncomeSummary{
+		Currency: currency,
+		GroupBy:  groupBy,
+		Groups:   []models.IncomeSummaryLine{},
+	}
+	missing := newCurrencySet()
+	converters := make(map[time.Time]*FxConverter)
+	lines := make(map[string]*models.IncomeSummaryLine)
+	for _, event := range events {
+		date := truncateToDate(event.PayDate)
+		converter, ok := converters[date]
+		if !ok {
+			if converter, err = s.fxService.Converter(date); err != nil {
+				return nil, err
+			}
+			converters[date] = converter
+		}
+		rate, ok, _ := conversionRate(converter, event.Currency, currency, missing)
+		if !ok {
+			continue
+		}
+
+		key := strings.ToUpper(event.Ticker)
+		if groupBy == models.IncomeGroupByYear {
+			key = strconv.Itoa(event.PayDate.Year())
+		}
+		line, ok := lines[key]
+		if !ok {
+			line = &models.IncomeSummaryLine{Key: key}
+			lines[key] = line
+		}
+		line.GrossAmount += event.GrossAmount * rate
+		line.WithholdingTax += event.WithholdingTax * rate
+		line.NetAmount += event.NetAmount() * rate
+		line.EventCount++
+	}
+
+	for _, line := range lines {
+		summary.Groups = append(summary.Groups, *line)
+		summary.GrossAmount += line.GrossAmount
+		summary.WithholdingTax += line.WithholdingTax
+		summary.NetAmount += line.NetAmount
+	}
+	sort.Slice(summary.Groups, func(i, j int) bool {
+		return summary.Groups[i].Key < summary.Groups[j].Key
+	})
+	summary.MissingCurrencies = missing.sorted()
+	return summary, nil
+}
+
+// receivedUnitTrades turns the stock dividends and staking rewards among the events into buys
+// of the units received, so they open lots like purchases. A lot costs the units' value on the
+// pay date and joins the position its account holds the ticker in, converted into that
+// position's currency when the event was recorded in another. Without a rate the value is
+// counted as entered and the lot is marked, as unconverted trade charges are.
+func receivedUnitTrades(fxService FxServiceInterface, trades []models.Trade, events []models.IncomeEvent) ([]models.Trade, error) {
+	currencies := make(map[string]string)
+	for _, trade := range trades {
+		key := trade.AccountID + "_" + normalizeTicker(trade.Ticker)
+		if _, ok := currencies[key]; !ok {
+			currencies[key] = strings.ToUpper(trade.Currency)
+		}
+	}
+
+	converters := make(map[time.Time]*FxConverter)
+	received := []models.Trade{}
+	for _, event := range events {
+		if event.IsCash() || event.Quantity == nil || *event.Quantity <= 0 {
+			continue
+		}
+		ticker := normalizeTicker(event.Ticker)
+		currency := strings.ToUpper(event.Currency)
+		price := event.GrossAmount / *event.Quantity
+		unconverted := false
+		if held, ok := currencies[event.AccountID+"_"+ticker]; ok && held != currency {
+			date := truncateToDate(event.PayDate)
+			converter, ok := converters[date]
+			if !ok {
+				var err error
+				if converter, err = fxService.Converter(date); err != nil {
+					return nil, err
+				}
+				converters[date] = converter
+			}
+			rate, err := converter.Rate(currency, held)
+			switch {
+			case errors.Is(err, ErrFxRateNotFound):
+				unconverted = true
+			case err != nil:
+				return nil, err
+			default:
+				price *= rate
+			}
+			currency = held
+		}
+		assetType := models.AssetClassStock
+		if event.Type == models.IncomeStakingReward {
+			assetType = models.AssetClassCrypto
+		}
+		received = append(received, models.Trade{
+			ID:                 event.ID,
+			Type:               "buy",
+			AssetType:          assetType,
+			Ticker:             ticker,
+			TradeDate:          event.PayDate,
+			Quantity:           *event.Quantity,
+			Price:              price,
+			Currency:           currency,
+			AccountID:          event.AccountID,
+			CreatedAt:          event.CreatedAt,
+			UnconvertedCharges: unconverted,
+		})
+	}
+	return received, nil
+}
+
+// trailingIncome sums the gross cash dividends and coupons paid in the year up to asOf, keyed by
+// upper-case ticker and then by the currency they were paid in
+func trailingIncome(events []models.IncomeEvent, asOf time.Time) map[string]map[string]float64 {
+	since := asOf.AddDate(-1, 0, 0)
+	income := make(map[string]map[string]float64)
+	for _, event := range events {
+		if !event.IsCash() || !event.PayDate.After(since) || event.PayDate.After(asOf) {
+			continue
+		}
+		ticker := strings.ToUpper(event.Ticker)
+		if income[ticker] == nil {
+			income[ticker] = make(map[string]float64)
+		}
+		income[ticker][strings.ToUpper(event.Currency)] += event.GrossAmount
+	}
+	return income
+}
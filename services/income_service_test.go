@@ -0,0 +1,194 @@
+package services
+
+import (
+	"asset-dairy/models"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+// MockIncomeEventRepository is a mock implementation of IncomeEventRepositoryInterface
+type MockIncomeEventRepository struct {
+	mock.Mock
+}
+
+func (m *MockIncomeEventRepository) ListEvents(userID string) ([]models.IncomeEvent, error) {
+	args := m.Called(userID)
+	return args.Get(0).([]models.IncomeEvent), args.Error(1)
+}
+
+func (m *MockIncomeEventRepository) CreateEvent(event models.IncomeEvent) error {
+	args := m.Called(event)
+	return args.Error(0)
+}
+
+func (m *MockIncomeEventRepository) GetAccountCurrency(userID, accountID string) (string, error) {
+	args := m.Called(userID, accountID)
+	return args.String(0), args.Error(1)
+}
+
+func (m *MockIncomeEventRepository) GetEvent(userID, eventID string) (*models.IncomeEvent, error) {
+	args := m.Called(userID, eventID)
+	return args.Get(0).(*models.IncomeEvent), args.Error(1)
+}
+
+func (m *MockIncomeEventRepository) UpdateEvent(event models.IncomeEvent) error {
+	args := m.Called(event)
+	return args.Error(0)
+}
+
+func (m *MockIncomeEventRepository) DeleteEvent(userID, eventID string) (bool, error) {
+	args := m.Called(userID, eventID)
+	return args.Bool(0), args.Error(1)
+}
+
+func TestCreateIncomeEventCreditsNetCash(t *testing.T) {
+	mockRepo := new(MockIncomeEventRepository)
+	mockFxService := new(MockFxService)
+	service := NewIncomeService(mockRepo, new(MockProfileService), mockFxService, new(MockTradeService))
+
+	mockRepo.On("GetAccountCurrency", "user1", "acc1").Return("TWD", nil)
+	mockRepo.On("CreateEvent", mock.Anything).Return(nil)
+	mockFxService.On("Converter").Return(NewFxConverter([]models.FxRate{{BaseCurrency: "USD", QuoteCurrency: "TWD", Rate: 32}}, "USD"), nil)
+
+	event, err := service.CreateEvent("user1", models.IncomeEventCreateRequest{
+		AccountID: "acc1", Ticker: "AAPL", Type: models.IncomeCashDividend, PayDate: "2024-02-15",
+		GrossAmount: 24, WithholdingTax: 7.2, Currency: "usd",
+	})
+
+	assert.NoError(t, err)
+	assert.Equal(t, "USD", event.Currency)
+	assert.Equal(t, models.CashEntryIncome, event.Settlement.Type)
+	assert.Equal(t, event.ID, *event.Settlement.IncomeEventID)
+	assert.InDelta(t, 537.6, event.Settlement.Amount, 1e-9)
+	assert.InDelta(t, 16.8, *event.Settlement.OriginalAmount, 1e-9)
+}
+
+func TestCreateIncomeEventRequiresQuantityForUnits(t *testing.T) {
+	mockRepo := new(MockIncomeEventRepository)
+	service := NewIncomeService(mockRepo, new(MockProfileService), new(MockFxService), new(MockTradeService))
+
+	_, err := service.CreateEvent("user1", models.IncomeEventCreateRequest{
+		AccountID: "acc1", Ticker: "ETH", Type: models.IncomeStakingReward, PayDate: "2024-02-15",
+		GrossAmount: 30, Currency: "USD",
+	})
+
+	assert.ErrorIs(t, err, ErrInvalidIncomeEvent)
+	mockRepo.AssertNotCalled(t, "CreateEvent", mock.Anything)
+}
+
+func TestGetIncomeSummaryByYear(t *testing.T) {
+	mockRepo := new(MockIncomeEventRepository)
+	mockFxService := new(MockFxService)
+	service := NewIncomeService(mockRepo, new(MockProfileService), mockFxService, new(MockTradeService))
+
+	mockRepo.On("ListEvents", "user1").Return([]models.IncomeEvent{
+		{Ticker: "AAPL", Type: models.IncomeCashDividend, PayDate: time.Date(2023, 5, 1, 0, 0, 0, 0, time.UTC), GrossAmount: 10, WithholdingTax: 3, Currency: "USD"},
+		{Ticker: "2330", Type: models.IncomeCashDividend, PayDate: time.Date(2024, 1, 10, 0, 0, 0, 0, time.UTC), GrossAmount: 320, Currency: "TWD"},
+		{Ticker: "AAPL", Type: models.IncomeCashDividend, PayDate: time.Date(2024, 5, 1, 0, 0, 0, 0, time.UTC), GrossAmount: 12, Currency: "USD"},
+		{Ticker: "VOD", Type: models.IncomeCashDividend, PayDate: time.Date(2024, 6, 1, 0, 0, 0, 0, time.UTC), GrossAmount: 5, Currency: "GBP"},
+	}, nil)
+	mockFxService.On("Converter").Return(NewFxConverter([]models.FxRate{{BaseCurrency: "USD", QuoteCurrency: "TWD", Rate: 32}}, "USD"), nil)
+
+	summary, err := service.GetSummary("user1", "USD", models.IncomeGroupByYear, 0)
+
+	assert.NoError(t, err)
+	assert.Equal(t, []models.IncomeSummaryLine{
+		{Key: "2023", GrossAmount: 10, WithholdingTax: 3, NetAmount: 7, EventCount: 1},
+		{Key: "2024", GrossAmount: 22, NetAmount: 22, EventCount: 2},
+	}, summary.Groups)
+	assert.InDelta(t, 29, summary.NetAmount, 1e-9)
+	assert.Equal(t, []string{"GBP"}, summary.MissingCurrencies)
+}
+
+func TestChangeReceivedUnits(t *testing.T) {
+	day := func(d int) time.Time {
+		return time.Date(2024, 1, d, 0, 0, 0, 0, time.UTC)
+	}
+	// Ten shares bought and two received, all twelve sold afterwards
+	trades := []models.Trade{
+		{ID: "b1", Type: "buy", AssetType: "stock", Ticker: "AAPL", TradeDate: day(1), Quantity: 10, Price: 100, Currency: "USD", AccountID: "acc-1"},
+		{ID: "s1", Type: "sell", AssetType: "stock", Ticker: "AAPL", TradeDate: day(5), Quantity: 12, Price: 120, Currency: "USD", AccountID: "acc-1"},
+	}
+	stockDividend := models.IncomeEvent{ID: "e1", UserID: "test-user", AccountID: "acc-1", Ticker: "AAPL", Type: models.IncomeStockDividend, PayDate: day(3), Quantity: floatPtr(2), GrossAmount: 220, Currency: "USD"}
+	cashDividend := models.IncomeEvent{ID: "e2", UserID: "test-user", AccountID: "acc-1", Ticker: "AAPL", Type: models.IncomeCashDividend, PayDate: day(3), GrossAmount: 5, Currency: "USD"}
+	tests := []struct {
+		name          string
+		event         models.IncomeEvent
+		update        *models.IncomeEventUpdateRequest
+		shortable     []string
+		expectedError error
+	}{
+		{
+			name:          "deleting units a later sell needs should be rejected",
+			event:         stockDividend,
+			expectedError: ErrPositionOversold,
+		},
+		{
+			name:      "deleting units in an account allowing short positions should be accepted",
+			event:     stockDividend,
+			shortable: []string{"acc-1"},
+		},
+		{
+			name:  "deleting a cash dividend should be accepted",
+			event: cashDividend,
+		},
+		{
+			name:          "reducing units a later sell needs should be rejected",
+			event:         stockDividend,
+			update:        &models.IncomeEventUpdateRequest{Quantity: floatPtr(1)},
+			expectedError: ErrPositionOversold,
+		},
+		{
+			name:          "moving units past a sell that needs them should be rejected",
+			event:         stockDividend,
+			update:        &models.IncomeEventUpdateRequest{PayDate: "2024-01-06"},
+			expectedError: ErrPositionOversold,
+		},
+		{
+			name:   "increasing units should be accepted",
+			event:  stockDividend,
+			update: &models.IncomeEventUpdateRequest{Quantity: floatPtr(3)},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			shortable := tt.shortable
+			if shortable == nil {
+				shortable = []string{}
+			}
+			mockTradeRepo := new(MockTradeRepository)
+			mockTradeRepo.On("ListTrades", "test-user").Return(trades, nil)
+			mockTradeRepo.On("ListReceivedUnits", "test-user").Return([]models.IncomeEvent{stockDividend}, nil)
+			mockTradeRepo.On("ListShortableAccountIDs", "test-user").Return(shortable, nil)
+			mockTradeRepo.On("GetCostBasisMethods", "test-user").Return("", map[string]string{}, nil)
+			mockRepo := new(MockIncomeEventRepository)
+			mockRepo.On("GetEvent", "test-user", tt.event.ID).Return(&tt.event, nil)
+			mockRepo.On("GetAccountCurrency", "test-user", "acc-1").Return("USD", nil)
+			mockRepo.On("UpdateEvent", mock.Anything).Return(nil)
+			mockRepo.On("DeleteEvent", "test-user", tt.event.ID).Return(true, nil)
+
+			tradeService := NewTradeService(mockTradeRepo, new(MockFxService), withCorporateActions(), noInstruments())
+			service := NewIncomeService(mockRepo, new(MockProfileService), new(MockFxService), tradeService)
+
+			var err error
+			if tt.update != nil {
+				_, err = service.UpdateEvent("test-user", tt.event.ID, *tt.update)
+			} else {
+				_, err = service.DeleteEvent("test-user", tt.event.ID)
+			}
+
+			if tt.expectedError != nil {
+				assert.True(t, errors.Is(err, tt.expectedError), "expected %v, got %v", tt.expectedError, err)
+				mockRepo.AssertNotCalled(t, "UpdateEvent", mock.Anything)
+				mockRepo.AssertNotCalled(t, "DeleteEvent", "test-user", tt.event.ID)
+				return
+			}
+			assert.NoError(t, err)
+		})
+	}
+}
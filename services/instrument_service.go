@@ -0,0 +1,192 @@
+package services
+
+import (
+	"asset-dairy/models"
+	"asset-dairy/repositories"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+var (
+	ErrInstrumentNotFound = errors.New("instrument not found")
+	ErrInvalidInstrument  = errors.New("invalid instrument")
+)
+
+// instrumentSearchLimit caps the number of instruments a search returns
+const instrumentSearchLimit = 50
+
+type InstrumentServiceInterface interface {
+	SearchInstruments(query string) ([]models.Instrument, error)
+	GetInstrument(instrumentID string) (*models.Instrument, error)
+	FindInstrument(symbol, currency string) (*models.Instrument, error)
+	CreateInstrument(req models.InstrumentCreateRequest) (*models.Instrument, error)
+	UpdateInstrument(instrumentID string, req models.InstrumentCreateRequest) (*models.Instrument, error)
+	DeleteInstrument(instrumentID string) (bool, error)
+}
+
+type InstrumentService struct {
+	repo repositories.InstrumentRepositoryInterface
+}
+
+func NewInstrumentService(repo repositories.InstrumentRepositoryInterface) *InstrumentService {
+	return &InstrumentService{repo: repo}
+}
+
+// SearchInstruments matches the query against symbol, name, ISIN and CUSIP
+func (s *InstrumentService) SearchInstruments(query string) ([]models.Instrument, error) {
+	return s.repo.SearchInstruments(query, instrumentSearchLimit)
+}
+
+func (s *InstrumentService) GetInstrument(instrumentID string) (*models.Instrument, error) {
+	instrument, err := s.repo.GetInstrument(instrumentID)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, ErrInstrumentNotFound
+	}
+	return instrument, err
+}
+
+// FindInstrument returns the instrument listed under a symbol in a currency, or nil when the
+// catalog has none
+func (s *InstrumentService) FindInstrument(symbol, currency string) (*models.Instrument, error) {
+	return s.repo.FindInstrument(normalizeTicker(symbol), strings.ToUpper(strings.TrimSpace(currency)))
+}
+
+func (s *InstrumentService) CreateInstrument(req models.InstrumentCreateRequest) (*models.Instrument, error) {
+	instrument, err := newInstrument(uuid.New().String(), req)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.checkUnique(instrument); err != nil {
+		return nil, err
+	}
+	if err := s.repo.CreateInstrument(instrument); err != nil {
+		return nil, err
+	}
+	return &instrument, nil
+}
+
+// UpdateInstrument replaces the stored instrument with the request. Linked trades copy the
+// symbol, currency, asset class and multiplier, so those cannot change once the instrument has
+// trades; a new symbol is recorded as a corporate action instead.
+func (s *InstrumentService) UpdateInstrument(instrumentID string, req models.InstrumentCreateRequest) (*models.Instrument, error) {
+	instrument, err := newInstrument(instrumentID, req)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.checkUnique(instrument); err != nil {
+		return nil, err
+	}
+	current, err := s.GetInstrument(instrumentID)
+	if err != nil {
+		return nil, err
+	}
+	if current.Symbol != instrument.Symbol || current.Currency != instrument.Currency ||
+		current.AssetClass != instrument.AssetClass || current.ContractSize() != instrument.ContractSize() {
+		linked, err := s.repo.HasTrades(instrumentID)
+		if err != nil {
+			return nil, err
+		}
+		if linked {
+			return nil, fmt.Errorf("%w: %s %s has trades, so its symbol, currency, asset class and multiplier cannot change; record a new symbol as a corporate action", ErrInvalidInstrument, current.Symbol, current.Currency)
+		}
+	}
+	updated, err := s.repo.UpdateInstrument(instrument)
+	if err != nil {
+		return nil, err
+	}
+	if !updated {
+		return nil, ErrInstrumentNotFound
+	}
+	return &instrument, nil
+}
+
+func (s *InstrumentService) DeleteInstrument(instrumentID string) (bool, error) {
+	return s.repo.DeleteInstrument(instrumentID)
+}
+
+// checkUnique rejects an instrument whose symbol and currency are already listed by another one
+func (s *InstrumentService) checkUnique(instrument models.Instrument) error {
+	existing, err := s.repo.FindInstrument(instrument.Symbol, instrument.Currency)
+	if err != nil {
+		return err
+	}
+	if existing != nil && existing.ID != instrument.ID {
+		return fmt.Errorf("%w: %s %s is already listed", ErrInvalidInstrument, instrument.Symbol, instrument.Currency)
+	}
+	return nil
+}
+
+// newInstrument builds the instrument a request describes, with identifiers in upper case
+func newInstrument(id string, req models.InstrumentCreateRequest) (models.Instrument, error) {
+	if req.AssetClass != models.AssetClassBond && (req.FaceValue != nil || req.CouponRate != nil) {
+		return models.Instrument{}, fmt.Errorf("%w: faceValue and couponRate only apply to bonds", ErrInvalidInstrument)
+	}
+	instrument := models.Instrument{
+		ID:             id,
+		Symbol:         normalizeTicker(req.Symbol),
+		Name:           strings.TrimSpace(req.Name),
+		Exchange:       upperOrNil(req.Exchange),
+		AssetClass:     req.AssetClass,
+		Currency:       strings.ToUpper(strings.TrimSpace(req.Currency)),
+		ISIN:           upperOrNil(req.ISIN),
+		CUSIP:          upperOrNil(req.CUSIP),
+		LotSize:        1,
+		PricePrecision: 2,
+		Multiplier:     req.Multiplier,
+		FaceValue:      req.FaceValue,
+		CouponRate:     req.CouponRate,
+	}
+	if req.LotSize != nil {
+		instrument.LotSize = *req.LotSize
+	}
+	if req.PricePrecision != nil {
+		instrument.PricePrecision = *req.PricePrecision
+	}
+	if err := applyOptionTerms(&instrument, req); err != nil {
+		return models.Instrument{}, err
+	}
+	return instrument, nil
+}
+
+// applyOptionTerms copies the contract terms of an option request onto the instrument. An
+// option needs all of them and any other asset class none.
+func applyOptionTerms(instrument *models.Instrument, req models.InstrumentCreateRequest) error {
+	hasTerms := req.Underlying != nil || req.OptionType != nil || req.StrikePrice != nil || req.ExpirationDate != nil
+	if req.AssetClass != models.AssetClassOption {
+		if hasTerms {
+			return fmt.Errorf("%w: underlying, optionType, strikePrice and expirationDate only apply to options", ErrInvalidInstrument)
+		}
+		return nil
+	}
+	if upperOrNil(req.Underlying) == nil || req.OptionType == nil || req.StrikePrice == nil || req.ExpirationDate == nil {
+		return fmt.Errorf("%w: an option needs underlying, optionType, strikePrice and expirationDate", ErrInvalidInstrument)
+	}
+	expirationDate, err := time.Parse("2006-01-02", *req.ExpirationDate)
+	if err != nil {
+		return fmt.Errorf("%w: expirationDate must be YYYY-MM-DD", ErrInvalidInstrument)
+	}
+	instrument.Underlying = upperOrNil(req.Underlying)
+	instrument.OptionType = req.OptionType
+	instrument.StrikePrice = req.StrikePrice
+	instrument.ExpirationDate = &expirationDate
+	return nil
+}
+
+// normalizeTicker is the form tickers are stored and compared in, so "aapl " and "AAPL" are
+// the same position
+func normalizeTicker(ticker string) string {
+	return strings.ToUpper(strings.TrimSpace(ticker))
+}
+
+func upperOrNil(value *string) *string {
+	if value == nil || strings.TrimSpace(*value) == "" {
+		return nil
+	}
+	upper := strings.ToUpper(strings.TrimSpace(*value))
+	return &upper
+}
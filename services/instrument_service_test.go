@@ -0,0 +1,180 @@
+package services
+
+import (
+	"asset-dairy/models"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"gorm.io/gorm"
+)
+
+// MockInstrumentRepository is a mock implementation of InstrumentRepositoryInterface
+type MockInstrumentRepository struct {
+	mock.Mock
+}
+
+func (m *MockInstrumentRepository) FindInstrument(symbol, currency string) (*models.Instrument, error) {
+	args := m.Called(symbol, currency)
+	instrument, _ := args.Get(0).(*models.Instrument)
+	return instrument, args.Error(1)
+}
+
+func (m *MockInstrumentRepository) CreateInstrument(instrument models.Instrument) error {
+	args := m.Called(instrument)
+	return args.Error(0)
+}
+
+func (m *MockInstrumentRepository) UpdateInstrument(instrument models.Instrument) (bool, error) {
+	args := m.Called(instrument)
+	return args.Bool(0), args.Error(1)
+}
+
+func (m *MockInstrumentRepository) GetInstrument(instrumentID string) (*models.Instrument, error) {
+	args := m.Called(instrumentID)
+	instrument, _ := args.Get(0).(*models.Instrument)
+	return instrument, args.Error(1)
+}
+
+func (m *MockInstrumentRepository) HasTrades(instrumentID string) (bool, error) {
+	args := m.Called(instrumentID)
+	return args.Bool(0), args.Error(1)
+}
+
+// Add stub methods to satisfy InstrumentRepositoryInterface
+func (m *MockInstrumentRepository) SearchInstruments(query string, limit int) ([]models.Instrument, error) {
+	panic("not implemented")
+}
+func (m *MockInstrumentRepository) DeleteInstrument(instrumentID string) (bool, error) {
+	panic("not implemented")
+}
+
+func TestCreateInstrumentNormalizesIdentifiers(t *testing.T) {
+	mockRepo := new(MockInstrumentRepository)
+	service := NewInstrumentService(mockRepo)
+
+	mockRepo.On("FindInstrument", "2330", "TWD").Return(nil, nil)
+	mockRepo.On("CreateInstrument", mock.Anything).Return(nil)
+
+	exchange, isin := "twse", "tw0002330008"
+	instrument, err := service.CreateInstrument(models.InstrumentCreateRequest{
+		Symbol: " 2330 ", Name: "Taiwan Semiconductor", Exchange: &exchange, AssetClass: "stock", Currency: "twd", ISIN: &isin,
+	})
+
+	assert.NoError(t, err)
+	assert.Equal(t, "2330", instrument.Symbol)
+	assert.Equal(t, "TWD", instrument.Currency)
+	assert.Equal(t, "TWSE", *instrument.Exchange)
+	assert.Equal(t, "TW0002330008", *instrument.ISIN)
+	assert.Nil(t, instrument.CUSIP)
+	assert.Equal(t, 1.0, instrument.LotSize)
+	assert.Equal(t, 2, instrument.PricePrecision)
+	mockRepo.AssertCalled(t, "CreateInstrument", *instrument)
+}
+
+func TestUpdateInstrument(t *testing.T) {
+	apple := models.Instrument{ID: "inst-2", Symbol: "AAPL", Name: "Apple", AssetClass: "stock", Currency: "USD", LotSize: 1, PricePrecision: 2}
+	multiplier := 10.0
+	tests := []struct {
+		name          string
+		req           models.InstrumentCreateRequest
+		current       *models.Instrument
+		hasTrades     bool
+		expectedError error
+	}{
+		{
+			name:      "name of an instrument with trades should change",
+			req:       models.InstrumentCreateRequest{Symbol: "aapl", Name: "Apple Inc.", AssetClass: "stock", Currency: "usd"},
+			current:   &apple,
+			hasTrades: true,
+		},
+		{
+			name:    "symbol of an instrument without trades should change",
+			req:     models.InstrumentCreateRequest{Symbol: "APLE", Name: "Apple", AssetClass: "stock", Currency: "USD"},
+			current: &apple,
+		},
+		{
+			name:          "symbol of an instrument with trades should not change",
+			req:           models.InstrumentCreateRequest{Symbol: "APLE", Name: "Apple", AssetClass: "stock", Currency: "USD"},
+			current:       &apple,
+			hasTrades:     true,
+			expectedError: ErrInvalidInstrument,
+		},
+		{
+			name:          "currency of an instrument with trades should not change",
+			req:           models.InstrumentCreateRequest{Symbol: "AAPL", Name: "Apple", AssetClass: "stock", Currency: "EUR"},
+			current:       &apple,
+			hasTrades:     true,
+			expectedError: ErrInvalidInstrument,
+		},
+		{
+			name:          "multiplier of an instrument with trades should not change",
+			req:           models.InstrumentCreateRequest{Symbol: "AAPL", Name: "Apple", AssetClass: "stock", Currency: "USD", Multiplier: &multiplier},
+			current:       &apple,
+			hasTrades:     true,
+			expectedError: ErrInvalidInstrument,
+		},
+		{
+			name:          "symbol listed by another instrument should be rejected",
+			req:           models.InstrumentCreateRequest{Symbol: "msft", Name: "Microsoft", AssetClass: "stock", Currency: "USD"},
+			current:       &apple,
+			expectedError: ErrInvalidInstrument,
+		},
+		{
+			name:          "unknown instrument should not be found",
+			req:           models.InstrumentCreateRequest{Symbol: "AAPL", Name: "Apple", AssetClass: "stock", Currency: "USD"},
+			expectedError: ErrInstrumentNotFound,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockRepo := new(MockInstrumentRepository)
+			service := NewInstrumentService(mockRepo)
+			mockRepo.On("FindInstrument", "MSFT", "USD").Return(&models.Instrument{ID: "inst-1", Symbol: "MSFT", Currency: "USD"}, nil)
+			mockRepo.On("FindInstrument", mock.Anything, mock.Anything).Return(nil, nil)
+			if tt.current != nil {
+				mockRepo.On("GetInstrument", "inst-2").Return(tt.current, nil)
+			} else {
+				mockRepo.On("GetInstrument", "inst-2").Return(nil, gorm.ErrRecordNotFound)
+			}
+			mockRepo.On("HasTrades", "inst-2").Return(tt.hasTrades, nil)
+			mockRepo.On("UpdateInstrument", mock.Anything).Return(true, nil)
+
+			instrument, err := service.UpdateInstrument("inst-2", tt.req)
+
+			if tt.expectedError != nil {
+				assert.True(t, errors.Is(err, tt.expectedError), "expected %v, got %v", tt.expectedError, err)
+				mockRepo.AssertNotCalled(t, "UpdateInstrument", mock.Anything)
+				return
+			}
+			assert.NoError(t, err)
+			mockRepo.AssertCalled(t, "UpdateInstrument", *instrument)
+		})
+	}
+}
+
+func TestCreateInstrumentRequiresOptionTerms(t *testing.T) {
+	mockRepo := new(MockInstrumentRepository)
+	service := NewInstrumentService(mockRepo)
+
+	mockRepo.On("FindInstrument", mock.Anything, mock.Anything).Return(nil, nil)
+	mockRepo.On("CreateInstrument", mock.Anything).Return(nil)
+
+	underlying, call, strike := "aapl", models.OptionTypeCall, 200.0
+	_, err := service.CreateInstrument(models.InstrumentCreateRequest{
+		Symbol: "AAPL240621C00200000", Name: "AAPL Jun 2024 200 Call", AssetClass: "option", Currency: "USD", Underlying: &underlying, OptionType: &call, StrikePrice: &strike,
+	})
+	assert.True(t, errors.Is(err, ErrInvalidInstrument), "expected %v, got %v", ErrInvalidInstrument, err)
+
+	expiry := "2024-06-21"
+	instrument, err := service.CreateInstrument(models.InstrumentCreateRequest{
+		Symbol: "AAPL240621C00200000", Name: "AAPL Jun 2024 200 Call", AssetClass: "option", Currency: "USD", Underlying: &underlying, OptionType: &call, StrikePrice: &strike, ExpirationDate: &expiry,
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, "AAPL", *instrument.Underlying)
+	assert.Equal(t, time.Date(2024, 6, 21, 0, 0, 0, 0, time.UTC), *instrument.ExpirationDate)
+	assert.Equal(t, 100.0, instrument.ContractSize())
+}
@@ -0,0 +1,740 @@
+package services
+
+import (
+	"asset-dairy/models"
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+	"time"
+)
+
+// quantityEpsilon absorbs floating point noise when comparing quantities against zero
+const quantityEpsilon = 1e-9
+
+// Lot represents a batch of shares bought at a specific price
+type Lot struct {
+	TradeID      string
+	TradeDate    time.Time
+	Quantity     float64
+	Price        float64
+	RemainingQty float64
+}
+
+// position holds the running holding and open lots of one ticker/currency pair in one account
+type position struct {
+	accountID string
+	holding   *models.Holding
+	lots      []*Lot
+	// shortLots are opened by sells beyond the long quantity and covered FIFO by later buys
+	shortLots []*Lot
+}
+
+// costBasisSettings resolves which cost-basis method a sell in a given account uses
+type costBasisSettings struct {
+	defaultMethod  string
+	accountMethods map[string]string
+}
+
+func (c costBasisSettings) methodFor(accountID string) string {
+	if method, ok := c.accountMethods[accountID]; ok && method != "" {
+		return method
+	}
+	if c.defaultMethod != "" {
+		return c.defaultMethod
+	}
+	return models.CostBasisFIFO
+}
+
+// lotMatcher replays trades, matching every sell against the open buy lots and
+// every buy against the open short lots
+type lotMatcher struct {
+	costBasis costBasisSettings
+	positions map[string]*position
+	// keys keeps positions in the order they were first traded so results are stable
+	keys     []string
+	realized []models.RealizedGain
+	// allocationErrors holds, per sell trade ID, the first lot allocation that could not be honored
+	allocationErrors map[string]error
+	// actions are the corporate actions not applied yet, in the order they take effect
+	actions []models.CorporateAction
+	// payouts holds the cash corporate actions paid into each account, in the order paid
+	payouts []actionPayout
+	// unconverted holds the IDs of trades whose charges had no rate into the trade currency
+	unconverted map[string]bool
+}
+
+// actionPayout is the cash one corporate action paid into one account, in the currency of the
+// position it was paid on
+type actionPayout struct {
+	action    models.CorporateAction
+	accountID string
+	currency  string
+	amount    float64
+}
+
+func newLotMatcher(costBasis costBasisSettings, actions []models.CorporateAction) *lotMatcher {
+	pending := make([]models.CorporateAction, len(actions))
+	copy(pending, actions)
+	sort.SliceStable(pending, func(i, j int) bool {
+		return pending[i].EffectiveDate.Before(pending[j].EffectiveDate)
+	})
+	return &lotMatcher{
+		costBasis:        costBasis,
+		positions:        make(map[string]*position),
+		allocationErrors: make(map[string]error),
+		actions:          pending,
+		unconverted:      make(map[string]bool),
+	}
+}
+
+// matchTrades replays the given trades chronologically, together with the corporate actions
+// that have taken effect by today, and returns the resulting matcher. Fees and taxes must
+// already be in the trade currency; buy lots carry them in their price and sells book them
+// against the proceeds.
+func matchTrades(trades []models.Trade, costBasis costBasisSettings, actions []models.CorporateAction) *lotMatcher {
+	m := newLotMatcher(costBasis, actions)
+	for _, trade := range sortTrades(trades) {
+		m.apply(trade)
+	}
+	m.applyActions(truncateToDate(time.Now()))
+	return m
+}
+
+// matchTradesThrough replays the trades dated on or before through, with the corporate actions
+// that have taken effect by then
+func matchTradesThrough(trades []models.Trade, costBasis costBasisSettings, actions []models.CorporateAction, through time.Time) *lotMatcher {
+	through = truncateToDate(through)
+	m := newLotMatcher(costBasis, actions)
+	for _, trade := range sortTrades(trades) {
+		if truncateToDate(trade.TradeDate).After(through) {
+			break
+		}
+		m.apply(trade)
+	}
+	m.applyActions(through)
+	return m
+}
+
+// sortTrades returns a copy of the trades ordered by trade date, then creation time.
+// The sort is stable so trades without timestamps keep their given order.
+func sortTrades(trades []models.Trade) []models.Trade {
+	sorted := make([]models.Trade, len(trades))
+	copy(sorted, trades)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		if !sorted[i].TradeDate.Equal(sorted[j].TradeDate) {
+			return sorted[i].TradeDate.Before(sorted[j].TradeDate)
+		}
+		return sorted[i].CreatedAt.Before(sorted[j].CreatedAt)
+	})
+	return sorted
+}
+
+// positionKey identifies the position a trade belongs to. Lots are matched within an account,
+// so a sell at one broker never draws down the lots held at another.
+func positionKey(trade models.Trade) string {
+	return accountPositionKey(trade.AccountID, trade.Ticker, trade.Currency)
+}
+
+func accountPositionKey(accountID, ticker, currency string) string {
+	return accountID + "_" + ticker + "_" + currency
+}
+
+// position returns the position the trade belongs to; a new one takes the trade's multiplier
+func (m *lotMatcher) position(trade models.Trade) *position {
+	pos := m.positionFor(trade.AccountID, trade.Ticker, trade.AssetType, trade.Currency)
+	if pos.holding.Multiplier == 0 && trade.ContractSize() != 1 {
+		pos.holding.Multiplier = trade.ContractSize()
+	}
+	return pos
+}
+
+// positionFor returns the position of a ticker/currency pair in an account, opening an empty
+// one if needed
+func (m *lotMatcher) positionFor(accountID, ticker, assetType, currency string) *position {
+	key := accountPositionKey(accountID, ticker, currency)
+	pos, exists := m.positions[key]
+	if !exists {
+		pos = &position{
+			accountID: accountID,
+			holding: &models.Holding{
+				Ticker:    ticker,
+				AssetType: assetType,
+				Currency:  currency,
+			},
+			lots:      []*Lot{},
+			shortLots: []*Lot{},
+		}
+		m.positions[key] = pos
+		m.keys = append(m.keys, key)
+	}
+	return pos
+}
+
+func (m *lotMatcher) apply(trade models.Trade) {
+	// A trade on the effective date of an action is already in post-action units
+	m.applyActions(trade.TradeDate)
+	pos := m.position(trade)
+	if trade.UnconvertedCharges {
+		m.unconverted[trade.ID] = true
+	}
+	switch trade.Type {
+	case "buy":
+		if remainingBuyQty := m.cover(pos, trade); remainingBuyQty > quantityEpsilon {
+			pos.lots = append(pos.lots, &Lot{
+				TradeID:      trade.ID,
+				TradeDate:    trade.TradeDate,
+				Quantity:     remainingBuyQty,
+				Price:        netPrice(trade),
+				RemainingQty: remainingBuyQty,
+			})
+		}
+		pos.holding.Quantity += trade.Quantity
+	case "sell":
+		m.sell(pos, trade)
+		pos.holding.Quantity -= trade.Quantity
+	}
+}
+
+// applyActions applies the pending corporate actions effective on or before the given date
+func (m *lotMatcher) applyActions(through time.Time) {
+	through = truncateToDate(through)
+	for len(m.actions) > 0 && !truncateToDate(m.actions[0].EffectiveDate).After(through) {
+		action := m.actions[0]
+		m.actions = m.actions[1:]
+		// Ticker changes open positions; only those that existed before the action take part
+		keys := append([]string(nil), m.keys...)
+		for _, key := range keys {
+			pos := m.positions[key]
+			if !strings.EqualFold(pos.holding.Ticker, action.Ticker) {
+				continue
+			}
+			switch action.Type {
+			case models.CorporateActionSplit:
+				m.split(pos, action)
+			case models.CorporateActionSymbolChange, models.CorporateActionMerger:
+				m.convert(pos, action)
+			case models.CorporateActionSpinOff:
+				m.spinOff(pos, action)
+			}
+		}
+	}
+}
+
+// split scales the quantity and price of every open lot by the split ratio, leaving the cost
+// basis unchanged, then pays out any fractional share left over as cash in lieu
+func (m *lotMatcher) split(pos *position, action models.CorporateAction) {
+	ratio := action.Ratio()
+	for _, lots := range [][]*Lot{pos.lots, pos.shortLots} {
+		for _, lot := range lots {
+			lot.Quantity *= ratio
+			lot.RemainingQty *= ratio
+			lot.Price /= ratio
+		}
+	}
+	pos.holding.Quantity *= ratio
+	m.payCashInLieu(pos, action)
+}
+
+// convert closes the position for a symbol change or merger and carries its open lots to the
+// new ticker. Cash a merger pays is realized against the part of the cost basis that does not
+// carry over and paid into the account, or taken from it for a short position.
+func (m *lotMatcher) convert(pos *position, action models.CorporateAction) {
+	if cash := action.Cash(); cash > 0 {
+		payout := models.Trade{Type: "sell", TradeDate: action.EffectiveDate, Price: cash}
+		retained := 1 - action.CarriedBasis()
+		first := len(m.realized)
+		for _, lot := range pos.lots {
+			if lot.RemainingQty > quantityEpsilon {
+				m.realize(pos, lot, payout, lot.RemainingQty, lot.Price*retained)
+			}
+		}
+		for _, shortLot := range pos.shortLots {
+			if shortLot.RemainingQty > quantityEpsilon {
+				owed := *shortLot
+				owed.Price *= retained
+				// The short seller pays the cash, so it is the cost of covering
+				m.realizeCover(pos, &owed, models.Trade{Type: "buy", TradeDate: action.EffectiveDate, Price: cash}, shortLot.RemainingQty)
+			}
+		}
+		m.tagRealized(first, action)
+		if math.Abs(pos.holding.Quantity) > quantityEpsilon {
+			m.pay(pos, action, pos.holding.Quantity*cash*pos.holding.ContractSize())
+		}
+	}
+
+	if action.NewTicker != nil && action.Ratio() > 0 {
+		target := m.positionFor(pos.accountID, *action.NewTicker, pos.holding.AssetType, pos.holding.Currency)
+		target.holding.Multiplier = pos.holding.Multiplier
+		m.carry(pos, target, action)
+		m.payCashInLieu(target, action)
+	}
+	for _, lots := range [][]*Lot{pos.lots, pos.shortLots} {
+		for _, lot := range lots {
+			lot.RemainingQty = 0
+		}
+	}
+	pos.holding.Quantity = 0
+}
+
+// spinOff keeps the position and opens the spun-off ticker against its open lots, moving the
+// action's share of the cost basis to the new shares
+func (m *lotMatcher) spinOff(pos *position, action models.CorporateAction) {
+	if action.NewTicker == nil || action.Ratio() <= 0 {
+		return
+	}
+	target := m.positionFor(pos.accountID, *action.NewTicker, pos.holding.AssetType, pos.holding.Currency)
+	target.holding.Multiplier = pos.holding.Multiplier
+	m.carry(pos, target, action)
+	retained := 1 - action.CarriedBasis()
+	for _, lots := range [][]*Lot{pos.lots, pos.shortLots} {
+		for _, lot := range lots {
+			lot.Price *= retained
+		}
+	}
+	m.payCashInLieu(target, action)
+}
+
+// carry adds a lot to target for every open lot of pos, received at the action's ratio with the
+// action's share of the cost basis. The new lots keep the trade and date of the lots they come
+// from, so holding periods and lot allocations continue across the change.
+func (m *lotMatcher) carry(pos, target *position, action models.CorporateAction) {
+	ratio, carried := action.Ratio(), action.CarriedBasis()
+	carryLots := func(lots []*Lot) []*Lot {
+		received := []*Lot{}
+		for _, lot := range lots {
+			if lot.RemainingQty <= quantityEpsilon {
+				continue
+			}
+			received = append(received, &Lot{
+				TradeID:      lot.TradeID,
+				TradeDate:    lot.TradeDate,
+				Quantity:     lot.RemainingQty * ratio,
+				Price:        lot.Price * carried / ratio,
+				RemainingQty: lot.RemainingQty * ratio,
+			})
+		}
+		return received
+	}
+	target.lots = mergeLots(target.lots, carryLots(pos.lots))
+	target.shortLots = mergeLots(target.shortLots, carryLots(pos.shortLots))
+	target.holding.Quantity += pos.holding.Quantity * ratio
+
+	lineage := append([]models.HoldingLineage{}, target.holding.Lineage...)
+	lineage = append(lineage, pos.holding.Lineage...)
+	target.holding.Lineage = append(lineage, models.HoldingLineage{
+		CorporateActionID: action.ID,
+		Type:              action.Type,
+		EffectiveDate:     action.EffectiveDate,
+		FromTicker:        pos.holding.Ticker,
+		ToTicker:          target.holding.Ticker,
+	})
+}
+
+// mergeLots adds received lots to a position's lots, keeping them in trade date order so FIFO
+// and LIFO still see the oldest lot first and last
+func mergeLots(lots, received []*Lot) []*Lot {
+	if len(received) == 0 {
+		return lots
+	}
+	merged := append(lots, received...)
+	sort.SliceStable(merged, func(i, j int) bool {
+		return merged[i].TradeDate.Before(merged[j].TradeDate)
+	})
+	return merged
+}
+
+// payCashInLieu sells the fractional share a corporate action leaves in a long position at the
+// action's cash in lieu price
+func (m *lotMatcher) payCashInLieu(pos *position, action models.CorporateAction) {
+	if action.CashInLieuPrice == nil || pos.holding.Quantity <= quantityEpsilon {
+		return
+	}
+	fraction := pos.holding.Quantity - math.Floor(pos.holding.Quantity+quantityEpsilon)
+	if fraction <= quantityEpsilon {
+		return
+	}
+	sale := models.Trade{Type: "sell", TradeDate: action.EffectiveDate, Quantity: fraction, Price: *action.CashInLieuPrice}
+	first := len(m.realized)
+	m.sellOrdered(pos, sale, fraction, orderLots(pos.lots, m.costBasis.methodFor(pos.accountID)))
+	m.tagRealized(first, action)
+	pos.holding.Quantity -= fraction
+	m.pay(pos, action, fraction*sale.Price*pos.holding.ContractSize())
+}
+
+// pay records cash an action paid into the position's account, adding to what the action
+// already paid there in the same currency
+func (m *lotMatcher) pay(pos *position, action models.CorporateAction, amount float64) {
+	for i := range m.payouts {
+		payout := &m.payouts[i]
+		if payout.action.ID == action.ID && payout.accountID == pos.accountID && payout.currency == pos.holding.Currency {
+			payout.amount += amount
+			return
+		}
+	}
+	m.payouts = append(m.payouts, actionPayout{action: action, accountID: pos.accountID, currency: pos.holding.Currency, amount: amount})
+}
+
+// tagRealized marks the gains realized since index first as paid out by the action
+func (m *lotMatcher) tagRealized(first int, action models.CorporateAction) {
+	for i := first; i < len(m.realized); i++ {
+		m.realized[i].CorporateActionID = action.ID
+	}
+}
+
+// cover closes open short lots FIFO with a buy and returns the quantity left to open a long lot
+func (m *lotMatcher) cover(pos *position, trade models.Trade) float64 {
+	remainingBuyQty := trade.Quantity
+	for _, shortLot := range pos.shortLots {
+		if remainingBuyQty <= 0 {
+			break
+		}
+		if shortLot.RemainingQty <= 0 {
+			continue
+		}
+		matchedQty := shortLot.RemainingQty
+		if matchedQty > remainingBuyQty {
+			matchedQty = remainingBuyQty
+		}
+		shortLot.RemainingQty -= matchedQty
+		remainingBuyQty -= matchedQty
+		m.realizeCover(pos, shortLot, trade, matchedQty)
+	}
+	return remainingBuyQty
+}
+
+// sell draws down the lots named by the trade's allocations first, then consumes
+// open lots in the order of the account's cost-basis method, recording a realized
+// gain for every lot it draws down. Whatever the long lots cannot cover opens a short lot.
+func (m *lotMatcher) sell(pos *position, trade models.Trade) {
+	remainingSellQty := m.sellAllocated(pos, trade)
+	if remainingSellQty > 0 {
+		if method := m.costBasis.methodFor(trade.AccountID); method == models.CostBasisAverage {
+			remainingSellQty = m.sellAverage(pos, trade, remainingSellQty)
+		} else {
+			remainingSellQty = m.sellOrdered(pos, trade, remainingSellQty, orderLots(pos.lots, method))
+		}
+	}
+
+	if remainingSellQty > quantityEpsilon {
+		pos.shortLots = append(pos.shortLots, &Lot{
+			TradeID:      trade.ID,
+			TradeDate:    trade.TradeDate,
+			Quantity:     remainingSellQty,
+			Price:        netPrice(trade),
+			RemainingQty: remainingSellQty,
+		})
+	}
+}
+
+// sellOrdered consumes the lots in the given order and returns the quantity they could not cover
+func (m *lotMatcher) sellOrdered(pos *position, trade models.Trade, remainingSellQty float64, lots []*Lot) float64 {
+	for _, lot := range lots {
+		if remainingSellQty <= 0 {
+			break
+		}
+		if lot.RemainingQty <= 0 {
+			continue
+		}
+		matchedQty := lot.RemainingQty
+		if matchedQty > remainingSellQty {
+			matchedQty = remainingSellQty
+		}
+		lot.RemainingQty -= matchedQty
+		remainingSellQty -= matchedQty
+		m.realize(pos, lot, trade, matchedQty, lot.Price)
+	}
+	return remainingSellQty
+}
+
+// sellAllocated honors the trade's specific-lot allocations and returns the quantity left to match
+func (m *lotMatcher) sellAllocated(pos *position, trade models.Trade) float64 {
+	remainingSellQty := trade.Quantity
+	for _, allocation := range trade.LotAllocations {
+		lot := pos.lot(allocation.BuyTradeID)
+		if lot == nil {
+			m.allocationError(trade.ID, fmt.Errorf("%w: buy trade %s is not an open %s lot at the sell date", ErrInvalidLotAllocation, allocation.BuyTradeID, pos.holding.Ticker))
+			continue
+		}
+		matchedQty := allocation.Quantity
+		if matchedQty > lot.RemainingQty {
+			m.allocationError(trade.ID, fmt.Errorf("%w: buy trade %s has %g remaining, %g requested", ErrInvalidLotAllocation, allocation.BuyTradeID, lot.RemainingQty, allocation.Quantity))
+			matchedQty = lot.RemainingQty
+		}
+		if matchedQty > remainingSellQty {
+			matchedQty = remainingSellQty
+		}
+		if matchedQty <= 0 {
+			continue
+		}
+		lot.RemainingQty -= matchedQty
+		remainingSellQty -= matchedQty
+		m.realize(pos, lot, trade, matchedQty, lot.Price)
+	}
+	return remainingSellQty
+}
+
+func (m *lotMatcher) allocationError(tradeID string, err error) {
+	if _, exists := m.allocationErrors[tradeID]; !exists {
+		m.allocationErrors[tradeID] = err
+	}
+}
+
+// lot returns the lot opened by the given buy trade, if it belongs to this position
+func (p *position) lot(tradeID string) *Lot {
+	for _, lot := range p.lots {
+		if lot.TradeID == tradeID {
+			return lot
+		}
+	}
+	return nil
+}
+
+// sellAverage draws every open lot down pro rata so the remaining lots keep the
+// moving weighted average price, books each match at that average, and returns
+// the quantity the open lots could not cover
+func (m *lotMatcher) sellAverage(pos *position, trade models.Trade, quantity float64) float64 {
+	var openQty, openCost float64
+	for _, lot := range pos.lots {
+		if lot.RemainingQty > 0 {
+			openQty += lot.RemainingQty
+			openCost += lot.Price * lot.RemainingQty
+		}
+	}
+	if openQty <= 0 {
+		return quantity
+	}
+	averagePrice := openCost / openQty
+	fraction := quantity / openQty
+	if fraction > 1 {
+		fraction = 1
+	}
+	for _, lot := range pos.lots {
+		if lot.RemainingQty <= 0 {
+			continue
+		}
+		matchedQty := lot.RemainingQty * fraction
+		lot.RemainingQty -= matchedQty
+		m.realize(pos, lot, trade, matchedQty, averagePrice)
+	}
+	if quantity > openQty {
+		return quantity - openQty
+	}
+	return 0
+}
+
+// orderLots returns the lots in the order a sell should consume them
+func orderLots(lots []*Lot, method string) []*Lot {
+	ordered := make([]*Lot, len(lots))
+	copy(ordered, lots)
+	switch method {
+	case models.CostBasisLIFO:
+		for i, j := 0, len(ordered)-1; i < j; i, j = i+1, j-1 {
+			ordered[i], ordered[j] = ordered[j], ordered[i]
+		}
+	case models.CostBasisHIFO:
+		sort.SliceStable(ordered, func(i, j int) bool {
+			return ordered[i].Price > ordered[j].Price
+		})
+	}
+	return ordered
+}
+
+// realize records the gain of a long lot closed by a sell; lot and trade prices are per unit
+// and scaled by the position's contract size
+func (m *lotMatcher) realize(pos *position, lot *Lot, trade models.Trade, quantity, costPrice float64) {
+	// Shares transferred out leave with their lots; nothing was sold
+	if trade.Transfer {
+		return
+	}
+	size := pos.holding.ContractSize()
+	costBasis := costPrice * quantity * size
+	proceeds := netPrice(trade) * quantity * size
+	m.realized = append(m.realized, models.RealizedGain{
+		AccountID:          pos.accountID,
+		Ticker:             pos.holding.Ticker,
+		AssetType:          pos.holding.AssetType,
+		Currency:           pos.holding.Currency,
+		BuyTradeID:         lot.TradeID,
+		SellTradeID:        trade.ID,
+		BuyDate:            lot.TradeDate,
+		SellDate:           trade.TradeDate,
+		Quantity:           quantity,
+		CostBasis:          costBasis,
+		Proceeds:           proceeds,
+		Gain:               proceeds - costBasis,
+		HoldingPeriodDays:  int(trade.TradeDate.Sub(lot.TradeDate).Hours() / 24),
+		UnconvertedCharges: m.unconverted[lot.TradeID] || m.unconverted[trade.ID],
+	})
+}
+
+// realizeCover records the gain of a short lot closed by a buy: the short sale is the
+// proceeds and the covering buy is the cost
+func (m *lotMatcher) realizeCover(pos *position, shortLot *Lot, trade models.Trade, quantity float64) {
+	// Shares transferred in return the borrowed ones; nothing was bought
+	if trade.Transfer {
+		return
+	}
+	size := pos.holding.ContractSize()
+	costBasis := netPrice(trade) * quantity * size
+	proceeds := shortLot.Price * quantity * size
+	m.realized = append(m.realized, models.RealizedGain{
+		AccountID:          pos.accountID,
+		Ticker:             pos.holding.Ticker,
+		AssetType:          pos.holding.AssetType,
+		Currency:           pos.holding.Currency,
+		BuyTradeID:         trade.ID,
+		SellTradeID:        shortLot.TradeID,
+		BuyDate:            trade.TradeDate,
+		SellDate:           shortLot.TradeDate,
+		Quantity:           quantity,
+		CostBasis:          costBasis,
+		Proceeds:           proceeds,
+		Gain:               proceeds - costBasis,
+		HoldingPeriodDays:  int(trade.TradeDate.Sub(shortLot.TradeDate).Hours() / 24),
+		Short:              true,
+		UnconvertedCharges: m.unconverted[shortLot.TradeID] || m.unconverted[trade.ID],
+	})
+}
+
+// holdings returns the open positions summed across accounts. The average price is taken over
+// the accounts holding the ticker on the side of the summed quantity: the remaining lots of the
+// long positions, or for a short position, which has a negative quantity, the average short
+// sale price of the short ones. Positions on the other side only reduce the quantity.
+func (m *lotMatcher) holdings() []models.Holding {
+	assets := []models.Holding{}
+	// cost and quantity of the long (0) and short (1) positions behind each holding
+	costs := [][2]float64{}
+	quantities := [][2]float64{}
+	index := make(map[string]int)
+	for _, pos := range m.openPositions() {
+		key := pos.holding.Ticker + "_" + pos.holding.Currency
+		i, ok := index[key]
+		if !ok {
+			i = len(assets)
+			index[key] = i
+			holding := *pos.holding
+			holding.Quantity = 0
+			holding.Lineage = append([]models.HoldingLineage(nil), pos.holding.Lineage...)
+			assets = append(assets, holding)
+			costs = append(costs, [2]float64{})
+			quantities = append(quantities, [2]float64{})
+		} else {
+			assets[i].Lineage = mergeLineage(assets[i].Lineage, pos.holding.Lineage)
+			assets[i].UnconvertedCharges = assets[i].UnconvertedCharges || pos.holding.UnconvertedCharges
+		}
+		side := 0
+		if pos.holding.Quantity < 0 {
+			side = 1
+		}
+		assets[i].Quantity += pos.holding.Quantity
+		costs[i][side] += pos.holding.Quantity * pos.holding.AveragePrice
+		quantities[i][side] += pos.holding.Quantity
+	}
+
+	// Long and short positions in different accounts may cancel out
+	open := []models.Holding{}
+	for i, holding := range assets {
+		if math.Abs(holding.Quantity) <= quantityEpsilon {
+			continue
+		}
+		side := 0
+		if holding.Quantity < 0 {
+			side = 1
+		}
+		holding.AveragePrice = costs[i][side] / quantities[i][side]
+		open = append(open, holding)
+	}
+	return open
+}
+
+// mergeLineage adds the steps of another account's lineage that are not listed yet
+func mergeLineage(lineage, other []models.HoldingLineage) []models.HoldingLineage {
+	for _, step := range other {
+		listed := false
+		for _, existing := range lineage {
+			if existing.CorporateActionID == step.CorporateActionID && existing.FromTicker == step.FromTicker {
+				listed = true
+				break
+			}
+		}
+		if !listed {
+			lineage = append(lineage, step)
+		}
+	}
+	return lineage
+}
+
+// accountHoldings returns the open positions of each account keyed by account ID, listing
+// their open lots when withLots is set
+func (m *lotMatcher) accountHoldings(withLots bool) map[string][]models.Holding {
+	assets := make(map[string][]models.Holding)
+	for _, pos := range m.openPositions() {
+		holding := *pos.holding
+		if withLots {
+			sign := 1.0
+			if holding.Quantity < 0 {
+				sign = -1
+			}
+			for _, lot := range pos.openLots() {
+				holding.Lots = append(holding.Lots, models.HoldingLot{
+					TradeID:   lot.TradeID,
+					TradeDate: lot.TradeDate,
+					Quantity:  sign * lot.RemainingQty,
+					Price:     lot.Price,
+				})
+			}
+		}
+		assets[pos.accountID] = append(assets[pos.accountID], holding)
+	}
+	return assets
+}
+
+// openPositions returns the positions with a quantity, in the order they were first traded,
+// after setting their average price and whether an open lot has unconverted charges
+func (m *lotMatcher) openPositions() []*position {
+	open := []*position{}
+	for _, key := range m.keys {
+		pos := m.positions[key]
+		if pos.holding.Quantity > -quantityEpsilon && pos.holding.Quantity < quantityEpsilon {
+			continue
+		}
+		var totalCost float64
+		var totalRemainingQty float64
+		pos.holding.UnconvertedCharges = false
+		for _, lot := range pos.openLots() {
+			totalCost += lot.Price * lot.RemainingQty
+			totalRemainingQty += lot.RemainingQty
+			pos.holding.UnconvertedCharges = pos.holding.UnconvertedCharges || m.unconverted[lot.TradeID]
+		}
+		pos.holding.AveragePrice = 0
+		if totalRemainingQty > 0 {
+			pos.holding.AveragePrice = totalCost / totalRemainingQty
+		}
+		open = append(open, pos)
+	}
+	return open
+}
+
+// openLots returns the lots with a remaining quantity on the side the position is on
+func (p *position) openLots() []*Lot {
+	lots := p.lots
+	if p.holding.Quantity < 0 {
+		lots = p.shortLots
+	}
+	open := []*Lot{}
+	for _, lot := range lots {
+		if lot.RemainingQty > 0 {
+			open = append(open, lot)
+		}
+	}
+	return open
+}
+
+// realizedGains returns every sell-to-lot match in the order the sells were applied
+func (m *lotMatcher) realizedGains() []models.RealizedGain {
+	if m.realized == nil {
+		return []models.RealizedGain{}
+	}
+	return m.realized
+}
@@ -0,0 +1,321 @@
+package services
+
+import (
+	"asset-dairy/models"
+	"errors"
+	"fmt"
+	"html"
+	"io"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ofxNode is an element of an OFX document: an aggregate with children or a leaf with a value
+type ofxNode struct {
+	name     string
+	value    string
+	children []*ofxNode
+}
+
+// child returns the first direct child with the name, or nil
+func (n *ofxNode) child(name string) *ofxNode {
+	if n == nil {
+		return nil
+	}
+	for _, child := range n.children {
+		if child.name == name {
+			return child
+		}
+	}
+	return nil
+}
+
+// find returns the first element with the name beneath the node, depth first, or nil
+func (n *ofxNode) find(name string) *ofxNode {
+	if n == nil {
+		return nil
+	}
+	for _, child := range n.children {
+		if child.name == name {
+			return child
+		}
+		if found := child.find(name); found != nil {
+			return found
+		}
+	}
+	return nil
+}
+
+// findAll returns every element with the name beneath the node, without looking inside them
+func (n *ofxNode) findAll(name string) []*ofxNode {
+	found := []*ofxNode{}
+	for _, child := range n.children {
+		if child.name == name {
+			found = append(found, child)
+			continue
+		}
+		found = append(found, child.findAll(name)...)
+	}
+	return found
+}
+
+// text returns the value of the first element with the name beneath the node, or ""
+func (n *ofxNode) text(name string) string {
+	if found := n.find(name); found != nil {
+		return found.value
+	}
+	return ""
+}
+
+// parseOFXTree reads an OFX document into a tree. It accepts both the SGML of OFX 1.x, whose
+// leaf elements are not closed, and the XML of OFX 2.x; headers, processing instructions and
+// comments are skipped.
+func parseOFXTree(data string) (*ofxNode, error) {
+	root := &ofxNode{}
+	stack := []*ofxNode{root}
+	for {
+		start := strings.IndexByte(data, '<')
+		if start < 0 {
+			break
+		}
+		end := strings.IndexByte(data[start:], '>')
+		if end < 0 {
+			return nil, errors.New("unterminated tag")
+		}
+		tag := strings.TrimSpace(data[start+1 : start+end])
+		data = data[start+end+1:]
+		value := data
+		if next := strings.IndexByte(data, '<'); next >= 0 {
+			value = data[:next]
+		}
+		value = strings.TrimSpace(value)
+
+		switch {
+		case tag == "" || strings.HasPrefix(tag, "?") || strings.HasPrefix(tag, "!"):
+			continue
+		case strings.HasPrefix(tag, "/"):
+			// Closing an aggregate also closes anything SGML left open inside it; the closing
+			// tag of a leaf matches nothing on the stack and is ignored
+			name := strings.ToUpper(strings.TrimSpace(tag[1:]))
+			for i := len(stack) - 1; i > 0; i-- {
+				if stack[i].name == name {
+					stack = stack[:i]
+					break
+				}
+			}
+		default:
+			name := strings.ToUpper(strings.Fields(strings.TrimSuffix(tag, "/"))[0])
+			node := &ofxNode{name: name}
+			parent := stack[len(stack)-1]
+			parent.children = append(parent.children, node)
+			if value != "" {
+				node.value = html.UnescapeString(value)
+			} else if !strings.HasSuffix(tag, "/") {
+				stack = append(stack, node)
+			}
+		}
+	}
+	if len(root.children) == 0 {
+		return nil, errors.New("no OFX elements found")
+	}
+	return root, nil
+}
+
+// ofxStatement is one account's statement in an OFX file
+type ofxStatement struct {
+	AccountID    string // the ACCTID the institution knows the account by
+	Currency     string // CURDEF, the default currency of its amounts
+	Transactions []ofxTransaction
+}
+
+// ofxTransaction is a transaction of a statement, with the elements the import maps. Kind is
+// the OFX aggregate, such as BUYSTOCK, INCOME or STMTTRN; amounts keep the signs of the file.
+type ofxTransaction struct {
+	Kind           string
+	FITID          string
+	Date           time.Time
+	Name           string
+	Memo           string
+	SecurityID     string
+	Currency       string // the transaction's own currency, when it differs from the statement's
+	TrnType        string // the TRNTYPE of a bank transaction
+	IncomeType     string
+	TransferAction string
+	Units          float64
+	UnitPrice      float64
+	AvgCostBasis   float64
+	Commission     float64
+	Fees           float64
+	Taxes          float64
+	Withholding    float64
+	Total          float64
+	Amount         float64 // the TRNAMT of a bank transaction
+	// Problems are the elements that could not be read
+	Problems []string
+}
+
+// ofxSecurity is an entry of the file's security list
+type ofxSecurity struct {
+	Ticker    string
+	AssetType string
+}
+
+// ofxSecurityAssetTypes maps the security list's info aggregates to asset classes
+var ofxSecurityAssetTypes = map[string]string{
+	"STOCKINFO": models.AssetClassStock,
+	"MFINFO":    models.AssetClassMutualFund,
+	"DEBTINFO":  models.AssetClassBond,
+	"OPTINFO":   models.AssetClassOption,
+}
+
+// ofxDocument is what an OFX file holds for the import
+type ofxDocument struct {
+	Statements []ofxStatement
+	// Securities are keyed by the UNIQUEID of their SECID, such as a CUSIP
+	Securities map[string]ofxSecurity
+}
+
+// parseOFX reads the investment and bank statements and the security list of an OFX or QFX file
+func parseOFX(r io.Reader) (*ofxDocument, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	root, err := parseOFXTree(string(data))
+	if err != nil {
+		return nil, err
+	}
+
+	document := &ofxDocument{Securities: map[string]ofxSecurity{}}
+	for _, info := range root.findAll("SECINFO") {
+		id := info.find("SECID").text("UNIQUEID")
+		if id == "" {
+			continue
+		}
+		document.Securities[id] = ofxSecurity{Ticker: strings.ToUpper(info.text("TICKER"))}
+	}
+	for aggregate, assetType := range ofxSecurityAssetTypes {
+		for _, info := range root.findAll(aggregate) {
+			id := info.find("SECID").text("UNIQUEID")
+			if security, ok := document.Securities[id]; ok {
+				security.AssetType = assetType
+				document.Securities[id] = security
+			}
+		}
+	}
+
+	for _, statement := range append(root.findAll("INVSTMTRS"), root.findAll("STMTRS")...) {
+		account := statement.child("INVACCTFROM")
+		list := statement.child("INVTRANLIST")
+		if account == nil {
+			account = statement.child("BANKACCTFROM")
+			list = statement.child("BANKTRANLIST")
+		}
+		parsed := ofxStatement{
+			AccountID: account.text("ACCTID"),
+			Currency:  strings.ToUpper(statement.text("CURDEF")),
+		}
+		if list != nil {
+			for _, element := range list.children {
+				if element.name == "DTSTART" || element.name == "DTEND" {
+					continue
+				}
+				parsed.Transactions = append(parsed.Transactions, parseOFXTransaction(element))
+			}
+		}
+		document.Statements = append(document.Statements, parsed)
+	}
+	if len(document.Statements) == 0 {
+		return nil, errors.New("no investment or bank statement found")
+	}
+	return document, nil
+}
+
+// parseOFXTransaction reads the elements of a transaction aggregate. Investment transactions
+// nest their identity in INVTRAN and bank transactions within one are wrapped in INVBANKTRAN;
+// both are read the same way since the elements are looked up anywhere inside the aggregate.
+func parseOFXTransaction(element *ofxNode) ofxTransaction {
+	transaction := ofxTransaction{
+		Kind:           element.name,
+		FITID:          element.text("FITID"),
+		Name:           element.text("NAME"),
+		Memo:           element.text("MEMO"),
+		SecurityID:     element.find("SECID").text("UNIQUEID"),
+		TrnType:        strings.ToUpper(element.text("TRNTYPE")),
+		IncomeType:     strings.ToUpper(element.text("INCOMETYPE")),
+		TransferAction: strings.ToUpper(element.text("TFERACTION")),
+	}
+	if element.name == "INVBANKTRAN" {
+		transaction.Kind = "STMTTRN"
+	}
+	if currency := element.child("CURRENCY"); currency != nil {
+		transaction.Currency = strings.ToUpper(currency.text("CURSYM"))
+	} else if currency := element.find("ORIGCURRENCY"); currency != nil {
+		transaction.Currency = strings.ToUpper(currency.text("CURSYM"))
+	}
+
+	dateElement := "DTTRADE"
+	if transaction.Kind == "STMTTRN" {
+		dateElement = "DTPOSTED"
+	}
+	date, err := parseOFXDate(element.text(dateElement))
+	if err != nil {
+		transaction.Problems = append(transaction.Problems, fmt.Sprintf("invalid %s: %v", dateElement, err))
+	}
+	transaction.Date = date
+
+	for _, amount := range []struct {
+		name  string
+		field *float64
+	}{
+		{"UNITS", &transaction.Units},
+		{"UNITPRICE", &transaction.UnitPrice},
+		{"AVGCOSTBASIS", &transaction.AvgCostBasis},
+		{"COMMISSION", &transaction.Commission},
+		{"FEES", &transaction.Fees},
+		{"TAXES", &transaction.Taxes},
+		{"WITHHOLDING", &transaction.Withholding},
+		{"TOTAL", &transaction.Total},
+		{"TRNAMT", &transaction.Amount},
+	} {
+		raw := element.text(amount.name)
+		if raw == "" {
+			continue
+		}
+		number, err := parseOFXAmount(raw)
+		if err != nil {
+			transaction.Problems = append(transaction.Problems, fmt.Sprintf("invalid %s %q", amount.name, raw))
+			continue
+		}
+		*amount.field = number
+	}
+	return transaction
+}
+
+// parseOFXDate reads the date of an OFX datetime such as 20240115, 20240115103000 or
+// 20240115103000.000[-5:EST]. Trades are kept by day, so the time and zone are dropped.
+func parseOFXDate(value string) (time.Time, error) {
+	if len(value) < 8 {
+		return time.Time{}, fmt.Errorf("%q is not YYYYMMDD", value)
+	}
+	date, err := time.Parse("20060102", value[:8])
+	if err != nil {
+		return time.Time{}, fmt.Errorf("%q is not YYYYMMDD", value)
+	}
+	return date, nil
+}
+
+// parseOFXAmount reads an OFX amount, which may use a comma as the decimal separator
+func parseOFXAmount(value string) (float64, error) {
+	value = strings.TrimSpace(value)
+	if !strings.Contains(value, ".") {
+		value = strings.Replace(value, ",", ".", 1)
+	}
+	number, err := strconv.ParseFloat(value, 64)
+	if err != nil || math.IsNaN(number) || math.IsInf(number, 0) {
+		return 0, errors.New("not a number")
+	}
+	return number, nil
+}
@@ -0,0 +1,90 @@
+package services
+
+import (
+	"os"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseOFX(t *testing.T) {
+	day := func(m time.Month, d int) time.Time {
+		return time.Date(2024, m, d, 0, 0, 0, 0, time.UTC)
+	}
+
+	file, err := os.Open("testdata/investment.qfx")
+	assert.NoError(t, err)
+	defer file.Close()
+	document, err := parseOFX(file)
+	assert.NoError(t, err)
+
+	assert.Len(t, document.Statements, 1)
+	statement := document.Statements[0]
+	assert.Equal(t, "U1234567", statement.AccountID)
+	assert.Equal(t, "USD", statement.Currency)
+	assert.Equal(t, map[string]ofxSecurity{
+		"037833100": {Ticker: "AAPL", AssetType: "stock"},
+		"922908363": {Ticker: "VOO", AssetType: "stock"},
+	}, document.Securities)
+
+	transactions := statement.Transactions
+	assert.Len(t, transactions, 8)
+	kinds := []string{}
+	for _, transaction := range transactions {
+		kinds = append(kinds, transaction.Kind)
+		assert.Empty(t, transaction.Problems)
+	}
+	assert.Equal(t, []string{"BUYSTOCK", "SELLSTOCK", "INCOME", "REINVEST", "TRANSFER", "STMTTRN", "STMTTRN", "SPLIT"}, kinds)
+
+	buy := transactions[0]
+	assert.Equal(t, "T-1001", buy.FITID)
+	assert.Equal(t, day(1, 2), buy.Date)
+	assert.Equal(t, "Buy Apple", buy.Memo)
+	assert.Equal(t, "037833100", buy.SecurityID)
+	assert.Equal(t, 10.0, buy.Units)
+	assert.Equal(t, 185.25, buy.UnitPrice)
+	assert.Equal(t, 1.0, buy.Commission)
+	assert.Equal(t, 0.5, buy.Fees)
+
+	assert.Equal(t, -4.0, transactions[1].Units)
+	assert.Equal(t, 0.02, transactions[1].Taxes)
+	assert.Equal(t, "DIV", transactions[2].IncomeType)
+	assert.Equal(t, 0.72, transactions[2].Withholding)
+	assert.Equal(t, "IN", transactions[4].TransferAction)
+	assert.Equal(t, 300.0, transactions[4].AvgCostBasis)
+
+	deposit := transactions[5]
+	assert.Equal(t, "T-1006", deposit.FITID)
+	assert.Equal(t, "CREDIT", deposit.TrnType)
+	assert.Equal(t, day(1, 3), deposit.Date)
+	assert.Equal(t, 5000.0, deposit.Amount)
+	assert.Equal(t, "Wire from checking", deposit.Name)
+
+	file, err = os.Open("testdata/checking.ofx")
+	assert.NoError(t, err)
+	defer file.Close()
+	document, err = parseOFX(file)
+	assert.NoError(t, err)
+
+	assert.Len(t, document.Statements, 1)
+	statement = document.Statements[0]
+	assert.Equal(t, "9876543210", statement.AccountID)
+	assert.Len(t, statement.Transactions, 5)
+	assert.Equal(t, "Payroll", statement.Transactions[0].Name)
+	assert.Equal(t, "February salary", statement.Transactions[0].Memo)
+	assert.Empty(t, statement.Transactions[1].Memo)
+	assert.Equal(t, "B-2002", statement.Transactions[1].FITID)
+	assert.Equal(t, -12.5, statement.Transactions[2].Amount)
+	assert.Equal(t, []string{`invalid DTPOSTED: "20240231" is not YYYYMMDD`}, statement.Transactions[4].Problems)
+}
+
+func TestParseOFXTreeUnescapesValues(t *testing.T) {
+	root, err := parseOFXTree("<SECINFO><SECNAME>S&amp;P 500</SECNAME><TICKER>VOO</SECINFO>")
+	assert.NoError(t, err)
+	assert.Equal(t, "S&P 500", root.text("SECNAME"))
+	assert.Equal(t, "VOO", root.find("SECINFO").text("TICKER"))
+
+	_, err = parseOFXTree("no markup here")
+	assert.Error(t, err)
+}
@@ -0,0 +1,207 @@
+package services
+
+import (
+	"asset-dairy/models"
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+var ErrInvalidOptionSettlement = errors.New("invalid option settlement")
+
+type OptionServiceInterface interface {
+	ListPositions(userID string) ([]models.OptionPosition, error)
+	SettleOption(userID, instrumentID string, req models.OptionSettlementRequest) ([]models.Trade, error)
+}
+
+type OptionService struct {
+	tradeService      TradeServiceInterface
+	holdingService    HoldingServiceInterface
+	instrumentService InstrumentServiceInterface
+}
+
+// NewOptionService creates an OptionService. Positions come from the holdings, contract terms
+// from the instrument catalog, and settlements are recorded as ordinary trades.
+func NewOptionService(tradeService TradeServiceInterface, holdingService HoldingServiceInterface, instrumentService InstrumentServiceInterface) *OptionService {
+	return &OptionService{
+		tradeService:      tradeService,
+		holdingService:    holdingService,
+		instrumentService: instrumentService,
+	}
+}
+
+// ListPositions returns the user's open option positions with their contract terms, soonest
+// expiry first. Options whose catalog entry has no terms only appear among the holdings.
+func (s *OptionService) ListPositions(userID string) ([]models.OptionPosition, error) {
+	holdings, err := s.holdingService.ListHoldings(userID)
+	if err != nil {
+		return nil, err
+	}
+
+	today := truncateToDate(time.Now())
+	positions := []models.OptionPosition{}
+	for _, holding := range holdings {
+		if holding.AssetType != models.AssetClassOption {
+			continue
+		}
+		instrument, err := s.instrumentService.FindInstrument(holding.Ticker, holding.Currency)
+		if err != nil {
+			return nil, err
+		}
+		if instrument == nil || !hasOptionTerms(*instrument) {
+			continue
+		}
+		positions = append(positions, models.OptionPosition{
+			Holding:        holding,
+			InstrumentID:   instrument.ID,
+			Underlying:     *instrument.Underlying,
+			OptionType:     *instrument.OptionType,
+			StrikePrice:    *instrument.StrikePrice,
+			ExpirationDate: *instrument.ExpirationDate,
+			DaysToExpiry:   int(instrument.ExpirationDate.Sub(today).Hours() / 24),
+		})
+	}
+	sort.SliceStable(positions, func(i, j int) bool {
+		return positions[i].ExpirationDate.Before(positions[j].ExpirationDate)
+	})
+	return positions, nil
+}
+
+// SettleOption closes the user's open positions in an option at expiry, in every account or
+// the one requested, storing all the trades or none. Each position is closed at a price of
+// zero; an exercised long or an assigned short also trades the underlying at the strike,
+// buying on a long call or a short put and selling on a long put or a short call. The premium
+// stays a gain or loss of the option and is not folded into the underlying trade. Exercise
+// only applies to long positions and assignment to short ones.
+func (s *OptionService) SettleOption(userID, instrumentID string, req models.OptionSettlementRequest) ([]models.Trade, error) {
+	instrument, err := s.instrumentService.GetInstrument(instrumentID)
+	if err != nil {
+		return nil, err
+	}
+	if !hasOptionTerms(*instrument) {
+		return nil, fmt.Errorf("%w: %s is not an option with contract terms", ErrInvalidOptionSettlement, instrument.Symbol)
+	}
+	date := *instrument.ExpirationDate
+	if req.Date != "" {
+		if date, err = time.Parse("2006-01-02", req.Date); err != nil {
+			return nil, fmt.Errorf("%w: date must be YYYY-MM-DD", ErrInvalidOptionSettlement)
+		}
+	}
+
+	holdingsByAccount, err := s.holdingService.ListAccountHoldings(userID)
+	if err != nil {
+		return nil, err
+	}
+	accountIDs := make([]string, 0, len(holdingsByAccount))
+	for accountID := range holdingsByAccount {
+		if req.AccountID == nil || *req.AccountID == accountID {
+			accountIDs = append(accountIDs, accountID)
+		}
+	}
+	sort.Strings(accountIDs)
+
+	settlements := []models.Trade{}
+	for _, accountID := range accountIDs {
+		quantity := openQuantity(holdingsByAccount[accountID], *instrument)
+		switch {
+		case math.Abs(quantity) < quantityEpsilon:
+			continue
+		case req.Outcome == models.OptionOutcomeExercise && quantity < 0:
+			continue
+		case req.Outcome == models.OptionOutcomeAssign && quantity > 0:
+			continue
+		}
+		trades, err := s.settlementTrades(*instrument, accountID, quantity, date, req.Outcome)
+		if err != nil {
+			return nil, err
+		}
+		settlements = append(settlements, trades...)
+	}
+	if len(settlements) == 0 {
+		return nil, fmt.Errorf("%w: no open %s position to %s", ErrInvalidOptionSettlement, instrument.Symbol, req.Outcome)
+	}
+	// Every account settles in one transaction, so a rejected trade leaves all positions open
+	return s.tradeService.CreateTrades(userID, settlements)
+}
+
+// settlementTrades builds the trades that settle quantity contracts of the option in one
+// account, negative for a short position. The underlying trade comes first, so the delivery
+// is checked before the option it settles is closed.
+func (s *OptionService) settlementTrades(instrument models.Instrument, accountID string, quantity float64, date time.Time, outcome string) ([]models.Trade, error) {
+	long := quantity > 0
+	reason := "Expired worthless"
+	switch outcome {
+	case models.OptionOutcomeExercise:
+		reason = "Exercised " + instrument.Symbol
+	case models.OptionOutcomeAssign:
+		reason = "Assigned " + instrument.Symbol
+	}
+
+	closeType := "buy"
+	if long {
+		closeType = "sell"
+	}
+	closeEffect := models.PositionEffectClose
+	closing := models.Trade{
+		ID:             uuid.New().String(),
+		Type:           closeType,
+		AssetType:      models.AssetClassOption,
+		Ticker:         instrument.Symbol,
+		TradeDate:      date,
+		Quantity:       math.Abs(quantity),
+		Currency:       instrument.Currency,
+		AccountID:      accountID,
+		Reason:         &reason,
+		InstrumentID:   &instrument.ID,
+		PositionEffect: &closeEffect,
+	}
+	if outcome == models.OptionOutcomeExpire {
+		return []models.Trade{closing}, nil
+	}
+
+	deliveryType := "sell"
+	if (*instrument.OptionType == models.OptionTypeCall) == long {
+		deliveryType = "buy"
+	}
+	delivery := models.Trade{
+		ID:        uuid.New().String(),
+		Type:      deliveryType,
+		AssetType: models.AssetClassStock,
+		Ticker:    *instrument.Underlying,
+		TradeDate: date,
+		Quantity:  math.Abs(quantity) * instrument.ContractSize(),
+		Price:     *instrument.StrikePrice,
+		Currency:  instrument.Currency,
+		AccountID: accountID,
+		Reason:    &reason,
+	}
+	// An underlying listed in the catalog supplies its own asset class
+	underlying, err := s.instrumentService.FindInstrument(delivery.Ticker, delivery.Currency)
+	if err != nil {
+		return nil, err
+	}
+	if underlying != nil {
+		delivery.InstrumentID = &underlying.ID
+	}
+	return []models.Trade{delivery, closing}, nil
+}
+
+// openQuantity is the quantity of the instrument among the holdings, negative when short
+func openQuantity(holdings []models.Holding, instrument models.Instrument) float64 {
+	for _, holding := range holdings {
+		if holding.Ticker == instrument.Symbol && holding.Currency == instrument.Currency {
+			return holding.Quantity
+		}
+	}
+	return 0
+}
+
+// hasOptionTerms reports whether the instrument is an option with its contract terms filled in
+func hasOptionTerms(instrument models.Instrument) bool {
+	return instrument.AssetClass == models.AssetClassOption && instrument.Underlying != nil &&
+		instrument.OptionType != nil && instrument.StrikePrice != nil && instrument.ExpirationDate != nil
+}
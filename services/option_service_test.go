@@ -0,0 +1,134 @@
+package services
+
+import (
+	"asset-dairy/models"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+func TestSettleOption(t *testing.T) {
+	expiry := time.Date(2024, 6, 21, 0, 0, 0, 0, time.UTC)
+	underlying, strike := "AAPL", 200.0
+	optionInstrument := func(optionType string) *models.Instrument {
+		return &models.Instrument{
+			ID: "opt-1", Symbol: "AAPL240621C00200000", AssetClass: models.AssetClassOption, Currency: "USD",
+			Underlying: &underlying, OptionType: &optionType, StrikePrice: &strike, ExpirationDate: &expiry,
+		}
+	}
+	tests := []struct {
+		name           string
+		optionType     string
+		quantity       float64
+		otherQuantity  float64
+		outcome        string
+		expectedTrades []models.Trade
+		expectedError  error
+	}{
+		{
+			name:       "exercised long call should buy the underlying at the strike and close the option",
+			optionType: models.OptionTypeCall,
+			quantity:   2,
+			outcome:    models.OptionOutcomeExercise,
+			expectedTrades: []models.Trade{
+				{Type: "buy", AssetType: "stock", Ticker: "AAPL", Quantity: 200, Price: 200, AccountID: "acc-1"},
+				{Type: "sell", AssetType: "option", Ticker: "AAPL240621C00200000", Quantity: 2, AccountID: "acc-1"},
+			},
+		},
+		{
+			name:          "exercise should leave a short position in another account open",
+			optionType:    models.OptionTypeCall,
+			quantity:      2,
+			otherQuantity: -1,
+			outcome:       models.OptionOutcomeExercise,
+			expectedTrades: []models.Trade{
+				{Type: "buy", AssetType: "stock", Ticker: "AAPL", Quantity: 200, Price: 200, AccountID: "acc-1"},
+				{Type: "sell", AssetType: "option", Ticker: "AAPL240621C00200000", Quantity: 2, AccountID: "acc-1"},
+			},
+		},
+		{
+			name:          "worthless expiry should close the positions of every account together",
+			optionType:    models.OptionTypeCall,
+			quantity:      2,
+			otherQuantity: -1,
+			outcome:       models.OptionOutcomeExpire,
+			expectedTrades: []models.Trade{
+				{Type: "sell", AssetType: "option", Ticker: "AAPL240621C00200000", Quantity: 2, AccountID: "acc-1"},
+				{Type: "buy", AssetType: "option", Ticker: "AAPL240621C00200000", Quantity: 1, AccountID: "acc-2"},
+			},
+		},
+		{
+			name:       "assigned short put should buy the underlying at the strike and close the option",
+			optionType: models.OptionTypePut,
+			quantity:   -1,
+			outcome:    models.OptionOutcomeAssign,
+			expectedTrades: []models.Trade{
+				{Type: "buy", AssetType: "stock", Ticker: "AAPL", Quantity: 100, Price: 200, AccountID: "acc-1"},
+				{Type: "buy", AssetType: "option", Ticker: "AAPL240621C00200000", Quantity: 1, AccountID: "acc-1"},
+			},
+		},
+		{
+			name:       "worthless expiry should only close the option at zero",
+			optionType: models.OptionTypeCall,
+			quantity:   -3,
+			outcome:    models.OptionOutcomeExpire,
+			expectedTrades: []models.Trade{
+				{Type: "buy", AssetType: "option", Ticker: "AAPL240621C00200000", Quantity: 3, AccountID: "acc-1"},
+			},
+		},
+		{
+			name:          "short position cannot be exercised",
+			optionType:    models.OptionTypeCall,
+			quantity:      -1,
+			outcome:       models.OptionOutcomeExercise,
+			expectedError: ErrInvalidOptionSettlement,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			instrument := optionInstrument(tt.optionType)
+			mockInstrumentService := new(MockInstrumentService)
+			mockInstrumentService.On("GetInstrument", "opt-1").Return(instrument, nil)
+			mockInstrumentService.On("FindInstrument", mock.Anything, mock.Anything).Return(nil, nil)
+			mockHoldingService := new(MockHoldingService)
+			mockHoldingService.On("ListAccountHoldings", "test-user").Return(map[string][]models.Holding{
+				"acc-1": {{Ticker: instrument.Symbol, Quantity: tt.quantity, AssetType: models.AssetClassOption, Currency: "USD", Multiplier: 100}},
+				"acc-2": {{Ticker: instrument.Symbol, Quantity: tt.otherQuantity, AssetType: models.AssetClassOption, Currency: "USD", Multiplier: 100}},
+			}, nil)
+			mockTradeService := new(MockTradeService)
+			mockTradeService.On("CreateTrades", "test-user", mock.Anything).Return(func(userID string, trades []models.Trade) []models.Trade {
+				return trades
+			}, nil)
+
+			service := NewOptionService(mockTradeService, mockHoldingService, mockInstrumentService)
+
+			created, err := service.SettleOption("test-user", "opt-1", models.OptionSettlementRequest{Outcome: tt.outcome})
+
+			if tt.expectedError != nil {
+				assert.True(t, errors.Is(err, tt.expectedError), "expected %v, got %v", tt.expectedError, err)
+				mockTradeService.AssertNotCalled(t, "CreateTrades", "test-user", mock.Anything)
+				return
+			}
+			assert.NoError(t, err)
+			mockTradeService.AssertNumberOfCalls(t, "CreateTrades", 1)
+			assert.Len(t, created, len(tt.expectedTrades))
+			for i, expected := range tt.expectedTrades {
+				trade := created[i]
+				assert.Equal(t, expected.Type, trade.Type)
+				assert.Equal(t, expected.AssetType, trade.AssetType)
+				assert.Equal(t, expected.Ticker, trade.Ticker)
+				assert.Equal(t, expected.Quantity, trade.Quantity)
+				assert.Equal(t, expected.Price, trade.Price)
+				assert.Equal(t, expiry, trade.TradeDate)
+				assert.Equal(t, expected.AccountID, trade.AccountID)
+				if trade.AssetType == models.AssetClassOption {
+					assert.Equal(t, models.PositionEffectClose, *trade.PositionEffect)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,110 @@
+package services
+
+import (
+	"math"
+	"time"
+)
+
+const moneyEpsilon = 1e-9
+
+// valuationDay is the value of a portfolio or account at the end of a day, and the net
+// external flow into it during that day
+type valuationDay struct {
+	date  time.Time
+	value float64
+	flow  float64
+}
+
+// cashFlow is money paid (negative) or received (positive) by the investor
+type cashFlow struct {
+	date   time.Time
+	amount float64
+}
+
+// timeWeightedReturn chains the daily returns of a valuation series whose first day is the
+// starting value. A net inflow is treated as arriving at the start of its day, so it earns
+// that day's return; a net outflow leaves at the end of the day, after earning it. ok is
+// false when nothing was ever invested.
+func timeWeightedReturn(days []valuationDay) (float64, bool) {
+	growth := 1.0
+	invested := false
+	for i := 1; i < len(days); i++ {
+		base, end := days[i-1].value, days[i].value
+		if days[i].flow > 0 {
+			base += days[i].flow
+		} else {
+			end -= days[i].flow
+		}
+		if math.Abs(base) < moneyEpsilon {
+			continue
+		}
+		invested = true
+		growth *= end / base
+	}
+	return growth - 1, invested
+}
+
+// moneyWeightedFlows turns a valuation series into investor cash flows: the starting value
+// and every inflow are paid in, outflows and the ending value are received
+func moneyWeightedFlows(days []valuationDay) []cashFlow {
+	if len(days) == 0 {
+		return nil
+	}
+	flows := []cashFlow{{date: days[0].date, amount: -days[0].value}}
+	for _, day := range days[1:] {
+		if day.flow != 0 {
+			flows = append(flows, cashFlow{date: day.date, amount: -day.flow})
+		}
+	}
+	last := days[len(days)-1]
+	return append(flows, cashFlow{date: last.date, amount: last.value})
+}
+
+// xirr finds the annualized rate at which the flows have a net present value of zero.
+// ok is false when the flows do not both pay in and pay out, or no rate is found.
+func xirr(flows []cashFlow) (float64, bool) {
+	var hasIn, hasOut bool
+	for _, flow := range flows {
+		if flow.amount < -moneyEpsilon {
+			hasIn = true
+		}
+		if flow.amount > moneyEpsilon {
+			hasOut = true
+		}
+	}
+	if !hasIn || !hasOut {
+		return 0, false
+	}
+
+	start := flows[0].date
+	npv := func(rate float64) float64 {
+		var total float64
+		for _, flow := range flows {
+			years := flow.date.Sub(start).Hours() / 24 / 365
+			total += flow.amount / math.Pow(1+rate, years)
+		}
+		return total
+	}
+
+	// Bisect between a near total loss and an ever higher upper bound until the sign changes
+	low, high := -0.999999, 1.0
+	for npv(low)*npv(high) > 0 {
+		high *= 2
+		if high > 1e6 {
+			return 0, false
+		}
+	}
+	for i := 0; i < 200; i++ {
+		mid := (low + high) / 2
+		value := npv(mid)
+		if math.Abs(value) < moneyEpsilon || high-low < 1e-12 {
+			return mid, true
+		}
+		if npv(low)*value < 0 {
+			high = mid
+		} else {
+			low = mid
+		}
+	}
+	return (low + high) / 2, true
+}
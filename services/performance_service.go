@@ -0,0 +1,515 @@
+package services
+
+import (
+	"asset-dairy/models"
+	"errors"
+	"fmt"
+	"math"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+var (
+	ErrInvalidPerformancePeriod = errors.New("invalid performance period")
+)
+
+type PerformanceServiceInterface interface {
+	GetPerformance(userID, currency, period string, from, to time.Time) (*models.PerformanceReport, error)
+	DailyValuations(userID, currency string, from, to time.Time) ([]models.PortfolioSnapshot, error)
+}
+
+type PerformanceService struct {
+	tradeService        TradeServiceInterface
+	accountService      AccountServiceInterface
+	profileService      ProfileServiceInterface
+	priceHistoryService PriceHistoryServiceInterface
+	fxService           FxServiceInterface
+	cashLedgerService   CashLedgerServiceInterface
+	incomeService       IncomeServiceInterface
+	actionService       CorporateActionServiceInterface
+}
+
+func NewPerformanceService(tradeService TradeServiceInterface, accountService AccountServiceInterface, profileService ProfileServiceInterface, priceHistoryService PriceHistoryServiceInterface, fxService FxServiceInterface, cashLedgerService CashLedgerServiceInterface, incomeService IncomeServiceInterface, actionService CorporateActionServiceInterface) *PerformanceService {
+	return &PerformanceService{
+		tradeService:        tradeService,
+		accountService:      accountService,
+		profileService:      profileService,
+		priceHistoryService: priceHistoryService,
+		fxService:           fxService,
+		cashLedgerService:   cashLedgerService,
+		incomeService:       incomeService,
+		actionService:       actionService,
+	}
+}
+
+// performancePosition tracks one ticker in one account while the trades are replayed
+type performancePosition struct {
+	accountID string
+	ticker    string
+	currency  string
+	quantity  float64
+	mark      float64 // last trade price, used on days without a stored close
+	// multiplier is the contract size the first trade was recorded with
+	multiplier float64
+}
+
+// applyAction adjusts the position for a corporate action on its ticker. Symbol changes,
+// mergers and spin-offs move quantity into target, the position of the new ticker in the same
+// account. It returns the cash paid in the position's currency, by a merger or in lieu of
+// fractional shares.
+func (p *performancePosition) applyAction(action models.CorporateAction, target *performancePosition) float64 {
+	ratio := action.Ratio()
+	switch action.Type {
+	case models.CorporateActionSplit:
+		p.quantity *= ratio
+		p.mark /= ratio
+		return p.payCashInLieu(action)
+	case models.CorporateActionSymbolChange, models.CorporateActionMerger:
+		cash := p.quantity * action.Cash() * p.multiplier
+		if target != nil && ratio > 0 {
+			target.multiplier = p.multiplier
+			target.quantity += p.quantity * ratio
+			if target.mark == 0 {
+				target.mark = p.mark * action.CarriedBasis() / ratio
+			}
+			cash += target.payCashInLieu(action)
+		}
+		p.quantity = 0
+		return cash
+	case models.CorporateActionSpinOff:
+		if target != nil && ratio > 0 {
+			target.multiplier = p.multiplier
+			target.quantity += p.quantity * ratio
+			if target.mark == 0 {
+				target.mark = p.mark * action.CarriedBasis() / ratio
+			}
+			p.mark *= 1 - action.CarriedBasis()
+			return target.payCashInLieu(action)
+		}
+	}
+	return 0
+}
+
+// payCashInLieu removes the fractional share an action leaves in a long position and returns
+// the cash paid for it, as the lot matcher does
+func (p *performancePosition) payCashInLieu(action models.CorporateAction) float64 {
+	if action.CashInLieuPrice == nil || p.quantity <= quantityEpsilon {
+		return 0
+	}
+	fraction := p.quantity - math.Floor(p.quantity+quantityEpsilon)
+	if fraction <= quantityEpsilon {
+		return 0
+	}
+	p.quantity -= fraction
+	return fraction * *action.CashInLieuPrice * p.multiplier
+}
+
+// GetPerformance computes time-weighted and money-weighted returns for the portfolio and each
+// account. A named period (MTD, QTD, YTD, 1Y, inception) takes precedence over from and to.
+// Positions are valued at the stored daily close, or at their last trade price when there is
+// none, and converted into the reporting currency at the rates known on each day. Cash
+// balances from the ledger are part of each account's value; deposits, withdrawals, transfers
+// and balance adjustments are the external flows. Trades recorded before the ledger existed
+// have no settlement entry, so for those buys count as money flowing in and sells as money
+// flowing out. Units received as stock dividends or staking rewards join their positions
+// without being a flow.
+func (s *PerformanceService) GetPerformance(userID, currency, period string, from, to time.Time) (*models.PerformanceReport, error) {
+	currency, err := reportingCurrency(s.profileService, s.fxService, userID, currency)
+	if err != nil {
+		return nil, err
+	}
+	trades, received, err := s.listTrades(userID)
+	if err != nil {
+		return nil, err
+	}
+	entries, err := s.cashLedgerService.ListUserEntries(userID)
+	if err != nil {
+		return nil, err
+	}
+	accounts, err := s.accountService.ListAccounts(userID)
+	if err != nil {
+		return nil, err
+	}
+
+	inception := truncateToDate(time.Now())
+	if len(trades) > 0 {
+		inception = truncateToDate(trades[0].TradeDate)
+	}
+	if len(entries) > 0 && truncateToDate(entries[0].EntryDate).Before(inception) {
+		inception = truncateToDate(entries[0].EntryDate)
+	}
+	from, to, err = performanceRange(period, from, to, inception, truncateToDate(time.Now()))
+	if err != nil {
+		return nil, err
+	}
+
+	// The day before the range supplies the starting value
+	portfolioDays, accountDays, missing, err := s.replay(trades, received, entries, currency, from.AddDate(0, 0, -1), to)
+	if err != nil {
+		return nil, err
+	}
+
+	report := &models.PerformanceReport{
+		Currency:          currency,
+		Period:            period,
+		From:              from,
+		To:                to,
+		Accounts:          []models.PerformanceResult{},
+		MissingCurrencies: missing.sorted(),
+	}
+	report.Portfolio = performanceResult(portfolioDays)
+	for _, acc := range accounts {
+		days, ok := accountDays[acc.ID]
+		if !ok {
+			days = emptyValuationSeries(from.AddDate(0, 0, -1), to)
+		}
+		result := performanceResult(days)
+		result.AccountID = acc.ID
+		result.Name = acc.Name
+		report.Accounts = append(report.Accounts, result)
+	}
+	return report, nil
+}
+
+// DailyValuations returns one portfolio snapshot and one snapshot per active account for each
+// day from from to to, valued the same way as GetPerformance
+func (s *PerformanceService) DailyValuations(userID, currency string, from, to time.Time) ([]models.PortfolioSnapshot, error) {
+	currency, err := reportingCurrency(s.profileService, s.fxService, userID, currency)
+	if err != nil {
+		return nil, err
+	}
+	trades, received, err := s.listTrades(userID)
+	if err != nil {
+		return nil, err
+	}
+	entries, err := s.cashLedgerService.ListUserEntries(userID)
+	if err != nil {
+		return nil, err
+	}
+	from, to = truncateToDate(from), truncateToDate(to)
+	portfolioDays, accountDays, _, err := s.replay(trades, received, entries, currency, from.AddDate(0, 0, -1), to)
+	if err != nil {
+		return nil, err
+	}
+
+	snapshots := []models.PortfolioSnapshot{}
+	appendDays := func(accountID *string, days []valuationDay) {
+		for _, day := range days[1:] {
+			snapshots = append(snapshots, models.PortfolioSnapshot{
+				ID:        uuid.New().String(),
+				UserID:    userID,
+				AccountID: accountID,
+				Date:      day.date,
+				Currency:  currency,
+				Value:     day.value,
+				NetFlow:   day.flow,
+			})
+		}
+	}
+	appendDays(nil, portfolioDays)
+	for accountID, days := range accountDays {
+		id := accountID
+		appendDays(&id, days)
+	}
+	return snapshots, nil
+}
+
+// listTrades returns the user's trades, sorted, and buys of the units they received as income
+func (s *PerformanceService) listTrades(userID string) ([]models.Trade, []models.Trade, error) {
+	trades, err := s.tradeService.ListTrades(userID)
+	if err != nil {
+		return nil, nil, err
+	}
+	events, err := s.incomeService.ListEvents(userID, 0, "")
+	if err != nil {
+		return nil, nil, err
+	}
+	received, err := receivedUnitTrades(s.fxService, trades, events)
+	if err != nil {
+		return nil, nil, err
+	}
+	return sortTrades(trades), received, nil
+}
+
+// replay values the sorted trades, the units received as income and the ledger entries day by
+// day from start to end in the reporting currency
+func (s *PerformanceService) replay(trades, received []models.Trade, entries []models.CashLedgerEntry, currency string, start, end time.Time) ([]valuationDay, map[string][]valuationDay, currencySet, error) {
+	converters, err := s.fxService.DailyConverters(start, end)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	actions, err := s.actionService.ListActions("")
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	tickers := make([]string, 0, len(trades))
+	for _, trade := range trades {
+		tickers = append(tickers, trade.Ticker)
+	}
+	for _, trade := range received {
+		tickers = append(tickers, trade.Ticker)
+	}
+	for _, action := range actions {
+		if action.NewTicker != nil {
+			tickers = append(tickers, *action.NewTicker)
+		}
+	}
+	closes, err := s.dailyCloses(tickers, start, end)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	missing := newCurrencySet()
+	portfolioDays, accountDays := valuationSeries(trades, received, entries, actions, closes, converters, currency, start, end, missing)
+	return portfolioDays, accountDays, missing, nil
+}
+
+// dailyCloses loads the gap-filled closes of the given tickers, keyed by ticker and currency
+func (s *PerformanceService) dailyCloses(tickers []string, from, to time.Time) (map[string]map[time.Time]float64, error) {
+	closes := make(map[string]map[time.Time]float64)
+	loaded := make(map[string]bool)
+	for _, ticker := range tickers {
+		ticker = strings.ToUpper(ticker)
+		if loaded[ticker] {
+			continue
+		}
+		loaded[ticker] = true
+		series, err := s.priceHistoryService.GetSeries(ticker, from, to)
+		if err != nil {
+			return nil, err
+		}
+		byDate := make(map[time.Time]float64, len(series.Points))
+		for _, point := range series.Points {
+			byDate[truncateToDate(point.Date)] = point.Close
+		}
+		closes[ticker+"_"+strings.ToUpper(series.Currency)] = byDate
+	}
+	return closes, nil
+}
+
+// valuationSeries replays the sorted trades, the units received as income, ledger entries and
+// corporate actions day by day from start to end, converting each day with that day's rates.
+// It returns the portfolio series and one series per account that has trades or cash.
+func valuationSeries(trades, received []models.Trade, entries []models.CashLedgerEntry, actions []models.CorporateAction, closes map[string]map[time.Time]float64, converters map[time.Time]*FxConverter, currency string, start, end time.Time, missing currencySet) ([]valuationDay, map[string][]valuationDay) {
+	positions := make(map[string]*performancePosition)
+	keys := []string{}
+	cash := make(map[string]map[string]float64) // account ID to currency to balance
+	portfolioDays := []valuationDay{}
+	accountDays := make(map[string][]valuationDay)
+	nextTrade, nextEntry, nextAction := 0, 0, 0
+
+	// A trade settled through the ledger only moves value between cash and the position, so
+	// neither the trade nor its settlement entry is a flow. Cash an action paid that the ledger
+	// holds for an account is counted through its entry rather than again from the action.
+	settled := make(map[string]bool)
+	paidOut := make(map[string]bool)
+	for _, entry := range entries {
+		if entry.TradeID != nil {
+			settled[*entry.TradeID] = true
+		}
+		if entry.CorporateActionID != nil {
+			paidOut[*entry.CorporateActionID+"_"+entry.AccountID] = true
+		}
+	}
+	// Units received as income are a return on the position, not money paid into it
+	for _, trade := range received {
+		settled[trade.ID] = true
+	}
+	trades = sortTrades(append(append([]models.Trade(nil), trades...), received...))
+	openAccount := func(accountID string, date time.Time) {
+		if _, ok := accountDays[accountID]; !ok {
+			accountDays[accountID] = emptyValuationSeries(start, date.AddDate(0, 0, -1))
+		}
+	}
+	position := func(accountID, ticker, tradeCurrency string, date time.Time) *performancePosition {
+		key := accountID + "_" + strings.ToUpper(ticker) + "_" + strings.ToUpper(tradeCurrency)
+		pos, ok := positions[key]
+		if !ok {
+			pos = &performancePosition{
+				accountID:  accountID,
+				ticker:     strings.ToUpper(ticker),
+				currency:   strings.ToUpper(tradeCurrency),
+				multiplier: 1,
+			}
+			positions[key] = pos
+			keys = append(keys, key)
+			openAccount(accountID, date)
+		}
+		return pos
+	}
+
+	for date, index := start, 0; !date.After(end); date, index = date.AddDate(0, 0, 1), index+1 {
+		converter := converters[date]
+		flows := make(map[string]float64)
+		for ; nextAction < len(actions) && !truncateToDate(actions[nextAction].EffectiveDate).After(date); nextAction++ {
+			action := actions[nextAction]
+			for _, key := range append([]string(nil), keys...) {
+				pos := positions[key]
+				if !strings.EqualFold(pos.ticker, action.Ticker) {
+					continue
+				}
+				var target *performancePosition
+				if action.NewTicker != nil {
+					target = position(pos.accountID, *action.NewTicker, pos.currency, date)
+				}
+				// Cash paid by the action stays in the account without being a flow
+				paid := pos.applyAction(action, target)
+				if paidOut[action.ID+"_"+pos.accountID] {
+					paid = 0
+				}
+				if paid != 0 {
+					if _, ok := cash[pos.accountID]; !ok {
+						cash[pos.accountID] = make(map[string]float64)
+					}
+					cash[pos.accountID][pos.currency] += paid
+				}
+			}
+		}
+		for ; nextTrade < len(trades) && !truncateToDate(trades[nextTrade].TradeDate).After(date); nextTrade++ {
+			trade := trades[nextTrade]
+			pos := position(trade.AccountID, trade.Ticker, trade.Currency, date)
+			if pos.quantity == 0 {
+				pos.multiplier = trade.ContractSize()
+			}
+			quantity := trade.Quantity
+			if trade.Type == "sell" {
+				quantity = -quantity
+			}
+			pos.quantity += quantity
+			pos.mark = trade.Price
+
+			// Trades up to the day before the range only build the starting positions
+			if index == 0 || settled[trade.ID] {
+				continue
+			}
+			rate, ok, _ := conversionRate(converter, pos.currency, currency, missing)
+			if ok {
+				flows[trade.AccountID] += quantity * trade.Price * pos.multiplier * rate
+			}
+		}
+		for ; nextEntry < len(entries) && !truncateToDate(entries[nextEntry].EntryDate).After(date); nextEntry++ {
+			entry := entries[nextEntry]
+			entryCurrency := strings.ToUpper(entry.Currency)
+			if _, ok := cash[entry.AccountID]; !ok {
+				cash[entry.AccountID] = make(map[string]float64)
+				openAccount(entry.AccountID, date)
+			}
+			cash[entry.AccountID][entryCurrency] += entry.Amount
+
+			if index == 0 || !entry.IsExternalFlow() {
+				continue
+			}
+			rate, ok, _ := conversionRate(converter, entryCurrency, currency, missing)
+			if ok {
+				flows[entry.AccountID] += entry.Amount * rate
+			}
+		}
+
+		values := make(map[string]float64)
+		for _, key := range keys {
+			pos := positions[key]
+			if pos.quantity > -quantityEpsilon && pos.quantity < quantityEpsilon {
+				continue
+			}
+			rate, ok, _ := conversionRate(converter, pos.currency, currency, missing)
+			if !ok {
+				continue
+			}
+			price := pos.mark
+			if close, ok := closes[pos.ticker+"_"+pos.currency][date]; ok {
+				price = close
+			}
+			values[pos.accountID] += pos.quantity * price * pos.multiplier * rate
+		}
+		for accountID, balances := range cash {
+			for balanceCurrency, balance := range balances {
+				rate, ok, _ := conversionRate(converter, balanceCurrency, currency, missing)
+				if ok {
+					values[accountID] += balance * rate
+				}
+			}
+		}
+
+		portfolioDay := valuationDay{date: date}
+		for accountID := range accountDays {
+			day := valuationDay{date: date, value: values[accountID], flow: flows[accountID]}
+			accountDays[accountID] = append(accountDays[accountID], day)
+			portfolioDay.value += day.value
+			portfolioDay.flow += day.flow
+		}
+		portfolioDays = append(portfolioDays, portfolioDay)
+	}
+	return portfolioDays, accountDays
+}
+
+// emptyValuationSeries returns zero-valued days from start to end
+func emptyValuationSeries(start, end time.Time) []valuationDay {
+	days := []valuationDay{}
+	for date := start; !date.After(end); date = date.AddDate(0, 0, 1) {
+		days = append(days, valuationDay{date: date})
+	}
+	return days
+}
+
+// performanceResult summarizes a valuation series whose first day is the starting value
+func performanceResult(days []valuationDay) models.PerformanceResult {
+	var result models.PerformanceResult
+	if len(days) == 0 {
+		return result
+	}
+	result.StartValue = days[0].value
+	result.EndValue = days[len(days)-1].value
+	for _, day := range days[1:] {
+		result.NetFlows += day.flow
+	}
+	result.Gain = result.EndValue - result.StartValue - result.NetFlows
+
+	if twr, ok := timeWeightedReturn(days); ok {
+		percent := twr * 100
+		result.TimeWeightedReturnPercent = &percent
+	}
+	if irr, ok := xirr(moneyWeightedFlows(days)); ok {
+		percent := irr * 100
+		result.MoneyWeightedReturnPercent = &percent
+	}
+	return result
+}
+
+// performanceRange resolves a named period, or validates a custom range when period is empty
+func performanceRange(period string, from, to, inception, today time.Time) (time.Time, time.Time, error) {
+	if period == "" {
+		if from.IsZero() {
+			return from, to, fmt.Errorf("%w: from or period is required", ErrInvalidPerformancePeriod)
+		}
+		if to.IsZero() || to.After(today) {
+			to = today
+		}
+		from, to = truncateToDate(from), truncateToDate(to)
+		if from.After(to) {
+			return from, to, fmt.Errorf("%w: from must not be after to", ErrInvalidPerformancePeriod)
+		}
+		return from, to, nil
+	}
+
+	to = today
+	switch strings.ToUpper(period) {
+	case models.PerformancePeriodMTD:
+		from = time.Date(today.Year(), today.Month(), 1, 0, 0, 0, 0, time.UTC)
+	case models.PerformancePeriodQTD:
+		quarterStart := time.Month((int(today.Month())-1)/3*3 + 1)
+		from = time.Date(today.Year(), quarterStart, 1, 0, 0, 0, 0, time.UTC)
+	case models.PerformancePeriodYTD:
+		from = time.Date(today.Year(), time.January, 1, 0, 0, 0, 0, time.UTC)
+	case models.PerformancePeriod1Y:
+		from = today.AddDate(-1, 0, 1)
+	case strings.ToUpper(models.PerformancePeriodInception):
+		from = inception
+	default:
+		return from, to, fmt.Errorf("%w: %s", ErrInvalidPerformancePeriod, period)
+	}
+	if from.After(to) {
+		from = to
+	}
+	return from, to, nil
+}
@@ -0,0 +1,277 @@
+package services
+
+import (
+	"asset-dairy/models"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTimeWeightedReturn(t *testing.T) {
+	day := func(d int) time.Time { return time.Date(2024, 1, d, 0, 0, 0, 0, time.UTC) }
+	tests := []struct {
+		name           string
+		days           []valuationDay
+		expectedReturn float64
+		expectedOK     bool
+	}{
+		{
+			name: "timing of flows should not change the return",
+			days: []valuationDay{
+				{date: day(1), value: 0},
+				{date: day(2), value: 110, flow: 100},
+				{date: day(3), value: 231, flow: 100},
+			},
+			expectedReturn: 0.21,
+			expectedOK:     true,
+		},
+		{
+			name: "withdrawal should not count as a loss",
+			days: []valuationDay{
+				{date: day(1), value: 100},
+				{date: day(2), value: 60, flow: -50},
+			},
+			expectedReturn: 0.10,
+			expectedOK:     true,
+		},
+		{
+			name: "nothing invested should have no return",
+			days: []valuationDay{
+				{date: day(1), value: 0},
+				{date: day(2), value: 0},
+			},
+			expectedOK: false,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			twr, ok := timeWeightedReturn(tt.days)
+
+			assert.Equal(t, tt.expectedOK, ok)
+			assert.InDelta(t, tt.expectedReturn, twr, 1e-9)
+		})
+	}
+}
+
+func TestXirr(t *testing.T) {
+	year := func(y int) time.Time { return time.Date(y, 1, 1, 0, 0, 0, 0, time.UTC) }
+	tests := []struct {
+		name         string
+		flows        []cashFlow
+		expectedRate float64
+		expectedOK   bool
+	}{
+		{
+			name:         "single investment should be annualized",
+			flows:        []cashFlow{{date: year(2023), amount: -1000}, {date: year(2024), amount: 1100}},
+			expectedRate: 0.10,
+			expectedOK:   true,
+		},
+		{
+			name:         "loss should give a negative rate",
+			flows:        []cashFlow{{date: year(2023), amount: -1000}, {date: year(2024), amount: 800}},
+			expectedRate: -0.20,
+			expectedOK:   true,
+		},
+		{
+			name:       "money only paid out should have no rate",
+			flows:      []cashFlow{{date: year(2024), amount: 100}},
+			expectedOK: false,
+		},
+		{
+			name:       "money only paid in should have no rate",
+			flows:      []cashFlow{{date: year(2023), amount: -100}, {date: year(2024), amount: -100}},
+			expectedOK: false,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			irr, ok := xirr(tt.flows)
+
+			assert.Equal(t, tt.expectedOK, ok)
+			if tt.expectedOK {
+				assert.InDelta(t, tt.expectedRate, irr, 1e-6)
+			}
+		})
+	}
+}
+
+func TestValuationSeries(t *testing.T) {
+	day := func(d int) time.Time { return time.Date(2024, 1, d, 0, 0, 0, 0, time.UTC) }
+	actionID, tradeID, inLieuPrice := "ca1", "t1", 400.0
+	newTicker, cashPerShare, basis := "ABC", 20.0, 50.0
+	buy := func(ticker string) models.Trade {
+		return models.Trade{ID: tradeID, AccountID: "acc1", Type: "buy", Ticker: ticker, Currency: "USD", Quantity: 10, Price: 100, TradeDate: day(2)}
+	}
+	// A one-for-four reverse split leaves 2.5 shares, half a share paid out at 400
+	reverseSplit := models.CorporateAction{ID: actionID, Ticker: "XYZ", Type: models.CorporateActionSplit, EffectiveDate: day(3), NewShares: 1, OldShares: 4, CashInLieuPrice: &inLieuPrice}
+	merger := models.CorporateAction{ID: actionID, Ticker: "XYZ", Type: models.CorporateActionMerger, EffectiveDate: day(3), NewTicker: &newTicker, NewShares: 1, OldShares: 2, CashPerShare: &cashPerShare, CostBasisPercent: &basis}
+	settledThroughLedger := func(paid float64) []models.CashLedgerEntry {
+		return []models.CashLedgerEntry{
+			{AccountID: "acc1", Type: models.CashEntryDeposit, Amount: 1000, Currency: "USD", EntryDate: day(2)},
+			{AccountID: "acc1", Type: models.CashEntryTrade, Amount: -1000, Currency: "USD", TradeID: &tradeID, EntryDate: day(2)},
+			{AccountID: "acc1", Type: models.CashEntryCorporateAction, Amount: paid, Currency: "USD", CorporateActionID: &actionID, EntryDate: day(3)},
+		}
+	}
+	splitCloses := map[string]map[time.Time]float64{"XYZ_USD": {day(3): 400, day(4): 420}}
+	mergerCloses := map[string]map[time.Time]float64{"XYZ_USD": {day(2): 100}, "ABC_USD": {day(3): 170, day(4): 180}}
+	tests := []struct {
+		name           string
+		trades         []models.Trade
+		received       []models.Trade
+		entries        []models.CashLedgerEntry
+		actions        []models.CorporateAction
+		closes         map[string]map[time.Time]float64
+		rates          map[time.Time]float64
+		expectedValues []float64
+		expectedFlows  []float64
+		expectedGain   float64
+	}{
+		{
+			name: "positions should be valued at closes with trades as flows",
+			trades: []models.Trade{
+				buy("AAPL"),
+				{ID: "t2", AccountID: "acc1", Type: "sell", Ticker: "AAPL", Currency: "USD", Quantity: 5, Price: 120, TradeDate: day(4)},
+			},
+			closes:         map[string]map[time.Time]float64{"AAPL_USD": {day(3): 110, day(4): 120}},
+			expectedValues: []float64{0, 1000, 1100, 600},
+			expectedFlows:  []float64{0, 1000, 0, -600},
+			expectedGain:   200,
+		},
+		{
+			name: "received units should join the position without being a flow",
+			trades: []models.Trade{
+				buy("AAPL"),
+				{ID: "t2", AccountID: "acc1", Type: "sell", Ticker: "AAPL", Currency: "USD", Quantity: 12, Price: 120, TradeDate: day(4)},
+			},
+			received:       []models.Trade{{ID: "ie1", AccountID: "acc1", Type: "buy", Ticker: "AAPL", Currency: "USD", Quantity: 2, Price: 110, TradeDate: day(3)}},
+			closes:         map[string]map[time.Time]float64{"AAPL_USD": {day(3): 110, day(4): 120}},
+			expectedValues: []float64{0, 1000, 1320, 0},
+			expectedFlows:  []float64{0, 1000, 0, -1440},
+			expectedGain:   440,
+		},
+		{
+			name:           "positions should be converted at each day's rate",
+			trades:         []models.Trade{{ID: tradeID, AccountID: "acc1", Type: "buy", Ticker: "SAP", Currency: "EUR", Quantity: 10, Price: 100, TradeDate: day(2)}},
+			closes:         map[string]map[time.Time]float64{"SAP_EUR": {day(3): 100, day(4): 100}},
+			rates:          map[time.Time]float64{day(1): 1.1, day(2): 1.1, day(3): 1.1, day(4): 1.2},
+			expectedValues: []float64{0, 1100, 1100, 1200},
+			expectedFlows:  []float64{0, 1100, 0, 0},
+			expectedGain:   100,
+		},
+		{
+			name:   "cash should be valued and only external cash should be a flow",
+			trades: []models.Trade{buy("AAPL")},
+			entries: []models.CashLedgerEntry{
+				{AccountID: "acc1", Type: models.CashEntryDeposit, Amount: 1500, Currency: "USD", EntryDate: day(2)},
+				{AccountID: "acc1", Type: models.CashEntryTrade, Amount: -1000, Currency: "USD", TradeID: &tradeID, EntryDate: day(2)},
+				{AccountID: "acc1", Type: models.CashEntryInterest, Amount: 10, Currency: "USD", EntryDate: day(3)},
+				{AccountID: "acc1", Type: models.CashEntryWithdrawal, Amount: -200, Currency: "USD", EntryDate: day(4)},
+			},
+			closes:         map[string]map[time.Time]float64{"AAPL_USD": {day(3): 110, day(4): 110}},
+			expectedValues: []float64{0, 1500, 1610, 1410},
+			expectedFlows:  []float64{0, 1500, 0, -200},
+			expectedGain:   110,
+		},
+		{
+			name:           "merged position should be carried into the new ticker",
+			trades:         []models.Trade{buy("XYZ")},
+			actions:        []models.CorporateAction{merger},
+			closes:         mergerCloses,
+			expectedValues: []float64{0, 1000, 1050, 1100},
+			expectedFlows:  []float64{0, 1000, 0, 0},
+			expectedGain:   100,
+		},
+		{
+			name:           "cash in lieu missing from the ledger should be counted from the action",
+			trades:         []models.Trade{buy("XYZ")},
+			actions:        []models.CorporateAction{reverseSplit},
+			closes:         splitCloses,
+			expectedValues: []float64{0, 1000, 1000, 1040},
+			expectedFlows:  []float64{0, 1000, 0, 0},
+			expectedGain:   40,
+		},
+		{
+			name:           "cash in lieu on the ledger should be counted once",
+			trades:         []models.Trade{buy("XYZ")},
+			entries:        settledThroughLedger(200),
+			actions:        []models.CorporateAction{reverseSplit},
+			closes:         splitCloses,
+			expectedValues: []float64{0, 1000, 1000, 1040},
+			expectedFlows:  []float64{0, 1000, 0, 0},
+			expectedGain:   40,
+		},
+		{
+			name:           "merger cash on the ledger should be counted once",
+			trades:         []models.Trade{buy("XYZ")},
+			entries:        settledThroughLedger(200),
+			actions:        []models.CorporateAction{merger},
+			closes:         mergerCloses,
+			expectedValues: []float64{0, 1000, 1050, 1100},
+			expectedFlows:  []float64{0, 1000, 0, 0},
+			expectedGain:   100,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			converters := make(map[time.Time]*FxConverter)
+			for d := 1; d <= 4; d++ {
+				rates := []models.FxRate{}
+				if rate, ok := tt.rates[day(d)]; ok {
+					rates = append(rates, models.FxRate{BaseCurrency: "EUR", QuoteCurrency: "USD", Rate: rate})
+				}
+				converters[day(d)] = NewFxConverter(rates, "USD")
+			}
+
+			portfolio, accounts := valuationSeries(tt.trades, tt.received, tt.entries, tt.actions, tt.closes, converters, "USD", day(1), day(4), newCurrencySet())
+
+			assert.Len(t, portfolio, 4)
+			assert.Equal(t, tt.expectedValues, []float64{portfolio[0].value, portfolio[1].value, portfolio[2].value, portfolio[3].value})
+			assert.Equal(t, tt.expectedFlows, []float64{portfolio[0].flow, portfolio[1].flow, portfolio[2].flow, portfolio[3].flow})
+			assert.Len(t, accounts["acc1"], 4)
+			assert.InDelta(t, tt.expectedGain, performanceResult(portfolio).Gain, 1e-9)
+		})
+	}
+}
+
+func TestPerformanceRange(t *testing.T) {
+	today := time.Date(2024, 5, 15, 0, 0, 0, 0, time.UTC)
+	inception := time.Date(2020, 3, 2, 0, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name          string
+		period        string
+		from          time.Time
+		to            time.Time
+		expectedFrom  time.Time
+		expectedTo    time.Time
+		expectedError error
+	}{
+		{name: "MTD should start on the first of the month", period: "MTD", expectedFrom: time.Date(2024, 5, 1, 0, 0, 0, 0, time.UTC), expectedTo: today},
+		{name: "QTD should start on the first of the quarter", period: "QTD", expectedFrom: time.Date(2024, 4, 1, 0, 0, 0, 0, time.UTC), expectedTo: today},
+		{name: "period should be case-insensitive", period: "ytd", expectedFrom: time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC), expectedTo: today},
+		{name: "1Y should cover the last year", period: "1Y", expectedFrom: time.Date(2023, 5, 16, 0, 0, 0, 0, time.UTC), expectedTo: today},
+		{name: "inception should start on the first trade", period: "inception", expectedFrom: inception, expectedTo: today},
+		{name: "custom range should end no later than today", from: time.Date(2024, 2, 1, 0, 0, 0, 0, time.UTC), to: time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC), expectedFrom: time.Date(2024, 2, 1, 0, 0, 0, 0, time.UTC), expectedTo: today},
+		{name: "unknown period should be rejected", period: "5Y", expectedError: ErrInvalidPerformancePeriod},
+		{name: "custom range without a start should be rejected", to: today, expectedError: ErrInvalidPerformancePeriod},
+		{name: "custom range ending before it starts should be rejected", from: today, to: time.Date(2024, 5, 1, 0, 0, 0, 0, time.UTC), expectedError: ErrInvalidPerformancePeriod},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			from, to, err := performanceRange(tt.period, tt.from, tt.to, inception, today)
+
+			if tt.expectedError != nil {
+				assert.ErrorIs(t, err, tt.expectedError)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tt.expectedFrom, from)
+			assert.Equal(t, tt.expectedTo, to)
+		})
+	}
+}
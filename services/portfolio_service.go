@@ -0,0 +1,267 @@
+package services
+
+import (
+	"asset-dairy/models"
+	"errors"
+	"math"
+	"sort"
+	"strings"
+	"time"
+)
+
+type PortfolioServiceInterface interface {
+	GetTotals(userID, currency string) (*models.PortfolioTotals, error)
+	GetOverview(userID, currency string) (*models.PortfolioOverview, error)
+}
+
+type PortfolioService struct {
+	holdingService HoldingServiceInterface
+	profileService ProfileServiceInterface
+	accountService AccountServiceInterface
+	fxService      FxServiceInterface
+}
+
+func NewPortfolioService(holdingService HoldingServiceInterface, profileService ProfileServiceInterface, accountService AccountServiceInterface, fxService FxServiceInterface) *PortfolioService {
+	return &PortfolioService{
+		holdingService: holdingService,
+		profileService: profileService,
+		accountService: accountService,
+		fxService:      fxService,
+	}
+}
+
+// GetTotals sums the cost and market value of the user's holdings in the given currency,
+// or in the profile's default currency when none is given. Holdings without a quote
+// count at cost; holdings in a currency without an exchange rate are left out.
+func (s *PortfolioService) GetTotals(userID, currency string) (*models.PortfolioTotals, error) {
+	currency, err := reportingCurrency(s.profileService, s.fxService, userID, currency)
+	if err != nil {
+		return nil, err
+	}
+
+	holdings, err := s.holdingService.ListHoldings(userID)
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	converter, err := s.fxService.Converter(now)
+	if err != nil {
+		return nil, err
+	}
+
+	totals := &models.PortfolioTotals{
+		Currency:          currency,
+		UnpricedTickers:   []string{},
+		MissingCurrencies: []string{},
+		AsOf:              now,
+	}
+	missing := newCurrencySet()
+	for _, holding := range holdings {
+		rate, ok, err := conversionRate(converter, holding.Currency, currency, missing)
+		if err != nil {
+			return nil, err
+		}
+		if !ok {
+			continue
+		}
+
+		cost, value, priced := holdingValue(holding, rate)
+		if !priced {
+			totals.UnpricedTickers = append(totals.UnpricedTickers, holding.Ticker)
+		}
+		totals.TotalCost += cost
+		totals.TotalValue += value
+		totals.HoldingCount++
+	}
+	totals.MissingCurrencies = missing.sorted()
+
+	totals.UnrealizedPnl = totals.TotalValue - totals.TotalCost
+	if totals.TotalCost != 0 {
+		percent := totals.UnrealizedPnl / math.Abs(totals.TotalCost) * 100
+		totals.UnrealizedPnlPercent = &percent
+	}
+	sort.Strings(totals.UnpricedTickers)
+	return totals, nil
+}
+
+// GetOverview combines account cash balances with the holdings of each account, broken down
+// by account, asset type and currency, in the given or the profile's default currency. Lots
+// are matched within each account for both this and GetTotals, so the accounts' holdings add
+// up to the totals.
+func (s *PortfolioService) GetOverview(userID, currency string) (*models.PortfolioOverview, error) {
+	currency, err := reportingCurrency(s.profileService, s.fxService, userID, currency)
+	if err != nil {
+		return nil, err
+	}
+
+	accounts, err := s.accountService.ListAccounts(userID)
+	if err != nil {
+		return nil, err
+	}
+	holdingsByAccount, err := s.holdingService.ListAccountHoldings(userID)
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	converter, err := s.fxService.Converter(now)
+	if err != nil {
+		return nil, err
+	}
+
+	overview := &models.PortfolioOverview{
+		Currency:        currency,
+		Accounts:        []models.AccountAllocation{},
+		UnpricedTickers: []string{},
+		AsOf:            now,
+	}
+	assetTypes := newAllocationTotals()
+	currencies := newAllocationTotals()
+	missing := newCurrencySet()
+	unpriced := make(map[string]bool)
+
+	for _, acc := range accounts {
+		allocation := models.AccountAllocation{
+			AccountID:   acc.ID,
+			Name:        acc.Name,
+			Currency:    acc.Currency,
+			CashBalance: acc.Balance,
+			Holdings:    holdingsByAccount[acc.ID],
+		}
+		if allocation.Holdings == nil {
+			allocation.Holdings = []models.Holding{}
+		}
+
+		rate, ok, err := conversionRate(converter, acc.Currency, currency, missing)
+		if err != nil {
+			return nil, err
+		}
+		if ok {
+			allocation.CashValue = acc.Balance * rate
+			assetTypes.add("cash", allocation.CashValue)
+			currencies.add(strings.ToUpper(acc.Currency), allocation.CashValue)
+		}
+
+		for _, holding := range allocation.Holdings {
+			rate, ok, err := conversionRate(converter, holding.Currency, currency, missing)
+			if err != nil {
+				return nil, err
+			}
+			if !ok {
+				continue
+			}
+			_, value, priced := holdingValue(holding, rate)
+			if !priced && !unpriced[holding.Ticker] {
+				unpriced[holding.Ticker] = true
+				overview.UnpricedTickers = append(overview.UnpricedTickers, holding.Ticker)
+			}
+			allocation.HoldingsValue += value
+			assetTypes.add(holding.AssetType, value)
+			currencies.add(strings.ToUpper(holding.Currency), value)
+		}
+
+		allocation.Value = allocation.CashValue + allocation.HoldingsValue
+		overview.CashValue += allocation.CashValue
+		overview.HoldingsValue += allocation.HoldingsValue
+		overview.Accounts = append(overview.Accounts, allocation)
+	}
+
+	overview.TotalValue = overview.CashValue + overview.HoldingsValue
+	for i := range overview.Accounts {
+		overview.Accounts[i].AllocationPercent = allocationPercent(overview.Accounts[i].Value, overview.TotalValue)
+	}
+	overview.AssetTypes = assetTypes.allocations(overview.TotalValue)
+	overview.Currencies = currencies.allocations(overview.TotalValue)
+	overview.MissingCurrencies = missing.sorted()
+	sort.Strings(overview.UnpricedTickers)
+	return overview, nil
+}
+
+// holdingValue returns the cost and market value of a holding at the given exchange rate.
+// A holding without a quote is valued at cost and reported as not priced.
+func holdingValue(holding models.Holding, rate float64) (cost, value float64, priced bool) {
+	cost = holding.CostBasis() * rate
+	if holding.MarketValue == nil {
+		return cost, cost, false
+	}
+	return cost, *holding.MarketValue * rate, true
+}
+
+// conversionRate looks up the rate from one currency to another. A missing rate is not an
+// error: the currency is recorded in missing and ok is false.
+func conversionRate(converter *FxConverter, from, to string, missing currencySet) (rate float64, ok bool, err error) {
+	rate, err = converter.Rate(from, to)
+	if errors.Is(err, ErrFxRateNotFound) {
+		missing[strings.ToUpper(from)] = true
+		return 0, false, nil
+	}
+	if err != nil {
+		return 0, false, err
+	}
+	return rate, true, nil
+}
+
+func allocationPercent(value, total float64) float64 {
+	if total == 0 {
+		return 0
+	}
+	return value / total * 100
+}
+
+type currencySet map[string]bool
+
+func newCurrencySet() currencySet {
+	return make(currencySet)
+}
+
+func (s currencySet) sorted() []string {
+	currencies := make([]string, 0, len(s))
+	for currency := range s {
+		currencies = append(currencies, currency)
+	}
+	sort.Strings(currencies)
+	return currencies
+}
+
+// allocationTotals sums values per key, remembering the order keys were first seen
+type allocationTotals struct {
+	keys   []string
+	values map[string]float64
+}
+
+func newAllocationTotals() *allocationTotals {
+	return &allocationTotals{values: make(map[string]float64)}
+}
+
+func (t *allocationTotals) add(key string, value float64) {
+	if _, ok := t.values[key]; !ok {
+		t.keys = append(t.keys, key)
+	}
+	t.values[key] += value
+}
+
+func (t *allocationTotals) allocations(total float64) []models.PortfolioAllocation {
+	allocations := make([]models.PortfolioAllocation, 0, len(t.keys))
+	for _, key := range t.keys {
+		allocations = append(allocations, models.PortfolioAllocation{
+			Key:               key,
+			Value:             t.values[key],
+			AllocationPercent: allocationPercent(t.values[key], total),
+		})
+	}
+	return allocations
+}
+
+// reportingCurrency picks the requested currency, else the profile default, else the FX base currency
+func reportingCurrency(profileService ProfileServiceInterface, fxService FxServiceInterface, userID, currency string) (string, error) {
+	if currency != "" {
+		return strings.ToUpper(currency), nil
+	}
+	profile, err := profileService.GetProfile(userID)
+	if err != nil {
+		return "", err
+	}
+	if profile.InvestmentProfile != nil && profile.InvestmentProfile.DefaultCurrency != "" {
+		return strings.ToUpper(profile.InvestmentProfile.DefaultCurrency), nil
+	}
+	return fxService.BaseCurrency(), nil
+}
@@ -0,0 +1,200 @@
+package services
+
+import (
+	"asset-dairy/models"
+	"io"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+// MockHoldingService is a mock implementation of HoldingServiceInterface
+type MockHoldingService struct {
+	mock.Mock
+}
+
+func (m *MockHoldingService) ListHoldings(userID string) ([]models.Holding, error) {
+	args := m.Called(userID)
+	return args.Get(0).([]models.Holding), args.Error(1)
+}
+
+func (m *MockHoldingService) ListAccountHoldings(userID string) (map[string][]models.Holding, error) {
+	args := m.Called(userID)
+	return args.Get(0).(map[string][]models.Holding), args.Error(1)
+}
+
+// Add stub methods to satisfy HoldingServiceInterface
+func (m *MockHoldingService) ListRealizedGains(userID string) ([]models.RealizedGain, error) {
+	panic("not implemented")
+}
+func (m *MockHoldingService) ListHoldingsByAccount(userID string, query models.HoldingsQuery) ([]models.AccountHoldings, error) {
+	panic("not implemented")
+}
+func (m *MockHoldingService) GetAccountHoldings(userID, accountID string, query models.HoldingsQuery) (*models.AccountHoldings, error) {
+	panic("not implemented")
+}
+func (m *MockHoldingService) ListHoldingsAsOf(userID string, query models.HoldingsQuery) ([]models.Holding, error) {
+	panic("not implemented")
+}
+func (m *MockHoldingService) DiffHoldings(userID string, from, to time.Time) (*models.HoldingsDiff, error) {
+	panic("not implemented")
+}
+
+// MockFxService is a mock implementation of FxServiceInterface
+type MockFxService struct {
+	mock.Mock
+}
+
+func (m *MockFxService) BaseCurrency() string {
+	return "USD"
+}
+
+func (m *MockFxService) Converter(asOf time.Time) (*FxConverter, error) {
+	args := m.Called()
+	return args.Get(0).(*FxConverter), args.Error(1)
+}
+
+// Add stub methods to satisfy FxServiceInterface
+func (m *MockFxService) DailyConverters(from, to time.Time) (map[time.Time]*FxConverter, error) {
+	panic("not implemented")
+}
+func (m *MockFxService) ImportCSV(r io.Reader) (int, error) {
+	panic("not implemented")
+}
+func (m *MockFxService) ImportFile(path string) (int, error) {
+	panic("not implemented")
+}
+
+func TestGetOverview_BreaksDownCashAndHoldingsInDefaultCurrency(t *testing.T) {
+	mockHoldingService := new(MockHoldingService)
+	mockProfileService := new(MockProfileService)
+	mockAccountService := new(MockAccountService)
+	mockFxService := new(MockFxService)
+	service := NewPortfolioService(mockHoldingService, mockProfileService, mockAccountService, mockFxService)
+
+	userID := "user1"
+	marketValue := 1500.0
+	mockProfileService.On("GetProfile", userID).Return(&models.Profile{InvestmentProfile: &models.InvestmentProfile{DefaultCurrency: "USD"}}, nil)
+	mockAccountService.On("ListAccounts", userID).Return([]models.Account{
+		{ID: "acc1", Name: "Broker", Currency: "USD", Balance: 1000},
+		{ID: "acc2", Name: "Exchange", Currency: "TWD", Balance: 32000},
+	}, nil)
+	mockHoldingService.On("ListAccountHoldings", userID).Return(map[string][]models.Holding{
+		"acc1": {{Ticker: "AAPL", Quantity: 10, AveragePrice: 100, AssetType: "stock", Currency: "USD", MarketValue: &marketValue}},
+		"acc2": {{Ticker: "BTC", Quantity: 1, AveragePrice: 640000, AssetType: "crypto", Currency: "TWD"}},
+	}, nil)
+	mockFxService.On("Converter").Return(NewFxConverter([]models.FxRate{{BaseCurrency: "USD", QuoteCurrency: "TWD", Rate: 32}}, "USD"), nil)
+
+	overview, err := service.GetOverview(userID, "")
+
+	assert.NoError(t, err)
+	assert.Equal(t, "USD", overview.Currency)
+	assert.InDelta(t, 23500, overview.TotalValue, 1e-6)
+	assert.InDelta(t, 2000, overview.CashValue, 1e-6)
+	assert.Equal(t, []string{"BTC"}, overview.UnpricedTickers)
+
+	assert.Len(t, overview.Accounts, 2)
+	assert.InDelta(t, 2500, overview.Accounts[0].Value, 1e-6)
+	assert.InDelta(t, 21000, overview.Accounts[1].Value, 1e-6)
+	assert.InDelta(t, 21000/23500.0*100, overview.Accounts[1].AllocationPercent, 1e-6)
+
+	assetTypes := make(map[string]float64)
+	for _, allocation := range overview.AssetTypes {
+		assetTypes[allocation.Key] = allocation.Value
+	}
+	assert.InDelta(t, 2000, assetTypes["cash"], 1e-6)
+	assert.InDelta(t, 1500, assetTypes["stock"], 1e-6)
+	assert.InDelta(t, 20000, assetTypes["crypto"], 1e-6)
+
+	currencies := make(map[string]float64)
+	for _, allocation := range overview.Currencies {
+		currencies[allocation.Key] = allocation.Value
+	}
+	assert.InDelta(t, 2500, currencies["USD"], 1e-6)
+	assert.InDelta(t, 21000, currencies["TWD"], 1e-6)
+}
+
+func TestGetTotals_SkipsHoldingsWithoutRate(t *testing.T) {
+	mockHoldingService := new(MockHoldingService)
+	mockProfileService := new(MockProfileService)
+	mockFxService := new(MockFxService)
+	service := NewPortfolioService(mockHoldingService, mockProfileService, new(MockAccountService), mockFxService)
+
+	userID := "user1"
+	marketValue := 1500.0
+	mockHoldingService.On("ListHoldings", userID).Return([]models.Holding{
+		{Ticker: "AAPL", Quantity: 10, AveragePrice: 100, Currency: "USD", MarketValue: &marketValue},
+		{Ticker: "7203", Quantity: 100, AveragePrice: 2500, Currency: "JPY"},
+	}, nil)
+	mockFxService.On("Converter").Return(NewFxConverter([]models.FxRate{{BaseCurrency: "USD", QuoteCurrency: "TWD", Rate: 32}}, "USD"), nil)
+
+	totals, err := service.GetTotals(userID, "twd")
+
+	assert.NoError(t, err)
+	assert.Equal(t, "TWD", totals.Currency)
+	assert.InDelta(t, 32000, totals.TotalCost, 1e-6)
+	assert.InDelta(t, 48000, totals.TotalValue, 1e-6)
+	assert.Equal(t, 1, totals.HoldingCount)
+	assert.Equal(t, []string{"JPY"}, totals.MissingCurrencies)
+	mockProfileService.AssertNotCalled(t, "GetProfile", userID)
+}
+
+func TestPortfolioTotalsAgreeWithAccountBreakdown(t *testing.T) {
+	day := func(d int) time.Time {
+		return time.Date(2024, 1, d, 0, 0, 0, 0, time.UTC)
+	}
+	accounts := []models.Account{
+		{ID: "acc-1", Name: "Broker A", Currency: "USD"},
+		{ID: "acc-2", Name: "Broker B", Currency: "USD"},
+	}
+	tests := []struct {
+		name            string
+		costBasisMethod string
+		trades          []models.Trade
+		expectedCost    float64
+	}{
+		{
+			name: "partial sell at one broker should leave the other broker's lots alone",
+			trades: []models.Trade{
+				{ID: "b1", Type: "buy", AssetType: "stock", Ticker: "AAPL", TradeDate: day(1), Quantity: 10, Price: 100, Currency: "USD", AccountID: "acc-1"},
+				{ID: "b2", Type: "buy", AssetType: "stock", Ticker: "AAPL", TradeDate: day(2), Quantity: 10, Price: 150, Currency: "USD", AccountID: "acc-2"},
+				{ID: "s1", Type: "sell", AssetType: "stock", Ticker: "AAPL", TradeDate: day(3), Quantity: 4, Price: 160, Currency: "USD", AccountID: "acc-2"},
+			},
+			expectedCost: 10*100 + 6*150,
+		},
+		{
+			name:            "sells at both brokers should draw down their own lots by the profile's method",
+			costBasisMethod: models.CostBasisLIFO,
+			trades: []models.Trade{
+				{ID: "b1", Type: "buy", AssetType: "stock", Ticker: "AAPL", TradeDate: day(1), Quantity: 10, Price: 100, Currency: "USD", AccountID: "acc-1"},
+				{ID: "b2", Type: "buy", AssetType: "stock", Ticker: "AAPL", TradeDate: day(2), Quantity: 10, Price: 150, Currency: "USD", AccountID: "acc-2"},
+				{ID: "b3", Type: "buy", AssetType: "stock", Ticker: "AAPL", TradeDate: day(3), Quantity: 10, Price: 120, Currency: "USD", AccountID: "acc-1"},
+				{ID: "s1", Type: "sell", AssetType: "stock", Ticker: "AAPL", TradeDate: day(4), Quantity: 5, Price: 160, Currency: "USD", AccountID: "acc-1"},
+				{ID: "s2", Type: "sell", AssetType: "stock", Ticker: "AAPL", TradeDate: day(5), Quantity: 5, Price: 160, Currency: "USD", AccountID: "acc-2"},
+			},
+			expectedCost: 10*100 + 5*120 + 5*150,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			holdingService, _ := newMockedHoldingService(tt.trades, tt.costBasisMethod, accounts)
+			mockAccountService := new(MockAccountService)
+			mockAccountService.On("ListAccounts", "test-user").Return(accounts, nil)
+			mockFxService := new(MockFxService)
+			mockFxService.On("Converter").Return(NewFxConverter([]models.FxRate{}, "USD"), nil)
+			service := NewPortfolioService(holdingService, new(MockProfileService), mockAccountService, mockFxService)
+
+			totals, err := service.GetTotals("test-user", "USD")
+			assert.NoError(t, err)
+			overview, err := service.GetOverview("test-user", "USD")
+			assert.NoError(t, err)
+
+			// Unpriced holdings count at cost in both views
+			assert.InDelta(t, tt.expectedCost, totals.TotalCost, 1e-6)
+			assert.InDelta(t, totals.TotalValue, overview.HoldingsValue, 1e-6)
+		})
+	}
+}
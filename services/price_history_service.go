@@ -0,0 +1,227 @@
+package services
+
+import (
+	"asset-dairy/models"
+	"asset-dairy/repositories"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var (
+	ErrInvalidPriceRange = errors.New("invalid price range")
+)
+
+type PriceHistoryServiceInterface interface {
+	GetSeries(ticker string, from, to time.Time) (*models.PriceSeries, error)
+	ImportCSV(r io.Reader, ticker, currency, assetType string) (int, error)
+}
+
+type PriceHistoryService struct {
+	repo      repositories.PriceHistoryRepositoryInterface
+	priceRepo repositories.PriceRepositoryInterface
+}
+
+// NewPriceHistoryService creates a new PriceHistoryService. Imported closes also
+// refresh the latest quotes in the prices table when they are newer.
+func NewPriceHistoryService(repo repositories.PriceHistoryRepositoryInterface, priceRepo repositories.PriceRepositoryInterface) *PriceHistoryService {
+	return &PriceHistoryService{repo: repo, priceRepo: priceRepo}
+}
+
+// GetSeries returns one point per calendar day between from and to (capped at today),
+// carrying the last known close over days without a stored bar
+func (s *PriceHistoryService) GetSeries(ticker string, from, to time.Time) (*models.PriceSeries, error) {
+	from, to = truncateToDate(from), truncateToDate(to)
+	if today := truncateToDate(time.Now()); to.After(today) {
+		to = today
+	}
+	if from.After(to) {
+		return nil, fmt.Errorf("%w: from must not be after to", ErrInvalidPriceRange)
+	}
+
+	ticker = strings.ToUpper(ticker)
+	bars, err := s.repo.ListRange(ticker, from, to)
+	if err != nil {
+		return nil, err
+	}
+	previous, err := s.repo.FindLatestBefore(ticker, from)
+	if err != nil {
+		return nil, err
+	}
+
+	series := &models.PriceSeries{
+		Ticker: ticker,
+		Points: fillPriceGaps(previous, bars, from, to),
+	}
+	if len(bars) > 0 {
+		series.Currency = bars[len(bars)-1].Currency
+	} else if previous != nil {
+		series.Currency = previous.Currency
+	}
+	return series, nil
+}
+
+// fillPriceGaps expands sorted bars into daily points. Days before the first known
+// close are skipped; later days without a bar repeat the previous close.
+func fillPriceGaps(previous *models.PriceHistory, bars []models.PriceHistory, from, to time.Time) []models.PricePoint {
+	points := []models.PricePoint{}
+	byDate := make(map[time.Time]models.PriceHistory, len(bars))
+	for _, bar := range bars {
+		byDate[truncateToDate(bar.Date)] = bar
+	}
+
+	var lastClose *float64
+	if previous != nil {
+		close := previous.Close
+		lastClose = &close
+	}
+	for day := from; !day.After(to); day = day.AddDate(0, 0, 1) {
+		if bar, ok := byDate[day]; ok {
+			points = append(points, models.PricePoint{
+				Date:   day,
+				Open:   bar.Open,
+				High:   bar.High,
+				Low:    bar.Low,
+				Close:  bar.Close,
+				Volume: bar.Volume,
+			})
+			close := bar.Close
+			lastClose = &close
+			continue
+		}
+		if lastClose == nil {
+			continue
+		}
+		points = append(points, models.PricePoint{
+			Date:   day,
+			Close:  *lastClose,
+			Filled: true,
+		})
+	}
+	return points
+}
+
+// ImportCSV stores daily bars from a CSV with date and close columns, plus optional
+// ticker, currency, assetType, open, high, low and volume columns. The ticker, currency
+// and asset type arguments fill in for missing columns. Rows repeating a ticker and
+// date replace earlier ones.
+func (s *PriceHistoryService) ImportCSV(r io.Reader, ticker, currency, assetType string) (int, error) {
+	reader := csv.NewReader(r)
+	reader.TrimLeadingSpace = true
+	columns, err := readCSVColumns(reader)
+	if err != nil {
+		return 0, fmt.Errorf("%w: missing header", ErrInvalidPriceUpload)
+	}
+	for _, required := range []string{"date", "close"} {
+		if !columns.has(required) {
+			return 0, fmt.Errorf("%w: missing %s column", ErrInvalidPriceUpload, required)
+		}
+	}
+
+	type barKey struct {
+		ticker string
+		date   time.Time
+	}
+	bars := []models.PriceHistory{}
+	index := make(map[barKey]int)
+	for row := 2; ; row++ {
+		record, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return 0, fmt.Errorf("%w: row %d: %v", ErrInvalidPriceUpload, row, err)
+		}
+		bar, err := parsePriceBar(columns, record, ticker, currency, assetType)
+		if err != nil {
+			return 0, fmt.Errorf("%w: row %d: %v", ErrInvalidPriceUpload, row, err)
+		}
+		key := barKey{bar.Ticker, bar.Date}
+		if i, exists := index[key]; exists {
+			bars[i] = bar
+			continue
+		}
+		index[key] = len(bars)
+		bars = append(bars, bar)
+	}
+
+	if err := s.repo.UpsertBars(bars); err != nil {
+		return 0, err
+	}
+	if err := s.priceRepo.UpsertPrices(latestCloses(bars)); err != nil {
+		return 0, err
+	}
+	return len(bars), nil
+}
+
+func parsePriceBar(columns csvColumns, record []string, ticker, currency, assetType string) (models.PriceHistory, error) {
+	bar := models.PriceHistory{
+		Ticker:    strings.ToUpper(firstNonEmpty(columns.value(record, "ticker"), ticker)),
+		Currency:  strings.ToUpper(firstNonEmpty(columns.value(record, "currency"), currency)),
+		AssetType: firstNonEmpty(columns.value(record, "assetType"), assetType),
+	}
+	if bar.Ticker == "" || bar.Currency == "" {
+		return bar, errors.New("ticker and currency are required")
+	}
+	date, err := time.Parse("2006-01-02", columns.value(record, "date"))
+	if err != nil {
+		return bar, errors.New("invalid date, use YYYY-MM-DD")
+	}
+	bar.Date = date
+	close, err := strconv.ParseFloat(columns.value(record, "close"), 64)
+	if err != nil {
+		return bar, errors.New("invalid close")
+	}
+	bar.Close = close
+	for name, field := range map[string]**float64{"open": &bar.Open, "high": &bar.High, "low": &bar.Low, "volume": &bar.Volume} {
+		raw := columns.value(record, name)
+		if raw == "" {
+			continue
+		}
+		value, err := strconv.ParseFloat(raw, 64)
+		if err != nil {
+			return bar, fmt.Errorf("invalid %s", name)
+		}
+		*field = &value
+	}
+	return bar, nil
+}
+
+// latestCloses returns the newest close of every ticker and currency as a quote
+func latestCloses(bars []models.PriceHistory) []models.Price {
+	latest := make(map[string]models.PriceHistory)
+	for _, bar := range bars {
+		key := bar.Ticker + "_" + bar.Currency
+		if current, ok := latest[key]; !ok || bar.Date.After(current.Date) {
+			latest[key] = bar
+		}
+	}
+	prices := make([]models.Price, 0, len(latest))
+	for _, bar := range latest {
+		prices = append(prices, models.Price{
+			Ticker:   bar.Ticker,
+			Currency: bar.Currency,
+			Price:    bar.Close,
+			AsOf:     bar.Date,
+		})
+	}
+	return prices
+}
+
+// truncateToDate drops the time of day, keeping the calendar date in UTC
+func truncateToDate(t time.Time) time.Time {
+	return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC)
+}
+
+func firstNonEmpty(values ...string) string {
+	for _, value := range values {
+		if value != "" {
+			return value
+		}
+	}
+	return ""
+}
@@ -0,0 +1,70 @@
+package services
+
+import (
+	"asset-dairy/models"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFillPriceGaps(t *testing.T) {
+	day := func(d int) time.Time { return time.Date(2024, 3, d, 0, 0, 0, 0, time.UTC) }
+	bar := func(d int, price float64) models.PriceHistory {
+		return models.PriceHistory{Ticker: "AAPL", Date: day(d), Close: price}
+	}
+	tests := []struct {
+		name           string
+		previous       *models.PriceHistory
+		bars           []models.PriceHistory
+		from           time.Time
+		to             time.Time
+		expectedDates  []time.Time
+		expectedCloses []float64
+		expectedFilled []bool
+	}{
+		{
+			name:           "last close should be carried over missing days",
+			previous:       &models.PriceHistory{Ticker: "AAPL", Date: day(1), Close: 100},
+			bars:           []models.PriceHistory{bar(4, 104), bar(5, 105)},
+			from:           day(2),
+			to:             day(6),
+			expectedDates:  []time.Time{day(2), day(3), day(4), day(5), day(6)},
+			expectedCloses: []float64{100, 100, 104, 105, 105},
+			expectedFilled: []bool{true, true, false, false, true},
+		},
+		{
+			name:           "days before the first close should be skipped",
+			bars:           []models.PriceHistory{bar(3, 103)},
+			from:           day(1),
+			to:             day(4),
+			expectedDates:  []time.Time{day(3), day(4)},
+			expectedCloses: []float64{103, 103},
+			expectedFilled: []bool{false, true},
+		},
+		{
+			name:           "no closes at all should give no points",
+			from:           day(1),
+			to:             day(4),
+			expectedDates:  []time.Time{},
+			expectedCloses: []float64{},
+			expectedFilled: []bool{},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			points := fillPriceGaps(tt.previous, tt.bars, tt.from, tt.to)
+
+			dates, closes, filled := []time.Time{}, []float64{}, []bool{}
+			for _, point := range points {
+				dates = append(dates, point.Date)
+				closes = append(closes, point.Close)
+				filled = append(filled, point.Filled)
+			}
+			assert.Equal(t, tt.expectedDates, dates)
+			assert.Equal(t, tt.expectedCloses, closes)
+			assert.Equal(t, tt.expectedFilled, filled)
+		})
+	}
+}
@@ -0,0 +1,54 @@
+package services
+
+import (
+	"asset-dairy/models"
+	"asset-dairy/repositories"
+	"strings"
+	"time"
+)
+
+// PriceProvider supplies the market quotes used to value holdings.
+// The stored implementation reads the prices and price history tables; a
+// vendor feed can be plugged in by implementing this interface.
+type PriceProvider interface {
+	// LatestPrices returns the quotes known for the given tickers, in any currency
+	LatestPrices(tickers []string) ([]models.Price, error)
+	// ClosingPrices returns the last close on or before the date of the given tickers
+	ClosingPrices(tickers []string, date time.Time) ([]models.Price, error)
+}
+
+// StoredPriceProvider serves quotes uploaded into the prices table and closes imported into
+// the price history
+type StoredPriceProvider struct {
+	repo        repositories.PriceRepositoryInterface
+	historyRepo repositories.PriceHistoryRepositoryInterface
+}
+
+// NewStoredPriceProvider creates a PriceProvider backed by the prices and price history tables
+func NewStoredPriceProvider(repo repositories.PriceRepositoryInterface, historyRepo repositories.PriceHistoryRepositoryInterface) *StoredPriceProvider {
+	return &StoredPriceProvider{repo: repo, historyRepo: historyRepo}
+}
+
+func (p *StoredPriceProvider) LatestPrices(tickers []string) ([]models.Price, error) {
+	return p.repo.FindPrices(tickers)
+}
+
+func (p *StoredPriceProvider) ClosingPrices(tickers []string, date time.Time) ([]models.Price, error) {
+	prices := []models.Price{}
+	seen := make(map[string]bool, len(tickers))
+	for _, ticker := range tickers {
+		ticker = strings.ToUpper(ticker)
+		if seen[ticker] {
+			continue
+		}
+		seen[ticker] = true
+		bar, err := p.historyRepo.FindLatestBefore(ticker, truncateToDate(date).AddDate(0, 0, 1))
+		if err != nil {
+			return nil, err
+		}
+		if bar != nil {
+			prices = append(prices, models.Price{Ticker: bar.Ticker, Currency: bar.Currency, Price: bar.Close, AsOf: bar.Date})
+		}
+	}
+	return prices, nil
+}
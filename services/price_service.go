@@ -0,0 +1,123 @@
+package services
+
+import (
+	"asset-dairy/models"
+	"asset-dairy/repositories"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var (
+	ErrInvalidPriceUpload = errors.New("invalid price upload")
+)
+
+type PriceServiceInterface interface {
+	ListPrices() ([]models.Price, error)
+	UploadPrices(reqs []models.PriceUploadRequest) (int, error)
+	UploadPricesCSV(r io.Reader) (int, error)
+}
+
+type PriceService struct {
+	repo repositories.PriceRepositoryInterface
+}
+
+// NewPriceService creates a new PriceService instance with a repository
+func NewPriceService(repo repositories.PriceRepositoryInterface) *PriceService {
+	return &PriceService{repo: repo}
+}
+
+func (s *PriceService) ListPrices() ([]models.Price, error) {
+	return s.repo.ListPrices()
+}
+
+// UploadPrices stores the quotes and returns how many were stored. A ticker and currency quoted
+// more than once keeps its latest quote, the last row winning a tie, since one upsert cannot
+// update the same row twice.
+func (s *PriceService) UploadPrices(reqs []models.PriceUploadRequest) (int, error) {
+	now := time.Now()
+	prices := make([]models.Price, 0, len(reqs))
+	index := make(map[string]int, len(reqs))
+	for i, req := range reqs {
+		asOf := now
+		if req.AsOf != "" {
+			parsed, err := parseQuoteTime(req.AsOf)
+			if err != nil {
+				return 0, fmt.Errorf("%w: row %d: invalid asOf %q", ErrInvalidPriceUpload, i+1, req.AsOf)
+			}
+			asOf = parsed
+		}
+		price := models.Price{
+			Ticker:   strings.ToUpper(strings.TrimSpace(req.Ticker)),
+			Currency: strings.ToUpper(strings.TrimSpace(req.Currency)),
+			Price:    req.Price,
+			AsOf:     asOf,
+		}
+		key := price.Ticker + "_" + price.Currency
+		if j, ok := index[key]; ok {
+			if !price.AsOf.Before(prices[j].AsOf) {
+				prices[j] = price
+			}
+			continue
+		}
+		index[key] = len(prices)
+		prices = append(prices, price)
+	}
+	if err := s.repo.UpsertPrices(prices); err != nil {
+		return 0, err
+	}
+	return len(prices), nil
+}
+
+// UploadPricesCSV reads quotes from a CSV with a ticker,currency,price[,asOf] header
+func (s *PriceService) UploadPricesCSV(r io.Reader) (int, error) {
+	reader := csv.NewReader(r)
+	reader.TrimLeadingSpace = true
+	columns, err := readCSVColumns(reader)
+	if err != nil {
+		return 0, fmt.Errorf("%w: missing header", ErrInvalidPriceUpload)
+	}
+	for _, required := range []string{"ticker", "currency", "price"} {
+		if !columns.has(required) {
+			return 0, fmt.Errorf("%w: missing %s column", ErrInvalidPriceUpload, required)
+		}
+	}
+
+	var reqs []models.PriceUploadRequest
+	for row := 2; ; row++ {
+		record, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return 0, fmt.Errorf("%w: row %d: %v", ErrInvalidPriceUpload, row, err)
+		}
+		price, err := strconv.ParseFloat(columns.value(record, "price"), 64)
+		if err != nil || price < 0 {
+			return 0, fmt.Errorf("%w: row %d: invalid price", ErrInvalidPriceUpload, row)
+		}
+		req := models.PriceUploadRequest{
+			Ticker:   columns.value(record, "ticker"),
+			Currency: columns.value(record, "currency"),
+			Price:    price,
+			AsOf:     columns.value(record, "asOf"),
+		}
+		if req.Ticker == "" || req.Currency == "" {
+			return 0, fmt.Errorf("%w: row %d: ticker and currency are required", ErrInvalidPriceUpload, row)
+		}
+		reqs = append(reqs, req)
+	}
+	return s.UploadPrices(reqs)
+}
+
+// parseQuoteTime accepts a plain date or an RFC 3339 timestamp
+func parseQuoteTime(value string) (time.Time, error) {
+	if t, err := time.Parse("2006-01-02", value); err == nil {
+		return t, nil
+	}
+	return time.Parse(time.RFC3339, value)
+}
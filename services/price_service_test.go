@@ -0,0 +1,87 @@
+package services
+
+import (
+	"asset-dairy/models"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+// MockPriceRepository is a mock implementation of PriceRepositoryInterface
+type MockPriceRepository struct {
+	mock.Mock
+}
+
+func (m *MockPriceRepository) UpsertPrices(prices []models.Price) error {
+	args := m.Called(prices)
+	return args.Error(0)
+}
+
+// Add stub methods to satisfy PriceRepositoryInterface
+func (m *MockPriceRepository) ListPrices() ([]models.Price, error) {
+	panic("not implemented")
+}
+func (m *MockPriceRepository) FindPrices(tickers []string) ([]models.Price, error) {
+	panic("not implemented")
+}
+
+func TestUploadPrices(t *testing.T) {
+	day := func(d int) time.Time {
+		return time.Date(2024, 3, d, 0, 0, 0, 0, time.UTC)
+	}
+	tests := []struct {
+		name           string
+		reqs           []models.PriceUploadRequest
+		expectedPrices []models.Price
+	}{
+		{
+			name: "quotes of different tickers should all be stored",
+			reqs: []models.PriceUploadRequest{
+				{Ticker: "aapl", Currency: "usd", Price: 180, AsOf: "2024-03-01"},
+				{Ticker: "2330", Currency: "TWD", Price: 750, AsOf: "2024-03-01"},
+			},
+			expectedPrices: []models.Price{
+				{Ticker: "AAPL", Currency: "USD", Price: 180, AsOf: day(1)},
+				{Ticker: "2330", Currency: "TWD", Price: 750, AsOf: day(1)},
+			},
+		},
+		{
+			name: "ticker quoted twice should keep its latest quote",
+			reqs: []models.PriceUploadRequest{
+				{Ticker: "AAPL", Currency: "USD", Price: 182, AsOf: "2024-03-02"},
+				{Ticker: "MSFT", Currency: "USD", Price: 400, AsOf: "2024-03-01"},
+				{Ticker: "aapl", Currency: "USD", Price: 180, AsOf: "2024-03-01"},
+			},
+			expectedPrices: []models.Price{
+				{Ticker: "AAPL", Currency: "USD", Price: 182, AsOf: day(2)},
+				{Ticker: "MSFT", Currency: "USD", Price: 400, AsOf: day(1)},
+			},
+		},
+		{
+			name: "ticker quoted twice for the same time should keep the last row",
+			reqs: []models.PriceUploadRequest{
+				{Ticker: "AAPL", Currency: "USD", Price: 180, AsOf: "2024-03-01"},
+				{Ticker: "AAPL", Currency: "USD", Price: 181, AsOf: "2024-03-01"},
+			},
+			expectedPrices: []models.Price{
+				{Ticker: "AAPL", Currency: "USD", Price: 181, AsOf: day(1)},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockRepo := new(MockPriceRepository)
+			mockRepo.On("UpsertPrices", mock.Anything).Return(nil)
+			service := NewPriceService(mockRepo)
+
+			count, err := service.UploadPrices(tt.reqs)
+
+			assert.NoError(t, err)
+			assert.Equal(t, len(tt.expectedPrices), count)
+			mockRepo.AssertCalled(t, "UpsertPrices", tt.expectedPrices)
+		})
+	}
+}
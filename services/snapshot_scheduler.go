@@ -0,0 +1,47 @@
+package services
+
+import (
+	"context"
+	"log"
+	"time"
+)
+
+// SnapshotScheduler writes daily portfolio snapshots in the background
+type SnapshotScheduler struct {
+	snapshotService SnapshotServiceInterface
+	interval        time.Duration
+}
+
+// NewSnapshotScheduler creates a scheduler that runs a snapshot pass every interval
+func NewSnapshotScheduler(snapshotService SnapshotServiceInterface, interval time.Duration) *SnapshotScheduler {
+	return &SnapshotScheduler{
+		snapshotService: snapshotService,
+		interval:        interval,
+	}
+}
+
+// Start runs a pass right away, which backfills any missing days, and then one pass per
+// interval until the context is done. Each pass snapshots every completed day (UTC), so
+// running it more often than daily only repeats cheap no-op checks.
+func (s *SnapshotScheduler) Start(ctx context.Context) {
+	go func() {
+		s.run()
+		ticker := time.NewTicker(s.interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				s.run()
+			}
+		}
+	}()
+}
+
+func (s *SnapshotScheduler) run() {
+	yesterday := truncateToDate(time.Now().UTC()).AddDate(0, 0, -1)
+	if err := s.snapshotService.SnapshotAllUsers(yesterday); err != nil {
+		log.Println("Failed to write portfolio snapshots:", err)
+	}
+}
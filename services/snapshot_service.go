@@ -0,0 +1,155 @@
+package services
+
+import (
+	"asset-dairy/models"
+	"asset-dairy/repositories"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+)
+
+var (
+	ErrInvalidHistoryQuery = errors.New("invalid history query")
+)
+
+type SnapshotServiceInterface interface {
+	SnapshotUser(userID string, through time.Time) (int, error)
+	SnapshotAllUsers(through time.Time) error
+	GetHistory(userID, accountID string, from, to time.Time, granularity string) ([]models.PortfolioHistoryPoint, error)
+}
+
+type SnapshotService struct {
+	repo               repositories.PortfolioSnapshotRepositoryInterface
+	performanceService PerformanceServiceInterface
+	profileService     ProfileServiceInterface
+	fxService          FxServiceInterface
+}
+
+func NewSnapshotService(repo repositories.PortfolioSnapshotRepositoryInterface, performanceService PerformanceServiceInterface, profileService ProfileServiceInterface, fxService FxServiceInterface) *SnapshotService {
+	return &SnapshotService{
+		repo:               repo,
+		performanceService: performanceService,
+		profileService:     profileService,
+		fxService:          fxService,
+	}
+}
+
+// SnapshotUser writes the user's missing snapshots up to and including through, and returns how
+// many rows were written. It starts the day after the latest snapshot, or earlier when a trade,
+// cash entry, income event or corporate action created, edited or deleted since then takes
+// effect before it. Everything is rebuilt from the first trade when there are no snapshots yet
+// or the reporting currency changed.
+func (s *SnapshotService) SnapshotUser(userID string, through time.Time) (int, error) {
+	currency, err := reportingCurrency(s.profileService, s.fxService, userID, "")
+	if err != nil {
+		return 0, err
+	}
+	firstTradeDate, err := s.repo.EarliestTradeDate(userID)
+	if err != nil || firstTradeDate == nil {
+		return 0, err
+	}
+
+	from := truncateToDate(*firstTradeDate)
+	latest, err := s.repo.LatestSnapshot(userID)
+	if err != nil {
+		return 0, err
+	}
+	// Read before valuing, so a change made while the snapshots are built marks them again
+	stale, err := s.repo.GetStaleDate(userID)
+	if err != nil {
+		return 0, err
+	}
+	if latest != nil && latest.Currency == currency {
+		from = truncateToDate(latest.Date).AddDate(0, 0, 1)
+		if stale != nil && truncateToDate(stale.StaleFrom).Before(from) {
+			from = truncateToDate(stale.StaleFrom)
+		}
+	}
+	through = truncateToDate(through)
+	if from.After(through) {
+		return 0, nil
+	}
+
+	snapshots, err := s.performanceService.DailyValuations(userID, currency, from, through)
+	if err != nil {
+		return 0, err
+	}
+	if err := s.repo.ReplaceSnapshots(userID, from, through, snapshots, stale); err != nil {
+		return 0, err
+	}
+	return len(snapshots), nil
+}
+
+// SnapshotAllUsers snapshots every user with trades. A failure for one user is logged and does
+// not stop the others.
+func (s *SnapshotService) SnapshotAllUsers(through time.Time) error {
+	userIDs, err := s.repo.ListSnapshotUserIDs()
+	if err != nil {
+		return err
+	}
+	for _, userID := range userIDs {
+		if _, err := s.SnapshotUser(userID, through); err != nil {
+			log.Printf("Failed to snapshot portfolio of user %s: %v", userID, err)
+		}
+	}
+	return nil
+}
+
+// GetHistory returns the stored snapshots of the portfolio, or of one account, between two dates.
+// Weekly and monthly points carry the last value in the period and the sum of its flows.
+func (s *SnapshotService) GetHistory(userID, accountID string, from, to time.Time, granularity string) ([]models.PortfolioHistoryPoint, error) {
+	if granularity == "" {
+		granularity = models.HistoryGranularityDay
+	}
+	if granularity != models.HistoryGranularityDay && granularity != models.HistoryGranularityWeek && granularity != models.HistoryGranularityMonth {
+		return nil, fmt.Errorf("%w: granularity must be day, week or month", ErrInvalidHistoryQuery)
+	}
+	from, to = truncateToDate(from), truncateToDate(to)
+	if from.After(to) {
+		return nil, fmt.Errorf("%w: from must not be after to", ErrInvalidHistoryQuery)
+	}
+
+	var account *string
+	if accountID != "" {
+		account = &accountID
+	}
+	snapshots, err := s.repo.ListSnapshots(userID, account, from, to)
+	if err != nil {
+		return nil, err
+	}
+	return historyPoints(snapshots, granularity), nil
+}
+
+// historyPoints groups date-ordered snapshots into one point per period
+func historyPoints(snapshots []models.PortfolioSnapshot, granularity string) []models.PortfolioHistoryPoint {
+	points := []models.PortfolioHistoryPoint{}
+	var currentPeriod time.Time
+	for _, snapshot := range snapshots {
+		date := truncateToDate(snapshot.Date)
+		period := historyPeriod(date, granularity)
+		if len(points) == 0 || !period.Equal(currentPeriod) {
+			currentPeriod = period
+			points = append(points, models.PortfolioHistoryPoint{})
+		}
+		point := &points[len(points)-1]
+		point.Date = date
+		point.Currency = snapshot.Currency
+		point.Value = snapshot.Value
+		point.NetFlow += snapshot.NetFlow
+	}
+	return points
+}
+
+// historyPeriod returns the first day of the day, week (starting Monday) or month containing date
+func historyPeriod(date time.Time, granularity string) time.Time {
+	switch granularity {
+	case models.HistoryGranularityWeek:
+		offset := (int(date.Weekday()) + 6) % 7
+		return date.AddDate(0, 0, -offset)
+	case models.HistoryGranularityMonth:
+		return time.Date(date.Year(), date.Month(), 1, 0, 0, 0, 0, time.UTC)
+	default:
+		return date
+	}
+}
@@ -0,0 +1,168 @@
+package services
+
+import (
+	"asset-dairy/models"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+// MockPortfolioSnapshotRepository is a mock implementation of PortfolioSnapshotRepositoryInterface
+type MockPortfolioSnapshotRepository struct {
+	mock.Mock
+}
+
+func (m *MockPortfolioSnapshotRepository) ListSnapshotUserIDs() ([]string, error) {
+	args := m.Called()
+	return args.Get(0).([]string), args.Error(1)
+}
+
+func (m *MockPortfolioSnapshotRepository) LatestSnapshot(userID string) (*models.PortfolioSnapshot, error) {
+	args := m.Called(userID)
+	return args.Get(0).(*models.PortfolioSnapshot), args.Error(1)
+}
+
+func (m *MockPortfolioSnapshotRepository) EarliestTradeDate(userID string) (*time.Time, error) {
+	args := m.Called(userID)
+	return args.Get(0).(*time.Time), args.Error(1)
+}
+
+func (m *MockPortfolioSnapshotRepository) GetStaleDate(userID string) (*models.PortfolioSnapshotStaleDate, error) {
+	args := m.Called(userID)
+	return args.Get(0).(*models.PortfolioSnapshotStaleDate), args.Error(1)
+}
+
+func (m *MockPortfolioSnapshotRepository) ReplaceSnapshots(userID string, from, to time.Time, snapshots []models.PortfolioSnapshot, stale *models.PortfolioSnapshotStaleDate) error {
+	args := m.Called(userID, from, to, snapshots, stale)
+	return args.Error(0)
+}
+
+func (m *MockPortfolioSnapshotRepository) ListSnapshots(userID string, accountID *string, from, to time.Time) ([]models.PortfolioSnapshot, error) {
+	args := m.Called(userID, accountID, from, to)
+	return args.Get(0).([]models.PortfolioSnapshot), args.Error(1)
+}
+
+// MockPerformanceService is a mock implementation of PerformanceServiceInterface
+type MockPerformanceService struct {
+	mock.Mock
+}
+
+func (m *MockPerformanceService) DailyValuations(userID, currency string, from, to time.Time) ([]models.PortfolioSnapshot, error) {
+	args := m.Called(userID, currency, from, to)
+	return args.Get(0).([]models.PortfolioSnapshot), args.Error(1)
+}
+
+// Add stub methods to satisfy PerformanceServiceInterface
+func (m *MockPerformanceService) GetPerformance(userID, currency, period string, from, to time.Time) (*models.PerformanceReport, error) {
+	panic("not implemented")
+}
+
+func TestSnapshotUser(t *testing.T) {
+	userID := "user1"
+	day := func(d int) time.Time { return time.Date(2024, 6, d, 0, 0, 0, 0, time.UTC) }
+	firstTrade := time.Date(2024, 1, 2, 0, 0, 0, 0, time.UTC)
+	marked := time.Date(2024, 6, 11, 8, 30, 0, 0, time.UTC)
+	staleFrom := func(date time.Time) *models.PortfolioSnapshotStaleDate {
+		return &models.PortfolioSnapshotStaleDate{UserID: userID, StaleFrom: date, MarkedAt: marked}
+	}
+	tests := []struct {
+		name         string
+		firstTrade   *time.Time
+		latest       *models.PortfolioSnapshot
+		stale        *models.PortfolioSnapshotStaleDate
+		expectedFrom time.Time
+	}{
+		{
+			name:         "snapshots should resume the day after the latest one",
+			firstTrade:   &firstTrade,
+			latest:       &models.PortfolioSnapshot{Date: day(9), Currency: "TWD"},
+			expectedFrom: day(10),
+		},
+		{
+			name:         "change taking effect before the latest snapshot should rewind to its date",
+			firstTrade:   &firstTrade,
+			latest:       &models.PortfolioSnapshot{Date: day(9), Currency: "TWD"},
+			stale:        staleFrom(day(5)),
+			expectedFrom: day(5),
+		},
+		{
+			name:         "change taking effect after the latest snapshot should not skip missing days",
+			firstTrade:   &firstTrade,
+			latest:       &models.PortfolioSnapshot{Date: day(9), Currency: "TWD"},
+			stale:        staleFrom(day(11)),
+			expectedFrom: day(10),
+		},
+		{
+			name:         "changed reporting currency should rebuild from the first trade",
+			firstTrade:   &firstTrade,
+			latest:       &models.PortfolioSnapshot{Date: day(9), Currency: "USD"},
+			stale:        staleFrom(day(5)),
+			expectedFrom: firstTrade,
+		},
+		{
+			name:         "first pass should build from the first trade",
+			firstTrade:   &firstTrade,
+			latest:       nil,
+			expectedFrom: firstTrade,
+		},
+		{
+			name:       "snapshots up to date should write nothing",
+			firstTrade: &firstTrade,
+			latest:     &models.PortfolioSnapshot{Date: day(12), Currency: "TWD"},
+		},
+		{
+			name:       "user without trades should write nothing",
+			firstTrade: nil,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockRepo := new(MockPortfolioSnapshotRepository)
+			mockPerformanceService := new(MockPerformanceService)
+			mockProfileService := new(MockProfileService)
+			service := NewSnapshotService(mockRepo, mockPerformanceService, mockProfileService, new(MockFxService))
+			snapshots := []models.PortfolioSnapshot{{UserID: userID, Date: day(12)}}
+
+			mockProfileService.On("GetProfile", userID).Return(&models.Profile{InvestmentProfile: &models.InvestmentProfile{DefaultCurrency: "TWD"}}, nil)
+			mockRepo.On("EarliestTradeDate", userID).Return(tt.firstTrade, nil)
+			if tt.firstTrade != nil {
+				mockRepo.On("LatestSnapshot", userID).Return(tt.latest, nil)
+				mockRepo.On("GetStaleDate", userID).Return(tt.stale, nil)
+			}
+			if !tt.expectedFrom.IsZero() {
+				mockPerformanceService.On("DailyValuations", userID, "TWD", tt.expectedFrom, day(12)).Return(snapshots, nil)
+				mockRepo.On("ReplaceSnapshots", userID, tt.expectedFrom, day(12), snapshots, tt.stale).Return(nil)
+			}
+
+			count, err := service.SnapshotUser(userID, day(12))
+
+			assert.NoError(t, err)
+			mockRepo.AssertExpectations(t)
+			mockPerformanceService.AssertExpectations(t)
+			if tt.expectedFrom.IsZero() {
+				assert.Equal(t, 0, count)
+				return
+			}
+			assert.Equal(t, len(snapshots), count)
+		})
+	}
+}
+
+func TestHistoryPoints_MonthlyKeepsLastValueAndSumsFlows(t *testing.T) {
+	snapshots := []models.PortfolioSnapshot{
+		{Date: time.Date(2024, 1, 30, 0, 0, 0, 0, time.UTC), Currency: "USD", Value: 100, NetFlow: 100},
+		{Date: time.Date(2024, 1, 31, 0, 0, 0, 0, time.UTC), Currency: "USD", Value: 150, NetFlow: 40},
+		{Date: time.Date(2024, 2, 1, 0, 0, 0, 0, time.UTC), Currency: "USD", Value: 160},
+	}
+
+	points := historyPoints(snapshots, models.HistoryGranularityMonth)
+
+	assert.Len(t, points, 2)
+	assert.Equal(t, time.Date(2024, 1, 31, 0, 0, 0, 0, time.UTC), points[0].Date)
+	assert.Equal(t, 150.0, points[0].Value)
+	assert.Equal(t, 140.0, points[0].NetFlow)
+	assert.Equal(t, 160.0, points[1].Value)
+}
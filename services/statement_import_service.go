@@ -0,0 +1,489 @@
+package services
+
+import (
+	"asset-dairy/models"
+	"asset-dairy/repositories"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"math"
+	"strings"
+
+	"github.com/google/uuid"
+)
+
+var ErrInvalidStatement = errors.New("invalid statement")
+
+type StatementImportServiceInterface interface {
+	ImportOFX(userID, accountID string, r io.Reader, commit bool) (*models.StatementImportResult, error)
+}
+
+type StatementImportService struct {
+	tradeService      TradeServiceInterface
+	cashLedgerService CashLedgerServiceInterface
+	incomeService     IncomeServiceInterface
+	accountService    AccountServiceInterface
+	instrumentService InstrumentServiceInterface
+	actionService     CorporateActionServiceInterface
+	repo              repositories.StatementImportRepositoryInterface
+}
+
+// NewStatementImportService creates a StatementImportService. Statements become trades, cash
+// ledger entries and income events checked by their services; securities the statement does
+// not name a ticker for are looked up in the instrument catalog, and the repository tells
+// which transactions an earlier import already stored and stores the new ones.
+func NewStatementImportService(tradeService TradeServiceInterface, cashLedgerService CashLedgerServiceInterface, incomeService IncomeServiceInterface, accountService AccountServiceInterface, instrumentService InstrumentServiceInterface, actionService CorporateActionServiceInterface, repo repositories.StatementImportRepositoryInterface) *StatementImportService {
+	return &StatementImportService{
+		tradeService:      tradeService,
+		cashLedgerService: cashLedgerService,
+		incomeService:     incomeService,
+		accountService:    accountService,
+		instrumentService: instrumentService,
+		actionService:     actionService,
+		repo:              repo,
+	}
+}
+
+// ImportOFX reads the investment and bank transactions of an OFX or QFX statement into one of
+// the user's accounts:
+//
+//   - buys and sells of stocks and mutual funds become trades
+//   - income becomes a cash dividend or, for interest, a coupon, net of withholding
+//   - reinvested income becomes the income and a buy of the units it paid for
+//   - securities transferred in or out become a buy or sell marked as a transfer, at the unit
+//     price or average cost basis and offset by a deposit or withdrawal so the account's cash
+//     is unchanged; a transfer out closes lots without realizing a gain
+//   - bank transactions become interest, fees, deposits or withdrawals
+//
+// Every record keeps the transaction's FITID, and transactions whose records are already
+// stored are reported as duplicates and skipped, so a statement can be imported again safely.
+// Nothing is stored unless commit is set, and then the records of all valid rows are stored in
+// one transaction, checked and stored while the user's trades are locked against other changes.
+func (s *StatementImportService) ImportOFX(userID, accountID string, r io.Reader, commit bool) (*models.StatementImportResult, error) {
+	if !commit {
+		return s.importOFX(userID, accountID, r, false)
+	}
+	var result *models.StatementImportResult
+	err := s.tradeService.WithUserLock(userID, func() error {
+		var err error
+		result, err = s.importOFX(userID, accountID, r, true)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+func (s *StatementImportService) importOFX(userID, accountID string, r io.Reader, commit bool) (*models.StatementImportResult, error) {
+	account, err := s.account(userID, accountID)
+	if err != nil {
+		return nil, err
+	}
+	document, err := parseOFX(r)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidStatement, err)
+	}
+	for _, statement := range document.Statements[1:] {
+		if statement.AccountID != document.Statements[0].AccountID {
+			return nil, fmt.Errorf("%w: the file holds statements of accounts %s and %s, import them one at a time", ErrInvalidStatement, document.Statements[0].AccountID, statement.AccountID)
+		}
+	}
+	imported, err := s.repo.ListExternalIDs(userID, account.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	mapper := &statementMapper{
+		account:           account,
+		securities:        document.Securities,
+		instrumentService: s.instrumentService,
+		searched:          map[string]bool{},
+	}
+	rows := []models.StatementImportRow{}
+	seen := map[string]bool{}
+	for _, statement := range document.Statements {
+		for _, transaction := range statement.Transactions {
+			row, err := mapper.row(statement, transaction)
+			if err != nil {
+				return nil, err
+			}
+			if len(row.Errors) == 0 {
+				if seen[row.FITID] {
+					row.Trade, row.CashEntry, row.IncomeEvent = nil, nil, nil
+				}
+				seen[row.FITID] = true
+				skipImported(&row, imported)
+			}
+			rows = append(rows, row)
+		}
+	}
+	return s.importRows(userID, account, rows, commit)
+}
+
+// importRows checks the records of the rows, income events and cash entries one row at a time
+// and trades as a batch, and, when committing, stores the records of the valid rows
+func (s *StatementImportService) importRows(userID string, account *models.Account, rows []models.StatementImportRow, commit bool) (*models.StatementImportResult, error) {
+	for i, row := range rows {
+		if len(row.Errors) > 0 {
+			continue
+		}
+		if row.IncomeEvent != nil {
+			event, err := s.incomeService.ValidateEvent(userID, *row.IncomeEvent)
+			if errors.Is(err, ErrInvalidIncomeEvent) || errors.Is(err, ErrFxRateNotFound) {
+				rows[i].Errors = append(rows[i].Errors, err.Error())
+				continue
+			}
+			if err != nil {
+				return nil, err
+			}
+			rows[i].IncomeEvent = event
+		}
+		if row.CashEntry != nil {
+			entries, err := s.cashLedgerService.ValidateEntries(userID, account.ID, []models.CashLedgerEntry{*row.CashEntry})
+			if errors.Is(err, ErrInvalidCashEntry) {
+				rows[i].Errors = append(rows[i].Errors, err.Error())
+				continue
+			}
+			if err != nil {
+				return nil, err
+			}
+			rows[i].CashEntry = &entries[0]
+		}
+	}
+
+	trades := []models.Trade{}
+	tradeRows := []int{}
+	for i, row := range rows {
+		if row.Trade != nil && len(row.Errors) == 0 {
+			trades = append(trades, *row.Trade)
+			tradeRows = append(tradeRows, i)
+		}
+	}
+	prepared, rejections, err := s.tradeService.ValidateTrades(userID, trades)
+	if err != nil {
+		return nil, err
+	}
+	for j, i := range tradeRows {
+		trade := prepared[j]
+		rows[i].Trade = &trade
+		if rejections[j] != nil {
+			rows[i].Errors = append(rows[i].Errors, rejections[j].Error())
+			continue
+		}
+		// The deposit or withdrawal offsetting a transfer matches its settlement exactly
+		if rows[i].CashEntry != nil && trade.Settlement != nil {
+			rows[i].CashEntry.Amount = -trade.Settlement.Amount
+		}
+	}
+
+	result := &models.StatementImportResult{AccountID: account.ID, Rows: rows}
+	if !commit {
+		return result, nil
+	}
+
+	validTrades := []models.Trade{}
+	entries := []models.CashLedgerEntry{}
+	events := []models.IncomeEvent{}
+	for _, row := range rows {
+		if len(row.Errors) > 0 {
+			continue
+		}
+		if row.Trade != nil {
+			validTrades = append(validTrades, *row.Trade)
+		}
+		if row.CashEntry != nil {
+			entries = append(entries, *row.CashEntry)
+		}
+		if row.IncomeEvent != nil {
+			events = append(events, *row.IncomeEvent)
+		}
+	}
+	if err := s.repo.CreateRecords(userID, validTrades, entries, events); err != nil {
+		return nil, err
+	}
+	// The records are stored, so cash that fails to sync is left for the next change to rewrite
+	if err := s.actionService.SyncCash(userID); err != nil {
+		log.Println("Failed to sync corporate action cash:", err)
+	}
+	result.Committed = true
+	return result, nil
+}
+
+// account finds one of the user's accounts, mapping a missing one to ErrAccountNotFound
+func (s *StatementImportService) account(userID, accountID string) (*models.Account, error) {
+	accounts, err := s.accountService.ListAccounts(userID)
+	if err != nil {
+		return nil, err
+	}
+	for i := range accounts {
+		if accounts[i].ID == accountID {
+			return &accounts[i], nil
+		}
+	}
+	return nil, ErrAccountNotFound
+}
+
+// skipImported leaves out the records of a row that are already stored, marking the row a
+// duplicate when none are left
+func skipImported(row *models.StatementImportRow, imported *models.ImportedExternalIDs) {
+	if row.Trade != nil && imported.Trades[row.FITID] {
+		row.Trade = nil
+	}
+	if row.CashEntry != nil && imported.CashEntries[row.FITID] {
+		row.CashEntry = nil
+	}
+	if row.IncomeEvent != nil && imported.IncomeEvents[row.FITID] {
+		row.IncomeEvent = nil
+	}
+	row.Duplicate = row.Trade == nil && row.CashEntry == nil && row.IncomeEvent == nil
+}
+
+// statementMapper turns the transactions of a statement into the records of an account
+type statementMapper struct {
+	account           *models.Account
+	securities        map[string]ofxSecurity
+	instrumentService InstrumentServiceInterface
+	searched          map[string]bool // SECIDs already looked up in the catalog
+}
+
+// ofxIncomeTypes maps the INCOMETYPE of income and reinvestments to income event types
+var ofxIncomeTypes = map[string]string{
+	"DIV":      models.IncomeCashDividend,
+	"CGLONG":   models.IncomeCashDividend,
+	"CGSHORT":  models.IncomeCashDividend,
+	"MISC":     models.IncomeCashDividend,
+	"INTEREST": models.IncomeCoupon,
+}
+
+// row maps one transaction. Transactions that cannot be mapped come back with errors; the
+// error result is reserved for failures to look up a security.
+func (m *statementMapper) row(statement ofxStatement, transaction ofxTransaction) (models.StatementImportRow, error) {
+	row := models.StatementImportRow{
+		FITID:  transaction.FITID,
+		Type:   transaction.Kind,
+		Date:   transaction.Date,
+		Errors: append([]string{}, transaction.Problems...),
+	}
+	if row.FITID == "" {
+		row.Errors = append(row.Errors, "missing FITID")
+	}
+	if len(row.Errors) > 0 {
+		return row, nil
+	}
+
+	currency := transaction.Currency
+	if currency == "" {
+		currency = statement.Currency
+	}
+	if currency == "" {
+		currency = m.account.Currency
+	}
+	memo := transactionMemo(transaction)
+	fail := func(format string, args ...interface{}) (models.StatementImportRow, error) {
+		row.Errors = append(row.Errors, fmt.Sprintf(format, args...))
+		return row, nil
+	}
+
+	if transaction.Kind == "STMTTRN" {
+		if !strings.EqualFold(currency, m.account.Currency) {
+			return fail("amounts in %s cannot be recorded in a %s account", currency, m.account.Currency)
+		}
+		if transaction.Amount == 0 {
+			return fail("TRNAMT must not be zero")
+		}
+		entryType := models.CashEntryDeposit
+		switch {
+		case transaction.TrnType == "INT" || transaction.TrnType == "DIV":
+			entryType = models.CashEntryInterest
+		case transaction.TrnType == "FEE" || transaction.TrnType == "SRVCHG":
+			entryType = models.CashEntryFee
+		case transaction.Amount < 0:
+			entryType = models.CashEntryWithdrawal
+		}
+		row.CashEntry = m.cashEntry(transaction, entryType, transaction.Amount, memo)
+		return row, nil
+	}
+
+	switch transaction.Kind {
+	case "BUYSTOCK", "SELLSTOCK", "BUYMF", "SELLMF", "INCOME", "REINVEST", "TRANSFER":
+	default:
+		return fail("%s transactions are not supported", transaction.Kind)
+	}
+	security, err := m.security(transaction.SecurityID)
+	if err != nil {
+		return row, err
+	}
+	if security.Ticker == "" {
+		return fail("unknown security %q", transaction.SecurityID)
+	}
+	if strings.HasSuffix(transaction.Kind, "MF") {
+		security.AssetType = models.AssetClassMutualFund
+	}
+	if security.AssetType == models.AssetClassBond || security.AssetType == models.AssetClassOption {
+		return fail("%s securities are not supported", security.AssetType)
+	}
+
+	switch transaction.Kind {
+	case "INCOME":
+		event, problem := m.incomeEvent(transaction, security, currency, math.Abs(transaction.Total), memo)
+		if problem != "" {
+			return fail("%s", problem)
+		}
+		row.IncomeEvent = event
+	case "REINVEST":
+		gross := math.Abs(transaction.Total)
+		if gross == 0 {
+			gross = math.Abs(transaction.Units)*transaction.UnitPrice + transaction.Commission + transaction.Fees + transaction.Taxes
+		}
+		event, problem := m.incomeEvent(transaction, security, currency, gross, memo)
+		if problem != "" {
+			return fail("%s", problem)
+		}
+		trade, problem := m.trade(transaction, security, currency, "buy", transaction.UnitPrice, memo)
+		if problem != "" {
+			return fail("%s", problem)
+		}
+		row.IncomeEvent, row.Trade = event, trade
+	case "TRANSFER":
+		price := transaction.UnitPrice
+		if price == 0 {
+			price = transaction.AvgCostBasis
+		}
+		tradeType, entryType, sign := "buy", models.CashEntryDeposit, 1.0
+		switch transaction.TransferAction {
+		case "IN":
+		case "OUT":
+			tradeType, entryType, sign = "sell", models.CashEntryWithdrawal, -1.0
+		default:
+			return fail("unknown TFERACTION %q", transaction.TransferAction)
+		}
+		trade, problem := m.trade(transaction, security, currency, tradeType, price, memo)
+		if problem != "" {
+			return fail("%s", problem)
+		}
+		trade.Transfer = true
+		// Stand-in until the trade's settlement gives the amount in the account currency
+		row.Trade = trade
+		row.CashEntry = m.cashEntry(transaction, entryType, sign*trade.Quantity*trade.Price, memo)
+	default:
+		tradeType := "buy"
+		if strings.HasPrefix(transaction.Kind, "SELL") {
+			tradeType = "sell"
+		}
+		trade, problem := m.trade(transaction, security, currency, tradeType, transaction.UnitPrice, memo)
+		if problem != "" {
+			return fail("%s", problem)
+		}
+		row.Trade = trade
+	}
+	return row, nil
+}
+
+// trade builds the trade of a transaction, or explains why it cannot
+func (m *statementMapper) trade(transaction ofxTransaction, security ofxSecurity, currency, tradeType string, price float64, memo *string) (*models.Trade, string) {
+	if transaction.Units == 0 {
+		return nil, "UNITS must not be zero"
+	}
+	if price <= 0 {
+		return nil, "UNITPRICE must be positive"
+	}
+	assetType := security.AssetType
+	if assetType == "" {
+		assetType = models.AssetClassStock
+	}
+	externalID := transaction.FITID
+	return &models.Trade{
+		ID:         uuid.New().String(),
+		Type:       tradeType,
+		AssetType:  assetType,
+		Ticker:     security.Ticker,
+		TradeDate:  transaction.Date,
+		Quantity:   math.Abs(transaction.Units),
+		Price:      price,
+		Currency:   currency,
+		AccountID:  m.account.ID,
+		Reason:     memo,
+		Fee:        math.Abs(transaction.Commission) + math.Abs(transaction.Fees),
+		Tax:        math.Abs(transaction.Taxes),
+		ExternalID: &externalID,
+	}, ""
+}
+
+// incomeEvent builds the income event of a transaction, or explains why it cannot
+func (m *statementMapper) incomeEvent(transaction ofxTransaction, security ofxSecurity, currency string, gross float64, memo *string) (*models.IncomeEvent, string) {
+	eventType, ok := ofxIncomeTypes[transaction.IncomeType]
+	if !ok {
+		return nil, fmt.Sprintf("unknown INCOMETYPE %q", transaction.IncomeType)
+	}
+	withholding := math.Abs(transaction.Withholding)
+	if withholding > gross {
+		return nil, "WITHHOLDING cannot exceed TOTAL"
+	}
+	externalID := transaction.FITID
+	return &models.IncomeEvent{
+		AccountID:      m.account.ID,
+		Ticker:         security.Ticker,
+		Type:           eventType,
+		PayDate:        transaction.Date,
+		GrossAmount:    gross,
+		WithholdingTax: withholding,
+		Currency:       currency,
+		Memo:           memo,
+		ExternalID:     &externalID,
+	}, ""
+}
+
+func (m *statementMapper) cashEntry(transaction ofxTransaction, entryType string, amount float64, memo *string) *models.CashLedgerEntry {
+	externalID := transaction.FITID
+	return &models.CashLedgerEntry{
+		AccountID:  m.account.ID,
+		Type:       entryType,
+		Amount:     amount,
+		Currency:   m.account.Currency,
+		EntryDate:  transaction.Date,
+		Memo:       memo,
+		ExternalID: &externalID,
+	}
+}
+
+// security resolves a SECID through the statement's security list or, when that names no
+// ticker, the instrument catalog by CUSIP or ISIN. An unknown security has no ticker.
+func (m *statementMapper) security(id string) (ofxSecurity, error) {
+	security := m.securities[id]
+	if security.Ticker != "" || id == "" || m.searched[id] {
+		return security, nil
+	}
+	instruments, err := m.instrumentService.SearchInstruments(id)
+	if err != nil {
+		return security, err
+	}
+	for _, instrument := range instruments {
+		if (instrument.CUSIP != nil && strings.EqualFold(*instrument.CUSIP, id)) || (instrument.ISIN != nil && strings.EqualFold(*instrument.ISIN, id)) {
+			security.Ticker = instrument.Symbol
+			if security.AssetType == "" {
+				security.AssetType = instrument.AssetClass
+			}
+			break
+		}
+	}
+	m.securities[id] = security
+	m.searched[id] = true
+	return security, nil
+}
+
+// transactionMemo joins the payee name and memo of a transaction
+func transactionMemo(transaction ofxTransaction) *string {
+	parts := []string{}
+	for _, part := range []string{transaction.Name, transaction.Memo} {
+		if part != "" {
+			parts = append(parts, part)
+		}
+	}
+	if len(parts) == 0 {
+		return nil
+	}
+	memo := strings.Join(parts, " - ")
+	return &memo
+}
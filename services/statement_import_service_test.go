@@ -0,0 +1,195 @@
+package services
+
+import (
+	"asset-dairy/models"
+	"errors"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+// MockStatementImportRepository is a mock implementation of StatementImportRepositoryInterface
+type MockStatementImportRepository struct {
+	mock.Mock
+}
+
+func (m *MockStatementImportRepository) ListExternalIDs(userID, accountID string) (*models.ImportedExternalIDs, error) {
+	args := m.Called(userID, accountID)
+	return args.Get(0).(*models.ImportedExternalIDs), args.Error(1)
+}
+
+func (m *MockStatementImportRepository) CreateRecords(userID string, trades []models.Trade, entries []models.CashLedgerEntry, events []models.IncomeEvent) error {
+	args := m.Called(userID, trades, entries, events)
+	return args.Error(0)
+}
+
+func TestImportOFX(t *testing.T) {
+	day := func(m time.Month, d int) time.Time {
+		return time.Date(2024, m, d, 0, 0, 0, 0, time.UTC)
+	}
+	account := models.Account{ID: "acc-1", Name: "Broker", Currency: "USD"}
+	// The buy was imported before, and so was the income of the reinvestment but not its buy
+	importedBuyID := "T-1001"
+	imported := &models.ImportedExternalIDs{
+		Trades:       map[string]bool{"T-1001": true},
+		CashEntries:  map[string]bool{},
+		IncomeEvents: map[string]bool{"T-1004": true},
+	}
+	msftCUSIP := "594918104"
+
+	type mocks struct {
+		trades *MockTradeRepository
+		cash   *MockCashLedgerRepository
+		income *MockIncomeEventRepository
+		repo   *MockStatementImportRepository
+	}
+	newService := func() (*StatementImportService, mocks) {
+		m := mocks{new(MockTradeRepository), new(MockCashLedgerRepository), new(MockIncomeEventRepository), new(MockStatementImportRepository)}
+		m.trades.On("ListTrades", "test-user").Return([]models.Trade{
+			{ID: "b1", Type: "buy", AssetType: "stock", Ticker: "AAPL", TradeDate: day(1, 2), Quantity: 10, Price: 185.25, Currency: "USD", AccountID: "acc-1", ExternalID: &importedBuyID},
+		}, nil)
+		m.trades.On("ListShortableAccountIDs", "test-user").Return([]string{}, nil)
+		m.trades.On("ListReceivedUnits", "test-user").Return([]models.IncomeEvent{}, nil)
+		m.trades.On("GetCostBasisMethods", "test-user").Return("", map[string]string{}, nil)
+		m.trades.On("GetAccountCurrency", "test-user", "acc-1").Return("USD", nil)
+		m.cash.On("GetAccount", "test-user", "acc-1").Return(&account, nil)
+		m.income.On("GetAccountCurrency", "test-user", "acc-1").Return("USD", nil)
+
+		mockAccountService := new(MockAccountService)
+		mockAccountService.On("ListAccounts", "test-user").Return([]models.Account{account}, nil)
+		mockInstrumentService := noInstruments()
+		mockInstrumentService.On("SearchInstruments", msftCUSIP).Return([]models.Instrument{
+			{Symbol: "MSFT", AssetClass: "stock", Currency: "USD", CUSIP: &msftCUSIP},
+		}, nil)
+		m.repo.On("ListExternalIDs", "test-user", "acc-1").Return(imported, nil)
+		m.repo.On("CreateRecords", "test-user", mock.Anything, mock.Anything, mock.Anything).Return(nil)
+		mockFxService := new(MockFxService)
+		mockFxService.On("Converter").Return(NewFxConverter([]models.FxRate{}, "USD"), nil)
+
+		actionService := withCorporateActions()
+		tradeService := NewTradeService(m.trades, mockFxService, actionService, mockInstrumentService)
+		incomeService := NewIncomeService(m.income, new(MockProfileService), mockFxService, tradeService)
+		service := NewStatementImportService(tradeService, NewCashLedgerService(m.cash), incomeService, mockAccountService, mockInstrumentService, actionService, m.repo)
+		return service, m
+	}
+	importFile := func(service *StatementImportService, name string, commit bool) (*models.StatementImportResult, error) {
+		file, err := os.Open(name)
+		assert.NoError(t, err)
+		defer file.Close()
+		return service.ImportOFX("test-user", "acc-1", file, commit)
+	}
+
+	service, m := newService()
+	preview, err := importFile(service, "testdata/investment.qfx", false)
+	assert.NoError(t, err)
+	assert.False(t, preview.Committed)
+	m.repo.AssertNotCalled(t, "CreateRecords", "test-user", mock.Anything, mock.Anything, mock.Anything)
+
+	rows := preview.Rows
+	assert.Len(t, rows, 8)
+
+	assert.True(t, rows[0].Duplicate)
+	assert.Nil(t, rows[0].Trade)
+
+	sell := rows[1]
+	assert.Empty(t, sell.Errors)
+	assert.False(t, sell.Duplicate)
+	assert.Equal(t, "sell", sell.Trade.Type)
+	assert.Equal(t, "AAPL", sell.Trade.Ticker)
+	assert.Equal(t, 4.0, sell.Trade.Quantity)
+	assert.Equal(t, 1.0, sell.Trade.Fee)
+	assert.Equal(t, 0.02, sell.Trade.Tax)
+	assert.Equal(t, "T-1002", *sell.Trade.ExternalID)
+	assert.NotNil(t, sell.Trade.Settlement)
+
+	income := rows[2].IncomeEvent
+	assert.Equal(t, models.IncomeCashDividend, income.Type)
+	assert.Equal(t, "AAPL", income.Ticker)
+	assert.Equal(t, 2.4, income.GrossAmount)
+	assert.Equal(t, 0.72, income.WithholdingTax)
+	assert.Equal(t, day(1, 15), income.PayDate)
+
+	reinvest := rows[3]
+	assert.False(t, reinvest.Duplicate)
+	assert.Nil(t, reinvest.IncomeEvent)
+	assert.Equal(t, "VOO", reinvest.Trade.Ticker)
+	assert.Equal(t, 0.125, reinvest.Trade.Quantity)
+
+	transfer := rows[4]
+	assert.Empty(t, transfer.Errors)
+	assert.Equal(t, "MSFT", transfer.Trade.Ticker)
+	assert.Equal(t, "buy", transfer.Trade.Type)
+	assert.Equal(t, 300.0, transfer.Trade.Price)
+	assert.Equal(t, models.CashEntryDeposit, transfer.CashEntry.Type)
+	assert.Equal(t, 1500.0, transfer.CashEntry.Amount)
+
+	assert.Equal(t, models.CashEntryDeposit, rows[5].CashEntry.Type)
+	assert.Equal(t, 5000.0, rows[5].CashEntry.Amount)
+	assert.Equal(t, "Wire from checking", *rows[5].CashEntry.Memo)
+	assert.Equal(t, models.CashEntryInterest, rows[6].CashEntry.Type)
+	assert.Equal(t, []string{"SPLIT transactions are not supported"}, rows[7].Errors)
+
+	service, m = newService()
+	committed, err := importFile(service, "testdata/investment.qfx", true)
+	assert.NoError(t, err)
+	assert.True(t, committed.Committed)
+	m.repo.AssertNumberOfCalls(t, "CreateRecords", 1)
+	records := m.repo.Calls[1].Arguments
+	trades := records.Get(1).([]models.Trade)
+	assert.Len(t, trades, 3)
+	assert.Equal(t, "T-1002", *trades[0].ExternalID)
+	assert.Equal(t, "VOO", trades[1].Ticker)
+	assert.Equal(t, "MSFT", trades[2].Ticker)
+	assert.True(t, trades[2].Transfer)
+	entries := records.Get(2).([]models.CashLedgerEntry)
+	assert.Len(t, entries, 3)
+	assert.Equal(t, "T-1005", *entries[0].ExternalID)
+	assert.Equal(t, 5000.0, entries[1].Amount)
+	assert.Equal(t, models.CashEntryInterest, entries[2].Type)
+	assert.Equal(t, "test-user", entries[2].UserID)
+	assert.Equal(t, "USD", entries[2].Currency)
+	events := records.Get(3).([]models.IncomeEvent)
+	assert.Len(t, events, 1)
+	assert.Equal(t, "T-1003", *events[0].ExternalID)
+	assert.InDelta(t, 2.4-0.72, events[0].Settlement.Amount, 1e-9)
+
+	// A transfer out is a sell marked as a transfer, and income without a rate into the
+	// account currency is rejected before anything is stored
+	service, m = newService()
+	transfers, err := importFile(service, "testdata/transfers.qfx", true)
+	assert.NoError(t, err)
+	rows = transfers.Rows
+	assert.Len(t, rows, 2)
+	assert.Empty(t, rows[0].Errors)
+	assert.Equal(t, "sell", rows[0].Trade.Type)
+	assert.True(t, rows[0].Trade.Transfer)
+	assert.Equal(t, models.CashEntryWithdrawal, rows[0].CashEntry.Type)
+	assert.Equal(t, -741.0, rows[0].CashEntry.Amount)
+	assert.Len(t, rows[1].Errors, 1)
+	assert.Contains(t, rows[1].Errors[0], ErrFxRateNotFound.Error())
+	events = m.repo.Calls[1].Arguments.Get(3).([]models.IncomeEvent)
+	assert.Empty(t, events)
+
+	service, _ = newService()
+	bank, err := importFile(service, "testdata/checking.ofx", false)
+	assert.NoError(t, err)
+	rows = bank.Rows
+	assert.Len(t, rows, 5)
+	assert.Equal(t, "Payroll - February salary", *rows[0].CashEntry.Memo)
+	assert.Equal(t, models.CashEntryWithdrawal, rows[1].CashEntry.Type)
+	assert.Equal(t, -1000.0, rows[1].CashEntry.Amount)
+	assert.Equal(t, models.CashEntryFee, rows[2].CashEntry.Type)
+	assert.Equal(t, -12.5, rows[2].CashEntry.Amount)
+	assert.Equal(t, models.CashEntryInterest, rows[3].CashEntry.Type)
+	assert.Len(t, rows[4].Errors, 1)
+	assert.Nil(t, rows[4].CashEntry)
+
+	_, err = service.ImportOFX("test-user", "acc-1", strings.NewReader("OFXHEADER:100\nnot a statement"), false)
+	assert.True(t, errors.Is(err, ErrInvalidStatement), "expected %v, got %v", ErrInvalidStatement, err)
+	_, err = service.ImportOFX("test-user", "acc-2", strings.NewReader(""), false)
+	assert.True(t, errors.Is(err, ErrAccountNotFound), "expected %v, got %v", ErrAccountNotFound, err)
+}
@@ -0,0 +1,85 @@
+package services
+
+import (
+	"asset-dairy/models"
+	"errors"
+	"strings"
+	"time"
+)
+
+// chargeCurrency returns the currency a fee or tax was charged in, defaulting to the trade currency
+func chargeCurrency(trade models.Trade, currency *string) string {
+	if currency == nil || *currency == "" {
+		return strings.ToUpper(trade.Currency)
+	}
+	return strings.ToUpper(*currency)
+}
+
+// hasForeignCharges reports whether the trade's fee or tax is in a currency other than the trade's
+func hasForeignCharges(trade models.Trade) bool {
+	tradeCurrency := strings.ToUpper(trade.Currency)
+	return (trade.Fee != 0 && chargeCurrency(trade, trade.FeeCurrency) != tradeCurrency) ||
+		(trade.Tax != 0 && chargeCurrency(trade, trade.TaxCurrency) != tradeCurrency)
+}
+
+// chargesInTradeCurrency returns the trade with its fee and tax converted into the trade currency
+func chargesInTradeCurrency(trade models.Trade, converter *FxConverter) (models.Trade, error) {
+	fee, err := converter.Convert(trade.Fee, chargeCurrency(trade, trade.FeeCurrency), trade.Currency)
+	if err != nil {
+		return trade, err
+	}
+	tax, err := converter.Convert(trade.Tax, chargeCurrency(trade, trade.TaxCurrency), trade.Currency)
+	if err != nil {
+		return trade, err
+	}
+	trade.Fee, trade.FeeCurrency = fee, nil
+	trade.Tax, trade.TaxCurrency = tax, nil
+	return trade, nil
+}
+
+// normalizeTradeCharges converts the fee and tax of every trade charged in another currency into
+// the trade currency, at the rates known on each trade date. A trade whose charges have no rate
+// keeps them as they are and is marked, so one missing rate does not fail every holding.
+func normalizeTradeCharges(fxService FxServiceInterface, trades []models.Trade) ([]models.Trade, error) {
+	normalized := make([]models.Trade, len(trades))
+	converters := make(map[time.Time]*FxConverter)
+	for i, trade := range trades {
+		normalized[i] = trade
+		if !hasForeignCharges(trade) {
+			continue
+		}
+		date := truncateToDate(trade.TradeDate)
+		converter, ok := converters[date]
+		if !ok {
+			var err error
+			if converter, err = fxService.Converter(date); err != nil {
+				return nil, err
+			}
+			converters[date] = converter
+		}
+		converted, err := chargesInTradeCurrency(trade, converter)
+		if errors.Is(err, ErrFxRateNotFound) {
+			normalized[i].UnconvertedCharges = true
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		normalized[i] = converted
+	}
+	return normalized, nil
+}
+
+// netPrice is the per-unit price after charges, which must be in the trade currency: they
+// raise what a buy costs and lower what a sell brings in. Like the price, it is multiplied by
+// the trade's contract size to get money.
+func netPrice(trade models.Trade) float64 {
+	if trade.Quantity == 0 {
+		return trade.Price
+	}
+	charges := (trade.Fee + trade.Tax) / (trade.Quantity * trade.ContractSize())
+	if trade.Type == "sell" {
+		return trade.Price - charges
+	}
+	return trade.Price + charges
+}
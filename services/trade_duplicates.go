@@ -0,0 +1,92 @@
+package services
+
+import (
+	"asset-dairy/models"
+	"fmt"
+	"math"
+	"strings"
+)
+
+// sameTradeKey reports whether two trades agree on everything but price: account, ticker,
+// trade date, type and quantity
+func sameTradeKey(a, b models.Trade) bool {
+	return a.AccountID == b.AccountID &&
+		strings.EqualFold(a.Ticker, b.Ticker) &&
+		a.TradeDate.Format("2006-01-02") == b.TradeDate.Format("2006-01-02") &&
+		a.Type == b.Type &&
+		math.Abs(a.Quantity-b.Quantity) <= quantityEpsilon
+}
+
+// likelyDuplicates reports whether two different trades look like one trade entered twice:
+// the same key, with prices no further apart than the tolerance times the higher one
+func likelyDuplicates(a, b models.Trade, tolerance float64) bool {
+	if a.ID == b.ID || !sameTradeKey(a, b) {
+		return false
+	}
+	return math.Abs(a.Price-b.Price) <= tolerance*math.Max(math.Abs(a.Price), math.Abs(b.Price))
+}
+
+// dismissalPair orders the IDs of two trades the way dismissals store them
+func dismissalPair(tradeID, otherTradeID string) [2]string {
+	if otherTradeID < tradeID {
+		return [2]string{otherTradeID, tradeID}
+	}
+	return [2]string{tradeID, otherTradeID}
+}
+
+// duplicateGroups collects trades linked by likely duplicate pairs that were not dismissed,
+// in the order of the trades. A trade matching two others that do not match each other, on
+// price, puts all three in one group.
+func duplicateGroups(trades []models.Trade, tolerance float64, dismissed map[[2]string]bool) []models.TradeDuplicateGroup {
+	parent := make([]int, len(trades))
+	for i := range parent {
+		parent[i] = i
+	}
+	root := func(i int) int {
+		for parent[i] != i {
+			parent[i] = parent[parent[i]]
+			i = parent[i]
+		}
+		return i
+	}
+
+	buckets := map[string][]int{}
+	for i, trade := range trades {
+		key := strings.Join([]string{trade.AccountID, strings.ToUpper(trade.Ticker), trade.TradeDate.Format("2006-01-02"), trade.Type}, "|")
+		for _, j := range buckets[key] {
+			if likelyDuplicates(trades[j], trade, tolerance) && !dismissed[dismissalPair(trades[j].ID, trade.ID)] {
+				parent[root(i)] = root(j)
+			}
+		}
+		buckets[key] = append(buckets[key], i)
+	}
+
+	members := map[int][]models.Trade{}
+	order := []int{}
+	for i, trade := range trades {
+		r := root(i)
+		if _, ok := members[r]; !ok {
+			order = append(order, r)
+		}
+		members[r] = append(members[r], trade)
+	}
+	groups := []models.TradeDuplicateGroup{}
+	for _, r := range order {
+		if len(members[r]) > 1 {
+			groups = append(groups, models.TradeDuplicateGroup{Trades: members[r]})
+		}
+	}
+	return groups
+}
+
+// duplicateWarnings describes the trades a new trade looks like a duplicate of
+func duplicateWarnings(trades []models.Trade, trade models.Trade) []string {
+	var warnings []string
+	for _, existing := range trades {
+		if likelyDuplicates(existing, trade, models.DefaultDuplicatePriceTolerance) {
+			warnings = append(warnings, fmt.Sprintf("looks like a duplicate of trade %s: %s %g %s on %s at %g",
+				existing.ID, existing.Type, existing.Quantity, existing.Ticker, existing.TradeDate.Format("2006-01-02"), existing.Price))
+		}
+	}
+	return warnings
+}
@@ -0,0 +1,409 @@
+package services
+
+import (
+	"asset-dairy/models"
+	"asset-dairy/repositories"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+var (
+	ErrInvalidTradeImport    = errors.New("invalid trade import")
+	ErrImportProfileNotFound = errors.New("import profile not found")
+)
+
+type TradeImportServiceInterface interface {
+	ImportCSV(userID string, r io.Reader, mapping models.TradeImportMapping, commit bool) (*models.TradeImportResult, error)
+	ListProfiles(userID string) ([]models.TradeImportProfile, error)
+	GetProfile(userID, profileID string) (*models.TradeImportProfile, error)
+	CreateProfile(userID string, req models.TradeImportProfileRequest) (*models.TradeImportProfile, error)
+	UpdateProfile(userID, profileID string, req models.TradeImportProfileRequest) (*models.TradeImportProfile, error)
+	DeleteProfile(userID, profileID string) (bool, error)
+}
+
+type TradeImportService struct {
+	tradeService   TradeServiceInterface
+	accountService AccountServiceInterface
+	profileRepo    repositories.TradeImportProfileRepositoryInterface
+}
+
+// NewTradeImportService creates a TradeImportService. Imported rows are validated and stored
+// by the trade service, accounts are matched against the user's own, and mappings can be
+// saved as profiles.
+func NewTradeImportService(tradeService TradeServiceInterface, accountService AccountServiceInterface, profileRepo repositories.TradeImportProfileRepositoryInterface) *TradeImportService {
+	return &TradeImportService{
+		tradeService:   tradeService,
+		accountService: accountService,
+		profileRepo:    profileRepo,
+	}
+}
+
+// ImportCSV reads trades from a CSV with a header row, as laid out by the mapping, and checks
+// every row as if the rows before it were already stored. Nothing is stored unless commit is
+// set, in which case the valid rows are stored in one transaction and the invalid ones skipped.
+// A file without valid rows is not committed.
+func (s *TradeImportService) ImportCSV(userID string, r io.Reader, mapping models.TradeImportMapping, commit bool) (*models.TradeImportResult, error) {
+	parser, err := s.newRowParser(userID, mapping)
+	if err != nil {
+		return nil, err
+	}
+
+	reader := csv.NewReader(r)
+	reader.TrimLeadingSpace = true
+	reader.FieldsPerRecord = -1
+	reader.Comma = parser.delimiter
+	columns, err := readCSVColumns(reader)
+	if err != nil {
+		return nil, fmt.Errorf("%w: missing header", ErrInvalidTradeImport)
+	}
+	for _, field := range []string{"tradeDate", "type", "ticker", "quantity", "price"} {
+		if !columns.has(parser.header(field)) {
+			return nil, fmt.Errorf("%w: missing %s column %q", ErrInvalidTradeImport, field, parser.header(field))
+		}
+	}
+
+	rows := []models.TradeImportRow{}
+	for {
+		record, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrInvalidTradeImport, err)
+		}
+		if strings.TrimSpace(strings.Join(record, "")) == "" {
+			continue
+		}
+		line, _ := reader.FieldPos(0)
+		trade, problems := parser.parse(columns, record)
+		rows = append(rows, models.TradeImportRow{Row: line, Trade: trade, Errors: problems})
+	}
+	return s.importRows(userID, rows, commit)
+}
+
+// importRows validates the trades read from the rows in file order and, when committing,
+// stores the valid ones together. Nothing is committed when no row is valid.
+func (s *TradeImportService) importRows(userID string, rows []models.TradeImportRow, commit bool) (*models.TradeImportResult, error) {
+	trades := []models.Trade{}
+	readRows := []int{}
+	for i, row := range rows {
+		if row.Trade != nil && len(row.Errors) == 0 {
+			trades = append(trades, *row.Trade)
+			readRows = append(readRows, i)
+		}
+	}
+	prepared, rejections, err := s.tradeService.ValidateTrades(userID, trades)
+	if err != nil {
+		return nil, err
+	}
+
+	valid := []models.Trade{}
+	for j, i := range readRows {
+		trade := prepared[j]
+		rows[i].Trade = &trade
+		if rejections[j] != nil {
+			rows[i].Errors = append(rows[i].Errors, rejections[j].Error())
+			continue
+		}
+		valid = append(valid, trade)
+	}
+
+	result := &models.TradeImportResult{Rows: rows}
+	if !commit || len(valid) == 0 {
+		return result, nil
+	}
+	if _, err := s.tradeService.CreateTrades(userID, valid); err != nil {
+		return nil, err
+	}
+	result.Committed = true
+	return result, nil
+}
+
+func (s *TradeImportService) ListProfiles(userID string) ([]models.TradeImportProfile, error) {
+	return s.profileRepo.ListProfiles(userID)
+}
+
+func (s *TradeImportService) GetProfile(userID, profileID string) (*models.TradeImportProfile, error) {
+	profile, err := s.profileRepo.GetProfile(userID, profileID)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, ErrImportProfileNotFound
+	}
+	return profile, err
+}
+
+func (s *TradeImportService) CreateProfile(userID string, req models.TradeImportProfileRequest) (*models.TradeImportProfile, error) {
+	profile := models.TradeImportProfile{
+		ID:      uuid.New().String(),
+		UserID:  userID,
+		Name:    strings.TrimSpace(req.Name),
+		Mapping: req.Mapping,
+	}
+	if err := s.checkProfile(profile); err != nil {
+		return nil, err
+	}
+	if err := s.profileRepo.CreateProfile(profile); err != nil {
+		return nil, err
+	}
+	return s.GetProfile(userID, profile.ID)
+}
+
+// UpdateProfile replaces the name and mapping of a saved profile
+func (s *TradeImportService) UpdateProfile(userID, profileID string, req models.TradeImportProfileRequest) (*models.TradeImportProfile, error) {
+	profile := models.TradeImportProfile{
+		ID:      profileID,
+		UserID:  userID,
+		Name:    strings.TrimSpace(req.Name),
+		Mapping: req.Mapping,
+	}
+	if err := s.checkProfile(profile); err != nil {
+		return nil, err
+	}
+	updated, err := s.profileRepo.UpdateProfile(profile)
+	if err != nil {
+		return nil, err
+	}
+	if !updated {
+		return nil, ErrImportProfileNotFound
+	}
+	return s.GetProfile(userID, profileID)
+}
+
+func (s *TradeImportService) DeleteProfile(userID, profileID string) (bool, error) {
+	return s.profileRepo.DeleteProfile(userID, profileID)
+}
+
+// checkProfile rejects a profile with an invalid mapping or the name of another of the user's
+// profiles
+func (s *TradeImportService) checkProfile(profile models.TradeImportProfile) error {
+	if profile.Name == "" {
+		return fmt.Errorf("%w: name is required", ErrInvalidTradeImport)
+	}
+	if _, err := newMappingLayout(profile.Mapping); err != nil {
+		return err
+	}
+	existing, err := s.profileRepo.FindProfileByName(profile.UserID, profile.Name)
+	if err != nil {
+		return err
+	}
+	if existing != nil && existing.ID != profile.ID {
+		return fmt.Errorf("%w: a profile named %s already exists", ErrInvalidTradeImport, profile.Name)
+	}
+	return nil
+}
+
+// mappingLayout is the checked form of a mapping's formats
+type mappingLayout struct {
+	delimiter  rune
+	dateLayout string
+	types      map[string]string // lower-case word to buy or sell
+	decimal    string
+	assetType  string
+}
+
+// newMappingLayout checks the formats of a mapping and fills in their defaults
+func newMappingLayout(mapping models.TradeImportMapping) (mappingLayout, error) {
+	layout := mappingLayout{
+		delimiter:  ',',
+		dateLayout: "2006-01-02",
+		types:      map[string]string{"buy": "buy", "sell": "sell"},
+		decimal:    ".",
+		assetType:  models.AssetClassStock,
+	}
+	if mapping.Delimiter != "" {
+		delimiter, size := utf8.DecodeRuneInString(mapping.Delimiter)
+		if size != len(mapping.Delimiter) || delimiter == '"' || delimiter == '\r' || delimiter == '\n' {
+			return layout, fmt.Errorf("%w: delimiter must be a single character", ErrInvalidTradeImport)
+		}
+		layout.delimiter = delimiter
+	}
+	if mapping.DateFormat != "" {
+		for _, token := range []string{"YYYY", "MM", "DD"} {
+			if strings.Count(mapping.DateFormat, token) != 1 {
+				return layout, fmt.Errorf("%w: dateFormat must contain YYYY, MM and DD once each", ErrInvalidTradeImport)
+			}
+		}
+		layout.dateLayout = strings.NewReplacer("YYYY", "2006", "MM", "01", "DD", "02").Replace(mapping.DateFormat)
+	}
+	for word, tradeType := range mapping.TypeSynonyms {
+		if tradeType != "buy" && tradeType != "sell" {
+			return layout, fmt.Errorf("%w: type synonym %s must map to buy or sell", ErrInvalidTradeImport, word)
+		}
+		layout.types[strings.ToLower(strings.TrimSpace(word))] = tradeType
+	}
+	switch mapping.DecimalSeparator {
+	case "", ".":
+	case ",":
+		layout.decimal = ","
+	default:
+		return layout, fmt.Errorf("%w: decimalSeparator must be . or ,", ErrInvalidTradeImport)
+	}
+	if mapping.DefaultAssetType != "" {
+		if !isAssetClass(mapping.DefaultAssetType) {
+			return layout, fmt.Errorf("%w: unknown defaultAssetType %s", ErrInvalidTradeImport, mapping.DefaultAssetType)
+		}
+		layout.assetType = mapping.DefaultAssetType
+	}
+	return layout, nil
+}
+
+// tradeRowParser turns CSV records into trades of the user's accounts
+type tradeRowParser struct {
+	mappingLayout
+	mapping        models.TradeImportMapping
+	accounts       []models.Account
+	defaultAccount *models.Account
+}
+
+func (s *TradeImportService) newRowParser(userID string, mapping models.TradeImportMapping) (*tradeRowParser, error) {
+	layout, err := newMappingLayout(mapping)
+	if err != nil {
+		return nil, err
+	}
+	accounts, err := s.accountService.ListAccounts(userID)
+	if err != nil {
+		return nil, err
+	}
+	parser := &tradeRowParser{mappingLayout: layout, mapping: mapping, accounts: accounts}
+	if mapping.DefaultAccountID != "" {
+		if parser.defaultAccount = parser.findAccount(mapping.DefaultAccountID); parser.defaultAccount == nil {
+			return nil, fmt.Errorf("%w: default account %s not found", ErrInvalidTradeImport, mapping.DefaultAccountID)
+		}
+	}
+	return parser, nil
+}
+
+// header is the CSV header the mapping gives a trade field
+func (p *tradeRowParser) header(field string) string {
+	columns := p.mapping.Columns
+	names := map[string]string{
+		"tradeDate": columns.TradeDate,
+		"type":      columns.Type,
+		"ticker":    columns.Ticker,
+		"quantity":  columns.Quantity,
+		"price":     columns.Price,
+		"currency":  columns.Currency,
+		"account":   columns.Account,
+		"assetType": columns.AssetType,
+		"fee":       columns.Fee,
+		"tax":       columns.Tax,
+		"reason":    columns.Reason,
+	}
+	return firstNonEmpty(names[field], field)
+}
+
+// parse reads one record as a trade, or returns every problem found in it
+func (p *tradeRowParser) parse(columns csvColumns, record []string) (*models.Trade, []string) {
+	value := func(field string) string {
+		return columns.value(record, p.header(field))
+	}
+	problems := []string{}
+	trade := models.Trade{ID: uuid.New().String(), Ticker: value("ticker")}
+
+	tradeDate, err := time.Parse(p.dateLayout, value("tradeDate"))
+	if err != nil {
+		problems = append(problems, fmt.Sprintf("invalid tradeDate %q, use %s", value("tradeDate"), firstNonEmpty(p.mapping.DateFormat, "YYYY-MM-DD")))
+	}
+	trade.TradeDate = tradeDate
+
+	tradeType, ok := p.types[strings.ToLower(value("type"))]
+	if !ok {
+		problems = append(problems, fmt.Sprintf("unknown type %q", value("type")))
+	}
+	trade.Type = tradeType
+
+	if trade.Ticker == "" {
+		problems = append(problems, "ticker is required")
+	}
+
+	trade.AssetType = strings.ToLower(firstNonEmpty(value("assetType"), p.assetType))
+	if !isAssetClass(trade.AssetType) {
+		problems = append(problems, fmt.Sprintf("unknown assetType %q", trade.AssetType))
+	}
+
+	account := p.defaultAccount
+	if name := value("account"); name != "" {
+		if account = p.findAccount(name); account == nil {
+			problems = append(problems, fmt.Sprintf("unknown account %q", name))
+		}
+	} else if account == nil {
+		problems = append(problems, "account is required")
+	}
+	if account != nil {
+		trade.AccountID = account.ID
+		trade.Currency = strings.ToUpper(firstNonEmpty(value("currency"), p.mapping.DefaultCurrency, account.Currency))
+	}
+
+	for _, amount := range []struct {
+		field    string
+		target   *float64
+		positive bool
+	}{
+		{"quantity", &trade.Quantity, true},
+		{"price", &trade.Price, true},
+		{"fee", &trade.Fee, false},
+		{"tax", &trade.Tax, false},
+	} {
+		raw := value(amount.field)
+		if raw == "" && !amount.positive {
+			continue
+		}
+		number, err := parseImportNumber(raw, p.decimal)
+		switch {
+		case err != nil:
+			problems = append(problems, fmt.Sprintf("invalid %s %q", amount.field, raw))
+		case amount.positive && number <= 0:
+			problems = append(problems, fmt.Sprintf("%s must be positive", amount.field))
+		case number < 0:
+			problems = append(problems, fmt.Sprintf("%s must not be negative", amount.field))
+		}
+		*amount.target = number
+	}
+
+	if reason := value("reason"); reason != "" {
+		trade.Reason = &reason
+	}
+	if len(problems) > 0 {
+		return nil, problems
+	}
+	return &trade, nil
+}
+
+// findAccount matches an account by ID, or by name ignoring case
+func (p *tradeRowParser) findAccount(idOrName string) *models.Account {
+	for i := range p.accounts {
+		if p.accounts[i].ID == idOrName || strings.EqualFold(p.accounts[i].Name, idOrName) {
+			return &p.accounts[i]
+		}
+	}
+	return nil
+}
+
+// parseImportNumber reads a number written with the given decimal separator, dropping the
+// other separator as a thousands separator
+func parseImportNumber(raw, decimal string) (float64, error) {
+	raw = strings.ReplaceAll(raw, " ", "")
+	if decimal == "," {
+		raw = strings.ReplaceAll(strings.ReplaceAll(raw, ".", ""), ",", ".")
+	} else {
+		raw = strings.ReplaceAll(raw, ",", "")
+	}
+	return strconv.ParseFloat(raw, 64)
+}
+
+func isAssetClass(code string) bool {
+	for _, assetClass := range models.AssetClasses {
+		if code == assetClass {
+			return true
+		}
+	}
+	return false
+}
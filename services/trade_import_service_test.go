@@ -0,0 +1,252 @@
+package services
+
+import (
+	"asset-dairy/models"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+// MockTradeImportProfileRepository is a mock implementation of TradeImportProfileRepositoryInterface
+type MockTradeImportProfileRepository struct {
+	mock.Mock
+}
+
+func (m *MockTradeImportProfileRepository) GetProfile(userID, profileID string) (*models.TradeImportProfile, error) {
+	args := m.Called(userID, profileID)
+	return args.Get(0).(*models.TradeImportProfile), args.Error(1)
+}
+
+func (m *MockTradeImportProfileRepository) FindProfileByName(userID, name string) (*models.TradeImportProfile, error) {
+	args := m.Called(userID, name)
+	return args.Get(0).(*models.TradeImportProfile), args.Error(1)
+}
+
+func (m *MockTradeImportProfileRepository) CreateProfile(profile models.TradeImportProfile) error {
+	args := m.Called(profile)
+	return args.Error(0)
+}
+
+func (m *MockTradeImportProfileRepository) UpdateProfile(profile models.TradeImportProfile) (bool, error) {
+	args := m.Called(profile)
+	return args.Bool(0), args.Error(1)
+}
+
+// Add stub methods to satisfy TradeImportProfileRepositoryInterface
+func (m *MockTradeImportProfileRepository) ListProfiles(userID string) ([]models.TradeImportProfile, error) {
+	panic("not implemented")
+}
+func (m *MockTradeImportProfileRepository) DeleteProfile(userID, profileID string) (bool, error) {
+	panic("not implemented")
+}
+
+func TestImportCSV(t *testing.T) {
+	csvData := strings.Join([]string{
+		"Datum;Aktion;Symbol;Anzahl;Kurs;Konto",
+		"02/01/2024;買進;2330;1.000;580,5;Broker A",
+		"03/01/2024;BUY;aapl;10;185,25;IB",
+		// Sells against the buy of the row above
+		"04/01/2024;Sell;AAPL;4;190;ib",
+		"05/01/2024;Sell;AAPL;20;190;IB",
+		"31/02/2024;BUY;MSFT;1;400;IB",
+		"",
+		"06/01/2024;Hold;MSFT;0;400;Nowhere",
+	}, "\n")
+	mapping := models.TradeImportMapping{
+		Columns: models.TradeImportColumns{
+			TradeDate: "Datum",
+			Type:      "Aktion",
+			Ticker:    "Symbol",
+			Quantity:  "Anzahl",
+			Price:     "Kurs",
+			Account:   "Konto",
+		},
+		Delimiter:        ";",
+		DateFormat:       "DD/MM/YYYY",
+		TypeSynonyms:     map[string]string{"買進": "buy", "buy": "buy", "sell": "sell"},
+		DecimalSeparator: ",",
+	}
+	accounts := []models.Account{
+		{ID: "acc-1", Name: "Broker A", Currency: "TWD"},
+		{ID: "acc-2", Name: "IB", Currency: "USD"},
+	}
+
+	newService := func() (*TradeImportService, *MockTradeRepository) {
+		mockRepo := new(MockTradeRepository)
+		mockRepo.On("ListTrades", "test-user").Return([]models.Trade{}, nil)
+		mockRepo.On("ListShortableAccountIDs", "test-user").Return([]string{}, nil)
+		mockRepo.On("ListReceivedUnits", "test-user").Return([]models.IncomeEvent{}, nil)
+		mockRepo.On("GetCostBasisMethods", "test-user").Return("", map[string]string{}, nil)
+		mockRepo.On("GetAccountCurrency", "test-user", "acc-1").Return("TWD", nil)
+		mockRepo.On("GetAccountCurrency", "test-user", "acc-2").Return("USD", nil)
+		mockRepo.On("CreateTrades", "test-user", mock.Anything).Return(nil)
+		mockAccountService := new(MockAccountService)
+		mockAccountService.On("ListAccounts", "test-user").Return(accounts, nil)
+
+		tradeService := NewTradeService(mockRepo, new(MockFxService), withCorporateActions(), noInstruments())
+		return NewTradeImportService(tradeService, mockAccountService, nil), mockRepo
+	}
+
+	service, mockRepo := newService()
+	preview, err := service.ImportCSV("test-user", strings.NewReader(csvData), mapping, false)
+	assert.NoError(t, err)
+	assert.False(t, preview.Committed)
+	mockRepo.AssertNotCalled(t, "CreateTrades", "test-user", mock.Anything)
+
+	rows := preview.Rows
+	assert.Len(t, rows, 6)
+	assert.Equal(t, []int{2, 3, 4, 5, 6, 8}, []int{rows[0].Row, rows[1].Row, rows[2].Row, rows[3].Row, rows[4].Row, rows[5].Row})
+
+	assert.Empty(t, rows[0].Errors)
+	assert.Equal(t, "buy", rows[0].Trade.Type)
+	assert.Equal(t, time.Date(2024, 1, 2, 0, 0, 0, 0, time.UTC), rows[0].Trade.TradeDate)
+	assert.Equal(t, 1000.0, rows[0].Trade.Quantity)
+	assert.Equal(t, 580.5, rows[0].Trade.Price)
+	assert.Equal(t, "acc-1", rows[0].Trade.AccountID)
+	assert.Equal(t, "TWD", rows[0].Trade.Currency)
+	assert.Equal(t, "stock", rows[0].Trade.AssetType)
+
+	assert.Empty(t, rows[1].Errors)
+	assert.Equal(t, "AAPL", rows[1].Trade.Ticker)
+	assert.Equal(t, "USD", rows[1].Trade.Currency)
+	assert.Empty(t, rows[2].Errors)
+	assert.Equal(t, "acc-2", rows[2].Trade.AccountID)
+
+	assert.Len(t, rows[3].Errors, 1)
+	assert.Contains(t, rows[3].Errors[0], ErrPositionOversold.Error())
+	assert.NotNil(t, rows[3].Trade)
+
+	assert.Equal(t, []string{`invalid tradeDate "31/02/2024", use DD/MM/YYYY`}, rows[4].Errors)
+	assert.Nil(t, rows[4].Trade)
+	assert.Equal(t, []string{`unknown type "Hold"`, `unknown account "Nowhere"`, "quantity must be positive"}, rows[5].Errors)
+
+	service, mockRepo = newService()
+	committed, err := service.ImportCSV("test-user", strings.NewReader(csvData), mapping, true)
+	assert.NoError(t, err)
+	assert.True(t, committed.Committed)
+	mockRepo.AssertCalled(t, "CreateTrades", "test-user", mock.MatchedBy(func(trades []models.Trade) bool {
+		return len(trades) == 3 && trades[0].Ticker == "2330" && trades[2].Type == "sell" && trades[2].Settlement != nil
+	}))
+
+	// A file without valid rows stores nothing
+	service, mockRepo = newService()
+	invalidData := strings.Join([]string{"Datum;Aktion;Symbol;Anzahl;Kurs;Konto", "05/01/2024;Sell;AAPL;20;190;IB"}, "\n")
+	rejected, err := service.ImportCSV("test-user", strings.NewReader(invalidData), mapping, true)
+	assert.NoError(t, err)
+	assert.False(t, rejected.Committed)
+	assert.Len(t, rejected.Rows[0].Errors, 1)
+	mockRepo.AssertNotCalled(t, "CreateTrades", "test-user", mock.Anything)
+
+	_, err = service.ImportCSV("test-user", strings.NewReader("tradeDate,type,ticker,quantity\n"), models.TradeImportMapping{}, false)
+	assert.True(t, errors.Is(err, ErrInvalidTradeImport), "expected %v, got %v", ErrInvalidTradeImport, err)
+
+	_, err = service.ImportCSV("test-user", strings.NewReader(csvData), models.TradeImportMapping{DateFormat: "DD.MM.YY"}, false)
+	assert.True(t, errors.Is(err, ErrInvalidTradeImport), "expected %v, got %v", ErrInvalidTradeImport, err)
+}
+
+func TestCreateProfile(t *testing.T) {
+	mapping := models.TradeImportMapping{Delimiter: ";", DateFormat: "DD/MM/YYYY"}
+	tests := []struct {
+		name          string
+		req           models.TradeImportProfileRequest
+		existing      *models.TradeImportProfile
+		expectedName  string
+		expectedError error
+	}{
+		{
+			name:         "profile should be saved under the trimmed name",
+			req:          models.TradeImportProfileRequest{Name: "  IB ", Mapping: mapping},
+			expectedName: "IB",
+		},
+		{
+			name:          "name of another profile should be rejected",
+			req:           models.TradeImportProfileRequest{Name: "IB", Mapping: mapping},
+			existing:      &models.TradeImportProfile{ID: "p2", UserID: "test-user", Name: "IB"},
+			expectedError: ErrInvalidTradeImport,
+		},
+		{
+			name:          "blank name should be rejected",
+			req:           models.TradeImportProfileRequest{Name: " ", Mapping: mapping},
+			expectedError: ErrInvalidTradeImport,
+		},
+		{
+			name:          "invalid mapping should be rejected",
+			req:           models.TradeImportProfileRequest{Name: "IB", Mapping: models.TradeImportMapping{DateFormat: "DD.MM.YY"}},
+			expectedError: ErrInvalidTradeImport,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockRepo := new(MockTradeImportProfileRepository)
+			mockRepo.On("FindProfileByName", "test-user", "IB").Return(tt.existing, nil)
+			mockRepo.On("CreateProfile", mock.Anything).Return(nil)
+			mockRepo.On("GetProfile", "test-user", mock.Anything).Return(&models.TradeImportProfile{ID: "p1", UserID: "test-user", Name: tt.expectedName, Mapping: mapping}, nil)
+			service := NewTradeImportService(nil, nil, mockRepo)
+
+			profile, err := service.CreateProfile("test-user", tt.req)
+
+			if tt.expectedError != nil {
+				assert.True(t, errors.Is(err, tt.expectedError), "expected %v, got %v", tt.expectedError, err)
+				mockRepo.AssertNotCalled(t, "CreateProfile", mock.Anything)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tt.expectedName, profile.Name)
+			mockRepo.AssertCalled(t, "CreateProfile", mock.MatchedBy(func(saved models.TradeImportProfile) bool {
+				return saved.ID != "" && saved.UserID == "test-user" && saved.Name == tt.expectedName && saved.Mapping.Delimiter == ";"
+			}))
+		})
+	}
+}
+
+func TestUpdateProfile(t *testing.T) {
+	mapping := models.TradeImportMapping{Delimiter: ";", DateFormat: "DD/MM/YYYY"}
+	tests := []struct {
+		name          string
+		existing      *models.TradeImportProfile
+		updated       bool
+		expectedError error
+	}{
+		{
+			name:     "profile should keep its own name",
+			existing: &models.TradeImportProfile{ID: "p1", UserID: "test-user", Name: "IB"},
+			updated:  true,
+		},
+		{
+			name:          "name of another profile should be rejected",
+			existing:      &models.TradeImportProfile{ID: "p2", UserID: "test-user", Name: "IB"},
+			expectedError: ErrInvalidTradeImport,
+		},
+		{
+			name:          "unknown profile should not be found",
+			updated:       false,
+			expectedError: ErrImportProfileNotFound,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockRepo := new(MockTradeImportProfileRepository)
+			mockRepo.On("FindProfileByName", "test-user", "IB").Return(tt.existing, nil)
+			mockRepo.On("UpdateProfile", mock.Anything).Return(tt.updated, nil)
+			mockRepo.On("GetProfile", "test-user", "p1").Return(&models.TradeImportProfile{ID: "p1", UserID: "test-user", Name: "IB", Mapping: mapping}, nil)
+			service := NewTradeImportService(nil, nil, mockRepo)
+
+			profile, err := service.UpdateProfile("test-user", "p1", models.TradeImportProfileRequest{Name: "IB", Mapping: mapping})
+
+			if tt.expectedError != nil {
+				assert.True(t, errors.Is(err, tt.expectedError), "expected %v, got %v", tt.expectedError, err)
+				assert.Nil(t, profile)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, "p1", profile.ID)
+			mockRepo.AssertCalled(t, "UpdateProfile", models.TradeImportProfile{ID: "p1", UserID: "test-user", Name: "IB", Mapping: mapping})
+		})
+	}
+}
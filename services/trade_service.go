@@ -3,24 +3,54 @@ package services
 import (
 	"asset-dairy/models"
 	"asset-dairy/repositories"
+	"errors"
+	"fmt"
+	"log"
+	"math"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+var (
+	ErrInvalidLotAllocation  = errors.New("invalid lot allocation")
+	ErrPositionOversold      = errors.New("position would go short")
+	ErrInvalidPositionEffect = errors.New("invalid position effect")
+	ErrTradeNotFound         = errors.New("trade not found")
+	ErrInvalidDuplicates     = errors.New("invalid duplicate review")
 )
 
 type TradeServiceInterface interface {
 	ListTrades(userID string) ([]models.Trade, error)
-	CreateTrade(userID string, trade models.Trade) error
+	CreateTrade(userID string, trade models.Trade) (*models.Trade, error)
+	ValidateTrades(userID string, trades []models.Trade) ([]models.Trade, []error, error)
+	CreateTrades(userID string, trades []models.Trade) ([]models.Trade, error)
 	UpdateTrade(userID, tradeID string, req models.TradeUpdateRequest) (*models.Trade, error)
 	DeleteTrade(userID, tradeID string) (bool, error)
 	IsAccountOwnedByUser(accountID, userID string) (bool, error)
 	IsTradeOwnedByUser(tradeID, userID string) (bool, error)
+	FindDuplicates(userID string, tolerance float64) ([]models.TradeDuplicateGroup, error)
+	MergeDuplicates(userID string, req models.TradeMergeRequest) (*models.Trade, error)
+	DismissDuplicates(userID string, req models.TradeDismissRequest) error
+	ValidateReceivedUnits(userID string, before, after *models.IncomeEvent) error
+	ValidateDisallowShort(userID, accountID string) error
+	WithUserLock(userID string, fn func() error) error
 }
 
 type TradeService struct {
-	repo repositories.TradeRepositoryInterface
+	repo              repositories.TradeRepositoryInterface
+	fxService         FxServiceInterface
+	actionService     CorporateActionServiceInterface
+	instrumentService InstrumentServiceInterface
 }
 
-// NewTradeService creates a new TradeService instance with a repository
-func NewTradeService(repo repositories.TradeRepositoryInterface) *TradeService {
-	return &TradeService{repo: repo}
+// NewTradeService creates a new TradeService instance with a repository. The fx service
+// converts settlements of trades in a currency other than their account's; corporate actions
+// are replayed with the trades when checking for oversold positions and rebook the cash they
+// pay after every change, and the instrument catalog resolves the ticker of every trade written.
+func NewTradeService(repo repositories.TradeRepositoryInterface, fxService FxServiceInterface, actionService CorporateActionServiceInterface, instrumentService InstrumentServiceInterface) *TradeService {
+	return &TradeService{repo: repo, fxService: fxService, actionService: actionService, instrumentService: instrumentService}
 }
 
 // ListTrades retrieves all trades for a given user
@@ -28,16 +58,324 @@ func (s *TradeService) ListTrades(userID string) ([]models.Trade, error) {
 	return s.repo.ListTrades(userID)
 }
 
-func (s *TradeService) CreateTrade(userID string, trade models.Trade) error {
-	return s.repo.CreateTrade(userID, trade)
+// CreateTrade stores the trade with its settlement and returns it as stored, with the ticker
+// resolved against the instrument catalog and warnings when it looks like a trade already stored
+func (s *TradeService) CreateTrade(userID string, trade models.Trade) (*models.Trade, error) {
+	// Stamp the creation time up front so same-day ordering matches what gets stored
+	if trade.CreatedAt.IsZero() {
+		trade.CreatedAt = time.Now()
+	}
+	err := s.repo.WithUserLock(userID, func() error {
+		history, err := s.loadHistory(userID)
+		if err != nil {
+			return err
+		}
+		if err := s.prepareTrade(userID, history, &trade); err != nil {
+			return err
+		}
+		if err := s.repo.CreateTrade(userID, trade); err != nil {
+			return err
+		}
+		s.syncCash(userID)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &trade, nil
+}
+
+// ValidateTrades checks a batch of new trades in order, each against the stored history and the
+// valid trades before it, and returns them as they would be stored. The second result holds
+// the reason each trade was rejected, nil for valid ones; rejected trades are left out of the
+// history later trades are checked against. Trades without a creation time are stamped in
+// batch order so same-day trades keep it.
+func (s *TradeService) ValidateTrades(userID string, trades []models.Trade) ([]models.Trade, []error, error) {
+	history, err := s.loadHistory(userID)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	now := time.Now()
+	prepared := make([]models.Trade, len(trades))
+	rejections := make([]error, len(trades))
+	for i, trade := range trades {
+		if trade.CreatedAt.IsZero() {
+			trade.CreatedAt = now.Add(time.Duration(i) * time.Microsecond)
+		}
+		err := s.prepareTrade(userID, history, &trade)
+		prepared[i] = trade
+		if IsTradeValidationError(err) {
+			rejections[i] = err
+			continue
+		}
+		if err != nil {
+			return nil, nil, err
+		}
+		history.trades = append(history.trades, trade)
+	}
+	return prepared, rejections, nil
+}
+
+// CreateTrades stores a batch of new trades in one transaction, or none of them when any is
+// rejected by ValidateTrades
+func (s *TradeService) CreateTrades(userID string, trades []models.Trade) ([]models.Trade, error) {
+	var prepared []models.Trade
+	err := s.repo.WithUserLock(userID, func() error {
+		var rejections []error
+		var err error
+		prepared, rejections, err = s.ValidateTrades(userID, trades)
+		if err != nil {
+			return err
+		}
+		for _, rejection := range rejections {
+			if rejection != nil {
+				return rejection
+			}
+		}
+		if err := s.repo.CreateTrades(userID, prepared); err != nil {
+			return err
+		}
+		s.syncCash(userID)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return prepared, nil
+}
+
+// prepareTrade resolves a new trade against the instrument catalog, checks it against the
+// history, attaches its settlement and warns of trades in the history it looks like
+func (s *TradeService) prepareTrade(userID string, history *tradeHistory, trade *models.Trade) error {
+	if err := s.resolveInstrument(trade); err != nil {
+		return err
+	}
+	if err := history.checkChange(nil, trade); err != nil {
+		return err
+	}
+	settlement, err := s.settlement(userID, *trade)
+	if err != nil {
+		return err
+	}
+	trade.Settlement = settlement
+	trade.Warnings = duplicateWarnings(history.trades, *trade)
+	return nil
 }
 
 func (s *TradeService) UpdateTrade(userID, tradeID string, req models.TradeUpdateRequest) (*models.Trade, error) {
-	return s.repo.UpdateTrade(userID, tradeID, req)
+	var updated *models.Trade
+	err := s.repo.WithUserLock(userID, func() error {
+		existing, err := s.repo.GetTrade(userID, tradeID)
+		if err != nil {
+			return err
+		}
+
+		trade := *existing
+		if err := applyTradeUpdate(&trade, req); err != nil {
+			return err
+		}
+		if req.LotAllocations != nil {
+			trade.LotAllocations = NewLotAllocations(trade.ID, req.LotAllocations)
+		}
+		if err := s.resolveInstrument(&trade); err != nil {
+			return err
+		}
+
+		if err := s.validateChange(userID, existing, &trade); err != nil {
+			return err
+		}
+		settlement, err := s.settlement(userID, trade)
+		if err != nil {
+			return err
+		}
+		trade.Settlement = settlement
+		if updated, err = s.repo.UpdateTrade(userID, trade); err != nil {
+			return err
+		}
+		s.syncCash(userID)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return updated, nil
 }
 
 func (s *TradeService) DeleteTrade(userID, tradeID string) (bool, error) {
-	return s.repo.DeleteTrade(userID, tradeID)
+	deleted := false
+	err := s.repo.WithUserLock(userID, func() error {
+		trades, err := s.repo.ListTrades(userID)
+		if err != nil {
+			return err
+		}
+		for i := range trades {
+			if trades[i].ID != tradeID {
+				continue
+			}
+			if err := s.validateChange(userID, &trades[i], nil); err != nil {
+				return err
+			}
+			break
+		}
+		if deleted, err = s.repo.DeleteTrade(userID, tradeID); err != nil || !deleted {
+			return err
+		}
+		s.syncCash(userID)
+		return nil
+	})
+	return deleted, err
+}
+
+// FindDuplicates groups the user's trades that look like one trade entered more than once,
+// leaving out pairs the user dismissed. Prices may differ by the tolerance, a fraction of the
+// higher price.
+func (s *TradeService) FindDuplicates(userID string, tolerance float64) ([]models.TradeDuplicateGroup, error) {
+	trades, err := s.repo.ListTrades(userID)
+	if err != nil {
+		return nil, err
+	}
+	dismissals, err := s.repo.ListDuplicateDismissals(userID)
+	if err != nil {
+		return nil, err
+	}
+	dismissed := make(map[[2]string]bool, len(dismissals))
+	for _, dismissal := range dismissals {
+		dismissed[dismissalPair(dismissal.TradeID, dismissal.OtherTradeID)] = true
+	}
+	return duplicateGroups(trades, tolerance, dismissed), nil
+}
+
+// MergeDuplicates keeps one trade and deletes the others, which must match it in account,
+// ticker, date, type and quantity; the kept trade's price and charges stand. Sells drawing on
+// a deleted duplicate's lot draw on the kept trade instead, and the deletions are then checked
+// like DeleteTrade's. When the kept trade was not imported, it takes the external ID of an
+// imported duplicate so importing that statement again does not bring the trade back; only
+// one of the trades may have been imported, as the kept trade holds a single external ID.
+func (s *TradeService) MergeDuplicates(userID string, req models.TradeMergeRequest) (*models.Trade, error) {
+	var merged *models.Trade
+	err := s.repo.WithUserLock(userID, func() error {
+		var err error
+		merged, err = s.mergeDuplicates(userID, req)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return merged, nil
+}
+
+// mergeDuplicates checks and stores a merge; the caller holds the user's lock
+func (s *TradeService) mergeDuplicates(userID string, req models.TradeMergeRequest) (*models.Trade, error) {
+	history, err := s.loadHistory(userID)
+	if err != nil {
+		return nil, err
+	}
+	kept := findTrade(history.trades, req.KeepTradeID)
+	if kept == nil {
+		return nil, fmt.Errorf("%w: %s", ErrTradeNotFound, req.KeepTradeID)
+	}
+	merged := *kept
+
+	duplicateIDs := []string{}
+	seen := make(map[string]bool, len(req.TradeIDs))
+	reallocated := make(map[string]bool)
+	var externalID *string
+	importedID := kept.ID
+	for _, id := range req.TradeIDs {
+		if id == kept.ID {
+			return nil, fmt.Errorf("%w: trade %s cannot be merged into itself", ErrInvalidDuplicates, id)
+		}
+		if seen[id] {
+			continue
+		}
+		seen[id] = true
+		duplicate := findTrade(history.trades, id)
+		if duplicate == nil {
+			return nil, fmt.Errorf("%w: %s", ErrTradeNotFound, id)
+		}
+		if !sameTradeKey(*kept, *duplicate) {
+			return nil, fmt.Errorf("%w: trade %s differs from trade %s in account, ticker, date, type or quantity", ErrInvalidDuplicates, id, kept.ID)
+		}
+		if duplicate.ExternalID != nil {
+			if merged.ExternalID != nil {
+				return nil, fmt.Errorf("%w: trades %s and %s were both imported and only one external ID can be kept", ErrInvalidDuplicates, importedID, id)
+			}
+			externalID = duplicate.ExternalID
+			merged.ExternalID = externalID
+			importedID = id
+		}
+		history.trades = repointAllocations(history.trades, id, kept.ID, reallocated)
+		if err := history.checkChange(duplicate, nil); err != nil {
+			return nil, err
+		}
+		history.trades = withoutTrade(history.trades, id)
+		duplicateIDs = append(duplicateIDs, id)
+	}
+	// The kept lot must cover the sells moved onto it
+	if len(reallocated) > 0 {
+		if err := history.checkChange(kept, kept); err != nil {
+			return nil, err
+		}
+	}
+	sells := []models.Trade{}
+	for _, trade := range history.trades {
+		if reallocated[trade.ID] {
+			sells = append(sells, trade)
+		}
+	}
+
+	if err := s.repo.MergeTrades(userID, kept.ID, duplicateIDs, externalID, sells); err != nil {
+		return nil, err
+	}
+	s.syncCash(userID)
+	return &merged, nil
+}
+
+// WithUserLock runs fn while no other change to the user's trades, income units or accounts is
+// being checked and stored. Callers check their change against the history and store it in fn.
+func (s *TradeService) WithUserLock(userID string, fn func() error) error {
+	return s.repo.WithUserLock(userID, fn)
+}
+
+// syncCash rewrites the user's corporate action cash after a change to their trades. The change
+// is already stored, so a failure is logged rather than returned, and the next change or
+// corporate action rewrites the cash again.
+func (s *TradeService) syncCash(userID string) {
+	if err := s.actionService.SyncCash(userID); err != nil {
+		log.Println("Failed to sync corporate action cash:", err)
+	}
+}
+
+// DismissDuplicates records that the trades are distinct, so no pair of them is flagged again
+func (s *TradeService) DismissDuplicates(userID string, req models.TradeDismissRequest) error {
+	trades, err := s.repo.ListTrades(userID)
+	if err != nil {
+		return err
+	}
+	ids := []string{}
+	seen := make(map[string]bool, len(req.TradeIDs))
+	for _, id := range req.TradeIDs {
+		if findTrade(trades, id) == nil {
+			return fmt.Errorf("%w: %s", ErrTradeNotFound, id)
+		}
+		if !seen[id] {
+			seen[id] = true
+			ids = append(ids, id)
+		}
+	}
+	if len(ids) < 2 {
+		return fmt.Errorf("%w: at least two different trades are required", ErrInvalidDuplicates)
+	}
+
+	dismissals := []models.TradeDuplicateDismissal{}
+	for i := range ids {
+		for _, other := range ids[i+1:] {
+			pair := dismissalPair(ids[i], other)
+			dismissals = append(dismissals, models.TradeDuplicateDismissal{UserID: userID, TradeID: pair[0], OtherTradeID: pair[1]})
+		}
+	}
+	return s.repo.DismissDuplicates(dismissals)
 }
 
 func (s *TradeService) IsAccountOwnedByUser(accountID, userID string) (bool, error) {
@@ -47,3 +385,577 @@ func (s *TradeService) IsAccountOwnedByUser(accountID, userID string) (bool, err
 func (s *TradeService) IsTradeOwnedByUser(tradeID, userID string) (bool, error) {
 	return s.repo.IsTradeOwnedByUser(tradeID, userID)
 }
+
+// resolveInstrument normalizes the trade's ticker and currency and links the trade to the
+// instrument catalog. A trade naming an instrument takes its ticker, asset type, currency and
+// multiplier from it; any other trade is linked to the instrument listed under its ticker and
+// currency, when there is one. An unlinked option without a multiplier gets the standard one.
+func (s *TradeService) resolveInstrument(trade *models.Trade) error {
+	trade.Ticker = normalizeTicker(trade.Ticker)
+	trade.Currency = strings.ToUpper(strings.TrimSpace(trade.Currency))
+	if trade.InstrumentID == nil || *trade.InstrumentID == "" {
+		instrument, err := s.instrumentService.FindInstrument(trade.Ticker, trade.Currency)
+		if err != nil {
+			return err
+		}
+		trade.InstrumentID = nil
+		if instrument != nil {
+			trade.InstrumentID = &instrument.ID
+			trade.Multiplier = instrument.ContractSize()
+		} else if trade.Multiplier == 0 && trade.AssetType == models.AssetClassOption {
+			trade.Multiplier = models.DefaultOptionMultiplier
+		}
+		return nil
+	}
+
+	instrument, err := s.instrumentService.GetInstrument(*trade.InstrumentID)
+	if errors.Is(err, ErrInstrumentNotFound) {
+		return fmt.Errorf("%w: instrument %s does not exist", ErrInvalidInstrument, *trade.InstrumentID)
+	}
+	if err != nil {
+		return err
+	}
+	if trade.Ticker != "" && trade.Ticker != instrument.Symbol {
+		return fmt.Errorf("%w: ticker %s does not match instrument %s", ErrInvalidInstrument, trade.Ticker, instrument.Symbol)
+	}
+	if trade.Currency != "" && trade.Currency != instrument.Currency {
+		return fmt.Errorf("%w: currency %s does not match instrument currency %s", ErrInvalidInstrument, trade.Currency, instrument.Currency)
+	}
+	trade.Ticker = instrument.Symbol
+	trade.Currency = instrument.Currency
+	trade.AssetType = instrument.AssetClass
+	trade.Multiplier = instrument.ContractSize()
+	return nil
+}
+
+// settlement builds the cash ledger entry of a trade: a buy debits its account with the cost
+// plus fee and tax, and a sell credits it with the proceeds less fee and tax. Amounts in another
+// currency are converted at the trade's settlement rate, if it has one, or the newest rates
+// known on the trade date.
+func (s *TradeService) settlement(userID string, trade models.Trade) (*models.CashLedgerEntry, error) {
+	accountCurrency, err := s.repo.GetAccountCurrency(userID, trade.AccountID)
+	if err != nil {
+		return nil, err
+	}
+
+	var converter *FxConverter
+	sameCurrency := trade.Currency == "" || strings.EqualFold(trade.Currency, accountCurrency)
+	if hasForeignCharges(trade) || (!sameCurrency && trade.SettlementRate == nil) {
+		if converter, err = s.fxService.Converter(trade.TradeDate); err != nil {
+			return nil, err
+		}
+	}
+	if hasForeignCharges(trade) {
+		if trade, err = chargesInTradeCurrency(trade, converter); err != nil {
+			return nil, err
+		}
+	}
+
+	amount := trade.Quantity * netPrice(trade) * trade.ContractSize()
+	if trade.Type == "buy" {
+		amount = -amount
+	}
+	entry := &models.CashLedgerEntry{
+		ID:        uuid.New().String(),
+		UserID:    userID,
+		AccountID: trade.AccountID,
+		Type:      models.CashEntryTrade,
+		Amount:    amount,
+		Currency:  accountCurrency,
+		TradeID:   &trade.ID,
+		EntryDate: trade.TradeDate,
+	}
+	if sameCurrency {
+		return entry, nil
+	}
+
+	var rate float64
+	if trade.SettlementRate != nil {
+		rate = *trade.SettlementRate
+	} else if rate, err = converter.Rate(trade.Currency, accountCurrency); err != nil {
+		return nil, fmt.Errorf("%w; give the trade a settlementRate", err)
+	}
+	originalCurrency := trade.Currency
+	entry.Amount = amount * rate
+	entry.OriginalAmount = &amount
+	entry.OriginalCurrency = &originalCurrency
+	entry.FxRate = &rate
+	return entry, nil
+}
+
+// NewLotAllocations builds the allocation records of a sell trade from request payloads
+func NewLotAllocations(sellTradeID string, reqs []models.LotAllocationRequest) []models.TradeLotAllocation {
+	allocations := make([]models.TradeLotAllocation, 0, len(reqs))
+	for _, req := range reqs {
+		allocations = append(allocations, models.TradeLotAllocation{
+			ID:          uuid.New().String(),
+			SellTradeID: sellTradeID,
+			BuyTradeID:  req.BuyTradeID,
+			Quantity:    req.Quantity,
+		})
+	}
+	return allocations
+}
+
+// applyTradeUpdate copies the provided fields of an update request onto the trade
+func applyTradeUpdate(trade *models.Trade, req models.TradeUpdateRequest) error {
+	if req.Type != "" {
+		trade.Type = req.Type
+	}
+	if req.AssetType != "" {
+		trade.AssetType = req.AssetType
+	}
+	if req.TradeDate != "" {
+		tradeDate, err := time.Parse("2006-01-02", req.TradeDate)
+		if err != nil {
+			return err
+		}
+		trade.TradeDate = tradeDate
+	}
+	if req.Ticker != "" {
+		trade.Ticker = req.Ticker
+	}
+	// A new instrument supplies the ticker and currency unless the request names them; a new
+	// ticker or currency without one is looked up again
+	if req.InstrumentID != nil {
+		trade.InstrumentID = req.InstrumentID
+		if *req.InstrumentID != "" && req.Ticker == "" {
+			trade.Ticker = ""
+		}
+		if *req.InstrumentID != "" && req.Currency == "" {
+			trade.Currency = ""
+		}
+	} else if req.Ticker != "" || req.Currency != "" {
+		trade.InstrumentID = nil
+	}
+	if req.Quantity != 0 {
+		trade.Quantity = req.Quantity
+	}
+	if req.Price != 0 {
+		trade.Price = req.Price
+	}
+	if req.Currency != "" {
+		trade.Currency = req.Currency
+	}
+	if req.AccountID != "" {
+		trade.AccountID = req.AccountID
+	}
+	if req.Reason != nil {
+		trade.Reason = req.Reason
+	}
+	if req.Fee != nil {
+		trade.Fee = *req.Fee
+	}
+	if req.FeeCurrency != nil {
+		trade.FeeCurrency = req.FeeCurrency
+	}
+	if req.Tax != nil {
+		trade.Tax = *req.Tax
+	}
+	if req.TaxCurrency != nil {
+		trade.TaxCurrency = req.TaxCurrency
+	}
+	if req.Multiplier != nil {
+		trade.Multiplier = *req.Multiplier
+	}
+	if req.PositionEffect != nil {
+		trade.PositionEffect = req.PositionEffect
+	}
+	// A new currency or account without a new rate drops the old one
+	if req.SettlementRate != nil {
+		trade.SettlementRate = req.SettlementRate
+	} else if req.Currency != "" || req.AccountID != "" || req.InstrumentID != nil {
+		trade.SettlementRate = nil
+	}
+	return nil
+}
+
+// tradeHistory is what a change to the user's trades is checked against: the stored trades,
+// the units received as income, the accounts that allow short positions, the cost-basis
+// methods and the corporate actions
+type tradeHistory struct {
+	trades []models.Trade
+	// received are the buys standing in for units received as income; they are not trades
+	received  []models.Trade
+	shortable map[string]bool
+	costBasis costBasisSettings
+	actions   []models.CorporateAction
+}
+
+func (s *TradeService) loadHistory(userID string) (*tradeHistory, error) {
+	trades, err := s.repo.ListTrades(userID)
+	if err != nil {
+		return nil, err
+	}
+	events, err := s.repo.ListReceivedUnits(userID)
+	if err != nil {
+		return nil, err
+	}
+	received, err := receivedUnitTrades(s.fxService, trades, events)
+	if err != nil {
+		return nil, err
+	}
+
+	shortableIDs, err := s.repo.ListShortableAccountIDs(userID)
+	if err != nil {
+		return nil, err
+	}
+	shortable := make(map[string]bool, len(shortableIDs))
+	for _, id := range shortableIDs {
+		shortable[id] = true
+	}
+
+	defaultMethod, accountMethods, err := s.repo.GetCostBasisMethods(userID)
+	if err != nil {
+		return nil, err
+	}
+
+	actions, err := s.actionService.ListActions("")
+	if err != nil {
+		return nil, err
+	}
+
+	return &tradeHistory{
+		trades:    trades,
+		received:  received,
+		shortable: shortable,
+		costBasis: costBasisSettings{defaultMethod: defaultMethod, accountMethods: accountMethods},
+		actions:   actions,
+	}, nil
+}
+
+// validateChange checks a trade created (before is nil), updated, or deleted (after is nil)
+// against the user's stored trade history
+func (s *TradeService) validateChange(userID string, before, after *models.Trade) error {
+	history, err := s.loadHistory(userID)
+	if err != nil {
+		return err
+	}
+	return history.checkChange(before, after)
+}
+
+// ValidateReceivedUnits checks an income event recorded (before is nil), updated, or deleted
+// (after is nil) against the user's trade history. Only stock dividends and staking rewards add
+// units to a position, so other events always pass.
+func (s *TradeService) ValidateReceivedUnits(userID string, before, after *models.IncomeEvent) error {
+	history, err := s.loadHistory(userID)
+	if err != nil {
+		return err
+	}
+	units := func(event *models.IncomeEvent) (*models.Trade, error) {
+		if event == nil {
+			return nil, nil
+		}
+		received, err := receivedUnitTrades(s.fxService, history.trades, []models.IncomeEvent{*event})
+		if err != nil || len(received) == 0 {
+			return nil, err
+		}
+		return &received[0], nil
+	}
+	beforeUnits, err := units(before)
+	if err != nil {
+		return err
+	}
+	afterUnits, err := units(after)
+	if err != nil {
+		return err
+	}
+	if beforeUnits == nil && afterUnits == nil {
+		return nil
+	}
+	return history.checkReceivedChange(beforeUnits, afterUnits)
+}
+
+// ValidateDisallowShort checks that the account's history never takes a position short, so
+// short positions can be disallowed in it. Options written with a sell to open do not count.
+func (s *TradeService) ValidateDisallowShort(userID, accountID string) error {
+	history, err := s.loadHistory(userID)
+	if err != nil {
+		return err
+	}
+	delete(history.shortable, accountID)
+	touched := make(map[string]bool)
+	for _, trade := range history.trades {
+		if trade.AccountID == accountID {
+			history.touch(touched, trade)
+		}
+	}
+	_, err = history.replay(history.trades, history.received, touched)
+	return err
+}
+
+// checkChange replays the history with a trade created (before is nil), updated, or deleted
+// (after is nil). It rejects the change when a lot allocation cannot be honored, including
+// the allocations of other sells to a changed buy, when a deleted buy is allocated to, when an
+// option trade does not open or close a position as it says, or when a position it touches
+// would go short at any point in an account that does not allow short positions. A trade
+// touches its own position and every position a symbol change, merger or spin-off carries it
+// into. Positions are those of one account, so shares held at another broker never cover a sell. Writing
+// options with a sell to open is allowed in any account. Sells without allocations are
+// replayed with their account's cost-basis method, as the holdings are.
+func (h *tradeHistory) checkChange(before, after *models.Trade) error {
+	if after != nil {
+		if err := checkLotAllocations(*after); err != nil {
+			return err
+		}
+		if after.PositionEffect != nil && after.AssetType != models.AssetClassOption {
+			return fmt.Errorf("%w: only option trades open or close positions", ErrInvalidPositionEffect)
+		}
+	}
+
+	if before != nil && after == nil {
+		if sell := allocatedTo(h.trades, before.ID); sell != nil {
+			return fmt.Errorf("%w: buy trade %s is allocated to sell trade %s; change that sell first", ErrInvalidLotAllocation, before.ID, sell.ID)
+		}
+	}
+
+	trades := h.trades
+	touched := make(map[string]bool)
+	if before != nil {
+		h.touch(touched, *before)
+		trades = withoutTrade(trades, before.ID)
+	}
+	if after != nil {
+		h.touch(touched, *after)
+		trades = withTrade(trades, *after)
+	}
+
+	matcher, err := h.replay(trades, h.received, touched)
+	if err != nil {
+		return err
+	}
+	if after != nil {
+		if err := matcher.allocationErrors[after.ID]; err != nil {
+			return err
+		}
+		// A changed buy must still cover the sells allocated to it
+		for _, trade := range trades {
+			if err := matcher.allocationErrors[trade.ID]; err != nil && allocates(trade, after.ID) {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// checkReceivedChange replays the history with the units of an income event received (before
+// is nil), changed, or removed (after is nil). It rejects the change when a sell in a position
+// the units are part of would go short at any point in an account that does not allow short
+// positions, or when a sell allocated to the units can no longer be honored.
+func (h *tradeHistory) checkReceivedChange(before, after *models.Trade) error {
+	received := h.received
+	touched := make(map[string]bool)
+	if before != nil {
+		h.touch(touched, *before)
+		received = withoutTrade(received, before.ID)
+	}
+	if after != nil {
+		h.touch(touched, *after)
+		received = withTrade(received, *after)
+	}
+
+	matcher, err := h.replay(h.trades, received, touched)
+	if err != nil {
+		return err
+	}
+	if before != nil {
+		for _, trade := range h.trades {
+			if err := matcher.allocationErrors[trade.ID]; err != nil && allocates(trade, before.ID) {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// replay matches the trades and received units in date order, checking the position effect of
+// every trade in a touched position and that its sells leave it short only where allowed
+func (h *tradeHistory) replay(trades, received []models.Trade, touched map[string]bool) (*lotMatcher, error) {
+	matcher := newLotMatcher(h.costBasis, h.actions)
+	for _, trade := range sortTrades(append(append([]models.Trade(nil), received...), trades...)) {
+		key := positionKey(trade)
+		matcher.applyActions(trade.TradeDate)
+		var held float64
+		if pos, ok := matcher.positions[key]; ok {
+			held = pos.holding.Quantity
+		}
+		matcher.apply(trade)
+		if !touched[key] {
+			continue
+		}
+		if err := checkPositionEffect(trade, held, matcher.positions[key].holding.Quantity); err != nil {
+			return nil, err
+		}
+		if trade.Type != "sell" || h.shortable[trade.AccountID] || opensPosition(trade) {
+			continue
+		}
+		if quantity := matcher.positions[key].holding.Quantity; quantity < -quantityEpsilon {
+			return nil, fmt.Errorf("%w: %s %s would be %g after the sell on %s", ErrPositionOversold, trade.Ticker, trade.Currency, quantity, trade.TradeDate.Format("2006-01-02"))
+		}
+	}
+	return matcher, nil
+}
+
+// touch adds the trade's position to touched, along with every position the corporate actions
+// carry it into under a new ticker
+func (h *tradeHistory) touch(touched map[string]bool, trade models.Trade) {
+	tickers := []string{trade.Ticker}
+	seen := map[string]bool{strings.ToUpper(trade.Ticker): true}
+	for i := 0; i < len(tickers); i++ {
+		touched[accountPositionKey(trade.AccountID, tickers[i], trade.Currency)] = true
+		for _, action := range h.actions {
+			if action.NewTicker == nil || !strings.EqualFold(action.Ticker, tickers[i]) || seen[strings.ToUpper(*action.NewTicker)] {
+				continue
+			}
+			seen[strings.ToUpper(*action.NewTicker)] = true
+			tickers = append(tickers, *action.NewTicker)
+		}
+	}
+}
+
+// allocatedTo returns the first sell with a lot allocation to the buy trade, or nil
+func allocatedTo(trades []models.Trade, buyTradeID string) *models.Trade {
+	for i := range trades {
+		if trades[i].ID != buyTradeID && allocates(trades[i], buyTradeID) {
+			return &trades[i]
+		}
+	}
+	return nil
+}
+
+// allocates reports whether the trade has a lot allocation to the buy trade
+func allocates(trade models.Trade, buyTradeID string) bool {
+	for _, allocation := range trade.LotAllocations {
+		if allocation.BuyTradeID == buyTradeID {
+			return true
+		}
+	}
+	return false
+}
+
+// IsTradeValidationError reports whether a trade was rejected for what it asked for, rather
+// than failing to be stored
+func IsTradeValidationError(err error) bool {
+	return errors.Is(err, ErrInvalidLotAllocation) ||
+		errors.Is(err, ErrPositionOversold) ||
+		errors.Is(err, ErrFxRateNotFound) ||
+		errors.Is(err, ErrInvalidInstrument) ||
+		errors.Is(err, ErrInvalidPositionEffect)
+}
+
+// checkPositionEffect checks that an option trade marked as opening adds to the position, or
+// to nothing, and one marked as closing reduces it without going past zero
+func checkPositionEffect(trade models.Trade, held, remaining float64) error {
+	if trade.PositionEffect == nil {
+		return nil
+	}
+	date := trade.TradeDate.Format("2006-01-02")
+	switch {
+	case opensPosition(trade) && trade.Type == "buy" && held < -quantityEpsilon:
+		return fmt.Errorf("%w: buy to open %s on %s while the position is short", ErrInvalidPositionEffect, trade.Ticker, date)
+	case opensPosition(trade) && trade.Type == "sell" && held > quantityEpsilon:
+		return fmt.Errorf("%w: sell to open %s on %s while the position is long", ErrInvalidPositionEffect, trade.Ticker, date)
+	case !opensPosition(trade) && trade.Type == "buy" && remaining > quantityEpsilon:
+		return fmt.Errorf("%w: buy to close %s on %s is more than the %g short", ErrInvalidPositionEffect, trade.Ticker, date, math.Max(-held, 0))
+	case !opensPosition(trade) && trade.Type == "sell" && remaining < -quantityEpsilon:
+		return fmt.Errorf("%w: sell to close %s on %s is more than the %g held", ErrInvalidPositionEffect, trade.Ticker, date, math.Max(held, 0))
+	}
+	return nil
+}
+
+// opensPosition reports whether the trade is marked as opening a position
+func opensPosition(trade models.Trade) bool {
+	return trade.PositionEffect != nil && *trade.PositionEffect == models.PositionEffectOpen
+}
+
+// checkLotAllocations validates the allocations a trade carries on their own
+func checkLotAllocations(trade models.Trade) error {
+	if len(trade.LotAllocations) == 0 {
+		return nil
+	}
+	if trade.Type != "sell" {
+		return fmt.Errorf("%w: only sell trades can carry lot allocations", ErrInvalidLotAllocation)
+	}
+	var allocatedQty float64
+	allocated := make(map[string]bool, len(trade.LotAllocations))
+	for _, allocation := range trade.LotAllocations {
+		if allocated[allocation.BuyTradeID] {
+			return fmt.Errorf("%w: buy trade %s is allocated more than once", ErrInvalidLotAllocation, allocation.BuyTradeID)
+		}
+		allocated[allocation.BuyTradeID] = true
+		allocatedQty += allocation.Quantity
+	}
+	if allocatedQty > trade.Quantity+quantityEpsilon {
+		return fmt.Errorf("%w: allocations total %g but the sell is for %g", ErrInvalidLotAllocation, allocatedQty, trade.Quantity)
+	}
+	return nil
+}
+
+// repointAllocations returns the trades with the lot allocations drawing on one buy moved to
+// another, folded into an allocation the sell already has to it. The IDs of the sells changed
+// are added to changed.
+func repointAllocations(trades []models.Trade, fromID, toID string, changed map[string]bool) []models.Trade {
+	result := make([]models.Trade, len(trades))
+	for i, trade := range trades {
+		result[i] = trade
+		if trade.ID == fromID || !allocates(trade, fromID) {
+			continue
+		}
+		allocations := []models.TradeLotAllocation{}
+		target := -1
+		for _, allocation := range trade.LotAllocations {
+			if allocation.BuyTradeID == fromID || allocation.BuyTradeID == toID {
+				if target >= 0 {
+					allocations[target].Quantity += allocation.Quantity
+					continue
+				}
+				allocation.BuyTradeID = toID
+				target = len(allocations)
+			}
+			allocations = append(allocations, allocation)
+		}
+		result[i].LotAllocations = allocations
+		changed[trade.ID] = true
+	}
+	return result
+}
+
+// withTrade returns the trades with the candidate replacing the stored trade of the same ID,
+// or appended when it is new
+func withTrade(trades []models.Trade, candidate models.Trade) []models.Trade {
+	result := make([]models.Trade, 0, len(trades)+1)
+	replaced := false
+	for _, trade := range trades {
+		if trade.ID == candidate.ID {
+			result = append(result, candidate)
+			replaced = true
+			continue
+		}
+		result = append(result, trade)
+	}
+	if !replaced {
+		result = append(result, candidate)
+	}
+	return result
+}
+
+// findTrade returns the trade with the ID, or nil
+func findTrade(trades []models.Trade, tradeID string) *models.Trade {
+	for i := range trades {
+		if trades[i].ID == tradeID {
+			return &trades[i]
+		}
+	}
+	return nil
+}
+
+// withoutTrade returns the trades without the one with the given ID
+func withoutTrade(trades []models.Trade, tradeID string) []models.Trade {
+	result := make([]models.Trade, 0, len(trades))
+	for _, trade := range trades {
+		if trade.ID != tradeID {
+			result = append(result, trade)
+		}
+	}
+	return result
+}
@@ -0,0 +1,752 @@
+package services
+
+import (
+	"asset-dairy/models"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+// MockTradeRepository is a mock implementation of TradeRepositoryInterface
+type MockTradeRepository struct {
+	mock.Mock
+}
+
+func (m *MockTradeRepository) ListTrades(userID string) ([]models.Trade, error) {
+	args := m.Called(userID)
+	return args.Get(0).([]models.Trade), args.Error(1)
+}
+
+func (m *MockTradeRepository) ListTradingUserIDs() ([]string, error) {
+	args := m.Called()
+	return args.Get(0).([]string), args.Error(1)
+}
+
+func (m *MockTradeRepository) CreateTrade(userID string, trade models.Trade) error {
+	args := m.Called(userID, trade)
+	return args.Error(0)
+}
+
+func (m *MockTradeRepository) CreateTrades(userID string, trades []models.Trade) error {
+	args := m.Called(userID, trades)
+	return args.Error(0)
+}
+
+func (m *MockTradeRepository) ListShortableAccountIDs(userID string) ([]string, error) {
+	args := m.Called(userID)
+	return args.Get(0).([]string), args.Error(1)
+}
+
+func (m *MockTradeRepository) ListReceivedUnits(userID string) ([]models.IncomeEvent, error) {
+	args := m.Called(userID)
+	return args.Get(0).([]models.IncomeEvent), args.Error(1)
+}
+
+func (m *MockTradeRepository) GetCostBasisMethods(userID string) (string, map[string]string, error) {
+	args := m.Called(userID)
+	return args.String(0), args.Get(1).(map[string]string), args.Error(2)
+}
+
+func (m *MockTradeRepository) GetAccountCurrency(userID, accountID string) (string, error) {
+	args := m.Called(userID, accountID)
+	return args.String(0), args.Error(1)
+}
+
+func (m *MockTradeRepository) MergeTrades(userID, keepTradeID string, tradeIDs []string, externalID *string, sells []models.Trade) error {
+	args := m.Called(userID, keepTradeID, tradeIDs, externalID, sells)
+	return args.Error(0)
+}
+
+func (m *MockTradeRepository) ListDuplicateDismissals(userID string) ([]models.TradeDuplicateDismissal, error) {
+	args := m.Called(userID)
+	return args.Get(0).([]models.TradeDuplicateDismissal), args.Error(1)
+}
+
+func (m *MockTradeRepository) DismissDuplicates(dismissals []models.TradeDuplicateDismissal) error {
+	args := m.Called(dismissals)
+	return args.Error(0)
+}
+
+func (m *MockTradeRepository) DeleteTrade(userID, tradeID string) (bool, error) {
+	args := m.Called(userID, tradeID)
+	return args.Bool(0), args.Error(1)
+}
+
+// WithUserLock runs fn at once; tests do not change trades concurrently
+func (m *MockTradeRepository) WithUserLock(userID string, fn func() error) error {
+	return fn()
+}
+
+// Add stub methods to satisfy TradeRepositoryInterface
+func (m *MockTradeRepository) GetTrade(userID, tradeID string) (*models.Trade, error) {
+	panic("not implemented")
+}
+func (m *MockTradeRepository) UpdateTrade(userID string, trade models.Trade) (*models.Trade, error) {
+	panic("not implemented")
+}
+func (m *MockTradeRepository) IsAccountOwnedByUser(accountID, userID string) (bool, error) {
+	panic("not implemented")
+}
+func (m *MockTradeRepository) IsTradeOwnedByUser(tradeID, userID string) (bool, error) {
+	panic("not implemented")
+}
+
+// MockInstrumentService is a mock implementation of InstrumentServiceInterface
+type MockInstrumentService struct {
+	mock.Mock
+}
+
+func (m *MockInstrumentService) GetInstrument(instrumentID string) (*models.Instrument, error) {
+	args := m.Called(instrumentID)
+	instrument, _ := args.Get(0).(*models.Instrument)
+	return instrument, args.Error(1)
+}
+
+func (m *MockInstrumentService) FindInstrument(symbol, currency string) (*models.Instrument, error) {
+	args := m.Called(symbol, currency)
+	instrument, _ := args.Get(0).(*models.Instrument)
+	return instrument, args.Error(1)
+}
+
+func (m *MockInstrumentService) SearchInstruments(query string) ([]models.Instrument, error) {
+	args := m.Called(query)
+	return args.Get(0).([]models.Instrument), args.Error(1)
+}
+
+// Add stub methods to satisfy InstrumentServiceInterface
+func (m *MockInstrumentService) CreateInstrument(req models.InstrumentCreateRequest) (*models.Instrument, error) {
+	panic("not implemented")
+}
+func (m *MockInstrumentService) UpdateInstrument(instrumentID string, req models.InstrumentCreateRequest) (*models.Instrument, error) {
+	panic("not implemented")
+}
+func (m *MockInstrumentService) DeleteInstrument(instrumentID string) (bool, error) {
+	panic("not implemented")
+}
+
+// noInstruments returns an instrument service mock with an empty catalog
+func noInstruments() *MockInstrumentService {
+	mockInstrumentService := new(MockInstrumentService)
+	mockInstrumentService.On("FindInstrument", mock.Anything, mock.Anything).Return(nil, nil)
+	return mockInstrumentService
+}
+
+func TestCreateTradeOversell(t *testing.T) {
+	day := func(d int) time.Time {
+		return time.Date(2024, 1, d, 0, 0, 0, 0, time.UTC)
+	}
+	existing := []models.Trade{
+		{ID: "b1", Type: "buy", AssetType: "stock", Ticker: "AAPL", TradeDate: day(2), Quantity: 10, Price: 100, Currency: "USD", AccountID: "acc-1"},
+		{ID: "s1", Type: "sell", AssetType: "stock", Ticker: "AAPL", TradeDate: day(5), Quantity: 8, Price: 120, Currency: "USD", AccountID: "acc-1"},
+	}
+	// Two lots of which a sell took one, the first under FIFO and the second under LIFO
+	twoLots := []models.Trade{
+		{ID: "b1", Type: "buy", AssetType: "stock", Ticker: "AAPL", TradeDate: day(1), Quantity: 10, Price: 100, Currency: "USD", AccountID: "acc-1"},
+		{ID: "b2", Type: "buy", AssetType: "stock", Ticker: "AAPL", TradeDate: day(2), Quantity: 10, Price: 110, Currency: "USD", AccountID: "acc-1"},
+		{ID: "s1", Type: "sell", AssetType: "stock", Ticker: "AAPL", TradeDate: day(3), Quantity: 10, Price: 120, Currency: "USD", AccountID: "acc-1"},
+	}
+	// Shares merged into a new ticker and sold under it
+	merged := []models.Trade{
+		{ID: "b1", Type: "buy", AssetType: "stock", Ticker: "XYZ", TradeDate: day(1), Quantity: 10, Price: 100, Currency: "USD", AccountID: "acc-1"},
+		{ID: "s1", Type: "sell", AssetType: "stock", Ticker: "ABC", TradeDate: day(5), Quantity: 10, Price: 120, Currency: "USD", AccountID: "acc-1"},
+	}
+	merger := models.CorporateAction{ID: "ca1", Ticker: "XYZ", Type: models.CorporateActionSymbolChange, EffectiveDate: day(4), NewTicker: stringPtr("ABC"), NewShares: 1, OldShares: 1}
+	// The same option held long in one account and written in another
+	optionLegs := []models.Trade{
+		{ID: "o1", Type: "buy", AssetType: "option", Ticker: "AAPL240621C00200000", TradeDate: day(1), Quantity: 2, Price: 3, Currency: "USD", AccountID: "acc-1", PositionEffect: stringPtr(models.PositionEffectOpen)},
+		{ID: "o2", Type: "sell", AssetType: "option", Ticker: "AAPL240621C00200000", TradeDate: day(2), Quantity: 1, Price: 3, Currency: "USD", AccountID: "acc-2", PositionEffect: stringPtr(models.PositionEffectOpen)},
+	}
+	tests := []struct {
+		name            string
+		history         []models.Trade
+		costBasisMethod string
+		shortable       []string
+		actions         []models.CorporateAction
+		received        []models.IncomeEvent
+		trade           models.Trade
+		expectedError   error
+	}{
+		{
+			name:     "sell of shares received as a stock dividend should be accepted",
+			received: []models.IncomeEvent{{ID: "e1", AccountID: "acc-1", Ticker: "AAPL", Type: models.IncomeStockDividend, PayDate: day(6), Quantity: floatPtr(2), Currency: "USD"}},
+			trade:    models.Trade{ID: "s2", Type: "sell", AssetType: "stock", Ticker: "AAPL", TradeDate: day(7), Quantity: 4, Price: 130, Currency: "USD", AccountID: "acc-1"},
+		},
+		{
+			name:          "sell beyond the shares bought and received should be rejected",
+			received:      []models.IncomeEvent{{ID: "e1", AccountID: "acc-1", Ticker: "AAPL", Type: models.IncomeStockDividend, PayDate: day(6), Quantity: floatPtr(2), Currency: "USD"}},
+			trade:         models.Trade{ID: "s2", Type: "sell", AssetType: "stock", Ticker: "AAPL", TradeDate: day(7), Quantity: 5, Price: 130, Currency: "USD", AccountID: "acc-1"},
+			expectedError: ErrPositionOversold,
+		},
+		{
+			name:  "sell within the open quantity should be accepted",
+			trade: models.Trade{ID: "s2", Type: "sell", AssetType: "stock", Ticker: "AAPL", TradeDate: day(6), Quantity: 2, Price: 130, Currency: "USD", AccountID: "acc-1"},
+		},
+		{
+			name:          "sell beyond the open quantity should be rejected",
+			trade:         models.Trade{ID: "s2", Type: "sell", AssetType: "stock", Ticker: "AAPL", TradeDate: day(6), Quantity: 3, Price: 130, Currency: "USD", AccountID: "acc-1"},
+			expectedError: ErrPositionOversold,
+		},
+		{
+			name:          "backdated sell that leaves a later sell short should be rejected",
+			trade:         models.Trade{ID: "s2", Type: "sell", AssetType: "stock", Ticker: "AAPL", TradeDate: day(3), Quantity: 5, Price: 130, Currency: "USD", AccountID: "acc-1"},
+			expectedError: ErrPositionOversold,
+		},
+		{
+			name:          "sell before the first buy should be rejected",
+			trade:         models.Trade{ID: "s2", Type: "sell", AssetType: "stock", Ticker: "AAPL", TradeDate: day(1), Quantity: 1, Price: 130, Currency: "USD", AccountID: "acc-1"},
+			expectedError: ErrPositionOversold,
+		},
+		{
+			name:    "sell of post-split shares should be accepted",
+			actions: []models.CorporateAction{{ID: "ca1", Ticker: "AAPL", Type: models.CorporateActionSplit, EffectiveDate: day(6), NewShares: 2, OldShares: 1}},
+			trade:   models.Trade{ID: "s2", Type: "sell", AssetType: "stock", Ticker: "AAPL", TradeDate: day(7), Quantity: 4, Price: 65, Currency: "USD", AccountID: "acc-1"},
+		},
+		{
+			name:          "backdated sell that leaves a sell under the new ticker short should be rejected",
+			history:       merged,
+			actions:       []models.CorporateAction{merger},
+			trade:         models.Trade{ID: "s2", Type: "sell", AssetType: "stock", Ticker: "XYZ", TradeDate: day(2), Quantity: 5, Price: 110, Currency: "USD", AccountID: "acc-1"},
+			expectedError: ErrPositionOversold,
+		},
+		{
+			name:          "sell in an account without the position should be rejected although another account holds it",
+			trade:         models.Trade{ID: "s2", Type: "sell", AssetType: "stock", Ticker: "AAPL", TradeDate: day(6), Quantity: 1, Price: 130, Currency: "USD", AccountID: "acc-2"},
+			expectedError: ErrPositionOversold,
+		},
+		{
+			name:            "allocation to a lot the profile's method left open should be accepted",
+			history:         twoLots,
+			costBasisMethod: models.CostBasisLIFO,
+			trade:           models.Trade{ID: "s2", Type: "sell", AssetType: "stock", Ticker: "AAPL", TradeDate: day(4), Quantity: 5, Price: 130, Currency: "USD", AccountID: "acc-1", LotAllocations: []models.TradeLotAllocation{{BuyTradeID: "b1", Quantity: 5}}},
+		},
+		{
+			name:          "allocations naming the same buy twice should be rejected",
+			history:       twoLots,
+			trade:         models.Trade{ID: "s2", Type: "sell", AssetType: "stock", Ticker: "AAPL", TradeDate: day(4), Quantity: 4, Price: 130, Currency: "USD", AccountID: "acc-1", LotAllocations: []models.TradeLotAllocation{{BuyTradeID: "b2", Quantity: 2}, {BuyTradeID: "b2", Quantity: 2}}},
+			expectedError: ErrInvalidLotAllocation,
+		},
+		{
+			name:          "allocation to a lot the profile's method already sold should be rejected",
+			history:       twoLots,
+			trade:         models.Trade{ID: "s2", Type: "sell", AssetType: "stock", Ticker: "AAPL", TradeDate: day(4), Quantity: 5, Price: 130, Currency: "USD", AccountID: "acc-1", LotAllocations: []models.TradeLotAllocation{{BuyTradeID: "b1", Quantity: 5}}},
+			expectedError: ErrInvalidLotAllocation,
+		},
+		{
+			name:      "account allowing short positions should accept the oversell",
+			shortable: []string{"acc-1"},
+			trade:     models.Trade{ID: "s2", Type: "sell", AssetType: "stock", Ticker: "AAPL", TradeDate: day(6), Quantity: 3, Price: 130, Currency: "USD", AccountID: "acc-1"},
+		},
+		{
+			name:  "sell to open an option should be accepted in any account",
+			trade: models.Trade{ID: "o1", Type: "sell", AssetType: "option", Ticker: "AAPL240621C00200000", TradeDate: day(6), Quantity: 1, Price: 3, Currency: "USD", AccountID: "acc-1", PositionEffect: stringPtr(models.PositionEffectOpen)},
+		},
+		{
+			name:          "buy to close an option without a short position should be rejected",
+			trade:         models.Trade{ID: "o1", Type: "buy", AssetType: "option", Ticker: "AAPL240621C00200000", TradeDate: day(6), Quantity: 1, Price: 3, Currency: "USD", AccountID: "acc-1", PositionEffect: stringPtr(models.PositionEffectClose)},
+			expectedError: ErrInvalidPositionEffect,
+		},
+		{
+			name:    "sell to close an option should only count the position of its own account",
+			history: optionLegs,
+			trade:   models.Trade{ID: "o3", Type: "sell", AssetType: "option", Ticker: "AAPL240621C00200000", TradeDate: day(6), Quantity: 2, Price: 0, Currency: "USD", AccountID: "acc-1", PositionEffect: stringPtr(models.PositionEffectClose)},
+		},
+		{
+			name:          "buy to close an option long in its own account should be rejected although another account is short",
+			history:       optionLegs,
+			trade:         models.Trade{ID: "o3", Type: "buy", AssetType: "option", Ticker: "AAPL240621C00200000", TradeDate: day(6), Quantity: 1, Price: 0, Currency: "USD", AccountID: "acc-1", PositionEffect: stringPtr(models.PositionEffectClose)},
+			expectedError: ErrInvalidPositionEffect,
+		},
+		{
+			name:          "position effect on a stock trade should be rejected",
+			trade:         models.Trade{ID: "s2", Type: "sell", AssetType: "stock", Ticker: "AAPL", TradeDate: day(6), Quantity: 1, Price: 130, Currency: "USD", AccountID: "acc-1", PositionEffect: stringPtr(models.PositionEffectClose)},
+			expectedError: ErrInvalidPositionEffect,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			shortable := tt.shortable
+			if shortable == nil {
+				shortable = []string{}
+			}
+			history := tt.history
+			if history == nil {
+				history = existing
+			}
+			received := tt.received
+			if received == nil {
+				received = []models.IncomeEvent{}
+			}
+			mockRepo := new(MockTradeRepository)
+			mockRepo.On("ListTrades", "test-user").Return(history, nil)
+			mockRepo.On("ListShortableAccountIDs", "test-user").Return(shortable, nil)
+			mockRepo.On("ListReceivedUnits", "test-user").Return(received, nil)
+			mockRepo.On("GetCostBasisMethods", "test-user").Return(tt.costBasisMethod, map[string]string{}, nil)
+			mockRepo.On("GetAccountCurrency", "test-user", mock.Anything).Return("USD", nil)
+			mockRepo.On("CreateTrade", "test-user", mock.Anything).Return(nil)
+
+			service := NewTradeService(mockRepo, new(MockFxService), withCorporateActions(tt.actions...), noInstruments())
+
+			_, err := service.CreateTrade("test-user", tt.trade)
+
+			if tt.expectedError != nil {
+				assert.True(t, errors.Is(err, tt.expectedError), "expected %v, got %v", tt.expectedError, err)
+				mockRepo.AssertNotCalled(t, "CreateTrade", "test-user", mock.Anything)
+			} else {
+				assert.NoError(t, err)
+				mockRepo.AssertCalled(t, "CreateTrade", "test-user", mock.Anything)
+			}
+		})
+	}
+}
+
+func TestCreateTradeSettlement(t *testing.T) {
+	tradeDate := time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name             string
+		trade            models.Trade
+		expectedAmount   float64
+		expectedOriginal *float64
+		expectedError    error
+	}{
+		{
+			name:           "buy in the account currency should debit the account",
+			trade:          models.Trade{ID: "b1", Type: "buy", AssetType: "stock", Ticker: "2330", TradeDate: tradeDate, Quantity: 10, Price: 600, Currency: "TWD", AccountID: "acc-1"},
+			expectedAmount: -6000,
+		},
+		{
+			name:             "buy in another currency should be converted into the account currency",
+			trade:            models.Trade{ID: "b1", Type: "buy", AssetType: "stock", Ticker: "AAPL", TradeDate: tradeDate, Quantity: 10, Price: 100, Currency: "USD", AccountID: "acc-1"},
+			expectedAmount:   -32000,
+			expectedOriginal: func() *float64 { v := -1000.0; return &v }(),
+		},
+		{
+			name:           "buy should debit the cost plus fee and tax",
+			trade:          models.Trade{ID: "b1", Type: "buy", AssetType: "stock", Ticker: "2330", TradeDate: tradeDate, Quantity: 10, Price: 600, Currency: "TWD", AccountID: "acc-1", Fee: 20, Tax: 18},
+			expectedAmount: -6038,
+		},
+		{
+			name:             "fee charged in the account currency should be added to a foreign buy",
+			trade:            models.Trade{ID: "b1", Type: "buy", AssetType: "stock", Ticker: "AAPL", TradeDate: tradeDate, Quantity: 10, Price: 100, Currency: "USD", AccountID: "acc-1", Fee: 320, FeeCurrency: stringPtr("TWD")},
+			expectedAmount:   -32320,
+			expectedOriginal: func() *float64 { v := -1010.0; return &v }(),
+		},
+		{
+			name:             "option without a multiplier should settle at the standard contract size",
+			trade:            models.Trade{ID: "b1", Type: "buy", AssetType: "option", Ticker: "AAPL240621C00200000", TradeDate: tradeDate, Quantity: 2, Price: 3.5, Currency: "USD", AccountID: "acc-1"},
+			expectedAmount:   -22400,
+			expectedOriginal: func() *float64 { v := -700.0; return &v }(),
+		},
+		{
+			name:             "settlement rate should convert a currency without a stored rate",
+			trade:            models.Trade{ID: "b1", Type: "buy", AssetType: "stock", Ticker: "SAP", TradeDate: tradeDate, Quantity: 10, Price: 100, Currency: "EUR", AccountID: "acc-1", SettlementRate: floatPtr(35)},
+			expectedAmount:   -35000,
+			expectedOriginal: func() *float64 { v := -1000.0; return &v }(),
+		},
+		{
+			name:             "settlement rate should take precedence over the stored rate",
+			trade:            models.Trade{ID: "b1", Type: "buy", AssetType: "stock", Ticker: "AAPL", TradeDate: tradeDate, Quantity: 10, Price: 100, Currency: "USD", AccountID: "acc-1", SettlementRate: floatPtr(31.5)},
+			expectedAmount:   -31500,
+			expectedOriginal: func() *float64 { v := -1000.0; return &v }(),
+		},
+		{
+			name:          "currency without a stored or settlement rate should be rejected",
+			trade:         models.Trade{ID: "b1", Type: "buy", AssetType: "stock", Ticker: "SAP", TradeDate: tradeDate, Quantity: 10, Price: 100, Currency: "EUR", AccountID: "acc-1"},
+			expectedError: ErrFxRateNotFound,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockRepo := new(MockTradeRepository)
+			mockFxService := new(MockFxService)
+			mockRepo.On("ListTrades", "test-user").Return([]models.Trade{}, nil)
+			mockRepo.On("ListShortableAccountIDs", "test-user").Return([]string{}, nil)
+			mockRepo.On("ListReceivedUnits", "test-user").Return([]models.IncomeEvent{}, nil)
+			mockRepo.On("GetCostBasisMethods", "test-user").Return("", map[string]string{}, nil)
+			mockRepo.On("GetAccountCurrency", "test-user", "acc-1").Return("TWD", nil)
+			mockRepo.On("CreateTrade", "test-user", mock.Anything).Return(nil)
+			mockFxService.On("Converter").Return(NewFxConverter([]models.FxRate{{BaseCurrency: "USD", QuoteCurrency: "TWD", Rate: 32}}, "USD"), nil)
+
+			service := NewTradeService(mockRepo, mockFxService, withCorporateActions(), noInstruments())
+
+			_, err := service.CreateTrade("test-user", tt.trade)
+
+			if tt.expectedError != nil {
+				assert.True(t, errors.Is(err, tt.expectedError), "expected %v, got %v", tt.expectedError, err)
+				mockRepo.AssertNotCalled(t, "CreateTrade", "test-user", mock.Anything)
+				return
+			}
+			assert.NoError(t, err)
+			created := mockRepo.Calls[len(mockRepo.Calls)-1].Arguments.Get(1).(models.Trade)
+			assert.NotNil(t, created.Settlement)
+			assert.Equal(t, models.CashEntryTrade, created.Settlement.Type)
+			assert.Equal(t, "TWD", created.Settlement.Currency)
+			assert.Equal(t, "b1", *created.Settlement.TradeID)
+			assert.InDelta(t, tt.expectedAmount, created.Settlement.Amount, 1e-9)
+			assert.Equal(t, tt.expectedOriginal, created.Settlement.OriginalAmount)
+		})
+	}
+}
+
+func TestCreateTradeResolvesInstrument(t *testing.T) {
+	tradeDate := time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC)
+	apple := &models.Instrument{ID: "inst-1", Symbol: "AAPL", Name: "Apple Inc.", AssetClass: "stock", Currency: "USD", LotSize: 1, PricePrecision: 2}
+	tests := []struct {
+		name               string
+		trade              models.Trade
+		expectedTicker     string
+		expectedInstrument *string
+		expectedError      error
+	}{
+		{
+			name:               "lower case ticker should be normalized and linked to the listed instrument",
+			trade:              models.Trade{ID: "b1", Type: "buy", AssetType: "stock", Ticker: " aapl", TradeDate: tradeDate, Quantity: 1, Price: 100, Currency: "usd", AccountID: "acc-1"},
+			expectedTicker:     "AAPL",
+			expectedInstrument: stringPtr("inst-1"),
+		},
+		{
+			name:           "ticker missing from the catalog should be stored without an instrument",
+			trade:          models.Trade{ID: "b1", Type: "buy", AssetType: "stock", Ticker: "msft", TradeDate: tradeDate, Quantity: 1, Price: 100, Currency: "USD", AccountID: "acc-1"},
+			expectedTicker: "MSFT",
+		},
+		{
+			name:               "instrument should supply the ticker, asset type and currency",
+			trade:              models.Trade{ID: "b1", Type: "buy", InstrumentID: stringPtr("inst-1"), TradeDate: tradeDate, Quantity: 1, Price: 100, AccountID: "acc-1"},
+			expectedTicker:     "AAPL",
+			expectedInstrument: stringPtr("inst-1"),
+		},
+		{
+			name:          "ticker that contradicts the instrument should be rejected",
+			trade:         models.Trade{ID: "b1", Type: "buy", InstrumentID: stringPtr("inst-1"), Ticker: "MSFT", TradeDate: tradeDate, Quantity: 1, Price: 100, AccountID: "acc-1"},
+			expectedError: ErrInvalidInstrument,
+		},
+		{
+			name:          "unknown instrument should be rejected",
+			trade:         models.Trade{ID: "b1", Type: "buy", InstrumentID: stringPtr("missing"), TradeDate: tradeDate, Quantity: 1, Price: 100, AccountID: "acc-1"},
+			expectedError: ErrInvalidInstrument,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockRepo := new(MockTradeRepository)
+			mockRepo.On("ListTrades", "test-user").Return([]models.Trade{}, nil)
+			mockRepo.On("ListShortableAccountIDs", "test-user").Return([]string{}, nil)
+			mockRepo.On("ListReceivedUnits", "test-user").Return([]models.IncomeEvent{}, nil)
+			mockRepo.On("GetCostBasisMethods", "test-user").Return("", map[string]string{}, nil)
+			mockRepo.On("GetAccountCurrency", "test-user", "acc-1").Return("USD", nil)
+			mockRepo.On("CreateTrade", "test-user", mock.Anything).Return(nil)
+			mockInstrumentService := new(MockInstrumentService)
+			mockInstrumentService.On("FindInstrument", "AAPL", "USD").Return(apple, nil)
+			mockInstrumentService.On("FindInstrument", mock.Anything, mock.Anything).Return(nil, nil)
+			mockInstrumentService.On("GetInstrument", "inst-1").Return(apple, nil)
+			mockInstrumentService.On("GetInstrument", "missing").Return(nil, ErrInstrumentNotFound)
+
+			service := NewTradeService(mockRepo, new(MockFxService), withCorporateActions(), mockInstrumentService)
+
+			created, err := service.CreateTrade("test-user", tt.trade)
+
+			if tt.expectedError != nil {
+				assert.True(t, errors.Is(err, tt.expectedError), "expected %v, got %v", tt.expectedError, err)
+				mockRepo.AssertNotCalled(t, "CreateTrade", "test-user", mock.Anything)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tt.expectedTicker, created.Ticker)
+			assert.Equal(t, "USD", created.Currency)
+			assert.Equal(t, "stock", created.AssetType)
+			assert.Equal(t, tt.expectedInstrument, created.InstrumentID)
+			mockRepo.AssertCalled(t, "CreateTrade", "test-user", *created)
+		})
+	}
+}
+
+func TestCreateTradeWarnsOfDuplicates(t *testing.T) {
+	tradeDate := time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC)
+	existing := []models.Trade{
+		{ID: "b1", Type: "buy", AssetType: "stock", Ticker: "AAPL", TradeDate: tradeDate, Quantity: 10, Price: 100, Currency: "USD", AccountID: "acc-1"},
+	}
+	tests := []struct {
+		name             string
+		trade            models.Trade
+		expectedWarnings int
+	}{
+		{
+			name:             "same trade at a price within the tolerance should be flagged",
+			trade:            models.Trade{ID: "b2", Type: "buy", AssetType: "stock", Ticker: "aapl", TradeDate: tradeDate, Quantity: 10, Price: 100.5, Currency: "USD", AccountID: "acc-1"},
+			expectedWarnings: 1,
+		},
+		{
+			name:  "same trade at a price beyond the tolerance should not be flagged",
+			trade: models.Trade{ID: "b2", Type: "buy", AssetType: "stock", Ticker: "AAPL", TradeDate: tradeDate, Quantity: 10, Price: 105, Currency: "USD", AccountID: "acc-1"},
+		},
+		{
+			name:  "different quantity should not be flagged",
+			trade: models.Trade{ID: "b2", Type: "buy", AssetType: "stock", Ticker: "AAPL", TradeDate: tradeDate, Quantity: 5, Price: 100, Currency: "USD", AccountID: "acc-1"},
+		},
+		{
+			name:  "trade in another account should not be flagged",
+			trade: models.Trade{ID: "b2", Type: "buy", AssetType: "stock", Ticker: "AAPL", TradeDate: tradeDate, Quantity: 10, Price: 100, Currency: "USD", AccountID: "acc-2"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockRepo := new(MockTradeRepository)
+			mockRepo.On("ListTrades", "test-user").Return(existing, nil)
+			mockRepo.On("ListShortableAccountIDs", "test-user").Return([]string{}, nil)
+			mockRepo.On("ListReceivedUnits", "test-user").Return([]models.IncomeEvent{}, nil)
+			mockRepo.On("GetCostBasisMethods", "test-user").Return("", map[string]string{}, nil)
+			mockRepo.On("GetAccountCurrency", "test-user", mock.Anything).Return("USD", nil)
+			mockRepo.On("CreateTrade", "test-user", mock.Anything).Return(nil)
+
+			service := NewTradeService(mockRepo, new(MockFxService), withCorporateActions(), noInstruments())
+
+			created, err := service.CreateTrade("test-user", tt.trade)
+
+			assert.NoError(t, err)
+			assert.Len(t, created.Warnings, tt.expectedWarnings)
+			mockRepo.AssertCalled(t, "CreateTrade", "test-user", mock.Anything)
+		})
+	}
+}
+
+func TestFindDuplicates(t *testing.T) {
+	day := time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC)
+	trades := []models.Trade{
+		{ID: "b1", Type: "buy", Ticker: "AAPL", TradeDate: day, Quantity: 10, Price: 100, AccountID: "acc-1"},
+		{ID: "b2", Type: "buy", Ticker: "MSFT", TradeDate: day, Quantity: 10, Price: 300, AccountID: "acc-1"},
+		{ID: "b3", Type: "buy", Ticker: "AAPL", TradeDate: day, Quantity: 10, Price: 100.4, AccountID: "acc-1"},
+		{ID: "b4", Type: "buy", Ticker: "MSFT", TradeDate: day, Quantity: 10, Price: 300, AccountID: "acc-1"},
+		{ID: "b5", Type: "buy", Ticker: "AAPL", TradeDate: day, Quantity: 10, Price: 103, AccountID: "acc-1"},
+		{ID: "s1", Type: "sell", Ticker: "AAPL", TradeDate: day, Quantity: 10, Price: 100, AccountID: "acc-1"},
+	}
+	groupIDs := func(groups []models.TradeDuplicateGroup) [][]string {
+		ids := [][]string{}
+		for _, group := range groups {
+			members := []string{}
+			for _, trade := range group.Trades {
+				members = append(members, trade.ID)
+			}
+			ids = append(ids, members)
+		}
+		return ids
+	}
+
+	mockRepo := new(MockTradeRepository)
+	mockRepo.On("ListTrades", "test-user").Return(trades, nil)
+	mockRepo.On("ListDuplicateDismissals", "test-user").Return([]models.TradeDuplicateDismissal{}, nil).Once()
+	mockRepo.On("ListDuplicateDismissals", "test-user").Return([]models.TradeDuplicateDismissal{{UserID: "test-user", TradeID: "b2", OtherTradeID: "b4"}}, nil)
+	service := NewTradeService(mockRepo, new(MockFxService), withCorporateActions(), noInstruments())
+
+	groups, err := service.FindDuplicates("test-user", models.DefaultDuplicatePriceTolerance)
+	assert.NoError(t, err)
+	assert.Equal(t, [][]string{{"b1", "b3"}, {"b2", "b4"}}, groupIDs(groups))
+
+	groups, err = service.FindDuplicates("test-user", 0.05)
+	assert.NoError(t, err)
+	assert.Equal(t, [][]string{{"b1", "b3", "b5"}}, groupIDs(groups))
+}
+
+func TestMergeDuplicates(t *testing.T) {
+	day := time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC)
+	importedID, otherImportedID := "T-1001", "T-2001"
+	trades := []models.Trade{
+		{ID: "b1", Type: "buy", AssetType: "stock", Ticker: "AAPL", TradeDate: day, Quantity: 10, Price: 100, Currency: "USD", AccountID: "acc-1"},
+		{ID: "b2", Type: "buy", AssetType: "stock", Ticker: "AAPL", TradeDate: day, Quantity: 10, Price: 100, Currency: "USD", AccountID: "acc-1", ExternalID: &importedID},
+		{ID: "b3", Type: "buy", AssetType: "stock", Ticker: "AAPL", TradeDate: day, Quantity: 5, Price: 100, Currency: "USD", AccountID: "acc-1"},
+		{ID: "b4", Type: "buy", AssetType: "stock", Ticker: "AAPL", TradeDate: day, Quantity: 10, Price: 100, Currency: "USD", AccountID: "acc-1", ExternalID: &otherImportedID},
+		{ID: "s1", Type: "sell", AssetType: "stock", Ticker: "AAPL", TradeDate: day.AddDate(0, 0, 1), Quantity: 10, Price: 110, Currency: "USD", AccountID: "acc-1"},
+	}
+	// withSell returns the trades with s1 drawing on the given lots
+	withSell := func(allocations map[string]float64) []models.Trade {
+		sell := trades[4]
+		for _, buyID := range []string{"b1", "b2"} {
+			if quantity, ok := allocations[buyID]; ok {
+				sell.LotAllocations = append(sell.LotAllocations, models.TradeLotAllocation{ID: "a-" + buyID, SellTradeID: "s1", BuyTradeID: buyID, Quantity: quantity})
+			}
+		}
+		return []models.Trade{trades[0], trades[1], sell}
+	}
+	tests := []struct {
+		name                string
+		trades              []models.Trade
+		req                 models.TradeMergeRequest
+		expectedIDs         []string
+		expectedExternalID  *string
+		expectedAllocations map[string]float64
+		expectedError       error
+	}{
+		{
+			name:               "kept trade should take the external ID of an imported duplicate",
+			req:                models.TradeMergeRequest{KeepTradeID: "b1", TradeIDs: []string{"b2", "b2"}},
+			expectedIDs:        []string{"b2"},
+			expectedExternalID: &importedID,
+		},
+		{
+			name:                "sell drawing on a duplicate should draw on the kept trade",
+			trades:              withSell(map[string]float64{"b2": 10}),
+			req:                 models.TradeMergeRequest{KeepTradeID: "b1", TradeIDs: []string{"b2"}},
+			expectedIDs:         []string{"b2"},
+			expectedExternalID:  &importedID,
+			expectedAllocations: map[string]float64{"b1": 10},
+		},
+		{
+			name:                "sell drawing on both trades should fold into one allocation",
+			trades:              withSell(map[string]float64{"b1": 4, "b2": 5}),
+			req:                 models.TradeMergeRequest{KeepTradeID: "b1", TradeIDs: []string{"b2"}},
+			expectedIDs:         []string{"b2"},
+			expectedExternalID:  &importedID,
+			expectedAllocations: map[string]float64{"b1": 9},
+		},
+		{
+			name:          "sell drawing on both trades beyond the kept lot should be rejected",
+			trades:        withSell(map[string]float64{"b1": 6, "b2": 6}),
+			req:           models.TradeMergeRequest{KeepTradeID: "b1", TradeIDs: []string{"b2"}},
+			expectedError: ErrInvalidLotAllocation,
+		},
+		{
+			name:          "two imported trades should not be merged",
+			req:           models.TradeMergeRequest{KeepTradeID: "b1", TradeIDs: []string{"b2", "b4"}},
+			expectedError: ErrInvalidDuplicates,
+		},
+		{
+			name:          "trade with another quantity should not be merged",
+			req:           models.TradeMergeRequest{KeepTradeID: "b1", TradeIDs: []string{"b3"}},
+			expectedError: ErrInvalidDuplicates,
+		},
+		{
+			name:          "trade should not be merged into itself",
+			req:           models.TradeMergeRequest{KeepTradeID: "b1", TradeIDs: []string{"b1"}},
+			expectedError: ErrInvalidDuplicates,
+		},
+		{
+			name:          "unknown trade should be rejected",
+			req:           models.TradeMergeRequest{KeepTradeID: "b1", TradeIDs: []string{"missing"}},
+			expectedError: ErrTradeNotFound,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			history := tt.trades
+			if history == nil {
+				history = trades
+			}
+			mockRepo := new(MockTradeRepository)
+			mockRepo.On("ListTrades", "test-user").Return(history, nil)
+			mockRepo.On("ListShortableAccountIDs", "test-user").Return([]string{}, nil)
+			mockRepo.On("ListReceivedUnits", "test-user").Return([]models.IncomeEvent{}, nil)
+			mockRepo.On("GetCostBasisMethods", "test-user").Return("", map[string]string{}, nil)
+			mockRepo.On("MergeTrades", "test-user", "b1", mock.Anything, mock.Anything, mock.Anything).Return(nil)
+
+			service := NewTradeService(mockRepo, new(MockFxService), withCorporateActions(), noInstruments())
+
+			merged, err := service.MergeDuplicates("test-user", tt.req)
+
+			if tt.expectedError != nil {
+				assert.True(t, errors.Is(err, tt.expectedError), "expected %v, got %v", tt.expectedError, err)
+				mockRepo.AssertNotCalled(t, "MergeTrades", "test-user", "b1", mock.Anything, mock.Anything, mock.Anything)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, "b1", merged.ID)
+			assert.Equal(t, tt.expectedExternalID, merged.ExternalID)
+			mockRepo.AssertCalled(t, "MergeTrades", "test-user", "b1", tt.expectedIDs, tt.expectedExternalID, mock.Anything)
+			sells := mockRepo.Calls[len(mockRepo.Calls)-1].Arguments.Get(4).([]models.Trade)
+			if tt.expectedAllocations == nil {
+				assert.Empty(t, sells)
+				return
+			}
+			assert.Len(t, sells, 1)
+			allocations := map[string]float64{}
+			for _, allocation := range sells[0].LotAllocations {
+				allocations[allocation.BuyTradeID] += allocation.Quantity
+			}
+			assert.Equal(t, tt.expectedAllocations, allocations)
+		})
+	}
+}
+
+func TestDismissDuplicates(t *testing.T) {
+	day := time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC)
+	mockRepo := new(MockTradeRepository)
+	mockRepo.On("ListTrades", "test-user").Return([]models.Trade{
+		{ID: "b1", Type: "buy", Ticker: "AAPL", TradeDate: day, Quantity: 10, Price: 100, AccountID: "acc-1"},
+		{ID: "b2", Type: "buy", Ticker: "AAPL", TradeDate: day, Quantity: 10, Price: 100, AccountID: "acc-1"},
+		{ID: "a3", Type: "buy", Ticker: "AAPL", TradeDate: day, Quantity: 10, Price: 100, AccountID: "acc-1"},
+	}, nil)
+	mockRepo.On("DismissDuplicates", mock.Anything).Return(nil)
+	service := NewTradeService(mockRepo, new(MockFxService), withCorporateActions(), noInstruments())
+
+	err := service.DismissDuplicates("test-user", models.TradeDismissRequest{TradeIDs: []string{"b2", "b1", "a3"}})
+	assert.NoError(t, err)
+	mockRepo.AssertCalled(t, "DismissDuplicates", []models.TradeDuplicateDismissal{
+		{UserID: "test-user", TradeID: "b1", OtherTradeID: "b2"},
+		{UserID: "test-user", TradeID: "a3", OtherTradeID: "b2"},
+		{UserID: "test-user", TradeID: "a3", OtherTradeID: "b1"},
+	})
+
+	err = service.DismissDuplicates("test-user", models.TradeDismissRequest{TradeIDs: []string{"b1", "b1"}})
+	assert.True(t, errors.Is(err, ErrInvalidDuplicates), "expected %v, got %v", ErrInvalidDuplicates, err)
+	err = service.DismissDuplicates("test-user", models.TradeDismissRequest{TradeIDs: []string{"b1", "missing"}})
+	assert.True(t, errors.Is(err, ErrTradeNotFound), "expected %v, got %v", ErrTradeNotFound, err)
+	mockRepo.AssertNumberOfCalls(t, "DismissDuplicates", 1)
+}
+
+func TestDeleteTrade(t *testing.T) {
+	day := func(d int) time.Time {
+		return time.Date(2024, 1, d, 0, 0, 0, 0, time.UTC)
+	}
+	trades := []models.Trade{
+		{ID: "b1", Type: "buy", AssetType: "stock", Ticker: "AAPL", TradeDate: day(1), Quantity: 10, Price: 100, Currency: "USD", AccountID: "acc-1"},
+		{ID: "b2", Type: "buy", AssetType: "stock", Ticker: "AAPL", TradeDate: day(2), Quantity: 10, Price: 110, Currency: "USD", AccountID: "acc-1"},
+		{ID: "s1", Type: "sell", AssetType: "stock", Ticker: "AAPL", TradeDate: day(3), Quantity: 5, Price: 120, Currency: "USD", AccountID: "acc-1", LotAllocations: []models.TradeLotAllocation{{SellTradeID: "s1", BuyTradeID: "b2", Quantity: 5}}},
+	}
+	tests := []struct {
+		name          string
+		tradeID       string
+		expectedError error
+	}{
+		{
+			name:    "buy no sell is allocated to should be deleted",
+			tradeID: "b1",
+		},
+		{
+			name:          "buy a sell is allocated to should be kept",
+			tradeID:       "b2",
+			expectedError: ErrInvalidLotAllocation,
+		},
+		{
+			name:    "sell with allocations should be deleted",
+			tradeID: "s1",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockRepo := new(MockTradeRepository)
+			mockRepo.On("ListTrades", "test-user").Return(trades, nil)
+			mockRepo.On("ListShortableAccountIDs", "test-user").Return([]string{}, nil)
+			mockRepo.On("ListReceivedUnits", "test-user").Return([]models.IncomeEvent{}, nil)
+			mockRepo.On("GetCostBasisMethods", "test-user").Return("", map[string]string{}, nil)
+			mockRepo.On("DeleteTrade", "test-user", tt.tradeID).Return(true, nil)
+
+			service := NewTradeService(mockRepo, new(MockFxService), withCorporateActions(), noInstruments())
+
+			deleted, err := service.DeleteTrade("test-user", tt.tradeID)
+
+			if tt.expectedError != nil {
+				assert.True(t, errors.Is(err, tt.expectedError), "expected %v, got %v", tt.expectedError, err)
+				mockRepo.AssertNotCalled(t, "DeleteTrade", "test-user", tt.tradeID)
+				return
+			}
+			assert.NoError(t, err)
+			assert.True(t, deleted)
+		})
+	}
+}